@@ -0,0 +1,134 @@
+// Package agent runs commands in a guest through cocoon-agent, reached over the VM's hybrid vsock UDS (CH/FC).
+package agent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/cocoonstack/cocoon-agent/client"
+)
+
+const (
+	// Port is the cocoon-agent listen port.
+	Port = 1024
+
+	// OutputTail caps how much guest output a failed Shell error carries.
+	OutputTail = 512
+
+	pollInterval = 500 * time.Millisecond
+	replyMax     = 256
+)
+
+// ErrVsockNotConfigured is returned for VMs predating vsock support (e.g. restored from a legacy snapshot).
+var ErrVsockNotConfigured = errors.New("vsock not configured for this VM")
+
+// Dial dials the UDS + runs CONNECT-port handshake (CH/FC); ctx-aware so Ctrl+C unblocks the "OK " read while the in-guest agent is still coming up.
+func Dial(ctx context.Context, socketPath string, port uint32) (io.ReadWriteCloser, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", socketPath)
+	if err != nil {
+		return nil, err
+	}
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+	if _, werr := fmt.Fprintf(conn, "CONNECT %d\n", port); werr != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("write CONNECT: %w", werr)
+	}
+	reply, err := readReply(conn)
+	if err != nil {
+		_ = conn.Close()
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, fmt.Errorf("read CONNECT reply: %w", err)
+	}
+	if !strings.HasPrefix(reply, "OK ") {
+		_ = conn.Close()
+		return nil, fmt.Errorf("hybrid vsock CONNECT %d: %s", port, strings.TrimSpace(reply))
+	}
+	return conn, nil
+}
+
+// Run dials cocoon-agent over the VM's hybrid vsock and runs argv to completion.
+func Run(ctx context.Context, vsockSocket string, argv []string, env map[string]string, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	if vsockSocket == "" {
+		return 0, ErrVsockNotConfigured
+	}
+	conn, err := Dial(ctx, vsockSocket, Port)
+	if err != nil {
+		return 0, fmt.Errorf("dial agent: %w", err)
+	}
+	defer conn.Close() //nolint:errcheck
+	return client.Run(ctx, conn, argv, env, stdin, stdout, stderr)
+}
+
+// Shell runs script under /bin/sh in the guest and returns its stdout; a non-zero exit is an error carrying the tail of stderr.
+func Shell(ctx context.Context, vsockSocket, script string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	code, err := Run(ctx, vsockSocket, []string{"/bin/sh", "-c", script}, nil, strings.NewReader(""), &stdout, &stderr)
+	if err != nil {
+		return "", err
+	}
+	if code != 0 {
+		msg := strings.TrimSpace(stderr.String())
+		if len(msg) > OutputTail {
+			msg = "..." + msg[len(msg)-OutputTail:]
+		}
+		return stdout.String(), fmt.Errorf("guest script exited %d: %s", code, msg)
+	}
+	return stdout.String(), nil
+}
+
+// Wait polls until cocoon-agent answers a no-op command, so callers can act right after boot or resume.
+func Wait(ctx context.Context, vsockSocket string, timeout time.Duration) error {
+	if vsockSocket == "" {
+		return ErrVsockNotConfigured
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for {
+		code, err := Run(ctx, vsockSocket, []string{"true"}, nil, strings.NewReader(""), io.Discard, io.Discard)
+		if err == nil && code == 0 {
+			return nil
+		}
+		if err == nil {
+			err = fmt.Errorf("probe exited %d", code)
+		}
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return fmt.Errorf("cocoon-agent not ready after %s: %w", timeout, err)
+			}
+			return ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// readReply reads one '\n'-terminated line byte-by-byte; bufio would over-read into the agent's first frame.
+func readReply(r io.Reader) (string, error) {
+	buf := make([]byte, 0, 32)
+	one := make([]byte, 1)
+	for {
+		n, err := r.Read(one)
+		if n > 0 {
+			buf = append(buf, one[0])
+			if one[0] == '\n' {
+				return string(buf), nil
+			}
+			if len(buf) >= replyMax {
+				return "", fmt.Errorf("reply line exceeds %d bytes", replyMax)
+			}
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package core
+
+import (
+	"context"
+
+	"github.com/projecteru2/core/log"
+
+	"github.com/cocoonstack/cocoon/config"
+	"github.com/cocoonstack/cocoon/hypervisor"
+	"github.com/cocoonstack/cocoon/network/discovery"
+	"github.com/cocoonstack/cocoon/types"
+)
+
+// EnsureDiscovery starts the VM-name DNS forwarder when --discovery-dns is set. Failures are logged, not returned:
+// VMs still boot with the forwarder's address listed, and their resolvers fall through to the next server.
+func EnsureDiscovery(ctx context.Context, conf *config.Config) {
+	if err := discovery.Ensure(conf); err != nil {
+		log.WithFunc("core.EnsureDiscovery").Warnf(ctx, "start discovery forwarder: %v", err)
+	}
+}
+
+// RunDiscoveryForwarder is the forwarder process: it serves names from the VM index of every hypervisor backend.
+func RunDiscoveryForwarder(ctx context.Context) {
+	conf := discovery.ForwarderConfig()
+	hypers, err := InitAllHypervisors(ctx, conf)
+	if err != nil {
+		log.WithFunc("core.RunDiscoveryForwarder").Warnf(ctx, "%v", err)
+		return
+	}
+	var paths []string
+	for _, h := range hypers {
+		if w, ok := h.(hypervisor.Watchable); ok {
+			paths = append(paths, w.WatchPath())
+		}
+	}
+	discovery.RunForwarder(ctx, conf, func(ctx context.Context) ([]*types.VM, error) {
+		return ListAllVMs(ctx, hypers)
+	}, paths)
+}
@@ -0,0 +1,30 @@
+package core
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cocoonstack/cocoon/network/firewall"
+	"github.com/cocoonstack/cocoon/types"
+)
+
+// FirewallFromFlags reads --firewall FILE or the inline --allow/--deny-egress rules; set reports whether any was
+// given, so callers can tell "no firewall" from "keep the current one".
+func FirewallFromFlags(cmd *cobra.Command) (fw *types.Firewall, set bool, err error) {
+	path, _ := cmd.Flags().GetString("firewall")
+	allow, _ := cmd.Flags().GetStringArray("allow")
+	denyEgress, _ := cmd.Flags().GetStringArray("deny-egress")
+	inline := len(allow) > 0 || len(denyEgress) > 0
+	switch {
+	case path != "" && inline:
+		return nil, true, fmt.Errorf("--firewall and --allow/--deny-egress are mutually exclusive")
+	case path != "":
+		fw, err = firewall.Load(path)
+		return fw, true, err
+	case inline:
+		fw, err = firewall.FromInline(allow, denyEgress)
+		return fw, true, err
+	}
+	return nil, false, nil
+}
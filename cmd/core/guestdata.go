@@ -0,0 +1,90 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/cocoonstack/cocoon/metadata"
+	"github.com/cocoonstack/cocoon/types"
+)
+
+// applyGuestDataFlags loads --ssh-key, --user-data and --vendor-data into cfg. Keys are appended to any already on
+// cfg (a clone's inherited ones), skipping duplicates.
+func applyGuestDataFlags(cmd *cobra.Command, cfg *types.VMConfig) error {
+	keyFiles, _ := cmd.Flags().GetStringArray("ssh-key")
+	keys, err := LoadSSHKeys(keyFiles)
+	if err != nil {
+		return err
+	}
+	cfg.SSHKeys = slices.Clone(cfg.SSHKeys)
+	for _, k := range keys {
+		if !slices.Contains(cfg.SSHKeys, k) {
+			cfg.SSHKeys = append(cfg.SSHKeys, k)
+		}
+	}
+	if cfg.UserData, err = loadCloudInitFile(cmd, "user-data"); err != nil {
+		return err
+	}
+	cfg.VendorData, err = loadCloudInitFile(cmd, "vendor-data")
+	return err
+}
+
+// LoadSSHKeys reads authorized_keys-format files (one or more keys each, # comments allowed) and returns each key
+// normalized to "TYPE BASE64 [COMMENT]".
+func LoadSSHKeys(paths []string) ([]string, error) {
+	var keys []string
+	for _, path := range paths {
+		data, err := os.ReadFile(path) //nolint:gosec // user-supplied key file
+		if err != nil {
+			return nil, fmt.Errorf("--ssh-key: %w", err)
+		}
+		n := 0
+		sc := bufio.NewScanner(bytes.NewReader(data))
+		for sc.Scan() {
+			line := strings.TrimSpace(sc.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			pub, comment, options, _, parseErr := ssh.ParseAuthorizedKey([]byte(line))
+			if parseErr != nil {
+				return nil, fmt.Errorf("--ssh-key %s: %w", path, parseErr)
+			}
+			if len(options) > 0 {
+				return nil, fmt.Errorf("--ssh-key %s: key options (%s) are not supported", path, strings.Join(options, ","))
+			}
+			key := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub)))
+			if comment != "" {
+				key += " " + comment
+			}
+			keys = append(keys, key)
+			n++
+		}
+		if n == 0 {
+			return nil, fmt.Errorf("--ssh-key %s: no public key found", path)
+		}
+	}
+	return keys, nil
+}
+
+// loadCloudInitFile reads --<flag> and checks it is a format cloud-init accepts as a multipart part.
+func loadCloudInitFile(cmd *cobra.Command, flag string) ([]byte, error) {
+	path, _ := cmd.Flags().GetString(flag)
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path) //nolint:gosec // user-supplied cloud-init file
+	if err != nil {
+		return nil, fmt.Errorf("--%s: %w", flag, err)
+	}
+	if _, err = metadata.UserDataType(data); err != nil {
+		return nil, fmt.Errorf("--%s %s: %w", flag, path, err)
+	}
+	return data, nil
+}
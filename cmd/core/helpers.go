@@ -7,10 +7,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"strings"
 	"text/tabwriter"
 
+	"filippo.io/age"
 	"github.com/docker/go-units"
 	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/projecteru2/core/log"
@@ -26,9 +28,14 @@ import (
 	"github.com/cocoonstack/cocoon/network"
 	bridgenet "github.com/cocoonstack/cocoon/network/bridge"
 	"github.com/cocoonstack/cocoon/network/cni"
+	"github.com/cocoonstack/cocoon/network/macvtap"
+	"github.com/cocoonstack/cocoon/network/passt"
+	"github.com/cocoonstack/cocoon/network/publish"
+	"github.com/cocoonstack/cocoon/network/vhostuser"
 	"github.com/cocoonstack/cocoon/progress"
 	"github.com/cocoonstack/cocoon/snapshot"
 	"github.com/cocoonstack/cocoon/snapshot/localfile"
+	snapshots3 "github.com/cocoonstack/cocoon/snapshot/s3"
 	"github.com/cocoonstack/cocoon/types"
 	"github.com/cocoonstack/cocoon/utils"
 )
@@ -187,8 +194,42 @@ func InitBridgeNetwork(conf *config.Config, bridgeDev string) (network.Network,
 	return p, nil
 }
 
+func InitPasstNetwork(conf *config.Config) (network.Network, error) {
+	p, err := passt.New(conf)
+	if err != nil {
+		return nil, fmt.Errorf("init passt network: %w", err)
+	}
+	return p, nil
+}
+
+func InitMacvtapNetwork(conf *config.Config, spec string) (network.Network, error) {
+	p, err := macvtap.New(conf, spec)
+	if err != nil {
+		return nil, fmt.Errorf("init macvtap network: %w", err)
+	}
+	return p, nil
+}
+
+func InitVhostUserNetwork(conf *config.Config) (network.Network, error) {
+	p, err := vhostuser.New(conf)
+	if err != nil {
+		return nil, fmt.Errorf("init vhost-user network: %w", err)
+	}
+	return p, nil
+}
+
+// InitSnapshot builds the configured snapshot backend; opts only apply to localfile.
 func InitSnapshot(ctx context.Context, conf *config.Config, opts ...localfile.Option) (snapshot.Snapshot, error) {
-	s, err := localfile.New(conf, MeteringRecorder(ctx, conf), opts...)
+	var (
+		s   snapshot.Snapshot
+		err error
+	)
+	switch conf.SnapshotBackend {
+	case config.SnapshotBackendS3:
+		s, err = snapshots3.New(conf, MeteringRecorder(ctx, conf))
+	default:
+		s, err = localfile.New(conf, MeteringRecorder(ctx, conf), opts...)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("init snapshot backend: %w", err)
 	}
@@ -293,6 +334,13 @@ func VMConfigFromFlags(cmd *cobra.Command, image string) (*types.VMConfig, error
 	windows, _ := cmd.Flags().GetBool("windows")
 	sharedMemory, _ := cmd.Flags().GetBool("shared-memory")
 	dataDiskRaw, _ := cmd.Flags().GetStringArray("data-disk")
+	clockSync, _ := cmd.Flags().GetString("clock-sync")
+	healthCmd, _ := cmd.Flags().GetString("health-cmd")
+	healthInterval, _ := cmd.Flags().GetDuration("health-interval")
+	healthRetries, _ := cmd.Flags().GetInt("health-retries")
+	publishRaw, _ := cmd.Flags().GetStringArray("publish")
+	nicRaw, _ := cmd.Flags().GetStringArray("nic")
+	bridgeIPAM, _ := cmd.Flags().GetString("bridge-ipam")
 
 	if vmName == "" {
 		vmName = sanitizeVMName(image)
@@ -311,24 +359,47 @@ func VMConfigFromFlags(cmd *cobra.Command, image string) (*types.VMConfig, error
 	if err != nil {
 		return nil, err
 	}
+	ports, err := publish.ParseAll(publishRaw)
+	if err != nil {
+		return nil, err
+	}
+	fw, _, err := FirewallFromFlags(cmd)
+	if err != nil {
+		return nil, err
+	}
+	nics, err := parseNICFlags(nicRaw)
+	if err != nil {
+		return nil, err
+	}
 
 	cfg := &types.VMConfig{
 		Name: vmName,
 		Config: types.Config{
-			CPU:           cpu,
-			Memory:        memBytes,
-			Storage:       storBytes,
-			QueueSize:     queueSize,
-			DiskQueueSize: diskQueueSize,
-			Image:         image,
-			Network:       network,
-			NoDirectIO:    noDirectIO,
-			Windows:       windows,
-			SharedMemory:  sharedMemory,
+			CPU:            cpu,
+			Memory:         memBytes,
+			Storage:        storBytes,
+			QueueSize:      queueSize,
+			DiskQueueSize:  diskQueueSize,
+			Image:          image,
+			Network:        network,
+			NoDirectIO:     noDirectIO,
+			Windows:        windows,
+			SharedMemory:   sharedMemory,
+			ClockSync:      clockSync,
+			HealthCmd:      healthCmd,
+			HealthInterval: healthInterval,
+			HealthRetries:  healthRetries,
+			Firewall:       fw,
 		},
-		User:      user,
-		Password:  password,
-		DataDisks: dataDisks,
+		User:       user,
+		Password:   password,
+		DataDisks:  dataDisks,
+		NICs:       nics,
+		BridgeIPAM: bridgeIPAM,
+		Ports:      ports,
+	}
+	if err := applyGuestDataFlags(cmd, cfg); err != nil {
+		return nil, err
 	}
 	if err := cfg.Validate(); err != nil {
 		return nil, err
@@ -339,7 +410,17 @@ func VMConfigFromFlags(cmd *cobra.Command, image string) (*types.VMConfig, error
 func CloneVMConfigFromFlags(cmd *cobra.Command, snapCfg types.SnapshotConfig) (*types.VMConfig, error) {
 	vmName, _ := cmd.Flags().GetString("name")
 	flagNetwork, _ := cmd.Flags().GetString("network")
+	nicRaw, _ := cmd.Flags().GetStringArray("nic")
+	nics, err := parseNICFlags(nicRaw)
+	if err != nil {
+		return nil, err
+	}
 	network := cmp.Or(flagNetwork, snapCfg.Network)
+	// The source's per-NIC fabrics carry over unless --network/--bridge/--vhost-user retarget the whole clone.
+	bridgeDev, _ := cmd.Flags().GetString("bridge")
+	if vhostUser, _ := cmd.Flags().GetBool("vhost-user"); flagNetwork == "" && bridgeDev == "" && !vhostUser {
+		nics = mergeNICSpecs(snapCfg.NICAttachments, nics)
+	}
 	flagQueueSize, _ := cmd.Flags().GetInt("queue-size")
 	queueSize := cmp.Or(flagQueueSize, snapCfg.QueueSize)
 	flagDiskQueueSize, _ := cmd.Flags().GetInt("disk-queue-size")
@@ -350,28 +431,69 @@ func CloneVMConfigFromFlags(cmd *cobra.Command, snapCfg types.SnapshotConfig) (*
 	}
 
 	onDemand, _ := cmd.Flags().GetBool("on-demand")
+	flagClockSync, _ := cmd.Flags().GetString("clock-sync")
+	publishRaw, _ := cmd.Flags().GetStringArray("publish")
+	// Published ports are per-VM, never inherited: the source may still hold the same host ports.
+	ports, err := publish.ParseAll(publishRaw)
+	if err != nil {
+		return nil, err
+	}
+	// The snapshot's firewall comes along only on request: a clone often lands in another tenant's network.
+	fw, fwSet, err := FirewallFromFlags(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if inherit, _ := cmd.Flags().GetBool("inherit-firewall"); inherit {
+		if fwSet {
+			return nil, fmt.Errorf("--inherit-firewall and --firewall/--allow/--deny-egress are mutually exclusive")
+		}
+		fw = snapCfg.Firewall
+	}
+
+	healthCmd, healthInterval, healthRetries := snapCfg.HealthCmd, snapCfg.HealthInterval, snapCfg.HealthRetries
+	if cmd.Flags().Changed("health-cmd") {
+		healthCmd, _ = cmd.Flags().GetString("health-cmd")
+	}
+	if cmd.Flags().Changed("health-interval") {
+		healthInterval, _ = cmd.Flags().GetDuration("health-interval")
+	}
+	if cmd.Flags().Changed("health-retries") {
+		healthRetries, _ = cmd.Flags().GetInt("health-retries")
+	}
 
-	return &types.VMConfig{
+	cfg := &types.VMConfig{
 		Name: vmName,
 		Config: types.Config{
-			CPU:           snapCfg.CPU,
-			Memory:        snapCfg.Memory,
-			Storage:       snapCfg.Storage,
-			QueueSize:     queueSize,
-			DiskQueueSize: diskQueueSize,
-			Image:         snapCfg.Image,
-			ImageDigest:   snapCfg.ImageDigest,
-			ImageType:     snapCfg.ImageType,
-			Network:       network,
-			NoDirectIO:    noDirectIO,
-			Windows:       snapCfg.Windows,
-			SharedMemory:  snapCfg.SharedMemory,
+			CPU:            snapCfg.CPU,
+			Memory:         snapCfg.Memory,
+			Storage:        snapCfg.Storage,
+			QueueSize:      queueSize,
+			DiskQueueSize:  diskQueueSize,
+			Image:          snapCfg.Image,
+			ImageDigest:    snapCfg.ImageDigest,
+			ImageType:      snapCfg.ImageType,
+			Network:        network,
+			NoDirectIO:     noDirectIO,
+			Windows:        snapCfg.Windows,
+			SharedMemory:   snapCfg.SharedMemory,
+			ClockSync:      cmp.Or(flagClockSync, snapCfg.ClockSync),
+			HealthCmd:      healthCmd,
+			HealthInterval: healthInterval,
+			HealthRetries:  healthRetries,
+			SSHKeys:        snapCfg.SSHKeys,
+			Firewall:       fw,
 		},
 		OnDemand: onDemand,
-	}, nil
+		NICs:     nics,
+		Ports:    ports,
+	}
+	if err := applyGuestDataFlags(cmd, cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
 }
 
-// RestoreVMConfigFromFlags builds VMConfig for restore: resources from the snapshot, Name/Network from the VM (CNI namespace survives restore).
+// RestoreVMConfigFromFlags builds VMConfig for restore: resources from the snapshot, Name/Network/Ports/Firewall from the VM (CNI namespace survives restore).
 func RestoreVMConfigFromFlags(cmd *cobra.Command, vm *types.VM, snapCfg types.SnapshotConfig) (*types.VMConfig, error) {
 	if snapCfg.NICs != len(vm.NetworkConfigs) {
 		return nil, fmt.Errorf("nic count mismatch: vm has %d, snapshot has %d",
@@ -379,11 +501,15 @@ func RestoreVMConfigFromFlags(cmd *cobra.Command, vm *types.VM, snapCfg types.Sn
 	}
 	cfg := snapCfg.Config
 	cfg.Network = vm.Config.Network
+	cfg.Firewall = vm.Config.Firewall
+	flagClockSync, _ := cmd.Flags().GetString("clock-sync")
+	cfg.ClockSync = cmp.Or(flagClockSync, vm.Config.ClockSync)
 	onDemand, _ := cmd.Flags().GetBool("on-demand")
 	result := &types.VMConfig{
 		Config:   cfg,
 		Name:     vm.Config.Name,
 		OnDemand: onDemand,
+		Ports:    vm.Config.Ports,
 	}
 	if err := result.Validate(); err != nil {
 		return nil, fmt.Errorf("snapshot config: %w", err)
@@ -391,6 +517,15 @@ func RestoreVMConfigFromFlags(cmd *cobra.Command, vm *types.VM, snapCfg types.Sn
 	return result, nil
 }
 
+// DecryptIdentities loads the --decrypt-key age identities; nil when the flag is unset.
+func DecryptIdentities(cmd *cobra.Command) ([]age.Identity, error) {
+	keyFile, _ := cmd.Flags().GetString("decrypt-key")
+	if keyFile == "" {
+		return nil, nil
+	}
+	return snapshot.ReadIdentityFile(keyFile)
+}
+
 func EnsureFirmwarePath(conf *config.Config, bootCfg *types.BootConfig) {
 	if bootCfg != nil && bootCfg.KernelPath == "" && bootCfg.FirmwarePath == "" {
 		bootCfg.FirmwarePath = cloudimg.NewConfig(conf).FirmwarePath()
@@ -641,6 +776,68 @@ func parseDataDiskSpec(s string) (types.DataDiskSpec, error) {
 	return spec, nil
 }
 
+func parseNICFlags(raw []string) ([]types.NICSpec, error) {
+	specs := make([]types.NICSpec, 0, len(raw))
+	for _, s := range raw {
+		spec, err := parseNICSpec(s)
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// parseNICSpec parses a comma-separated --nic arg (ip=, mac=, network=, bridge=); addresses are normalized so duplicates compare equal.
+func parseNICSpec(s string) (types.NICSpec, error) {
+	var spec types.NICSpec
+	if s == "" {
+		return spec, nil // a bare --nic "" keeps a slot for an all-default NIC
+	}
+	for part := range strings.SplitSeq(s, ",") {
+		rawKey, rawVal, ok := strings.Cut(part, "=")
+		if !ok {
+			return spec, fmt.Errorf("--nic: %q is not key=value", part)
+		}
+		key := strings.TrimSpace(rawKey)
+		val := strings.TrimSpace(rawVal)
+		switch key {
+		case "ip":
+			ip := net.ParseIP(val)
+			if ip == nil {
+				return spec, fmt.Errorf("--nic: invalid ip %q", val)
+			}
+			spec.IP = ip.String()
+		case "mac":
+			hw, err := net.ParseMAC(val)
+			if err != nil {
+				return spec, fmt.Errorf("--nic: invalid mac %q: %w", val, err)
+			}
+			spec.MAC = hw.String()
+		case "network":
+			spec.Network = val
+		case "bridge":
+			spec.Bridge = val
+		default:
+			return spec, fmt.Errorf("--nic: unknown key %q", key)
+		}
+	}
+	return spec, spec.Validate()
+}
+
+// mergeNICSpecs overlays --nic requests on inherited attachments: a request's IP/MAC always apply, its network or
+// bridge only when it names one.
+func mergeNICSpecs(inherited, requests []types.NICSpec) []types.NICSpec {
+	out := make([]types.NICSpec, max(len(inherited), len(requests)))
+	copy(out, requests)
+	for i, a := range inherited {
+		if out[i].Network == "" && out[i].Bridge == "" {
+			out[i].Network, out[i].Bridge = a.Network, a.Bridge
+		}
+	}
+	return out
+}
+
 // normalizeDataDiskSpecs fills defaults (FSType=ext4, Name=dataN, MountPoint=/mnt/<name>) and enforces unique names; fstype=none rejects non-empty MountPoint.
 func normalizeDataDiskSpecs(specs []types.DataDiskSpec) error {
 	used := make(map[string]bool)
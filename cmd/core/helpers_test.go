@@ -1,6 +1,7 @@
 package core
 
 import (
+	"slices"
 	"strings"
 	"testing"
 
@@ -122,6 +123,75 @@ func TestParseDataDiskSpec(t *testing.T) {
 	}
 }
 
+func TestParseNICSpec(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    types.NICSpec
+		wantErr bool
+	}{
+		{name: "empty keeps a default slot", input: ""},
+		{name: "ip only", input: "ip=10.22.0.50", want: types.NICSpec{IP: "10.22.0.50"}},
+		{
+			name:  "all fields normalized",
+			input: "ip=FD00::0050, mac=52:54:00:AB:CD:EF ,network=storage",
+			want:  types.NICSpec{IP: "fd00::50", MAC: "52:54:00:ab:cd:ef", Network: "storage"},
+		},
+		{name: "bridge", input: "bridge=br-data,mac=52:54:00:00:00:09", want: types.NICSpec{Bridge: "br-data", MAC: "52:54:00:00:00:09"}},
+		{name: "network and bridge", input: "network=storage,bridge=br-data", wantErr: true},
+		{name: "bad ip", input: "ip=10.22.0.300", wantErr: true},
+		{name: "bad mac", input: "mac=52:54:00", wantErr: true},
+		{name: "multicast mac", input: "mac=01:00:5e:00:00:01", wantErr: true},
+		{name: "infiniband mac", input: "mac=00:00:00:00:fe:80:00:00:00:00:00:00:00:00:00:00:00:00:00:00", wantErr: true},
+		{name: "not key=value", input: "10.22.0.50", wantErr: true},
+		{name: "unknown key", input: "gw=10.22.0.1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseNICSpec(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err=%v wantErr=%v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeNICSpecs(t *testing.T) {
+	inherited := []types.NICSpec{{}, {Network: "storage"}, {Bridge: "br-data"}}
+	tests := []struct {
+		name     string
+		requests []types.NICSpec
+		want     []types.NICSpec
+	}{
+		{name: "no requests inherit", want: inherited},
+		{
+			name:     "address-only request keeps the fabric",
+			requests: []types.NICSpec{{}, {IP: "10.30.0.5"}},
+			want:     []types.NICSpec{{}, {IP: "10.30.0.5", Network: "storage"}, {Bridge: "br-data"}},
+		},
+		{
+			name:     "fabric request replaces it",
+			requests: []types.NICSpec{{}, {Bridge: "br-storage"}, {Network: "mgmt"}},
+			want:     []types.NICSpec{{}, {Bridge: "br-storage"}, {Network: "mgmt"}},
+		},
+		{
+			name:     "requests past the inherited layout",
+			requests: []types.NICSpec{{}, {}, {}, {MAC: "52:54:00:00:00:04"}},
+			want:     []types.NICSpec{{}, {Network: "storage"}, {Bridge: "br-data"}, {MAC: "52:54:00:00:00:04"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergeNICSpecs(inherited, tt.requests); !slices.Equal(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestNormalizeDataDiskSpecs(t *testing.T) {
 	t.Run("auto names skip explicitly used", func(t *testing.T) {
 		specs := []types.DataDiskSpec{
@@ -7,8 +7,12 @@ import (
 	"github.com/spf13/cobra"
 
 	cmdcore "github.com/cocoonstack/cocoon/cmd/core"
+	"github.com/cocoonstack/cocoon/config"
 	"github.com/cocoonstack/cocoon/gc"
 	"github.com/cocoonstack/cocoon/network/bridge"
+	"github.com/cocoonstack/cocoon/network/macvtap"
+	"github.com/cocoonstack/cocoon/network/passt"
+	"github.com/cocoonstack/cocoon/network/publish"
 	"github.com/cocoonstack/cocoon/snapshot/localfile"
 	"github.com/cocoonstack/cocoon/version"
 )
@@ -27,6 +31,9 @@ func (h Handler) GC(cmd *cobra.Command, _ []string) error {
 	if err != nil {
 		return err
 	}
+	if policy.Enabled && conf.SnapshotBackend == config.SnapshotBackendS3 {
+		return fmt.Errorf("--snapshot LRU eviction is only supported by the %s snapshot backend", config.SnapshotBackendLocalFile)
+	}
 	backends, err := cmdcore.InitImageBackends(ctx, conf)
 	if err != nil {
 		return err
@@ -54,6 +61,9 @@ func (h Handler) GC(cmd *cobra.Command, _ []string) error {
 	}
 	netProvider.RegisterGC(o)
 	gc.Register(o, bridge.GCModule(conf.RootDir))
+	gc.Register(o, passt.GCModule(conf))
+	gc.Register(o, macvtap.GCModule(conf.RootDir))
+	gc.Register(o, publish.GCModule(conf.RootDir))
 	snapBackend.RegisterGC(o)
 	return o.Run(ctx)
 }
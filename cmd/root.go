@@ -42,6 +42,7 @@ var (
 		cmd.PersistentFlags().String("cni-conf-dir", "", "CNI plugin config directory (default: /etc/cni/net.d)")
 		cmd.PersistentFlags().String("cni-bin-dir", "", "CNI plugin binary directory (default: /opt/cni/bin)")
 		cmd.PersistentFlags().String("dns", "", `DNS servers for VMs, comma or semicolon separated (default: "8.8.8.8,1.1.1.1")`)
+		cmd.PersistentFlags().String("discovery-dns", "", "host IPv4 for the VM-name DNS forwarder, given to VMs as their first DNS server (e.g. the CNI gateway)")
 		cmd.PersistentFlags().String("log-level", "", `log level: debug, info, warn, error (default: "info")`)
 
 		_ = viper.BindPFlag("root_dir", cmd.PersistentFlags().Lookup("root-dir"))
@@ -50,6 +51,7 @@ var (
 		_ = viper.BindPFlag("cni_conf_dir", cmd.PersistentFlags().Lookup("cni-conf-dir"))
 		_ = viper.BindPFlag("cni_bin_dir", cmd.PersistentFlags().Lookup("cni-bin-dir"))
 		_ = viper.BindPFlag("dns", cmd.PersistentFlags().Lookup("dns"))
+		_ = viper.BindPFlag("discovery_dns", cmd.PersistentFlags().Lookup("discovery-dns"))
 		_ = viper.BindPFlag("log.level", cmd.PersistentFlags().Lookup("log-level"))
 
 		viper.SetEnvPrefix("COCOON")
@@ -59,11 +61,13 @@ var (
 		viper.SetDefault("log_dir", "/var/log/cocoon")
 		viper.SetDefault("ch_binary", "cloud-hypervisor")
 		viper.SetDefault("fc_binary", "firecracker")
+		viper.SetDefault("passt_binary", "passt")
 		viper.SetDefault("cni_conf_dir", "/etc/cni/net.d")
 		viper.SetDefault("cni_bin_dir", "/opt/cni/bin")
 		viper.SetDefault("dns", "8.8.8.8,1.1.1.1")
 		viper.SetDefault("stop_timeout_seconds", 30)
 		viper.SetDefault("pool_size", runtime.NumCPU())
+		viper.SetDefault("snapshot_backend", "localfile")
 		viper.SetDefault("log.level", "info")
 		viper.SetDefault("log.max_size", 500)
 		viper.SetDefault("log.max_age", 28)
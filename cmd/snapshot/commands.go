@@ -13,6 +13,8 @@ type Actions interface {
 	RM(cmd *cobra.Command, args []string) error
 	Export(cmd *cobra.Command, args []string) error
 	Import(cmd *cobra.Command, args []string) error
+	Verify(cmd *cobra.Command, args []string) error
+	Tree(cmd *cobra.Command, args []string) error
 }
 
 func Command(h Actions) *cobra.Command {
@@ -60,10 +62,15 @@ func Command(h Actions) *cobra.Command {
 		RunE:  h.Export,
 	}
 	exportCmd.Flags().StringP("output", "o", "", "output file path (default: <name-or-id>.tar)")
-	exportCmd.Flags().Bool("gzip", false, "compress output with gzip")
+	exportCmd.Flags().Bool("gzip", false, "compress output with gzip (shorthand for --compress gzip)")
+	exportCmd.Flags().String("compress", "", "compress output: none, gzip[:1-9] or zstd[:1-22] (zstd encodes on multiple threads)")
+	exportCmd.Flags().Int("parallel", 0, "zstd encoder threads (0 = pool_size)")
 	exportCmd.Flags().String("to-dir", "", "export into a directory (must be empty/absent) instead of a tar; pairs with `vm clone --from-dir`")
+	exportCmd.Flags().String("encrypt-to", "", "age X25519 recipient (age1...) or recipients/identity file; encrypts the archive (or each file with --to-dir)")
 	exportCmd.MarkFlagsMutuallyExclusive("to-dir", "output")
 	exportCmd.MarkFlagsMutuallyExclusive("to-dir", "gzip")
+	exportCmd.MarkFlagsMutuallyExclusive("to-dir", "compress")
+	exportCmd.MarkFlagsMutuallyExclusive("gzip", "compress")
 
 	importCmd := &cobra.Command{
 		Use:   "import [FILE]",
@@ -73,7 +80,26 @@ func Command(h Actions) *cobra.Command {
 	}
 	importCmd.Flags().String("name", "", "override snapshot name")
 	importCmd.Flags().String("description", "", "override snapshot description")
+	importCmd.Flags().String("decrypt-key", "", "age identity file for an encrypted archive")
+	importCmd.Flags().Int("parallel", 0, "files hashed concurrently while verifying the manifest (0 = pool_size)")
 
-	snapshotCmd.AddCommand(saveCmd, listCmd, inspectCmd, rmCmd, exportCmd, importCmd)
+	verifyCmd := &cobra.Command{
+		Use:   "verify SNAPSHOT|DIR",
+		Short: "Check snapshot data files against their sha256 manifest",
+		Args:  cobra.ExactArgs(1),
+		RunE:  h.Verify,
+	}
+	verifyCmd.Flags().Int("parallel", 0, "files hashed concurrently (0 = pool_size)")
+	verifyCmd.Flags().String("decrypt-key", "", "age identity file for an encrypted DIR")
+
+	treeCmd := &cobra.Command{
+		Use:   "tree [SNAPSHOT|VM]",
+		Short: "Show the snapshot → VM → snapshot clone lineage",
+		Args:  cobra.MaximumNArgs(1),
+		RunE:  h.Tree,
+	}
+	cmdcore.AddFormatFlag(treeCmd)
+
+	snapshotCmd.AddCommand(saveCmd, listCmd, inspectCmd, rmCmd, exportCmd, importCmd, verifyCmd, treeCmd)
 	return snapshotCmd
 }
@@ -2,11 +2,13 @@ package snapshot
 
 import (
 	"cmp"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"slices"
+	"strings"
 	"text/tabwriter"
 	"time"
 
@@ -14,6 +16,9 @@ import (
 	"github.com/spf13/cobra"
 
 	cmdcore "github.com/cocoonstack/cocoon/cmd/core"
+	"github.com/cocoonstack/cocoon/config"
+	"github.com/cocoonstack/cocoon/progress"
+	snapshotProgress "github.com/cocoonstack/cocoon/progress/snapshot"
 	"github.com/cocoonstack/cocoon/snapshot"
 	"github.com/cocoonstack/cocoon/types"
 )
@@ -34,6 +39,13 @@ func (h Handler) Save(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return fmt.Errorf("find VM %s: %w", vmRef, err)
 	}
+	// Clone and restore re-plumb TAP NICs only; a passt NIC's vhost-user socket belongs to the source VM, and a
+	// macvtap NIC's queue fds do not outlive its CH.
+	if vm, inspectErr := hyper.Inspect(ctx, vmRef); inspectErr == nil {
+		if backend := vm.ResolvedNetBackend(); backend == types.BackendPasst || backend == types.BackendMacvtap {
+			return fmt.Errorf("snapshot VM %s: VMs with --%s networking cannot be snapshotted", vmRef, backend)
+		}
+	}
 	snapBackend, err := cmdcore.InitSnapshot(ctx, conf)
 	if err != nil {
 		return err
@@ -167,16 +179,36 @@ func (h Handler) Export(cmd *cobra.Command, args []string) (err error) {
 
 	ref := args[0]
 	output, _ := cmd.Flags().GetString("output")
-	useGzip, _ := cmd.Flags().GetBool("gzip")
 	toDir, _ := cmd.Flags().GetString("to-dir")
+	encryptTo, _ := cmd.Flags().GetString("encrypt-to")
+	compression, err := exportCompression(cmd)
+	if err != nil {
+		return err
+	}
 
-	if toDir != "" {
-		exporter, ok := snapBackend.(snapshot.DirectoryExporter)
-		if !ok {
-			return fmt.Errorf("backend does not support directory export")
+	var enc *snapshot.Encrypter
+	if encryptTo != "" {
+		if enc, err = snapshot.NewEncrypter(encryptTo); err != nil {
+			return err
 		}
+	}
+
+	if toDir != "" {
 		logger.Infof(ctx, "exporting to dir %s ...", toDir)
-		if err = exporter.ExportToDir(ctx, ref, toDir); err != nil {
+		if enc != nil {
+			encExporter, ok := snapBackend.(snapshot.EncryptedExporter)
+			if !ok {
+				return fmt.Errorf("backend does not support encrypted export")
+			}
+			err = encExporter.ExportToDirEncrypted(ctx, ref, toDir, enc)
+		} else {
+			exporter, ok := snapBackend.(snapshot.DirectoryExporter)
+			if !ok {
+				return fmt.Errorf("backend does not support directory export")
+			}
+			err = exporter.ExportToDir(ctx, ref, toDir)
+		}
+		if err != nil {
 			return fmt.Errorf("export-to-dir: %w", err)
 		}
 		logger.Infof(ctx, "exported: %s", toDir)
@@ -184,14 +216,29 @@ func (h Handler) Export(cmd *cobra.Command, args []string) (err error) {
 	}
 
 	var stream io.ReadCloser
-	if useGzip {
-		compressor, ok := snapBackend.(snapshot.CompressedExporter)
-		if !ok {
-			return fmt.Errorf("backend does not support compressed export")
-		}
-		stream, err = compressor.ExportCompressed(ctx, ref)
+	if streamer, ok := snapBackend.(snapshot.StreamExporter); ok {
+		parallel, _ := cmd.Flags().GetInt("parallel")
+		stream, err = streamer.ExportStream(ctx, ref, snapshot.ExportOptions{
+			Compression: compression,
+			Encrypter:   enc,
+			Concurrency: parallel,
+			Tracker:     exportTracker(ctx, logger),
+		})
 	} else {
-		stream, err = snapBackend.Export(ctx, ref)
+		switch {
+		case enc != nil:
+			return fmt.Errorf("backend does not support encrypted export")
+		case compression.Algo == snapshot.CompressGzip && compression.Level == 0:
+			compressor, ok := snapBackend.(snapshot.CompressedExporter)
+			if !ok {
+				return fmt.Errorf("backend does not support compressed export")
+			}
+			stream, err = compressor.ExportCompressed(ctx, ref)
+		case compression.Enabled():
+			return fmt.Errorf("backend does not support %s export", compression.Algo)
+		default:
+			stream, err = snapBackend.Export(ctx, ref)
+		}
 	}
 	if err != nil {
 		return fmt.Errorf("export: %w", err)
@@ -212,9 +259,9 @@ func (h Handler) Export(cmd *cobra.Command, args []string) (err error) {
 			return fmt.Errorf("inspect: %w", inspectErr)
 		}
 		base := cmp.Or(snap.Name, snap.ID)
-		ext := ".tar"
-		if useGzip {
-			ext = ".tar.gz"
+		ext := ".tar" + compression.Ext()
+		if enc != nil {
+			ext += ".age"
 		}
 		output = base + ext
 	}
@@ -246,7 +293,7 @@ func (h Handler) Import(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	logger := log.WithFunc("cmd.snapshot.import")
-	snapBackend, err := cmdcore.InitSnapshot(ctx, conf)
+	snapBackend, err := cmdcore.InitSnapshot(ctx, withParallel(cmd, conf))
 	if err != nil {
 		return err
 	}
@@ -272,6 +319,18 @@ func (h Handler) Import(cmd *cobra.Command, args []string) error {
 		logger.Info(ctx, "importing from stdin ...")
 	}
 
+	ids, err := cmdcore.DecryptIdentities(cmd)
+	if err != nil {
+		return err
+	}
+	r, encrypted, err := snapshot.MaybeDecrypt(r, ids)
+	if err != nil {
+		return fmt.Errorf("import: %w", err)
+	}
+	if !encrypted && len(ids) > 0 {
+		logger.Warn(ctx, "archive is not encrypted; --decrypt-key ignored")
+	}
+
 	snapID, err := snapBackend.Import(ctx, r, name, description)
 	if err != nil {
 		return fmt.Errorf("import: %w", err)
@@ -281,6 +340,45 @@ func (h Handler) Import(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// Verify checks a snapshot DIR (from `export --to-dir`) or a stored snapshot against its manifest.
+func (h Handler) Verify(cmd *cobra.Command, args []string) error {
+	ctx, conf, err := h.Init(cmd)
+	if err != nil {
+		return err
+	}
+	logger := log.WithFunc("cmd.snapshot.verify")
+	conf = withParallel(cmd, conf)
+
+	ref := args[0]
+	if fi, statErr := os.Stat(ref); statErr == nil && fi.IsDir() {
+		ids, idErr := cmdcore.DecryptIdentities(cmd)
+		if idErr != nil {
+			return idErr
+		}
+		logger.Infof(ctx, "verifying dir %s ...", ref)
+		if _, err = snapshot.VerifyDir(ctx, ref, conf.EffectivePoolSize(), ids...); err != nil {
+			return fmt.Errorf("verify %s: %w", ref, err)
+		}
+		logger.Infof(ctx, "verified: %s", ref)
+		return nil
+	}
+
+	snapBackend, err := cmdcore.InitSnapshot(ctx, conf)
+	if err != nil {
+		return err
+	}
+	verifier, ok := snapBackend.(snapshot.Verifier)
+	if !ok {
+		return fmt.Errorf("backend %s does not support verify", snapBackend.Type())
+	}
+	logger.Infof(ctx, "verifying snapshot %s ...", ref)
+	if err = verifier.Verify(ctx, ref); err != nil {
+		return fmt.Errorf("verify %s: %w", ref, err)
+	}
+	logger.Infof(ctx, "verified: %s", ref)
+	return nil
+}
+
 func (h Handler) RM(cmd *cobra.Command, args []string) error {
 	ctx, conf, err := h.Init(cmd)
 	if err != nil {
@@ -292,6 +390,8 @@ func (h Handler) RM(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	warnLiveDescendants(ctx, conf, snapBackend, args, logger)
+
 	deleted, err := snapBackend.Delete(ctx, args)
 	for _, id := range deleted {
 		logger.Infof(ctx, "deleted: %s", id)
@@ -304,3 +404,150 @@ func (h Handler) RM(cmd *cobra.Command, args []string) error {
 	}
 	return nil
 }
+
+func (h Handler) Tree(cmd *cobra.Command, args []string) error {
+	ctx, conf, err := h.Init(cmd)
+	if err != nil {
+		return err
+	}
+	snapBackend, err := cmdcore.InitSnapshot(ctx, conf)
+	if err != nil {
+		return err
+	}
+	lineage, err := loadLineage(ctx, conf, snapBackend)
+	if err != nil {
+		return err
+	}
+
+	roots := lineage.Forest()
+	if len(args) > 0 {
+		tree, treeErr := lineage.Tree(args[0])
+		if treeErr != nil {
+			return fmt.Errorf("resolve %s: %w", args[0], treeErr)
+		}
+		roots = []*snapshot.LineageNode{tree}
+	}
+	if len(roots) == 0 {
+		fmt.Println("No snapshot lineage found.")
+		return nil
+	}
+
+	return cmdcore.OutputFormatted(cmd, roots, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "NAME\tTYPE\tID\tSTATE\tCREATED") //nolint:errcheck
+		for _, root := range roots {
+			printLineage(w, root, "", "")
+		}
+	})
+}
+
+// loadLineage joins the snapshot store with every hypervisor's VM records.
+func loadLineage(ctx context.Context, conf *config.Config, snapBackend snapshot.Snapshot) (*snapshot.Lineage, error) {
+	snaps, err := snapBackend.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list snapshots: %w", err)
+	}
+	hypers, err := cmdcore.InitAllHypervisors(ctx, conf)
+	if err != nil {
+		return nil, err
+	}
+	vms, err := cmdcore.ListAllVMs(ctx, hypers)
+	if err != nil {
+		return nil, err
+	}
+	return snapshot.NewLineage(snaps, vms), nil
+}
+
+// printLineage writes n and its children as box-drawn tree rows; prefix indents n's own row, childPrefix its children's.
+func printLineage(w io.Writer, n *snapshot.LineageNode, prefix, childPrefix string) {
+	label := cmp.Or(n.Name, "-")
+	switch {
+	case n.Cycle:
+		label += " (cycle)"
+	case n.MissingParent != "":
+		label += fmt.Sprintf(" (source %s deleted)", n.MissingParent)
+	}
+	if n.Target {
+		label += " *"
+	}
+	fmt.Fprintf(w, "%s%s\t%s\t%s\t%s\t%s\n", //nolint:errcheck
+		prefix, label, n.Kind, n.ID, cmp.Or(n.State, "-"), n.CreatedAt.Local().Format(time.DateTime))
+	for i, c := range n.Children {
+		if i == len(n.Children)-1 {
+			printLineage(w, c, childPrefix+"└── ", childPrefix+"    ")
+		} else {
+			printLineage(w, c, childPrefix+"├── ", childPrefix+"│   ")
+		}
+	}
+}
+
+// warnLiveDescendants flags refs whose clones are still on record; rm proceeds since clones own copies of their data.
+func warnLiveDescendants(ctx context.Context, conf *config.Config, snapBackend snapshot.Snapshot, refs []string, logger *log.Fields) {
+	lineage, err := loadLineage(ctx, conf, snapBackend)
+	if err != nil {
+		logger.Warnf(ctx, "skip descendant check: %v", err)
+		return
+	}
+	for _, ref := range refs {
+		snap, inspectErr := snapBackend.Inspect(ctx, ref)
+		if inspectErr != nil {
+			continue // Delete reports it
+		}
+		vms := lineage.LiveDescendants(snap.ID)
+		if len(vms) == 0 {
+			continue
+		}
+		names := make([]string, len(vms))
+		for i, vm := range vms {
+			names[i] = vm.Config.Name
+		}
+		logger.Warnf(ctx, "snapshot %s has %d live descendant VM(s): %s (they keep running; `snapshot tree` will show them without a source)",
+			ref, len(vms), strings.Join(names, ", "))
+	}
+}
+
+// exportCompression resolves --compress, with --gzip kept as shorthand for --compress gzip.
+func exportCompression(cmd *cobra.Command) (snapshot.Compression, error) {
+	if useGzip, _ := cmd.Flags().GetBool("gzip"); useGzip {
+		return snapshot.Compression{Algo: snapshot.CompressGzip}, nil
+	}
+	spec, _ := cmd.Flags().GetString("compress")
+	return snapshot.ParseCompression(spec)
+}
+
+// exportTracker logs export start/finish and redraws a byte counter on stderr (stdout may carry the archive).
+func exportTracker(ctx context.Context, logger *log.Fields) progress.Tracker {
+	start := time.Now()
+	return progress.NewTracker(func(e snapshotProgress.Event) {
+		switch e.Phase {
+		case snapshotProgress.PhaseExport:
+			logger.Infof(ctx, "exporting %d files (%s)", e.Total, cmdcore.FormatSize(e.BytesTotal))
+		case snapshotProgress.PhaseFile, snapshotProgress.PhaseWrite:
+			fmt.Fprintf(os.Stderr, "\r  %s / %s read, %s written (%s/s)", //nolint:errcheck
+				cmdcore.FormatSize(e.BytesDone), cmdcore.FormatSize(e.BytesTotal),
+				cmdcore.FormatSize(e.BytesOut), cmdcore.FormatSize(throughput(e.BytesOut, start)))
+		case snapshotProgress.PhaseDone:
+			fmt.Fprintln(os.Stderr) //nolint:errcheck
+			logger.Infof(ctx, "archive %s from %s in %s (%s/s)", cmdcore.FormatSize(e.BytesOut), cmdcore.FormatSize(e.BytesTotal),
+				time.Since(start).Round(time.Millisecond), cmdcore.FormatSize(throughput(e.BytesOut, start)))
+		}
+	})
+}
+
+func throughput(n int64, start time.Time) int64 {
+	elapsed := time.Since(start).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return int64(float64(n) / elapsed)
+}
+
+// withParallel returns conf with PoolSize overridden by --parallel; a copy so the shared config stays untouched.
+func withParallel(cmd *cobra.Command, conf *config.Config) *config.Config {
+	parallel, _ := cmd.Flags().GetInt("parallel")
+	if parallel <= 0 {
+		return conf
+	}
+	local := *conf
+	local.PoolSize = parallel
+	return &local
+}
@@ -0,0 +1,31 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cocoonstack/cocoon/agent"
+	cmdcore "github.com/cocoonstack/cocoon/cmd/core"
+	"github.com/cocoonstack/cocoon/config"
+	"github.com/cocoonstack/cocoon/hypervisor"
+	"github.com/cocoonstack/cocoon/types"
+)
+
+// agentVM resolves ref to a running VM whose cocoon-agent is reachable over vsock.
+func agentVM(ctx context.Context, conf *config.Config, ref string) (*types.VM, error) {
+	hyper, err := cmdcore.FindHypervisor(ctx, conf, ref)
+	if err != nil {
+		return nil, err
+	}
+	info, err := hyper.Inspect(ctx, ref)
+	if err != nil {
+		return nil, fmt.Errorf("inspect: %w", err)
+	}
+	if info.State != types.VMStateRunning {
+		return nil, hypervisor.ErrNotRunning
+	}
+	if info.VsockSocket == "" {
+		return nil, fmt.Errorf("%w (recreate the VM to enable cocoon-agent)", agent.ErrVsockNotConfigured)
+	}
+	return info, nil
+}
@@ -0,0 +1,22 @@
+package vm
+
+import (
+	"context"
+
+	"github.com/projecteru2/core/log"
+
+	"github.com/cocoonstack/cocoon/types"
+)
+
+// reportClockSync logs the guest clock step the backend took right after resume (see hypervisor.SyncGuestClock).
+func reportClockSync(ctx context.Context, vm *types.VM, logger *log.Fields) {
+	r := vm.LastClockSync
+	if r == nil || vm.Config.ClockSync == types.ClockSyncOff || vm.Config.Windows {
+		return
+	}
+	if r.Error != "" {
+		logger.Warnf(ctx, "guest clock sync (%s) failed, guest time may lag: %s", r.Method, r.Error)
+		return
+	}
+	logger.Infof(ctx, "guest clock stepped by %+.3fs (%s)", r.OffsetSeconds, r.Method)
+}
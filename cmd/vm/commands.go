@@ -2,10 +2,12 @@ package vm
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	cmdcore "github.com/cocoonstack/cocoon/cmd/core"
+	"github.com/cocoonstack/cocoon/types"
 )
 
 type Actions interface {
@@ -18,16 +20,27 @@ type Actions interface {
 	Inspect(cmd *cobra.Command, args []string) error
 	Console(cmd *cobra.Command, args []string) error
 	Exec(cmd *cobra.Command, args []string) error
+	Cp(cmd *cobra.Command, args []string) error
+	PortForward(cmd *cobra.Command, args []string) error
+	Wait(cmd *cobra.Command, args []string) error
+	Health(cmd *cobra.Command, args []string) error
 	Logs(cmd *cobra.Command, args []string) error
 	RM(cmd *cobra.Command, args []string) error
 	Restore(cmd *cobra.Command, args []string) error
 	Debug(cmd *cobra.Command, args []string) error
 	Status(cmd *cobra.Command, args []string) error
+	Stats(cmd *cobra.Command, args []string) error
+	Pcap(cmd *cobra.Command, args []string) error
 	FsAttach(cmd *cobra.Command, args []string) error
 	FsDetach(cmd *cobra.Command, args []string) error
 	DeviceAttach(cmd *cobra.Command, args []string) error
 	DeviceDetach(cmd *cobra.Command, args []string) error
 	NetResize(cmd *cobra.Command, args []string) error
+	PortAdd(cmd *cobra.Command, args []string) error
+	PortRm(cmd *cobra.Command, args []string) error
+	PortLs(cmd *cobra.Command, args []string) error
+	FirewallApply(cmd *cobra.Command, args []string) error
+	FirewallShow(cmd *cobra.Command, args []string) error
 }
 
 func Command(h Actions) *cobra.Command {
@@ -43,6 +56,9 @@ func Command(h Actions) *cobra.Command {
 		RunE:  h.Create,
 	}
 	addVMFlags(createCmd)
+	addNICFlag(createCmd)
+	addPublishFlag(createCmd)
+	addFirewallFlags(createCmd)
 	cmdcore.AddOutputFlag(createCmd)
 
 	runCmd := &cobra.Command{
@@ -52,6 +68,9 @@ func Command(h Actions) *cobra.Command {
 		RunE:  h.Run,
 	}
 	addVMFlags(runCmd)
+	addNICFlag(runCmd)
+	addPublishFlag(runCmd)
+	addFirewallFlags(runCmd)
 	cmdcore.AddOutputFlag(runCmd)
 
 	cloneCmd := &cobra.Command{
@@ -61,6 +80,10 @@ func Command(h Actions) *cobra.Command {
 		RunE:  h.Clone,
 	}
 	addCloneFlags(cloneCmd)
+	addNICFlag(cloneCmd)
+	addPublishFlag(cloneCmd)
+	addFirewallFlags(cloneCmd)
+	cloneCmd.Flags().Bool("inherit-firewall", false, "keep the snapshot's firewall (default: none unless --firewall/--allow/--deny-egress)")
 	cmdcore.AddOutputFlag(cloneCmd)
 
 	startCmd := &cobra.Command{
@@ -95,6 +118,8 @@ func Command(h Actions) *cobra.Command {
 		Args:  cobra.ExactArgs(1),
 		RunE:  h.Inspect,
 	}
+	inspectCmd.Flags().Bool("guest", false, "add a guest section (OS, kernel, uptime, load, memory, disks, IPs, users) read via cocoon-agent")
+	inspectCmd.Flags().Duration("guest-timeout", 5*time.Second, "give up on the guest section after this long") //nolint:mnd
 
 	consoleCmd := &cobra.Command{
 		Use:   "console VM",
@@ -111,6 +136,43 @@ func Command(h Actions) *cobra.Command {
 		RunE:  h.Exec,
 	}
 	execCmd.Flags().StringArrayP("env", "e", nil, "extra env var KEY=VALUE (repeatable)")
+	execCmd.Flags().BoolP("interactive", "i", false, "with -t, forward the local terminal as stdin")
+	execCmd.Flags().BoolP("tty", "t", false, "allocate a guest PTY (script(1)); with -i the local terminal goes raw")
+	execCmd.Flags().String("escape-char", "^]", "detach escape character for -it (single char or ^X caret notation)")
+
+	cpCmd := &cobra.Command{
+		Use:   "cp [flags] SRC VM:DST | VM:SRC DST",
+		Short: "Copy files or directories between the host and a running VM via cocoon-agent (vsock)",
+		Args:  cobra.ExactArgs(2),
+		RunE:  h.Cp,
+	}
+	cpCmd.Flags().BoolP("quiet", "q", false, "suppress the progress counter")
+
+	portForwardCmd := &cobra.Command{
+		Use:   "port-forward [flags] VM [LOCAL:]REMOTE [...]",
+		Short: "Forward host ports to guest-local ports via cocoon-agent (vsock; works without NICs)",
+		Args:  cobra.MinimumNArgs(2),
+		RunE:  h.PortForward,
+	}
+	portForwardCmd.Flags().String("address", "127.0.0.1", "host address to listen on")
+
+	waitCmd := &cobra.Command{
+		Use:   "wait [flags] VM",
+		Short: "Block until a VM is running, its agent answers, a guest port listens, a command succeeds, or it is healthy",
+		Args:  cobra.ExactArgs(1),
+		RunE:  h.Wait,
+	}
+	waitCmd.Flags().StringArray("for", nil, "condition: running, agent, healthy, tcp:PORT or exec:CMD (repeatable, checked in order; default running)")
+	waitCmd.Flags().Duration("timeout", 60*time.Second, "total time allowed for all conditions") //nolint:mnd
+	waitCmd.Flags().Duration("interval", time.Second, "delay between probes")
+
+	healthCmd := &cobra.Command{
+		Use:   "health [flags] [VM...]",
+		Short: "Run --health-cmd checks now; --watch keeps checking until interrupted",
+		RunE:  h.Health,
+	}
+	healthCmd.Flags().BoolP("watch", "w", false, "keep running due checks until interrupted (run as a service for always-on health)")
+	cmdcore.AddFormatFlag(healthCmd)
 
 	logsCmd := &cobra.Command{
 		Use:   "logs [flags] VM",
@@ -146,6 +208,9 @@ func Command(h Actions) *cobra.Command {
 	}
 	restoreCmd.Flags().Bool("on-demand", false, "use UFFD on-demand memory loading for faster restore (CH only; snapshot file must remain on disk)")
 	restoreCmd.Flags().String("from-dir", "", "restore from a snapshot directory (must contain snapshot.json) instead of the local snapshot DB; mutually exclusive with positional SNAPSHOT")
+	restoreCmd.Flags().Bool("no-verify", false, "skip the sha256 manifest check of --from-dir data files")
+	restoreCmd.Flags().String("decrypt-key", "", "age identity file for an encrypted --from-dir export")
+	restoreCmd.Flags().String("clock-sync", "", "guest clock step after resume: agent, ptp or off (empty = keep the VM's setting)")
 	restoreCmd.Flags().Bool("force", false, "skip the snapshot-belongs-to-VM check (only meaningful with --from-dir; risk of restoring to an unrelated lineage)")
 	cmdcore.AddOutputFlag(restoreCmd)
 
@@ -171,6 +236,28 @@ func Command(h Actions) *cobra.Command {
 	statusCmd.Flags().Bool("event", false, "event stream mode (append changes instead of refreshing); implies polling")
 	statusCmd.Flags().String("format", "", "output format: json (one-shot + event modes; --watch always renders a table)")
 
+	statsCmd := &cobra.Command{
+		Use:   "stats VM [VM...]",
+		Short: "Show a running VM's CPU time and NIC and disk I/O counters; --watch adds per-second rates",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  h.Stats,
+	}
+	statsCmd.Flags().BoolP("watch", "w", false, "resample every interval (tables show rates; json prints one line per VM per sample)")
+	statsCmd.Flags().IntP("interval", "n", 2, "sample interval in seconds (only with --watch)") //nolint:mnd
+	cmdcore.AddFormatFlag(statsCmd)
+
+	pcapCmd := &cobra.Command{
+		Use:   "pcap VM",
+		Short: "Capture a running VM NIC's traffic as pcapng (to stdout by default, e.g. | wireshark -k -i -)",
+		Args:  cobra.ExactArgs(1),
+		RunE:  h.Pcap,
+	}
+	pcapCmd.Flags().Int("nic", 0, "index of the NIC to capture, as listed by vm inspect")
+	pcapCmd.Flags().String("filter", "", `capture filter in a subset of tcpdump syntax: ip, ip6, arp, icmp, icmp6, tcp, udp, [src|dst] host ADDR, `+
+		`[src|dst] net CIDR, [tcp|udp] [src|dst] port N, ether [src|dst] host MAC, with and/or/not and parentheses `+
+		`(e.g. "tcp port 22 and not host 10.0.0.1")`)
+	pcapCmd.Flags().StringP("write", "w", "-", `pcapng output file ("-" for stdout)`)
+
 	vmCmd.AddCommand(
 		createCmd,
 		runCmd,
@@ -181,14 +268,22 @@ func Command(h Actions) *cobra.Command {
 		inspectCmd,
 		consoleCmd,
 		execCmd,
+		cpCmd,
+		portForwardCmd,
+		waitCmd,
+		healthCmd,
 		logsCmd,
 		rmCmd,
 		restoreCmd,
 		debugCmd,
 		statusCmd,
+		statsCmd,
+		pcapCmd,
 		buildFsCommand(h),
 		buildDeviceCommand(h),
 		buildNetCommand(h),
+		buildPortCommand(h),
+		buildFirewallCommand(h),
 	)
 	return vmCmd
 }
@@ -206,6 +301,68 @@ func buildNetCommand(h Actions) *cobra.Command {
 	return cmd
 }
 
+func buildPortCommand(h Actions) *cobra.Command {
+	parent := &cobra.Command{
+		Use:   "port",
+		Short: "Manage a VM's published host ports (nftables DNAT to its CNI address)",
+	}
+
+	add := &cobra.Command{
+		Use:   "add VM [HOST_IP:]HOST_PORT:GUEST_PORT[/tcp|udp]...",
+		Short: "Publish guest ports on the host; applied at once if the VM is running",
+		Args:  cobra.MinimumNArgs(2),
+		RunE:  h.PortAdd,
+	}
+	cmdcore.AddOutputFlag(add)
+
+	rm := &cobra.Command{
+		Use:   "rm VM [HOST_IP:]HOST_PORT[:GUEST_PORT][/tcp|udp]...",
+		Short: "Unpublish host ports; applied at once if the VM is running",
+		Args:  cobra.MinimumNArgs(2),
+		RunE:  h.PortRm,
+	}
+	cmdcore.AddOutputFlag(rm)
+
+	ls := &cobra.Command{
+		Use:     "ls VM",
+		Aliases: []string{"list"},
+		Short:   "List a VM's published ports",
+		Args:    cobra.ExactArgs(1),
+		RunE:    h.PortLs,
+	}
+	cmdcore.AddFormatFlag(ls)
+
+	parent.AddCommand(add, rm, ls)
+	return parent
+}
+
+func buildFirewallCommand(h Actions) *cobra.Command {
+	parent := &cobra.Command{
+		Use:   "firewall",
+		Short: "Manage a VM's firewall (TC filters on the host side of its NICs)",
+	}
+
+	apply := &cobra.Command{
+		Use:   "apply VM",
+		Short: "Replace a VM's firewall; applied at once if its NICs are plumbed",
+		Args:  cobra.ExactArgs(1),
+		RunE:  h.FirewallApply,
+	}
+	addFirewallFlags(apply)
+	apply.Flags().Bool("clear", false, "remove the firewall (allow everything)")
+	cmdcore.AddOutputFlag(apply)
+
+	show := &cobra.Command{
+		Use:   "show VM",
+		Short: "Print a VM's firewall as JSON (the --firewall file format)",
+		Args:  cobra.ExactArgs(1),
+		RunE:  h.FirewallShow,
+	}
+
+	parent.AddCommand(apply, show)
+	return parent
+}
+
 func buildFsCommand(h Actions) *cobra.Command {
 	parent := &cobra.Command{
 		Use:   "fs",
@@ -282,12 +439,19 @@ func addVMFlags(cmd *cobra.Command) {
 	cmd.Flags().Int("disk-queue-size", 0, "virtio-blk ring depth per device (0 = default 512; CH only, ignored by FC)")                                                //nolint:mnd
 	cmd.Flags().String("network", "", "CNI conflist name (empty = default); mutually exclusive with --bridge")
 	cmd.Flags().String("bridge", "", "use TAP-on-bridge instead of CNI (value is bridge device, e.g. cni0); VM gets IP via DHCP from the bridge")
+	cmd.Flags().String("bridge-ipam", "", "let cocoon manage --bridge's addresses: allocate from this IPv4 subnet and serve DHCP and VM-name DNS (e.g. 192.168.100.0/24)")
+	cmd.Flags().Bool("passt", false, "user-mode networking via passt: outbound NAT, DHCP and --publish without CNI, bridges or TAPs (CH only; implies --shared-memory)")
+	cmd.Flags().String("macvtap", "", "put NICs directly on a host interface's L2 segment via macvtap: PARENT[,mode=bridge|passthru] (CH only; guests take addresses from the parent's network)")
+	cmd.Flags().Bool("vhost-user", false, "attach NICs to a userspace switch (e.g. OVS-DPDK) over vhost-user; ports come from vhost_user_hook (CH only; needs --shared-memory)")
 	cmd.Flags().String("user", "root", "guest username for cloud-init (cloudimg only)")
 	cmd.Flags().String("password", "cocoon", "guest password for cloud-init (cloudimg only)")
 	cmd.Flags().Bool("no-direct-io", false, "disable O_DIRECT on writable disks (use page cache instead; CH only)")
 	cmd.Flags().Bool("windows", false, "Windows guest (UEFI boot, kvm_hyperv=on, no cidata)")
 	cmd.Flags().Bool("shared-memory", false, "enable CH memory shared=on; required to attach vhost-user-fs later (CH only, fixed for VM lifetime)")
 	cmd.Flags().StringArray("data-disk", nil, "extra data disk: size=20G[,name=...][,fstype=ext4|none][,mount=/mnt/x][,directio=on|off|auto]; repeatable")
+	cmd.Flags().String("clock-sync", types.ClockSyncAgent, "guest clock step after clone/restore: agent (host time via cocoon-agent), ptp (KVM PTP clock via cocoon-agent, needs linuxptp) or off")
+	addHealthFlags(cmd, "")
+	addGuestDataFlags(cmd)
 }
 
 func addCloneFlags(cmd *cobra.Command) {
@@ -297,8 +461,47 @@ func addCloneFlags(cmd *cobra.Command) {
 	cmd.Flags().Int("disk-queue-size", 0, "virtio-blk ring depth per device (0 = inherit from snapshot)") //nolint:mnd
 	cmd.Flags().String("network", "", "CNI conflist name (empty = inherit from source VM)")
 	cmd.Flags().String("bridge", "", "use TAP-on-bridge instead of CNI (value is bridge device, e.g. cni0)")
+	cmd.Flags().Bool("vhost-user", false, "attach NICs to a userspace switch over vhost-user via vhost_user_hook (CH only; the snapshot needs --shared-memory)")
 	cmd.Flags().Bool("no-direct-io", false, "disable O_DIRECT on writable disks (inherit from snapshot if not set)")
 	cmd.Flags().Bool("on-demand", false, "use UFFD on-demand memory loading for faster clone (CH only; snapshot file must remain on disk)")
 	cmd.Flags().Bool("pull", false, "auto-pull base image if not found locally (for cross-node clone)")
 	cmd.Flags().String("from-dir", "", "clone from a snapshot directory (must contain snapshot.json) instead of the local snapshot DB; mutually exclusive with positional SNAPSHOT")
+	cmd.Flags().Bool("no-verify", false, "skip the sha256 manifest check of --from-dir data files")
+	cmd.Flags().String("decrypt-key", "", "age identity file for an encrypted --from-dir export")
+	cmd.Flags().String("clock-sync", "", "guest clock step after resume: agent, ptp or off (empty = inherit from snapshot)")
+	addHealthFlags(cmd, " (default: inherit from snapshot)")
+	// Only keys: a clone resumes a guest whose cloud-init already ran, so user-data would never be read.
+	cmd.Flags().StringArray("ssh-key", nil, "authorized_keys file added to the snapshot's keys and installed for root via cocoon-agent (repeatable)")
+	cmd.Flags().Duration("identity-timeout", 30*time.Second, "wait this long for cocoon-agent to reset hostname/machine-id/network in the clone (0 = skip and print manual steps)") //nolint:mnd
+}
+
+// addNICFlag registers --nic for create/run/clone; each request describes the next NIC, starting at eth0.
+func addNICFlag(cmd *cobra.Command) {
+	cmd.Flags().StringArray("nic", nil, "configure a NIC: ip=ADDR,mac=MAC and network=CONFLIST or bridge=BRIDGE (all keys optional; repeatable, one per NIC in order)")
+}
+
+// addPublishFlag registers --publish for create/run/clone; debug has no host to install rules on.
+func addPublishFlag(cmd *cobra.Command) {
+	cmd.Flags().StringArrayP("publish", "p", nil, "publish a guest port on the host: [HOST_IP:]HOST_PORT:GUEST_PORT[/tcp|udp] (repeatable; CNI, --bridge-ipam or --passt networks; needs nft unless --passt)")
+}
+
+// addFirewallFlags registers the firewall flags for create/run/clone and `vm firewall apply`.
+func addFirewallFlags(cmd *cobra.Command) {
+	cmd.Flags().String("firewall", "", "firewall JSON file: ingress/egress policies and ordered rules (see README)")
+	cmd.Flags().StringArray("allow", nil, "allow inbound PROTO[:PORTS][@CIDR] and deny all other inbound, e.g. tcp:22,443 (repeatable)")
+	cmd.Flags().StringArray("deny-egress", nil, "deny outbound traffic to these comma-separated CIDRs (repeatable)")
+}
+
+// addGuestDataFlags registers --ssh-key and the cloud-init data files for create/run/debug.
+func addGuestDataFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArray("ssh-key", nil, "authorized_keys file to install for the guest user (repeatable; cloud-init for cloudimg, cocoon-agent into root for OCI)")
+	cmd.Flags().String("user-data", "", "cloud-init user-data file merged after cocoon's cloud-config (#cloud-config, #! script, ...; cloudimg only)")
+	cmd.Flags().String("vendor-data", "", "cloud-init vendor-data file (cloudimg only)")
+}
+
+// addHealthFlags registers the --health-* trio; suffix notes clone-time inheritance.
+func addHealthFlags(cmd *cobra.Command, suffix string) {
+	cmd.Flags().String("health-cmd", "", "guest shell command run via cocoon-agent by `vm health`, `vm status` watchers, and `vm wait --for healthy`; exit 0 = healthy"+suffix)
+	cmd.Flags().Duration("health-interval", types.DefaultHealthInterval, "time between health checks"+suffix)
+	cmd.Flags().Int("health-retries", types.DefaultHealthRetries, "consecutive failed checks before the VM is unhealthy"+suffix)
 }
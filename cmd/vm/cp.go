@@ -0,0 +1,255 @@
+package vm
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/projecteru2/core/log"
+	"github.com/spf13/cobra"
+
+	"github.com/cocoonstack/cocoon/agent"
+	cmdcore "github.com/cocoonstack/cocoon/cmd/core"
+	"github.com/cocoonstack/cocoon/utils"
+)
+
+// cpProgressInterval is the minimum time between progress redraws.
+const cpProgressInterval = 200 * time.Millisecond
+
+// Cp copies files between the host and a running VM by streaming tar through cocoon-agent.
+func (h Handler) Cp(cmd *cobra.Command, args []string) error {
+	ctx, conf, err := h.Init(cmd)
+	if err != nil {
+		return err
+	}
+	logger := log.WithFunc("cmd.vm.cp")
+
+	srcVM, srcPath, srcInGuest := splitGuestPath(args[0])
+	dstVM, dstPath, dstInGuest := splitGuestPath(args[1])
+	if srcInGuest == dstInGuest {
+		return fmt.Errorf("cp: exactly one of SRC and DST must be VM:PATH")
+	}
+	ref := dstVM
+	if srcInGuest {
+		ref = srcVM
+	}
+	info, err := agentVM(ctx, conf, ref)
+	if err != nil {
+		return fmt.Errorf("cp: %w", err)
+	}
+
+	quiet, _ := cmd.Flags().GetBool("quiet")
+	progress := newCopyProgress(!quiet)
+	if dstInGuest {
+		err = copyToGuest(ctx, info.VsockSocket, srcPath, dstPath, progress, logger)
+	} else {
+		err = copyFromGuest(ctx, info.VsockSocket, srcPath, dstPath, progress)
+	}
+	progress.finish()
+	if err != nil {
+		return fmt.Errorf("cp: %w", err)
+	}
+	logger.Infof(ctx, "copied %s to %s (%s in %s)", args[0], args[1],
+		cmdcore.FormatSize(progress.n.Load()), time.Since(progress.start).Round(time.Millisecond))
+	return nil
+}
+
+// splitGuestPath parses "VM:PATH". A colon after a slash (./a:b, /tmp/x:y) is part of a host path.
+func splitGuestPath(arg string) (vm, p string, inGuest bool) {
+	i := strings.Index(arg, ":")
+	if i <= 0 || strings.Contains(arg[:i], "/") {
+		return "", arg, false
+	}
+	return arg[:i], arg[i+1:], true
+}
+
+// copyToGuest streams hostSrc as tar into `tar -x` in the guest. Like cp(1), an existing guest directory (or a
+// DST ending in /) receives SRC under its own name; otherwise DST is the new name.
+func copyToGuest(ctx context.Context, vsock, hostSrc, guestDst string, progress *copyProgress, logger *log.Fields) error {
+	abs, err := filepath.Abs(hostSrc)
+	if err != nil {
+		return err
+	}
+	if _, err = os.Lstat(abs); err != nil {
+		return err
+	}
+	if guestDst == "" {
+		return fmt.Errorf("empty guest path")
+	}
+	out, err := agent.Shell(ctx, vsock, fmt.Sprintf("if [ -d %s ]; then echo dir; fi", shellQuote(guestDst)))
+	if err != nil {
+		return fmt.Errorf("stat guest %s: %w", guestDst, err)
+	}
+	extractDir, name := path.Dir(guestDst), path.Base(guestDst)
+	if strings.TrimSpace(out) == "dir" || strings.HasSuffix(guestDst, "/") {
+		extractDir, name = guestDst, filepath.Base(abs)
+	}
+
+	pr, pw := io.Pipe()
+	var sparse []string
+	tarDone := make(chan error, 1)
+	go func() {
+		tw := tar.NewWriter(progress.writer(pw))
+		var tarErr error
+		if sparse, tarErr = utils.TarTree(tw, abs, name); tarErr == nil {
+			tarErr = tw.Close()
+		}
+		pw.CloseWithError(tarErr) //nolint:errcheck,gosec
+		tarDone <- tarErr
+	}()
+
+	script := fmt.Sprintf("set -eu\nmkdir -p %s\ncd %s\ntar -x -o -f -\n", shellQuote(extractDir), shellQuote(extractDir))
+	var stderr bytes.Buffer
+	code, runErr := agent.Run(ctx, vsock, []string{"/bin/sh", "-c", script}, nil, pr, io.Discard, &stderr)
+	pr.Close() //nolint:errcheck,gosec // unblocks the tar writer if the guest stopped reading early
+	tarErr := <-tarDone
+	switch {
+	case runErr != nil:
+		return runErr
+	case code != 0:
+		return fmt.Errorf("guest tar exited %d: %s", code, strings.TrimSpace(stderr.String()))
+	case tarErr != nil:
+		return tarErr
+	}
+	if len(sparse) > 0 {
+		if _, err := agent.Shell(ctx, vsock, digHolesScript(extractDir, sparse)); err != nil {
+			logger.Warnf(ctx, "copied %d sparse file(s) fully allocated, holes not restored: %v", len(sparse), err)
+		}
+	}
+	return nil
+}
+
+// digHolesScript re-punches the zero runs of files that were sparse on the host (tar writes holes out as zeros).
+func digHolesScript(dir string, files []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "set -eu\ncd %s\ncommand -v fallocate >/dev/null 2>&1 || { echo 'fallocate not found' >&2; exit 1; }\n", shellQuote(dir))
+	for _, f := range files {
+		fmt.Fprintf(&b, "fallocate --dig-holes %s\n", shellQuote(f))
+	}
+	return b.String()
+}
+
+// copyFromGuest runs `tar -c` in the guest (GNU tar -S when available, so holes stay holes) and extracts on the host.
+func copyFromGuest(ctx context.Context, vsock, guestSrc, hostDst string, progress *copyProgress) error {
+	if guestSrc == "" {
+		return fmt.Errorf("empty guest path")
+	}
+	extractDir, top := hostDst, ""
+	fi, err := os.Stat(hostDst)
+	switch {
+	case err == nil && fi.IsDir():
+	case err == nil || errors.Is(err, fs.ErrNotExist):
+		if strings.HasSuffix(hostDst, "/") {
+			if err = os.MkdirAll(hostDst, 0o750); err != nil {
+				return err
+			}
+			break
+		}
+		extractDir, top = filepath.Dir(hostDst), filepath.Base(hostDst)
+	default:
+		return err
+	}
+
+	clean := path.Clean(guestSrc)
+	script := fmt.Sprintf("set -eu\nS=\nif tar --sparse --version >/dev/null 2>&1; then S=S; fi\ncd %s\nexec tar -c${S}f - %s\n",
+		shellQuote(path.Dir(clean)), shellQuote(path.Base(clean)))
+
+	pr, pw := io.Pipe()
+	extractDone := make(chan error, 1)
+	go func() {
+		extractErr := utils.ExtractTree(extractDir, progress.reader(pr), top)
+		if extractErr == nil {
+			// GNU tar pads the archive to its record size past the end-of-archive blocks.
+			_, extractErr = io.Copy(io.Discard, pr)
+		}
+		pr.CloseWithError(extractErr) //nolint:errcheck,gosec
+		extractDone <- extractErr
+	}()
+
+	var stderr bytes.Buffer
+	code, runErr := agent.Run(ctx, vsock, []string{"/bin/sh", "-c", script}, nil, strings.NewReader(""), pw, &stderr)
+	pw.Close() //nolint:errcheck,gosec
+	extractErr := <-extractDone
+	switch {
+	case code != 0:
+		return fmt.Errorf("guest tar exited %d: %s", code, strings.TrimSpace(stderr.String()))
+	case extractErr != nil:
+		return extractErr
+	}
+	return runErr
+}
+
+// copyProgress counts tar stream bytes and redraws a counter on stderr.
+type copyProgress struct {
+	enabled bool
+	start   time.Time
+	n       atomic.Int64
+	last    atomic.Int64 // unix nanos of the last redraw
+	drawn   atomic.Bool
+}
+
+func newCopyProgress(enabled bool) *copyProgress {
+	return &copyProgress{enabled: enabled, start: time.Now()}
+}
+
+func (p *copyProgress) add(n int) {
+	total := p.n.Add(int64(n))
+	if !p.enabled {
+		return
+	}
+	now := time.Now().UnixNano()
+	if last := p.last.Load(); now-last < int64(cpProgressInterval) || !p.last.CompareAndSwap(last, now) {
+		return
+	}
+	p.drawn.Store(true)
+	fmt.Fprintf(os.Stderr, "\r  %s copied (%s/s)", cmdcore.FormatSize(total), cmdcore.FormatSize(p.rate(total))) //nolint:errcheck
+}
+
+func (p *copyProgress) rate(n int64) int64 {
+	elapsed := time.Since(p.start).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return int64(float64(n) / elapsed)
+}
+
+func (p *copyProgress) finish() {
+	if p.drawn.Load() {
+		fmt.Fprintln(os.Stderr) //nolint:errcheck
+	}
+}
+
+func (p *copyProgress) writer(w io.Writer) io.Writer { return progressWriter{w, p} }
+func (p *copyProgress) reader(r io.Reader) io.Reader { return progressReader{r, p} }
+
+type progressWriter struct {
+	w io.Writer
+	p *copyProgress
+}
+
+func (pw progressWriter) Write(b []byte) (int, error) {
+	n, err := pw.w.Write(b)
+	pw.p.add(n)
+	return n, err
+}
+
+type progressReader struct {
+	r io.Reader
+	p *copyProgress
+}
+
+func (pr progressReader) Read(b []byte) (int, error) {
+	n, err := pr.r.Read(b)
+	pr.p.add(n)
+	return n, err
+}
@@ -0,0 +1,40 @@
+package vm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitGuestPath(t *testing.T) {
+	tests := []struct {
+		arg, vm, path string
+		inGuest       bool
+	}{
+		{arg: "web:/etc/hosts", vm: "web", path: "/etc/hosts", inGuest: true},
+		{arg: "web:", vm: "web", path: "", inGuest: true},
+		{arg: "./notes.txt", path: "./notes.txt"},
+		{arg: "./a:b", path: "./a:b"},
+		{arg: "/tmp/x:y", path: "/tmp/x:y"},
+		{arg: ":/etc", path: ":/etc"},
+	}
+	for _, tt := range tests {
+		vm, p, inGuest := splitGuestPath(tt.arg)
+		if vm != tt.vm || p != tt.path || inGuest != tt.inGuest {
+			t.Errorf("splitGuestPath(%q) = (%q, %q, %v), want (%q, %q, %v)", tt.arg, vm, p, inGuest, tt.vm, tt.path, tt.inGuest)
+		}
+	}
+}
+
+func TestDigHolesScript(t *testing.T) {
+	script := digHolesScript("/var/lib/my data", []string{"images/disk.img", "it's.raw"})
+	for _, want := range []string{
+		"cd '/var/lib/my data'",
+		"fallocate --dig-holes 'images/disk.img'",
+		`fallocate --dig-holes 'it'\''s.raw'`,
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("script missing %q:\n%s", want, script)
+		}
+	}
+	assertShellSyntax(t, script)
+}
@@ -1,27 +1,18 @@
 package vm
 
 import (
-	"context"
-	"errors"
+	"cmp"
 	"fmt"
 	"io"
-	"net"
 	"os"
 	"strings"
 
 	"github.com/spf13/cobra"
 
 	"github.com/cocoonstack/cocoon-agent/client"
-	cmdcore "github.com/cocoonstack/cocoon/cmd/core"
-	"github.com/cocoonstack/cocoon/hypervisor"
-	"github.com/cocoonstack/cocoon/types"
+	"github.com/cocoonstack/cocoon/agent"
 )
 
-const hybridVsockReplyMax = 256
-
-// ErrVsockNotConfigured is returned for VMs predating vsock support (e.g. restored from a legacy snapshot).
-var ErrVsockNotConfigured = errors.New("vsock not configured for this VM")
-
 // ExecExitError carries the agent child's exit code for host-shell propagation.
 type ExecExitError struct{ Code int }
 
@@ -40,20 +31,10 @@ func (h Handler) Exec(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("exec: no command given")
 	}
 
-	hyper, err := cmdcore.FindHypervisor(ctx, conf, ref)
+	info, err := agentVM(ctx, conf, ref)
 	if err != nil {
 		return fmt.Errorf("exec: %w", err)
 	}
-	info, err := hyper.Inspect(ctx, ref)
-	if err != nil {
-		return fmt.Errorf("exec: inspect: %w", err)
-	}
-	if info.State != types.VMStateRunning {
-		return fmt.Errorf("exec: %w", hypervisor.ErrNotRunning)
-	}
-	if info.VsockSocket == "" {
-		return fmt.Errorf("exec: %w (recreate the VM to enable agent exec)", ErrVsockNotConfigured)
-	}
 
 	envPairs, _ := cmd.Flags().GetStringArray("env")
 	env, err := parseExecEnv(envPairs)
@@ -61,14 +42,32 @@ func (h Handler) Exec(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	conn, err := dialHybridVsock(ctx, info.VsockSocket, hypervisor.VsockAgentPort)
+	interactive, _ := cmd.Flags().GetBool("interactive")
+	var stdin io.Reader = os.Stdin
+	var pty *execTTY
+	if allocTTY, _ := cmd.Flags().GetBool("tty"); allocTTY {
+		pty = newExecTTY(info.VsockSocket)
+		var restore func()
+		if ctx, argv, stdin, restore, err = pty.start(ctx, cmd, argv, interactive); err != nil {
+			return err
+		}
+		defer restore()
+		if _, ok := env["TERM"]; !ok {
+			env = withEnv(env, "TERM", cmp.Or(os.Getenv("TERM"), "xterm"))
+		}
+	}
+
+	conn, err := agent.Dial(ctx, info.VsockSocket, agent.Port)
 	if err != nil {
-		return fmt.Errorf("exec: dial agent: %w (cocoon-agent may still be starting; retry shortly)", err)
+		return fmt.Errorf("exec: dial agent: %w (cocoon-agent may still be starting; try `cocoon vm wait --for agent`)", err)
 	}
 	defer conn.Close() //nolint:errcheck
 
-	code, err := client.Run(ctx, conn, argv, env, os.Stdin, os.Stdout, os.Stderr)
+	code, err := client.Run(ctx, conn, argv, env, stdin, os.Stdout, os.Stderr)
 	if err != nil {
+		if pty != nil && pty.detached.Load() {
+			return nil
+		}
 		return fmt.Errorf("exec: %w", err)
 	}
 	if code != 0 {
@@ -79,6 +78,14 @@ func (h Handler) Exec(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+func withEnv(env map[string]string, k, v string) map[string]string {
+	if env == nil {
+		env = make(map[string]string, 1)
+	}
+	env[k] = v
+	return env
+}
+
 func parseExecEnv(pairs []string) (map[string]string, error) {
 	if len(pairs) == 0 {
 		return nil, nil
@@ -93,52 +100,3 @@ func parseExecEnv(pairs []string) (map[string]string, error) {
 	}
 	return out, nil
 }
-
-// dialHybridVsock dials the UDS + runs CONNECT-port handshake (CH/FC); ctx-aware so Ctrl+C unblocks the "OK " read while the in-guest agent is still coming up.
-func dialHybridVsock(ctx context.Context, socketPath string, port uint32) (io.ReadWriteCloser, error) {
-	var d net.Dialer
-	conn, err := d.DialContext(ctx, "unix", socketPath)
-	if err != nil {
-		return nil, err
-	}
-	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
-	defer stop()
-	if _, werr := fmt.Fprintf(conn, "CONNECT %d\n", port); werr != nil {
-		_ = conn.Close()
-		return nil, fmt.Errorf("write CONNECT: %w", werr)
-	}
-	reply, err := readHybridVsockReply(conn)
-	if err != nil {
-		_ = conn.Close()
-		if ctxErr := ctx.Err(); ctxErr != nil {
-			return nil, ctxErr
-		}
-		return nil, fmt.Errorf("read CONNECT reply: %w", err)
-	}
-	if !strings.HasPrefix(reply, "OK ") {
-		_ = conn.Close()
-		return nil, fmt.Errorf("hybrid vsock CONNECT %d: %s", port, strings.TrimSpace(reply))
-	}
-	return conn, nil
-}
-
-// readHybridVsockReply reads one '\n'-terminated line byte-by-byte; bufio would over-read into the agent's first frame.
-func readHybridVsockReply(r io.Reader) (string, error) {
-	buf := make([]byte, 0, 32)
-	one := make([]byte, 1)
-	for {
-		n, err := r.Read(one)
-		if n > 0 {
-			buf = append(buf, one[0])
-			if one[0] == '\n' {
-				return string(buf), nil
-			}
-			if len(buf) >= hybridVsockReplyMax {
-				return "", fmt.Errorf("reply line exceeds %d bytes", hybridVsockReplyMax)
-			}
-		}
-		if err != nil {
-			return "", err
-		}
-	}
-}
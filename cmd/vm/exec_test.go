@@ -1,10 +1,10 @@
 package vm
 
 import (
-	"net"
-	"os"
 	"strings"
 	"testing"
+
+	"github.com/moby/term"
 )
 
 func TestParseExecEnv(t *testing.T) {
@@ -46,97 +46,30 @@ func TestParseExecEnv(t *testing.T) {
 	}
 }
 
-func TestReadHybridVsockReply(t *testing.T) {
-	tests := []struct {
-		name    string
-		input   string
-		want    string
-		wantErr string
-	}{
-		{name: "ok line", input: "OK 1024\n", want: "OK 1024\n"},
-		{name: "stops at newline (next bytes preserved)", input: "OK 5\nLEFTOVER", want: "OK 5\n"},
-		{name: "no newline EOF", input: "OK 5", wantErr: "EOF"},
-		{name: "overflow", input: strings.Repeat("a", hybridVsockReplyMax+1), wantErr: "exceeds"},
+func TestExecTTYWrap(t *testing.T) {
+	pty := &execTTY{ttyFile: "/tmp/.cocoon-exec-abc.tty"}
+	argv := pty.wrap([]string{"bash", "-c", "echo it's"}, &term.Winsize{Height: 40, Width: 120})
+	if len(argv) != 5 || argv[0] != "/bin/sh" || argv[3] != "sh" {
+		t.Fatalf("argv = %q", argv)
 	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got, err := readHybridVsockReply(strings.NewReader(tt.input))
-			if tt.wantErr != "" {
-				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
-					t.Fatalf("got err=%v, want contains %q", err, tt.wantErr)
-				}
-				return
-			}
-			if err != nil {
-				t.Fatalf("unexpected err: %v", err)
-			}
-			if got != tt.want {
-				t.Errorf("got %q, want %q", got, tt.want)
-			}
-		})
+	inner := argv[4]
+	for _, want := range []string{"stty rows 40 cols 120", "tty > /tmp/.cocoon-exec-abc.tty", `exec 'bash' '-c' 'echo it'\''s'`} {
+		if !strings.Contains(inner, want) {
+			t.Errorf("inner missing %q: %s", want, inner)
+		}
 	}
-}
-
-// TestDialHybridVsock_ConnectHandshake spins up an in-process listener that
-// speaks the CH/FC hybrid vsock dialect (CONNECT <port>\n → OK <port>\n).
-func TestDialHybridVsock_ConnectHandshake(t *testing.T) {
-	// macOS caps unix socket paths at ~104 bytes, so t.TempDir() (long
-	// /var/folders/... path) can overflow. Use os.CreateTemp + immediate unlink.
-	f, err := os.CreateTemp("", "vsock-*.uds")
-	if err != nil {
-		t.Fatalf("create temp: %v", err)
+	if !strings.Contains(argv[2], `script -q -e -c "$1" /dev/null`) {
+		t.Errorf("outer does not run script(1):\n%s", argv[2])
 	}
-	sockPath := f.Name()
-	_ = f.Close()
-	_ = os.Remove(sockPath)
-	defer os.Remove(sockPath) //nolint:errcheck
+	assertShellSyntax(t, argv[2])
+	assertShellSyntax(t, inner)
 
-	ln, err := net.Listen("unix", sockPath)
-	if err != nil {
-		t.Fatalf("listen: %v", err)
+	if strings.Contains(pty.wrap([]string{"sh"}, nil)[4], "stty") {
+		t.Error("unknown window size should not emit stty")
 	}
-	defer ln.Close() //nolint:errcheck
-
-	tests := []struct {
-		name    string
-		reply   string
-		wantErr string
-	}{
-		{name: "OK accepted", reply: "OK 9001\n"},
-		{name: "rejected", reply: "Failed\n", wantErr: "Failed"},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			done := make(chan struct{})
-			go func() {
-				defer close(done)
-				server, aErr := ln.Accept()
-				if aErr != nil {
-					return
-				}
-				defer server.Close() //nolint:errcheck
-				buf := make([]byte, 64)
-				n, _ := server.Read(buf)
-				want := "CONNECT 1024\n"
-				if string(buf[:n]) != want {
-					t.Errorf("server got %q, want %q", buf[:n], want)
-				}
-				_, _ = server.Write([]byte(tt.reply))
-			}()
-
-			conn, err := dialHybridVsock(t.Context(), sockPath, 1024)
-			if tt.wantErr != "" {
-				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
-					t.Fatalf("got err=%v, want contains %q", err, tt.wantErr)
-				}
-				<-done
-				return
-			}
-			if err != nil {
-				t.Fatalf("unexpected err: %v", err)
-			}
-			_ = conn.Close()
-			<-done
-		})
+	resize := pty.resizeScript(&term.Winsize{Height: 50, Width: 200})
+	if !strings.Contains(resize, `stty -F "$(cat "$f")" rows 50 cols 200`) {
+		t.Errorf("resize script: %s", resize)
 	}
+	assertShellSyntax(t, resize)
 }
@@ -0,0 +1,97 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/moby/term"
+	"github.com/spf13/cobra"
+
+	"github.com/cocoonstack/cocoon/agent"
+	"github.com/cocoonstack/cocoon/console"
+	"github.com/cocoonstack/cocoon/utils"
+)
+
+// execTTY is a guest PTY session: cocoon-agent only speaks plain stdio, so the PTY is allocated in the guest by
+// script(1), and resizes are pushed with `stty -F` from a side session (the guest kernel then signals SIGWINCH).
+type execTTY struct {
+	vsock string
+	// ttyFile holds the guest PTY path, written from inside the PTY so resize sessions can find it.
+	ttyFile  string
+	detached atomic.Bool
+}
+
+func newExecTTY(vsock string) *execTTY {
+	return &execTTY{vsock: vsock, ttyFile: "/tmp/.cocoon-exec-" + utils.GenerateID() + ".tty"}
+}
+
+// wrap returns argv run under a guest PTY sized rows×cols; script -e passes the command's exit code through.
+func (t *execTTY) wrap(argv []string, ws *term.Winsize) []string {
+	var inner strings.Builder
+	if ws != nil && ws.Height > 0 && ws.Width > 0 {
+		fmt.Fprintf(&inner, "stty rows %d cols %d 2>/dev/null; ", ws.Height, ws.Width)
+	}
+	fmt.Fprintf(&inner, "tty > %s 2>/dev/null; exec", t.ttyFile)
+	for _, a := range argv {
+		inner.WriteString(" " + shellQuote(a))
+	}
+	outer := fmt.Sprintf(`command -v script >/dev/null 2>&1 || { echo "exec -t: script(1) not found in guest (install util-linux)" >&2; exit 127; }
+rc=0
+script -q -e -c "$1" /dev/null || rc=$?
+rm -f %s
+exit $rc
+`, t.ttyFile)
+	return []string{"/bin/sh", "-c", outer, "sh", inner.String()}
+}
+
+func (t *execTTY) resizeScript(ws *term.Winsize) string {
+	return fmt.Sprintf(`f=%s; [ -s "$f" ] || exit 0; stty -F "$(cat "$f")" rows %d cols %d`, t.ttyFile, ws.Height, ws.Width)
+}
+
+// start puts the local terminal in raw mode and watches SIGWINCH; with interactive stdin it also wires the escape
+// sequence, which cancels the returned ctx. The returned restore must run before anything else is printed.
+func (t *execTTY) start(ctx context.Context, cmd *cobra.Command, argv []string, interactive bool) (context.Context, []string, io.Reader, func(), error) {
+	inFd := os.Stdin.Fd()
+	var stdin io.Reader = strings.NewReader("")
+	if !interactive || !term.IsTerminal(inFd) {
+		if interactive {
+			return nil, nil, nil, nil, fmt.Errorf("exec: -it needs a terminal on stdin (drop -t for piped input)")
+		}
+		ws, _ := term.GetWinsize(os.Stdout.Fd())
+		return ctx, t.wrap(argv, ws), stdin, func() {}, nil
+	}
+
+	escapeStr, _ := cmd.Flags().GetString("escape-char")
+	escapeChar, err := console.ParseEscapeChar(escapeStr)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	ws, _ := term.GetWinsize(inFd)
+	oldState, err := term.SetRawTerminal(inFd)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("set raw mode: %w", err)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	stdin = console.DetachReader(os.Stdin, []byte{escapeChar, '.'}, func() {
+		t.detached.Store(true)
+		cancel()
+	})
+	stopResize := console.OnResize(func() {
+		if cur, wsErr := term.GetWinsize(inFd); wsErr == nil {
+			_, _ = agent.Shell(ctx, t.vsock, t.resizeScript(cur))
+		}
+	})
+	restore := func() {
+		stopResize()
+		cancel()
+		_ = term.RestoreTerminal(inFd, oldState)
+		if t.detached.Load() {
+			fmt.Fprint(os.Stderr, "\r\nDetached.\r\n") //nolint:errcheck
+		}
+	}
+	return ctx, t.wrap(argv, ws), stdin, restore, nil
+}
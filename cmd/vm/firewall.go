@@ -0,0 +1,90 @@
+package vm
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+
+	"github.com/projecteru2/core/log"
+	"github.com/spf13/cobra"
+
+	cmdcore "github.com/cocoonstack/cocoon/cmd/core"
+	"github.com/cocoonstack/cocoon/hypervisor"
+	"github.com/cocoonstack/cocoon/network/firewall"
+	"github.com/cocoonstack/cocoon/types"
+)
+
+// errFirewallRecorderUnsupported is returned when a backend cannot persist `vm firewall apply`.
+var errFirewallRecorderUnsupported = errors.New("backend does not persist firewalls")
+
+func (h Handler) FirewallApply(cmd *cobra.Command, args []string) error {
+	ctx, _, hyper, recorder, err := resolveAttacher[hypervisor.FirewallRecorder](h, cmd, args, "vm firewall apply", errFirewallRecorderUnsupported)
+	if err != nil {
+		return err
+	}
+	fw, set, err := cmdcore.FirewallFromFlags(cmd)
+	if err != nil {
+		return err
+	}
+	clearFW, _ := cmd.Flags().GetBool("clear")
+	switch {
+	case clearFW && set:
+		return fmt.Errorf("--clear and --firewall/--allow/--deny-egress are mutually exclusive")
+	case !clearFW && !set:
+		return fmt.Errorf("vm firewall apply: need --firewall, --allow, --deny-egress or --clear")
+	}
+	if fw.Empty() {
+		fw = nil
+	}
+	vm, err := hyper.Inspect(ctx, args[0])
+	if err != nil {
+		return fmt.Errorf("vm firewall apply: %w", err)
+	}
+	if backend := vm.ResolvedNetBackend(); fw != nil && (backend == types.BackendPasst || backend == types.BackendMacvtap || backend == types.BackendVhostUser) {
+		return fmt.Errorf("vm firewall apply: %s uses --%s: its NICs have no TAP to filter", vm.Config.Name, backend)
+	}
+	if err = recorder.RecordFirewall(ctx, vm.ID, fw); err != nil {
+		return fmt.Errorf("record firewall for %s: %w", vm.Config.Name, err)
+	}
+	if err = firewall.ApplyVM(vm, fw); err != nil {
+		return fmt.Errorf("firewall recorded but not applied (retried on next network setup): %w", err)
+	}
+	if done, jsonErr := cmdcore.MaybeOutputJSON(cmd, showFirewall(fw)); done {
+		return jsonErr
+	}
+	logger := log.WithFunc("cmd.vm.firewall")
+	if fw == nil {
+		logger.Infof(ctx, "%s: firewall cleared", vm.Config.Name)
+		return nil
+	}
+	logger.Infof(ctx, "%s: firewall with %d rule(s) applied", vm.Config.Name, len(fw.Rules))
+	return nil
+}
+
+func (h Handler) FirewallShow(cmd *cobra.Command, args []string) error {
+	ctx, conf, err := h.Init(cmd)
+	if err != nil {
+		return err
+	}
+	hyper, err := cmdcore.FindHypervisor(ctx, conf, args[0])
+	if err != nil {
+		return fmt.Errorf("vm firewall show: %w", err)
+	}
+	vm, err := hyper.Inspect(ctx, args[0])
+	if err != nil {
+		return fmt.Errorf("vm firewall show: %w", err)
+	}
+	return cmdcore.OutputJSON(showFirewall(vm.Config.Firewall))
+}
+
+// showFirewall spells out the defaults so the output reads as a complete policy and loads back with --firewall.
+func showFirewall(fw *types.Firewall) *types.Firewall {
+	if fw == nil {
+		fw = &types.Firewall{}
+	}
+	return &types.Firewall{
+		Ingress: cmp.Or(fw.Ingress, types.FirewallAllow),
+		Egress:  cmp.Or(fw.Egress, types.FirewallAllow),
+		Rules:   fw.Rules,
+	}
+}
@@ -0,0 +1,253 @@
+package vm
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cocoonstack/cocoon/agent"
+	"github.com/cocoonstack/cocoon/types"
+)
+
+// guestInfoSection prefixes each block of guestInfoScript output.
+const guestInfoSection = "@@cocoon "
+
+// guestInfoScript gathers everything in one agent round-trip. Every probe tolerates a missing tool (busybox, minimal
+// OCI images) so one gap only leaves its field empty.
+const guestInfoScript = `s() { echo "@@cocoon $1"; }
+s os; cat /etc/os-release 2>/dev/null
+s kernel; uname -r 2>/dev/null
+s uptime; cat /proc/uptime 2>/dev/null
+s loadavg; cat /proc/loadavg 2>/dev/null
+s meminfo; cat /proc/meminfo 2>/dev/null
+s df; df -P -k 2>/dev/null
+s links; for d in /sys/class/net/*; do [ -e "$d/address" ] && echo "${d##*/} $(cat "$d/address")"; done
+s addrs; ip -o addr show 2>/dev/null
+s users; who 2>/dev/null
+exit 0
+`
+
+// pseudoFilesystems are df sources that never hold guest data worth reporting.
+var pseudoFilesystems = []string{"tmpfs", "devtmpfs", "udev", "shm", "none", "proc", "sysfs", "cgroup", "cgroup2", "devpts"}
+
+// guestInfo is the `vm inspect --guest` section, read from inside the VM via cocoon-agent.
+type guestInfo struct {
+	OS            string           `json:"os,omitempty"`
+	Kernel        string           `json:"kernel,omitempty"`
+	UptimeSeconds float64          `json:"uptime_seconds,omitempty"`
+	Load          []float64        `json:"load,omitempty"` // 1, 5 and 15 minute averages
+	Memory        *guestMemory     `json:"memory,omitempty"`
+	Disks         []guestDisk      `json:"disks,omitempty"`
+	Interfaces    []guestInterface `json:"interfaces,omitempty"`
+	Users         []guestUser      `json:"users,omitempty"`
+	// Error explains an empty section (no agent, timeout, Windows guest); inspect itself never fails on it.
+	Error string `json:"error,omitempty"`
+}
+
+type guestMemory struct {
+	TotalBytes     int64 `json:"total_bytes"`
+	AvailableBytes int64 `json:"available_bytes"`
+	UsedBytes      int64 `json:"used_bytes"`
+}
+
+type guestDisk struct {
+	Mount      string `json:"mount"`
+	Filesystem string `json:"filesystem"`
+	SizeBytes  int64  `json:"size_bytes"`
+	UsedBytes  int64  `json:"used_bytes"`
+	AvailBytes int64  `json:"avail_bytes"`
+}
+
+// guestInterface keys guest addresses by MAC so they can be matched against the host-side network_configs.
+type guestInterface struct {
+	Name      string   `json:"name"`
+	MAC       string   `json:"mac"`
+	Addresses []string `json:"addresses,omitempty"` // CIDR notation, IPv4 and IPv6
+}
+
+type guestUser struct {
+	Name  string `json:"name"`
+	TTY   string `json:"tty,omitempty"`
+	Login string `json:"login,omitempty"` // as printed by who(1)
+}
+
+// collectGuestInfo never returns nil: failures land in Error so the host-side inspect output still prints.
+func collectGuestInfo(ctx context.Context, vm *types.VM, timeout time.Duration) *guestInfo {
+	switch {
+	case vm.State != types.VMStateRunning:
+		return &guestInfo{Error: "vm is not running"}
+	case vm.VsockSocket == "":
+		return &guestInfo{Error: agent.ErrVsockNotConfigured.Error()}
+	case vm.Config.Windows:
+		return &guestInfo{Error: "not supported for Windows guests"}
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	out, err := agent.Shell(ctx, vm.VsockSocket, guestInfoScript)
+	if err != nil {
+		if ctx.Err() != nil {
+			return &guestInfo{Error: fmt.Sprintf("cocoon-agent did not answer within %s", timeout)}
+		}
+		return &guestInfo{Error: err.Error()}
+	}
+	return parseGuestInfo(out)
+}
+
+func parseGuestInfo(out string) *guestInfo {
+	sections := map[string][]string{}
+	var cur string
+	sc := bufio.NewScanner(strings.NewReader(out))
+	for sc.Scan() {
+		line := sc.Text()
+		if name, ok := strings.CutPrefix(line, guestInfoSection); ok {
+			cur = name
+			continue
+		}
+		if cur != "" && strings.TrimSpace(line) != "" {
+			sections[cur] = append(sections[cur], line)
+		}
+	}
+
+	info := &guestInfo{
+		OS:         parseOSRelease(sections["os"]),
+		Memory:     parseMeminfo(sections["meminfo"]),
+		Disks:      parseDf(sections["df"]),
+		Interfaces: parseInterfaces(sections["links"], sections["addrs"]),
+		Users:      parseWho(sections["users"]),
+	}
+	if k := sections["kernel"]; len(k) > 0 {
+		info.Kernel = strings.TrimSpace(k[0])
+	}
+	if u := sections["uptime"]; len(u) > 0 {
+		if f := strings.Fields(u[0]); len(f) > 0 {
+			info.UptimeSeconds, _ = strconv.ParseFloat(f[0], 64)
+		}
+	}
+	if l := sections["loadavg"]; len(l) > 0 {
+		f := strings.Fields(l[0])
+		for _, field := range f[:min(3, len(f))] {
+			v, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				break
+			}
+			info.Load = append(info.Load, v)
+		}
+	}
+	return info
+}
+
+// parseOSRelease returns PRETTY_NAME, falling back to NAME VERSION_ID.
+func parseOSRelease(lines []string) string {
+	kv := map[string]string{}
+	for _, line := range lines {
+		k, v, ok := strings.Cut(line, "=")
+		if ok {
+			kv[k] = strings.Trim(v, `"'`)
+		}
+	}
+	if kv["PRETTY_NAME"] != "" {
+		return kv["PRETTY_NAME"]
+	}
+	return strings.TrimSpace(kv["NAME"] + " " + kv["VERSION_ID"])
+}
+
+func parseMeminfo(lines []string) *guestMemory {
+	kb := map[string]int64{}
+	for _, line := range lines {
+		k, v, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		if f := strings.Fields(v); len(f) > 0 {
+			n, err := strconv.ParseInt(f[0], 10, 64)
+			if err == nil {
+				kb[k] = n
+			}
+		}
+	}
+	total, ok := kb["MemTotal"]
+	if !ok {
+		return nil
+	}
+	avail, ok := kb["MemAvailable"]
+	if !ok {
+		// Kernels before 3.14 lack MemAvailable.
+		avail = kb["MemFree"] + kb["Buffers"] + kb["Cached"]
+	}
+	return &guestMemory{TotalBytes: total << 10, AvailableBytes: avail << 10, UsedBytes: (total - avail) << 10}
+}
+
+// parseDf reads POSIX `df -P -k` output, skipping the header, pseudo filesystems and zero-sized mounts.
+func parseDf(lines []string) []guestDisk {
+	var disks []guestDisk
+	for i, line := range lines {
+		f := strings.Fields(line)
+		if i == 0 || len(f) < 6 || slices.Contains(pseudoFilesystems, f[0]) {
+			continue
+		}
+		size, err1 := strconv.ParseInt(f[1], 10, 64)
+		used, err2 := strconv.ParseInt(f[2], 10, 64)
+		avail, err3 := strconv.ParseInt(f[3], 10, 64)
+		if err1 != nil || err2 != nil || err3 != nil || size == 0 {
+			continue
+		}
+		disks = append(disks, guestDisk{
+			Mount:      strings.Join(f[5:], " "),
+			Filesystem: f[0],
+			SizeBytes:  size << 10,
+			UsedBytes:  used << 10,
+			AvailBytes: avail << 10,
+		})
+	}
+	return disks
+}
+
+// parseInterfaces joins "NAME MAC" lines with `ip -o addr` output; loopback is dropped.
+func parseInterfaces(links, addrs []string) []guestInterface {
+	var ifaces []guestInterface
+	byName := map[string]int{}
+	for _, line := range links {
+		f := strings.Fields(line)
+		if len(f) != 2 || f[0] == "lo" {
+			continue
+		}
+		byName[f[0]] = len(ifaces)
+		ifaces = append(ifaces, guestInterface{Name: f[0], MAC: f[1]})
+	}
+	// ip -o addr: "2: eth0    inet 10.0.0.2/24 brd 10.0.0.255 scope global eth0\ ..."
+	for _, line := range addrs {
+		f := strings.Fields(line)
+		if len(f) < 4 || (f[2] != "inet" && f[2] != "inet6") {
+			continue
+		}
+		name, _, _ := strings.Cut(f[1], "@") // VLAN/veth names carry @parent
+		if i, ok := byName[name]; ok {
+			ifaces[i].Addresses = append(ifaces[i].Addresses, f[3])
+		}
+	}
+	return ifaces
+}
+
+// parseWho reads who(1): "root     pts/0        2026-10-18 09:12 (10.0.0.1)".
+func parseWho(lines []string) []guestUser {
+	var users []guestUser
+	for _, line := range lines {
+		f := strings.Fields(line)
+		if len(f) == 0 {
+			continue
+		}
+		u := guestUser{Name: f[0]}
+		if len(f) > 1 {
+			u.TTY = f[1]
+		}
+		if len(f) > 2 {
+			u.Login = strings.Join(f[2:], " ")
+		}
+		users = append(users, u)
+	}
+	return users
+}
@@ -0,0 +1,77 @@
+package vm
+
+import (
+	"slices"
+	"testing"
+)
+
+const sampleGuestInfo = `@@cocoon os
+PRETTY_NAME="Ubuntu 24.04.1 LTS"
+NAME="Ubuntu"
+VERSION_ID="24.04"
+@@cocoon kernel
+6.8.0-45-generic
+@@cocoon uptime
+3723.51 3690.12
+@@cocoon loadavg
+0.08 0.03 0.01 1/123 4567
+@@cocoon meminfo
+MemTotal:        2014232 kB
+MemFree:          912340 kB
+MemAvailable:    1604220 kB
+@@cocoon df
+Filesystem     1024-blocks    Used Available Capacity Mounted on
+/dev/vda1         10218772 2345678   7856794      24% /
+tmpfs               201424       0    201424       0% /run
+/dev/vdb           20511312    4096  19442640       1% /mnt/my data
+@@cocoon links
+eth0 52:54:00:12:34:56
+lo 00:00:00:00:00:00
+@@cocoon addrs
+1: lo    inet 127.0.0.1/8 scope host lo\       valid_lft forever preferred_lft forever
+2: eth0    inet 10.88.0.5/16 brd 10.88.255.255 scope global eth0\       valid_lft forever preferred_lft forever
+2: eth0    inet6 fe80::5054:ff:fe12:3456/64 scope link \       valid_lft forever preferred_lft forever
+@@cocoon users
+root     pts/0        2026-10-18 09:12 (10.88.0.1)
+`
+
+func TestParseGuestInfo(t *testing.T) {
+	info := parseGuestInfo(sampleGuestInfo)
+	if info.OS != "Ubuntu 24.04.1 LTS" || info.Kernel != "6.8.0-45-generic" || info.UptimeSeconds != 3723.51 {
+		t.Errorf("os/kernel/uptime = %q %q %v", info.OS, info.Kernel, info.UptimeSeconds)
+	}
+	if !slices.Equal(info.Load, []float64{0.08, 0.03, 0.01}) {
+		t.Errorf("load = %v", info.Load)
+	}
+	if m := info.Memory; m == nil || m.TotalBytes != 2014232<<10 || m.UsedBytes != (2014232-1604220)<<10 {
+		t.Errorf("memory = %+v", m)
+	}
+	if len(info.Disks) != 2 || info.Disks[0].Mount != "/" || info.Disks[1].Mount != "/mnt/my data" || info.Disks[1].UsedBytes != 4096<<10 {
+		t.Errorf("disks = %+v", info.Disks)
+	}
+	want := []string{"10.88.0.5/16", "fe80::5054:ff:fe12:3456/64"}
+	if len(info.Interfaces) != 1 || info.Interfaces[0].MAC != "52:54:00:12:34:56" || !slices.Equal(info.Interfaces[0].Addresses, want) {
+		t.Errorf("interfaces = %+v", info.Interfaces)
+	}
+	if len(info.Users) != 1 || info.Users[0].Name != "root" || info.Users[0].TTY != "pts/0" {
+		t.Errorf("users = %+v", info.Users)
+	}
+}
+
+func TestParseGuestInfoPartial(t *testing.T) {
+	// busybox without who/ip and an old kernel without MemAvailable.
+	info := parseGuestInfo("@@cocoon os\nNAME=Alpine Linux\nVERSION_ID=3.20.3\n@@cocoon meminfo\nMemTotal: 1000 kB\nMemFree: 100 kB\nBuffers: 50 kB\nCached: 250 kB\n@@cocoon users\n")
+	if info.OS != "Alpine Linux 3.20.3" {
+		t.Errorf("os = %q", info.OS)
+	}
+	if m := info.Memory; m == nil || m.AvailableBytes != 400<<10 {
+		t.Errorf("memory = %+v", m)
+	}
+	if info.Users != nil || info.Interfaces != nil || info.Load != nil {
+		t.Errorf("missing sections should stay empty: %+v", info)
+	}
+}
+
+func TestGuestInfoScriptSyntax(t *testing.T) {
+	assertShellSyntax(t, guestInfoScript)
+}
@@ -0,0 +1,194 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/projecteru2/core/log"
+	"github.com/spf13/cobra"
+
+	"github.com/cocoonstack/cocoon/agent"
+	cmdcore "github.com/cocoonstack/cocoon/cmd/core"
+	"github.com/cocoonstack/cocoon/hypervisor"
+	"github.com/cocoonstack/cocoon/types"
+)
+
+const (
+	// healthTick is how often the supervisor looks for due checks; per-VM cadence comes from HealthInterval.
+	healthTick = time.Second
+	// healthCheckTimeoutMax caps a single check so a hung command cannot stall the VM's next one indefinitely.
+	healthCheckTimeoutMax = 30 * time.Second
+)
+
+// healthReport is one row of `vm health` output.
+type healthReport struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	types.HealthStatus
+}
+
+// Health runs the --health-cmd of each matching running VM once and prints the results. With --watch it keeps
+// supervising until interrupted, which is the long-lived path that keeps recorded health current.
+func (h Handler) Health(cmd *cobra.Command, args []string) error {
+	ctx, conf, err := h.Init(cmd)
+	if err != nil {
+		return err
+	}
+	hypers, err := cmdcore.InitAllHypervisors(ctx, conf)
+	if err != nil {
+		return err
+	}
+	if watch, _ := cmd.Flags().GetBool("watch"); watch {
+		log.WithFunc("cmd.vm.health").Infof(ctx, "supervising health checks until interrupted")
+		superviseHealth(ctx, hypers, args)
+		return nil
+	}
+
+	var vms []*types.VM
+	for _, vm := range listAndFilter(ctx, hypers, args) {
+		if healthCheckable(vm) {
+			vms = append(vms, vm)
+		}
+	}
+	reports := make([]healthReport, len(vms))
+	var wg sync.WaitGroup
+	for i, vm := range vms {
+		wg.Go(func() {
+			health := runHealthCheck(ctx, vm)
+			recordHealth(ctx, hypers, vm, health)
+			reports[i] = healthReport{ID: vm.ID, Name: vm.Config.Name, HealthStatus: health}
+		})
+	}
+	wg.Wait()
+	return cmdcore.OutputFormatted(cmd, reports, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "ID\tNAME\tHEALTH\tSTREAK\tOUTPUT") //nolint:errcheck
+		for _, r := range reports {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", r.ID, r.Name, r.Status, r.FailingStreak, strings.ReplaceAll(r.Output, "\n", " ")) //nolint:errcheck
+		}
+	})
+}
+
+// runHealthCheck runs vm's HealthCmd once and folds the result into its previous status.
+func runHealthCheck(ctx context.Context, vm *types.VM) types.HealthStatus {
+	timeout := min(vm.Config.EffectiveHealthInterval(), healthCheckTimeoutMax)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	out, err := agent.Shell(ctx, vm.VsockSocket, vm.Config.HealthCmd)
+	if err != nil && ctx.Err() != nil {
+		out = "timed out after " + timeout.String()
+	} else if err != nil && strings.TrimSpace(out) == "" {
+		out = err.Error()
+	}
+	return nextHealth(vm, err == nil, out, time.Now().UTC())
+}
+
+// nextHealth applies one check result: a pass is healthy at once; failures turn unhealthy after HealthRetries in a row.
+// A status recorded before the VM's last start is discarded.
+func nextHealth(vm *types.VM, passed bool, output string, now time.Time) types.HealthStatus {
+	prev := types.HealthStatus{Status: types.HealthStarting}
+	if h := freshHealth(vm); h != nil {
+		prev = *h
+	}
+	if passed {
+		return types.HealthStatus{Status: types.HealthHealthy, CheckedAt: now}
+	}
+	next := types.HealthStatus{Status: prev.Status, FailingStreak: prev.FailingStreak + 1, CheckedAt: now, Output: tailOutput(output)}
+	if next.FailingStreak >= vm.Config.EffectiveHealthRetries() {
+		next.Status = types.HealthUnhealthy
+	}
+	return next
+}
+
+func tailOutput(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) > agent.OutputTail {
+		return "..." + s[len(s)-agent.OutputTail:]
+	}
+	return s
+}
+
+// recordHealth persists h via the VM's backend; backends without HealthRecorder are skipped.
+func recordHealth(ctx context.Context, hypers []hypervisor.Hypervisor, vm *types.VM, h types.HealthStatus) {
+	for _, hyper := range hypers {
+		if hyper.Type() != vm.Hypervisor {
+			continue
+		}
+		if rec, ok := hyper.(hypervisor.HealthRecorder); ok {
+			if err := rec.RecordHealth(ctx, vm.ID, h); err != nil {
+				log.WithFunc("cmd.vm.recordHealth").Warnf(ctx, "record health for %s: %v", vm.ID, err)
+			}
+		}
+		return
+	}
+}
+
+// superviseHealth runs due --health-cmd checks for running VMs until ctx ends. Due-ness is read from the persisted
+// CheckedAt, so several concurrent supervisors (e.g. `vm health --watch` and a `vm status --event` watcher) mostly
+// share the work.
+func superviseHealth(ctx context.Context, hypers []hypervisor.Hypervisor, filters []string) {
+	var (
+		mu       sync.Mutex
+		inFlight = map[string]struct{}{}
+		wg       sync.WaitGroup
+	)
+	defer wg.Wait()
+	ticker := time.NewTicker(healthTick)
+	defer ticker.Stop()
+	for {
+		for _, vm := range listAndFilter(ctx, hypers, filters) {
+			if !healthDue(vm, time.Now()) {
+				continue
+			}
+			mu.Lock()
+			_, busy := inFlight[vm.ID]
+			if !busy {
+				inFlight[vm.ID] = struct{}{}
+			}
+			mu.Unlock()
+			if busy {
+				continue
+			}
+			wg.Go(func() {
+				defer func() {
+					mu.Lock()
+					delete(inFlight, vm.ID)
+					mu.Unlock()
+				}()
+				h := runHealthCheck(ctx, vm)
+				if ctx.Err() == nil {
+					recordHealth(ctx, hypers, vm, h)
+				}
+			})
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func healthDue(vm *types.VM, now time.Time) bool {
+	if !healthCheckable(vm) {
+		return false
+	}
+	h := freshHealth(vm)
+	return h == nil || now.Sub(h.CheckedAt) >= vm.Config.EffectiveHealthInterval()
+}
+
+// healthCheckable reports whether vm has a --health-cmd and a running guest to run it in.
+func healthCheckable(vm *types.VM) bool {
+	return vm.Config.HealthCmd != "" && cmdcore.ReconcileState(vm) == string(types.VMStateRunning) && vm.VsockSocket != ""
+}
+
+// freshHealth returns vm.Health unless it predates the VM's last start.
+func freshHealth(vm *types.VM) *types.HealthStatus {
+	if h := vm.Health; h != nil && (vm.StartedAt == nil || !h.CheckedAt.Before(*vm.StartedAt)) {
+		return h
+	}
+	return nil
+}
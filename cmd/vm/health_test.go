@@ -0,0 +1,69 @@
+package vm
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/cocoonstack/cocoon/types"
+)
+
+func healthVM(retries int, health *types.HealthStatus) *types.VM {
+	started := time.Now().Add(-time.Hour)
+	return &types.VM{
+		Config:      types.VMConfig{Config: types.Config{HealthCmd: "true", HealthInterval: 10 * time.Second, HealthRetries: retries}},
+		State:       types.VMStateRunning,
+		PID:         os.Getpid(),
+		VsockSocket: "/run/vsock.sock",
+		StartedAt:   &started,
+		Health:      health,
+	}
+}
+
+func TestNextHealth(t *testing.T) {
+	now := time.Now()
+	vm := healthVM(2, nil)
+
+	h := nextHealth(vm, false, "refused", now)
+	if h.Status != types.HealthStarting || h.FailingStreak != 1 || h.Output != "refused" {
+		t.Fatalf("first failure = %+v, want starting with streak 1", h)
+	}
+	vm.Health = &h
+	h = nextHealth(vm, false, "refused", now)
+	if h.Status != types.HealthUnhealthy || h.FailingStreak != 2 {
+		t.Fatalf("second failure = %+v, want unhealthy with streak 2", h)
+	}
+	vm.Health = &h
+	h = nextHealth(vm, true, "", now)
+	if h.Status != types.HealthHealthy || h.FailingStreak != 0 || h.Output != "" {
+		t.Fatalf("pass = %+v, want healthy with streak reset", h)
+	}
+
+	// A streak recorded before the last start does not carry over.
+	stale := types.HealthStatus{Status: types.HealthUnhealthy, FailingStreak: 5, CheckedAt: vm.StartedAt.Add(-time.Minute)}
+	vm.Health = &stale
+	if h = nextHealth(vm, false, "", now); h.Status != types.HealthStarting || h.FailingStreak != 1 {
+		t.Errorf("failure after restart = %+v, want starting with streak 1", h)
+	}
+}
+
+func TestHealthDue(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name string
+		vm   *types.VM
+		want bool
+	}{
+		{name: "never checked", vm: healthVM(0, nil), want: true},
+		{name: "checked recently", vm: healthVM(0, &types.HealthStatus{Status: types.HealthHealthy, CheckedAt: now.Add(-time.Second)})},
+		{name: "interval elapsed", vm: healthVM(0, &types.HealthStatus{Status: types.HealthHealthy, CheckedAt: now.Add(-time.Minute)}), want: true},
+		{name: "no health cmd", vm: func() *types.VM { v := healthVM(0, nil); v.Config.HealthCmd = ""; return v }()},
+		{name: "no vsock", vm: func() *types.VM { v := healthVM(0, nil); v.VsockSocket = ""; return v }()},
+		{name: "stopped", vm: func() *types.VM { v := healthVM(0, nil); v.State = types.VMStateStopped; return v }()},
+	}
+	for _, tt := range tests {
+		if got := healthDue(tt.vm, now); got != tt.want {
+			t.Errorf("%s: healthDue = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/cocoonstack/cocoon/config"
+	"github.com/cocoonstack/cocoon/types"
+)
+
+// errIdentityResetSkipped means the clone was not touched (--identity-timeout 0, Windows guest) and manual hints apply.
+var errIdentityResetSkipped = errors.New("identity reset skipped")
+
+// cloneIdentity is the per-clone state pushed into a Linux guest right after resume.
+type cloneIdentity struct {
+	hostname string
+	nics     []*types.NetworkConfig
+	dns      []string
+	// fixMACs rewrites guest MACs by NIC index; FC bakes the source VM's MACs into vmstate.
+	fixMACs bool
+	// cloudimg re-runs cloud-init against the clone's regenerated cidata instead of writing networkd files.
+	cloudimg bool
+}
+
+func newCloneIdentity(vm *types.VM, dns []string) cloneIdentity {
+	return cloneIdentity{
+		hostname: vm.Config.Name,
+		nics:     vm.NetworkConfigs,
+		dns:      dns,
+		fixMACs:  vm.Hypervisor == string(config.HypervisorFirecracker),
+		cloudimg: vm.Config.ImageType == types.ImageTypeCloudImg,
+	}
+}
+
+const (
+	devOfFunc = `dev_of() { for d in /sys/class/net/*; do if [ "$(cat "$d/address")" = "$1" ]; then echo "${d##*/}"; return 0; fi; done; return 1; }`
+	// restartNetworkdLine tolerates guests without systemd, so the rest of the reset still lands.
+	restartNetworkdLine = "if command -v systemctl >/dev/null 2>&1; then systemctl restart systemd-networkd || true; fi"
+)
+
+// hostnameLine sets the hostname, falling back to /etc/hostname when hostnamectl is missing or fails (e.g. no D-Bus
+// in a minimal guest), so the network steps that follow still run.
+func hostnameLine(name string) string {
+	return fmt.Sprintf("if command -v hostnamectl >/dev/null 2>&1 && hostnamectl set-hostname %s; then :; else echo %s > /etc/hostname; hostname %s || true; fi", name, name, name)
+}
+
+// flushNICLine flushes the addresses of the NIC with mac, skipping a MAC the guest no longer has (hot-removed NIC,
+// renamed interface) instead of aborting the whole reset under set -e.
+func flushNICLine(mac string) string {
+	return fmt.Sprintf(`if dev=$(dev_of %s); then ip addr flush dev "$dev"; fi`, mac)
+}
+
+// identityScript renders the POSIX sh run by cocoon-agent: hostname, fresh machine-id, flushed addresses and
+// ARP cache, then MAC-matched systemd-networkd files (or a cloud-init re-run) for the clone's new IPs.
+func identityScript(id cloneIdentity) string {
+	var b strings.Builder
+	line := func(format string, args ...any) { fmt.Fprintf(&b, format+"\n", args...) }
+
+	line("set -eu")
+	line(devOfFunc)
+
+	name := shellQuote(id.hostname)
+	line(hostnameLine(name))
+	line("tr -d '-' < /proc/sys/kernel/random/uuid > /etc/machine-id")
+	line("if [ -f /var/lib/dbus/machine-id ] && [ ! -L /var/lib/dbus/machine-id ]; then cp /etc/machine-id /var/lib/dbus/machine-id; fi")
+
+	for i, nc := range id.nics {
+		if nc == nil || nc.MAC == "" {
+			continue
+		}
+		mac := shellQuote(nc.MAC)
+		if id.fixMACs {
+			line("if [ -e /sys/class/net/eth%d ]; then ip link set dev eth%d down && ip link set dev eth%d address %s && ip link set dev eth%d up; fi", i, i, i, mac, i)
+		}
+		line(flushNICLine(mac))
+	}
+	line("ip neigh flush all")
+	// Only the units this script writes; anything else the user put in /etc/systemd/network stays.
+	for _, nc := range id.nics {
+		if nc != nil && nc.MAC != "" {
+			line("rm -f %s", networkdUnitPath(nc.MAC))
+		}
+	}
+
+	if id.cloudimg {
+		// clean --configs arrived in cloud-init 22.3; older guests get the networkd files instead.
+		line("if cloud-init clean --help 2>&1 | grep -q -e --configs; then")
+		line("cloud-init clean --logs --seed --configs network && cloud-init init --local && cloud-init init")
+		line("cloud-init modules --mode=config")
+		line("else")
+		writeNetworkdFiles(line, id)
+		line("fi")
+	} else {
+		writeNetworkdFiles(line, id)
+	}
+	line(restartNetworkdLine)
+	return b.String()
+}
+
+// networkdUnitPath is the MAC-matched .network file the reset owns for one NIC.
+func networkdUnitPath(mac string) string {
+	return "/etc/systemd/network/10-" + strings.ReplaceAll(mac, ":", "") + ".network"
+}
+
+// writeNetworkdFiles emits one MAC-matched .network per NIC: static (every IPv4/IPv6 address) when the NIC has
+// any, DHCP otherwise.
+func writeNetworkdFiles(line func(string, ...any), id cloneIdentity) {
+	line("mkdir -p /etc/systemd/network")
+	static := false
+	for _, nc := range id.nics {
+		if nc == nil || nc.MAC == "" {
+			continue
+		}
+		unit := "[Match]\\nMACAddress=" + nc.MAC + "\\n\\n[Network]\\n"
+		if n := nc.Network; n.Static() {
+			static = true
+			for _, a := range n.All() {
+				unit += "Address=" + a.CIDR() + "\\n"
+			}
+			for _, gw := range []string{n.Gateway, n.Gateway6()} {
+				if gw != "" {
+					unit += "Gateway=" + gw + "\\n"
+				}
+			}
+			for _, s := range id.dns {
+				unit += "DNS=" + s + "\\n"
+			}
+		} else {
+			unit += "DHCP=yes\\n"
+		}
+		line("printf %s > %s", shellQuote(unit), networkdUnitPath(nc.MAC))
+	}
+	// A static resolv.conf (no resolved stub symlink) would keep the snapshot's servers.
+	if static && len(id.dns) > 0 {
+		var ns strings.Builder
+		for _, s := range id.dns {
+			ns.WriteString("nameserver " + s + "\\n")
+		}
+		line("if [ ! -L /etc/resolv.conf ]; then printf %s > /etc/resolv.conf; fi", shellQuote(ns.String()))
+	}
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
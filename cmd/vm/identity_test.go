@@ -0,0 +1,147 @@
+package vm
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cocoonstack/cocoon/config"
+	"github.com/cocoonstack/cocoon/types"
+)
+
+func identityTestVM(hyper string, imageType string) *types.VM {
+	return &types.VM{
+		Hypervisor: hyper,
+		Config:     types.VMConfig{Name: "web-clone", Config: types.Config{ImageType: imageType}},
+		NetSetup: types.NetSetup{NetworkConfigs: []*types.NetworkConfig{
+			{MAC: "52:54:00:aa:bb:01", Network: &types.Network{IP: "10.0.0.7", Prefix: 24, Gateway: "10.0.0.1"}},
+			{MAC: "52:54:00:aa:bb:02"},
+		}},
+	}
+}
+
+func TestIdentityScript_OCIStatic(t *testing.T) {
+	script := identityScript(newCloneIdentity(identityTestVM(string(config.HypervisorCH), types.ImageTypeOCI), []string{"1.1.1.1"}))
+	for _, want := range []string{
+		"hostnamectl set-hostname 'web-clone'",
+		"/proc/sys/kernel/random/uuid > /etc/machine-id",
+		`if dev=$(dev_of '52:54:00:aa:bb:01'); then ip addr flush dev "$dev"; fi`,
+		"ip neigh flush all",
+		`MACAddress=52:54:00:aa:bb:01\n\n[Network]\nAddress=10.0.0.7/24\nGateway=10.0.0.1\nDNS=1.1.1.1\n`,
+		"/etc/systemd/network/10-525400aabb01.network",
+		`MACAddress=52:54:00:aa:bb:02\n\n[Network]\nDHCP=yes\n`,
+		"nameserver 1.1.1.1",
+		"systemctl restart systemd-networkd",
+		"mkdir -p /etc/systemd/network",
+		"rm -f /etc/systemd/network/10-525400aabb01.network",
+		"rm -f /etc/systemd/network/10-525400aabb02.network",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("script missing %q:\n%s", want, script)
+		}
+	}
+	for _, unwanted := range []string{"10-*.network", "drop_caches"} {
+		if strings.Contains(script, unwanted) {
+			t.Errorf("script must not contain %q:\n%s", unwanted, script)
+		}
+	}
+	if strings.Contains(script, "ip link set dev eth0 address") {
+		t.Error("CH clone should not rewrite guest MACs")
+	}
+	if strings.Contains(script, "cloud-init") {
+		t.Error("OCI clone should not run cloud-init")
+	}
+	assertShellSyntax(t, script)
+}
+
+func TestIdentityScript_FCRewritesMACs(t *testing.T) {
+	script := identityScript(newCloneIdentity(identityTestVM(string(config.HypervisorFirecracker), types.ImageTypeOCI), nil))
+	if !strings.Contains(script, "ip link set dev eth1 address '52:54:00:aa:bb:02'") {
+		t.Errorf("FC clone must rewrite guest MACs:\n%s", script)
+	}
+	// MAC fix must precede the by-MAC lookups.
+	if strings.Index(script, "address '52:54:00:aa:bb:01'") > strings.Index(script, "dev_of '52:54:00:aa:bb:01'") {
+		t.Error("MAC rewrite runs after the by-MAC flush")
+	}
+	if strings.Contains(script, "resolv.conf") {
+		t.Error("no DNS servers configured, resolv.conf must stay untouched")
+	}
+	assertShellSyntax(t, script)
+}
+
+func TestIdentityScript_DualStack(t *testing.T) {
+	vm := identityTestVM(string(config.HypervisorCH), types.ImageTypeOCI)
+	vm.NetworkConfigs[0].Network.Addresses = []types.Address{{IP: "fd00::7", Prefix: 64, Gateway: "fd00::1"}}
+	vm.NetworkConfigs[1].Network = &types.Network{Addresses: []types.Address{{IP: "fd01::9", Prefix: 64}}}
+	script := identityScript(newCloneIdentity(vm, []string{"1.1.1.1", "2606:4700:4700::1111"}))
+	for _, want := range []string{
+		`Address=10.0.0.7/24\nAddress=fd00::7/64\nGateway=10.0.0.1\nGateway=fd00::1\nDNS=1.1.1.1\nDNS=2606:4700:4700::1111\n`,
+		`MACAddress=52:54:00:aa:bb:02\n\n[Network]\nAddress=fd01::9/64\n`,
+		"nameserver 2606:4700:4700::1111",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("script missing %q:\n%s", want, script)
+		}
+	}
+	assertShellSyntax(t, script)
+}
+
+func TestIdentityScript_CloudimgRerunsCloudInit(t *testing.T) {
+	script := identityScript(newCloneIdentity(identityTestVM(string(config.HypervisorCH), types.ImageTypeCloudImg), []string{"8.8.8.8"}))
+	if !strings.Contains(script, "cloud-init clean --logs --seed --configs network") {
+		t.Errorf("cloudimg clone should re-run cloud-init:\n%s", script)
+	}
+	// cloud-init before 22.3 has no clean --configs: the networkd files are the fallback.
+	fallback := script[strings.Index(script, "\nelse\n"):]
+	if !strings.Contains(fallback, "MACAddress=52:54:00:aa:bb:01") || strings.Index(script, "MACAddress=") < strings.Index(script, "\nelse\n") {
+		t.Errorf("networkd files should only be written when cloud-init lacks --configs:\n%s", script)
+	}
+	assertShellSyntax(t, script)
+}
+
+func TestShellQuote(t *testing.T) {
+	if got := shellQuote(`it's`); got != `'it'\''s'` {
+		t.Errorf("shellQuote = %s", got)
+	}
+}
+
+// A failing hostnamectl, a MAC the guest no longer has, or a guest without systemd must not abort the reset under
+// set -e.
+func TestIdentityScript_MissingMACAndNoSystemd(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no sh on PATH")
+	}
+	script := strings.Join([]string{
+		"set -eu",
+		"ip() { echo \"ip $*\"; }",
+		devOfFunc,
+		"hostnamectl() { return 1; }",
+		"hostname() { echo \"hostname $*\"; }",
+		// The fallback's /etc/hostname is redirected so the test never touches the host's.
+		strings.ReplaceAll(hostnameLine(shellQuote("web-clone")), "/etc/hostname", filepath.Join(t.TempDir(), "hostname")),
+		flushNICLine(shellQuote("02:00:00:de:ad:00")),
+		"PATH=/nonexistent",
+		restartNetworkdLine,
+		"echo reached",
+	}, "\n")
+	out, err := exec.Command(sh, "-c", script).CombinedOutput() //nolint:gosec
+	if err != nil {
+		t.Fatalf("script aborted: %v: %s", err, out)
+	}
+	if got := string(out); strings.Contains(got, "ip addr flush") || !strings.Contains(got, "hostname web-clone") || !strings.Contains(got, "reached") {
+		t.Errorf("got %q, want the hostname fallback, the flush skipped, and the script to finish", got)
+	}
+}
+
+func assertShellSyntax(t *testing.T, script string) {
+	t.Helper()
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no sh on PATH")
+	}
+	if out, err := exec.Command(sh, "-n", "-c", script).CombinedOutput(); err != nil { //nolint:gosec
+		t.Errorf("sh -n: %v: %s", err, out)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"slices"
 	"time"
 
 	"github.com/moby/term"
@@ -20,6 +21,9 @@ import (
 	"github.com/cocoonstack/cocoon/hypervisor"
 	"github.com/cocoonstack/cocoon/network"
 	bridgenet "github.com/cocoonstack/cocoon/network/bridge"
+	"github.com/cocoonstack/cocoon/network/macvtap"
+	"github.com/cocoonstack/cocoon/network/passt"
+	"github.com/cocoonstack/cocoon/network/vhostuser"
 	"github.com/cocoonstack/cocoon/types"
 	"github.com/cocoonstack/cocoon/utils"
 )
@@ -39,6 +43,7 @@ type attachedDevices struct {
 type inspectOutput struct {
 	*types.VM
 	AttachedDevices *attachedDevices `json:"attached_devices,omitempty"`
+	Guest           *guestInfo       `json:"guest,omitempty"`
 }
 
 func (h Handler) Start(cmd *cobra.Command, args []string) error {
@@ -60,8 +65,12 @@ func (h Handler) Start(cmd *cobra.Command, args []string) error {
 		h.recoverNetwork(ctx, conf, hyper, refs)
 	}
 
+	logger := log.WithFunc("cmd.vm.start")
 	return batchRoutedCmd(ctx, cmd, "start", "started", routed, func(hyper hypervisor.Hypervisor, refs []string) ([]string, error) {
-		return hyper.Start(ctx, refs)
+		started, startErr := hyper.Start(ctx, refs)
+		publishPortsFor(ctx, hyper, started, logger)
+		installSSHKeysFor(ctx, hyper, started, false, logger)
+		return started, startErr
 	})
 }
 
@@ -88,8 +97,12 @@ func (h Handler) Stop(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
+	logger := log.WithFunc("cmd.vm.stop")
 	return batchRoutedCmd(ctx, cmd, "stop", "stopped", routed, func(hyper hypervisor.Hypervisor, refs []string) ([]string, error) {
-		return hyper.Stop(ctx, refs)
+		published := publishedVMs(ctx, hyper, refs)
+		stopped, stopErr := hyper.Stop(ctx, refs)
+		unpublishPorts(ctx, published, stopped, logger)
+		return stopped, stopErr
 	})
 }
 
@@ -109,11 +122,23 @@ func (h Handler) Inspect(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("inspect: %w", err)
 	}
 	info.State = types.VMState(cmdcore.ReconcileState(info))
+	switch info.HealthState() {
+	case types.HealthStarting:
+		// A result from before the last start says nothing about this boot.
+		info.Health = &types.HealthStatus{Status: types.HealthStarting}
+	case types.HealthStale:
+		// Keep the last result for reference, but do not report it as current.
+		info.Health.Status = types.HealthStale
+	}
 
 	out := inspectOutput{VM: info}
 	if info.State == types.VMStateRunning {
 		out.AttachedDevices = collectAttachedDevices(ctx, hyper, args[0])
 	}
+	if guest, _ := cmd.Flags().GetBool("guest"); guest {
+		timeout, _ := cmd.Flags().GetDuration("guest-timeout")
+		out.Guest = collectGuestInfo(ctx, info, timeout)
+	}
 	return cmdcore.OutputJSON(out)
 }
 
@@ -214,7 +239,10 @@ func (h Handler) RM(cmd *cobra.Command, args []string) error {
 	wantJSON := cmdcore.WantJSON(cmd)
 	var allDeleted []string
 	var lastErr error
+	var published, vhostUser []string
 	for hyper, refs := range routed {
+		published = append(published, publishedVMs(ctx, hyper, refs)...)
+		vhostUser = append(vhostUser, vhostUserVMs(ctx, hyper, refs)...)
 		deleted, deleteErr := hyper.Delete(ctx, refs, force)
 		if !wantJSON {
 			for _, id := range deleted {
@@ -234,6 +262,11 @@ func (h Handler) RM(cmd *cobra.Command, args []string) error {
 			}
 		}
 		bridgenet.CleanupTAPs(allDeleted)
+		bridgenet.ReleaseLeases(ctx, conf.RootDir, allDeleted)
+		passt.Cleanup(ctx, conf, allDeleted)
+		macvtap.Cleanup(allDeleted)
+		vhostuser.Cleanup(ctx, conf, slices.DeleteFunc(vhostUser, func(id string) bool { return !slices.Contains(allDeleted, id) }))
+		unpublishPorts(ctx, published, allDeleted, logger)
 	}
 
 	if lastErr != nil {
@@ -248,8 +281,21 @@ func (h Handler) RM(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// vhostUserVMs returns the ids of vhost-user VMs, read before rm so only their ports go to the hook.
+func vhostUserVMs(ctx context.Context, hyper hypervisor.Hypervisor, ids []string) []string {
+	var out []string
+	for _, id := range ids {
+		if vm, err := hyper.Inspect(ctx, id); err == nil && vm.ResolvedNetBackend() == types.BackendVhostUser {
+			out = append(out, vm.ID)
+		}
+	}
+	return out
+}
+
 func (h Handler) recoverNetwork(ctx context.Context, conf *config.Config, hyper hypervisor.Hypervisor, refs []string) {
 	logger := log.WithFunc("cmd.vm.recoverNetwork")
+	// After a host reboot the forwarder is no longer running.
+	cmdcore.EnsureDiscovery(ctx, conf)
 
 	// Lazy CNI; OK to skip for bridge-only setups.
 	var cniProvider network.Network
@@ -279,7 +325,7 @@ func (h Handler) recoverNetwork(ctx context.Context, conf *config.Config, hyper
 		if backend == "" {
 			continue
 		}
-		if backend == types.BackendBridge && len(vm.NetworkConfigs) == 0 {
+		if backend != types.BackendCNI && len(vm.NetworkConfigs) == 0 {
 			continue
 		}
 		netProvider, provErr := providerForVM(conf, cniProvider, bridgeProviders, vm)
@@ -309,7 +355,17 @@ func providerForVM(conf *config.Config, cniProvider network.Network, bridgeCache
 	if vm == nil {
 		return nil, fmt.Errorf("no VM record")
 	}
-	if vm.ResolvedNetBackend() == types.BackendBridge {
+	switch vm.ResolvedNetBackend() {
+	case types.BackendPasst:
+		return cmdcore.InitPasstNetwork(conf)
+	case types.BackendVhostUser:
+		return cmdcore.InitVhostUserNetwork(conf)
+	case types.BackendMacvtap:
+		if vm.NetMacvtap == "" {
+			return nil, fmt.Errorf("macvtap backend but no --macvtap spec persisted")
+		}
+		return cmdcore.InitMacvtapNetwork(conf, vm.NetMacvtap)
+	case types.BackendBridge:
 		dev := vm.ResolvedNetBridgeDev()
 		if dev == "" {
 			return nil, fmt.Errorf("bridge backend but no bridge device persisted")
@@ -31,10 +31,12 @@ func (h Handler) NetResize(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return classifyAttachErr(err)
 	}
+	logger := log.WithFunc("cmd.vm.net")
+	// The DNAT target is the first NIC with an IPv4, which a resize may have added or removed.
+	publishPortsFor(ctx, hyper, []string{vm.ID}, logger)
 	if done, jsonErr := cmdcore.MaybeOutputJSON(cmd, res); done {
 		return jsonErr
 	}
-	logger := log.WithFunc("cmd.vm.net")
 	logger.Infof(ctx, "resized %s: before=%d after=%d added=%d removed=%d",
 		args[0], res.Before, res.After, len(res.Added), len(res.Removed))
 	for _, w := range res.Warnings {
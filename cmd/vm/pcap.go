@@ -0,0 +1,126 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/moby/term"
+	"github.com/projecteru2/core/log"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/bpf"
+
+	cmdcore "github.com/cocoonstack/cocoon/cmd/core"
+	"github.com/cocoonstack/cocoon/hypervisor"
+	"github.com/cocoonstack/cocoon/network/pcap"
+	"github.com/cocoonstack/cocoon/types"
+)
+
+// pcapSnaplen is tcpdump's default: whole packets, even with TSO/GRO super-frames on the TAP.
+const pcapSnaplen = 262144
+
+func (h Handler) Pcap(cmd *cobra.Command, args []string) error {
+	ctx, conf, err := h.Init(cmd)
+	if err != nil {
+		return err
+	}
+	hyper, err := cmdcore.FindHypervisor(ctx, conf, args[0])
+	if err != nil {
+		return fmt.Errorf("pcap: %w", err)
+	}
+	vm, err := hyper.Inspect(ctx, args[0])
+	if err != nil {
+		return fmt.Errorf("pcap: inspect: %w", err)
+	}
+	if vm.State != types.VMStateRunning {
+		return fmt.Errorf("pcap %s: %w", vm.Config.Name, hypervisor.ErrNotRunning)
+	}
+	idx, _ := cmd.Flags().GetInt("nic")
+	if idx < 0 || idx >= len(vm.NetworkConfigs) {
+		return fmt.Errorf("pcap %s: no NIC %d (VM has %d)", vm.Config.Name, idx, len(vm.NetworkConfigs))
+	}
+	nc := vm.NetworkConfigs[idx]
+	if nc.TAP == "" {
+		return fmt.Errorf("pcap %s: NIC %d uses --%s: it has no host link to capture on", vm.Config.Name, idx, vm.ResolvedNetBackend())
+	}
+	expr, _ := cmd.Flags().GetString("filter")
+	filter, err := pcap.Compile(expr, pcapSnaplen)
+	if err != nil {
+		return fmt.Errorf("pcap: filter: %w", err)
+	}
+
+	capture, err := openCapture(nc, filter)
+	if err != nil {
+		return fmt.Errorf("pcap %s: %w", vm.Config.Name, err)
+	}
+	defer capture.Close() //nolint:errcheck
+	// Expire the read rather than closing, so the drop count can still be read after Ctrl+C.
+	defer context.AfterFunc(ctx, func() { _ = capture.SetReadDeadline(time.Now()) })()
+
+	out, closeOut, err := pcapOutput(cmd)
+	if err != nil {
+		return err
+	}
+	defer closeOut()
+	desc := fmt.Sprintf("vm %s (%s) nic %d", vm.Config.Name, vm.ID, idx)
+	pw, err := pcap.NewWriter(out, nc.TAP, desc, pcapSnaplen)
+	if err != nil {
+		return fmt.Errorf("pcap: write header: %w", err)
+	}
+
+	logger := log.WithFunc("cmd.vm.pcap")
+	logger.Infof(ctx, "capturing on %s (%s), Ctrl+C to stop", nc.TAP, desc)
+	var written uint64
+	buf := make([]byte, pcapSnaplen)
+	for {
+		n, origLen, outbound, readErr := capture.Read(buf)
+		if readErr != nil {
+			if ctx.Err() != nil && errors.Is(readErr, os.ErrDeadlineExceeded) {
+				break
+			}
+			return fmt.Errorf("pcap: read: %w", readErr)
+		}
+		if err = pw.WritePacket(time.Now(), buf[:n], origLen, outbound); err != nil {
+			return fmt.Errorf("pcap: write: %w", err)
+		}
+		written++
+	}
+	if _, dropped, statsErr := capture.Stats(); statsErr == nil {
+		logger.Infof(ctx, "%d packets captured, %d dropped by kernel", written, dropped)
+	}
+	return nil
+}
+
+// openCapture opens the socket inside the VM's netns when the TAP lives there (CNI); bridge and macvtap links are
+// in the host netns.
+func openCapture(nc *types.NetworkConfig, filter []bpf.Instruction) (*pcap.Capture, error) {
+	if nc.NetnsPath == "" {
+		return pcap.Open(nc.TAP, filter)
+	}
+	restore, err := hypervisor.EnterNetns(nc.NetnsPath)
+	if err != nil {
+		return nil, err
+	}
+	defer restore()
+	return pcap.Open(nc.TAP, filter)
+}
+
+// pcapOutput is stdout for "-" (pipe into wireshark -k -i -), otherwise a new file. Like tcpdump, it refuses to
+// write binary pcapng to a terminal.
+func pcapOutput(cmd *cobra.Command) (io.Writer, func(), error) {
+	path, _ := cmd.Flags().GetString("write")
+	if path == "" || path == "-" {
+		if term.IsTerminal(os.Stdout.Fd()) {
+			return nil, nil, fmt.Errorf("pcap: stdout is a terminal: write to a file with -w FILE or pipe the output")
+		}
+		return os.Stdout, func() {}, nil
+	}
+	f, err := os.Create(path) //nolint:gosec // user-supplied output path
+	if err != nil {
+		return nil, nil, fmt.Errorf("pcap: %w", err)
+	}
+	return f, func() { f.Close() }, nil //nolint:errcheck,gosec
+}
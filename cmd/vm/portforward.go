@@ -0,0 +1,159 @@
+package vm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/projecteru2/core/log"
+	"github.com/spf13/cobra"
+
+	"github.com/cocoonstack/cocoon/agent"
+)
+
+// portMapping is one LOCAL:REMOTE pair; Local 0 picks a free host port.
+type portMapping struct {
+	Local  int
+	Remote int
+}
+
+// PortForward listens on host ports and relays each accepted connection to a guest-local port through cocoon-agent,
+// so it needs no guest NIC (works for --nics 0) and no route into the VM's netns.
+func (h Handler) PortForward(cmd *cobra.Command, args []string) error {
+	ctx, conf, err := h.Init(cmd)
+	if err != nil {
+		return err
+	}
+	logger := log.WithFunc("cmd.vm.portForward")
+
+	ref := args[0]
+	mappings, err := parsePortMappings(args[1:])
+	if err != nil {
+		return err
+	}
+	info, err := agentVM(ctx, conf, ref)
+	if err != nil {
+		return fmt.Errorf("port-forward: %w", err)
+	}
+	address, _ := cmd.Flags().GetString("address")
+
+	var listeners []net.Listener
+	defer func() {
+		for _, ln := range listeners {
+			ln.Close() //nolint:errcheck,gosec
+		}
+	}()
+	lc := net.ListenConfig{}
+	for _, m := range mappings {
+		ln, listenErr := lc.Listen(ctx, "tcp", net.JoinHostPort(address, strconv.Itoa(m.Local)))
+		if listenErr != nil {
+			return fmt.Errorf("port-forward: %w", listenErr)
+		}
+		listeners = append(listeners, ln)
+		fmt.Printf("Forwarding from %s -> %d\n", ln.Addr(), m.Remote)
+	}
+
+	var wg sync.WaitGroup
+	for i, ln := range listeners {
+		wg.Go(func() {
+			acceptLoop(ctx, ln, info.VsockSocket, mappings[i].Remote, logger)
+		})
+	}
+	<-ctx.Done()
+	for _, ln := range listeners {
+		ln.Close() //nolint:errcheck,gosec
+	}
+	wg.Wait()
+	return nil
+}
+
+func acceptLoop(ctx context.Context, ln net.Listener, vsock string, remote int, logger *log.Fields) {
+	var conns sync.WaitGroup
+	defer conns.Wait()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				logger.Warnf(ctx, "accept on %s: %v", ln.Addr(), err)
+			}
+			return
+		}
+		conns.Go(func() {
+			defer conn.Close() //nolint:errcheck
+			if err := relayToGuest(ctx, vsock, conn, remote); err != nil {
+				logger.Warnf(ctx, "forward %s -> %d: %v", conn.RemoteAddr(), remote, err)
+			}
+		})
+	}
+}
+
+// relayToGuest runs a stdio↔TCP relay in the guest; the agent session's stdin/stdout carry the connection's bytes.
+func relayToGuest(ctx context.Context, vsock string, conn net.Conn, remote int) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(ctx, func() { conn.Close() }) //nolint:errcheck,gosec
+	defer stop()
+
+	var stderr bytes.Buffer
+	code, err := agent.Run(ctx, vsock, []string{"/bin/sh", "-c", relayScript(remote)}, nil, conn, conn, &stderr)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+	if code != 0 {
+		return fmt.Errorf("guest relay exited %d: %s", code, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// relayScript picks the first relay the guest has: socat, nc (busybox or OpenBSD), then bash /dev/tcp.
+func relayScript(port int) string {
+	return fmt.Sprintf(`if command -v socat >/dev/null 2>&1; then exec socat - TCP:127.0.0.1:%[1]d
+elif command -v nc >/dev/null 2>&1; then exec nc 127.0.0.1 %[1]d
+elif command -v bash >/dev/null 2>&1; then exec bash -c 'exec 3<>/dev/tcp/127.0.0.1/%[1]d || exit 1; cat <&3 & cat >&3; wait'
+fi
+echo "no relay available in guest (install socat or nc)" >&2
+exit 127
+`, port)
+}
+
+// parsePortMappings accepts kubectl-style specs: "8080:80", "8080" (same port both sides), ":80" (random local port).
+func parsePortMappings(specs []string) ([]portMapping, error) {
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("port-forward: at least one LOCAL:REMOTE port is required")
+	}
+	out := make([]portMapping, 0, len(specs))
+	for _, spec := range specs {
+		localStr, remoteStr, found := strings.Cut(spec, ":")
+		if !found {
+			remoteStr = localStr
+		}
+		remote, err := parsePort(remoteStr, false)
+		if err != nil {
+			return nil, fmt.Errorf("port-forward: invalid spec %q: remote %w", spec, err)
+		}
+		local := 0
+		if localStr != "" {
+			if local, err = parsePort(localStr, true); err != nil {
+				return nil, fmt.Errorf("port-forward: invalid spec %q: local %w", spec, err)
+			}
+		}
+		out = append(out, portMapping{Local: local, Remote: remote})
+	}
+	return out, nil
+}
+
+func parsePort(s string, allowZero bool) (int, error) {
+	p, err := strconv.Atoi(s)
+	if err != nil || p < 0 || p > 65535 || (p == 0 && !allowZero) {
+		return 0, fmt.Errorf("port %q out of range", s)
+	}
+	return p, nil
+}
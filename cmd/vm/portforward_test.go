@@ -0,0 +1,41 @@
+package vm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParsePortMappings(t *testing.T) {
+	got, err := parsePortMappings([]string{"8080:80", "5432", ":22"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []portMapping{{Local: 8080, Remote: 80}, {Local: 5432, Remote: 5432}, {Local: 0, Remote: 22}}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("mapping %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+
+	for _, bad := range []string{"8080:", "0", "x:80", "80:70000", "-1:80"} {
+		if _, err := parsePortMappings([]string{bad}); err == nil {
+			t.Errorf("parsePortMappings(%q) should fail", bad)
+		}
+	}
+	if _, err := parsePortMappings(nil); err == nil {
+		t.Error("no specs should fail")
+	}
+}
+
+func TestRelayScript(t *testing.T) {
+	script := relayScript(8443)
+	for _, want := range []string{"socat - TCP:127.0.0.1:8443", "nc 127.0.0.1 8443", "/dev/tcp/127.0.0.1/8443"} {
+		if !strings.Contains(script, want) {
+			t.Errorf("script missing %q:\n%s", want, script)
+		}
+	}
+	assertShellSyntax(t, script)
+}
@@ -0,0 +1,246 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/projecteru2/core/log"
+	"github.com/spf13/cobra"
+
+	cmdcore "github.com/cocoonstack/cocoon/cmd/core"
+	"github.com/cocoonstack/cocoon/config"
+	"github.com/cocoonstack/cocoon/hypervisor"
+	"github.com/cocoonstack/cocoon/network/publish"
+	"github.com/cocoonstack/cocoon/types"
+)
+
+// errPortRecorderUnsupported is returned when a backend cannot persist `vm port` edits.
+var errPortRecorderUnsupported = errors.New("backend does not persist published ports")
+
+func (h Handler) PortAdd(cmd *cobra.Command, args []string) error {
+	ctx, conf, hyper, recorder, err := resolveAttacher[hypervisor.PortRecorder](h, cmd, args, "vm port add", errPortRecorderUnsupported)
+	if err != nil {
+		return err
+	}
+	vm, err := hyper.Inspect(ctx, args[0])
+	if err != nil {
+		return fmt.Errorf("vm port add: %w", err)
+	}
+	if err = checkLivePorts(vm); err != nil {
+		return fmt.Errorf("vm port add: %w", err)
+	}
+	if _, err = publish.GuestNetwork(vm); err != nil {
+		return fmt.Errorf("vm port add %s: %w", vm.Config.Name, err)
+	}
+	added, err := publish.ParseAll(args[1:])
+	if err != nil {
+		return err
+	}
+	if err = publish.CheckDNAT(added); err != nil {
+		return err
+	}
+	cfg := vm.Config
+	cfg.Ports = append(slices.Clone(vm.Config.Ports), added...)
+	if err = cfg.Validate(); err != nil {
+		return fmt.Errorf("vm port add: %w", err)
+	}
+	if err = checkPortConflicts(ctx, conf, vm.ID, added); err != nil {
+		return fmt.Errorf("vm port add: %w", err)
+	}
+	return updatePorts(ctx, cmd, recorder, vm, cfg.Ports)
+}
+
+func (h Handler) PortRm(cmd *cobra.Command, args []string) error {
+	ctx, _, hyper, recorder, err := resolveAttacher[hypervisor.PortRecorder](h, cmd, args, "vm port rm", errPortRecorderUnsupported)
+	if err != nil {
+		return err
+	}
+	vm, err := hyper.Inspect(ctx, args[0])
+	if err != nil {
+		return fmt.Errorf("vm port rm: %w", err)
+	}
+	if err = checkLivePorts(vm); err != nil {
+		return fmt.Errorf("vm port rm: %w", err)
+	}
+	kept := slices.Clone(vm.Config.Ports)
+	for _, spec := range args[1:] {
+		match, matchErr := portMatcher(spec)
+		if matchErr != nil {
+			return matchErr
+		}
+		n := len(kept)
+		kept = slices.DeleteFunc(kept, match)
+		if len(kept) == n {
+			return fmt.Errorf("vm port rm: %s does not publish %s", vm.Config.Name, spec)
+		}
+	}
+	return updatePorts(ctx, cmd, recorder, vm, kept)
+}
+
+func (h Handler) PortLs(cmd *cobra.Command, args []string) error {
+	ctx, conf, err := h.Init(cmd)
+	if err != nil {
+		return err
+	}
+	hyper, err := cmdcore.FindHypervisor(ctx, conf, args[0])
+	if err != nil {
+		return fmt.Errorf("vm port ls: %w", err)
+	}
+	vm, err := hyper.Inspect(ctx, args[0])
+	if err != nil {
+		return fmt.Errorf("vm port ls: %w", err)
+	}
+	ports := vm.Config.Ports
+	if ports == nil {
+		ports = []types.PortMapping{}
+	}
+	return cmdcore.OutputFormatted(cmd, ports, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "HOST\tGUEST\tPROTO") //nolint:errcheck
+		for _, p := range ports {
+			host := fmt.Sprintf("%d", p.HostPort)
+			if p.HostIP != "" {
+				host = fmt.Sprintf("%s:%d", p.HostIP, p.HostPort)
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\n", host, p.GuestPort, p.Protocol) //nolint:errcheck
+		}
+	})
+}
+
+// updatePorts persists ports and, for a running VM, swaps its live rules to match.
+func updatePorts(ctx context.Context, cmd *cobra.Command, recorder hypervisor.PortRecorder, vm *types.VM, ports []types.PortMapping) error {
+	if err := recorder.RecordPorts(ctx, vm.ID, ports); err != nil {
+		return fmt.Errorf("record ports for %s: %w", vm.Config.Name, err)
+	}
+	if vm.State == types.VMStateRunning {
+		guest, err := publish.GuestNetwork(vm)
+		if err == nil {
+			err = publish.Apply(ctx, vm.ID, guest, ports)
+		}
+		if err != nil {
+			return fmt.Errorf("ports recorded but not applied (retried on next start): %w", err)
+		}
+	}
+	if done, jsonErr := cmdcore.MaybeOutputJSON(cmd, ports); done {
+		return jsonErr
+	}
+	log.WithFunc("cmd.vm.port").Infof(ctx, "%s: %d port(s) published", vm.Config.Name, len(ports))
+	return nil
+}
+
+// portMatcher matches `vm port rm` arguments: a full mapping as `vm port ls` shows it, or just its host side.
+func portMatcher(spec string) (func(types.PortMapping) bool, error) {
+	if m, err := publish.Parse(spec); err == nil {
+		return func(p types.PortMapping) bool { return p == m }, nil
+	}
+	m, err := publish.ParseHost(spec)
+	if err != nil {
+		return nil, err
+	}
+	return func(p types.PortMapping) bool {
+		return p.HostIP == m.HostIP && p.HostPort == m.HostPort && p.Protocol == m.Protocol
+	}, nil
+}
+
+// checkPublishTarget rejects --publish when the VM would have no host-known IPv4 to DNAT to, or a mapping DNAT cannot
+// serve; passt forwards the ports itself.
+func checkPublishTarget(cfg *types.VMConfig, nics int, bridgeDev string, usePasst bool) error {
+	switch {
+	case len(cfg.Ports) == 0, usePasst && nics > 0:
+		return nil
+	case nics == 0:
+		return fmt.Errorf("--publish needs a network interface (--nics 0)")
+	case bridgeDev != "" && cfg.BridgeIPAM == "":
+		return fmt.Errorf("--publish needs a CNI network or --bridge-ipam: other --bridge guests take DHCP leases the host does not track")
+	}
+	return publish.CheckDNAT(cfg.Ports)
+}
+
+// checkLivePorts rejects live port edits on passt VMs, whose forwards are passt arguments fixed at create.
+func checkLivePorts(vm *types.VM) error {
+	if vm.ResolvedNetBackend() == types.BackendPasst {
+		return fmt.Errorf("%s uses --passt: its published ports are fixed at create", vm.Config.Name)
+	}
+	return nil
+}
+
+// checkPortConflicts rejects ports some other VM already publishes, running or not, so starting either never fails.
+func checkPortConflicts(ctx context.Context, conf *config.Config, selfID string, ports []types.PortMapping) error {
+	if len(ports) == 0 {
+		return nil
+	}
+	hypers, err := cmdcore.InitAllHypervisors(ctx, conf)
+	if err != nil {
+		return err
+	}
+	vms, err := cmdcore.ListAllVMs(ctx, hypers)
+	if err != nil {
+		return err
+	}
+	for _, vm := range vms {
+		if vm.ID == selfID {
+			continue
+		}
+		for _, q := range vm.Config.Ports {
+			for _, p := range ports {
+				if p.Conflicts(q) {
+					return fmt.Errorf("--publish %s conflicts with %s on VM %s", p, q, vm.Config.Name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// publishPortsFor installs the published ports of the freshly started VMs ids.
+func publishPortsFor(ctx context.Context, hyper hypervisor.Hypervisor, ids []string, logger *log.Fields) {
+	for _, id := range ids {
+		vm, err := hyper.Inspect(ctx, id)
+		if err != nil {
+			logger.Warnf(ctx, "ports not published for %s: %v", id, err)
+			continue
+		}
+		publishPorts(ctx, vm, logger)
+	}
+}
+
+// publishPorts installs vm's published ports. Failures are logged, not returned: the VM is already running and
+// `vm port add` or a restart retries.
+func publishPorts(ctx context.Context, vm *types.VM, logger *log.Fields) {
+	if len(vm.Config.Ports) == 0 || vm.ResolvedNetBackend() == types.BackendPasst {
+		return
+	}
+	guest, err := publish.GuestNetwork(vm)
+	if err == nil {
+		err = publish.Apply(ctx, vm.ID, guest, vm.Config.Ports)
+	}
+	if err != nil {
+		logger.Warnf(ctx, "ports not published for %s: %v", vm.Config.Name, err)
+	}
+}
+
+// publishedVMs returns the ids that publish ports through nftables, read before stop/rm so only those touch it
+// afterwards.
+func publishedVMs(ctx context.Context, hyper hypervisor.Hypervisor, ids []string) []string {
+	var out []string
+	for _, id := range ids {
+		if vm, err := hyper.Inspect(ctx, id); err == nil && len(vm.Config.Ports) > 0 && vm.ResolvedNetBackend() != types.BackendPasst {
+			out = append(out, vm.ID)
+		}
+	}
+	return out
+}
+
+// unpublishPorts drops the rules of the published VMs that were actually stopped or deleted (done).
+func unpublishPorts(ctx context.Context, published, done []string, logger *log.Fields) {
+	for _, id := range published {
+		if !slices.Contains(done, id) {
+			continue
+		}
+		if err := publish.Remove(ctx, id); err != nil {
+			logger.Warnf(ctx, "%v", err)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package vm
+
+import (
+	"testing"
+
+	"github.com/cocoonstack/cocoon/types"
+)
+
+func TestCheckPublishTarget(t *testing.T) {
+	lo := []types.PortMapping{{HostIP: "127.0.0.1", HostPort: 5353, GuestPort: 53, Protocol: "udp"}}
+	tests := []struct {
+		name     string
+		ports    []types.PortMapping
+		nics     int
+		bridge   string
+		usePasst bool
+		wantErr  bool
+	}{
+		{name: "no ports", nics: 0},
+		{name: "cni", ports: []types.PortMapping{{HostPort: 8080, GuestPort: 80, Protocol: "tcp"}}, nics: 1},
+		{name: "no nics", ports: lo, nics: 0, wantErr: true},
+		{name: "bridge without ipam", ports: []types.PortMapping{{HostPort: 8080, GuestPort: 80, Protocol: "tcp"}}, nics: 1, bridge: "br0", wantErr: true},
+		{name: "loopback over dnat", ports: lo, nics: 1, wantErr: true},
+		{name: "loopback over passt", ports: lo, nics: 1, usePasst: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &types.VMConfig{Ports: tt.ports}
+			if err := checkPublishTarget(cfg, tt.nics, tt.bridge, tt.usePasst); (err != nil) != tt.wantErr {
+				t.Errorf("checkPublishTarget = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -3,12 +3,15 @@ package vm
 import (
 	"context"
 	"fmt"
+	"io"
 	"slices"
 	"strings"
 
+	"filippo.io/age"
 	"github.com/projecteru2/core/log"
 	"github.com/spf13/cobra"
 
+	"github.com/cocoonstack/cocoon/agent"
 	cmdcore "github.com/cocoonstack/cocoon/cmd/core"
 	"github.com/cocoonstack/cocoon/config"
 	"github.com/cocoonstack/cocoon/hypervisor"
@@ -18,9 +21,9 @@ import (
 	"github.com/cocoonstack/cocoon/utils"
 )
 
+// nicHint carries one static NIC into the printed networkd loop; addrs and gws are space-separated lists.
 type nicHint struct {
-	mac, ip, gw string
-	prefix      int
+	mac, addrs, gws string
 }
 
 func (h Handler) Create(cmd *cobra.Command, args []string) error {
@@ -52,6 +55,8 @@ func (h Handler) Run(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return fmt.Errorf("start VM %s: %w", vm.ID, err)
 	}
+	publishPortsFor(ctx, hyper, started, logger)
+	installSSHKeysFor(ctx, hyper, started, false, logger)
 	if wantJSON {
 		info, inspectErr := hyper.Inspect(ctx, vm.ID)
 		switch {
@@ -114,24 +119,35 @@ func (h Handler) Clone(cmd *cobra.Command, args []string) error {
 	defer stream.Close() //nolint:errcheck
 	defer cmdcore.CloseOnCancel(ctx, stream)()
 
+	return h.cloneFromStream(ctx, cmd, conf, hyper, cfg, stream, fmt.Sprintf("snapshot %s", snapRef), logger)
+}
+
+// cloneFromStream is the shared tail for the snapshot-DB stream and encrypted --from-dir clone paths.
+func (h Handler) cloneFromStream(ctx context.Context, cmd *cobra.Command, conf *config.Config, hyper hypervisor.Hypervisor, cfg types.SnapshotConfig, stream io.Reader, sourceLabel string, logger *log.Fields) error {
 	vmCfg, vmID, netProvider, netSetup, err := h.prepareClone(ctx, cmd, conf, cfg)
 	if err != nil {
 		return err
 	}
 
-	logger.Infof(ctx, "cloning VM from snapshot %s ...", snapRef)
+	logger.Infof(ctx, "cloning VM from %s ...", sourceLabel)
 
 	vm, cloneErr := hyper.Clone(ctx, vmID, vmCfg, netSetup, &cfg, stream)
 	if cloneErr != nil {
 		rollbackNetwork(ctx, netProvider, vmID)
 		return fmt.Errorf("clone VM: %w", cloneErr)
 	}
+	publishPorts(ctx, vm, logger)
 
+	reportClockSync(ctx, vm, logger)
+	identityErr := resetCloneIdentity(ctx, cmd, conf, vm, logger)
+	installCloneSSHKeys(ctx, cmd, conf, vm, logger)
 	if done, jsonErr := cmdcore.MaybeOutputJSON(cmd, vm); done {
 		return jsonErr
 	}
 	logger.Infof(ctx, "VM cloned: %s (name: %s)", vm.ID, vm.Config.Name)
-	printPostCloneHints(vm)
+	if identityErr != nil {
+		printPostCloneHints(vm)
+	}
 	return nil
 }
 
@@ -177,7 +193,7 @@ func (h Handler) Restore(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	done, directErr := h.restoreDirect(ctx, cmd, snapRef, vmRef, vmCfg, snapBackend, hyper, logger)
+	done, directErr := h.restoreDirect(ctx, cmd, conf, snapRef, vmRef, vmCfg, snapBackend, hyper, logger)
 	if done {
 		return directErr
 	}
@@ -189,12 +205,19 @@ func (h Handler) Restore(cmd *cobra.Command, args []string) error {
 	defer stream.Close() //nolint:errcheck
 	defer cmdcore.CloseOnCancel(ctx, stream)()
 
-	logger.Infof(ctx, "restoring VM %s from snapshot %s ...", vmRef, snapRef)
+	return runStreamRestore(ctx, cmd, conf, hyper, vmRef, vmCfg, stream, snapInfo.ID, fmt.Sprintf("snapshot %s", snapRef), logger)
+}
 
-	result, err := hyper.Restore(ctx, vmRef, vmCfg, stream, snapInfo.ID)
+// runStreamRestore is the shared tail for the snapshot-DB stream and encrypted --from-dir restore paths.
+func runStreamRestore(ctx context.Context, cmd *cobra.Command, conf *config.Config, hyper hypervisor.Hypervisor, vmRef string, vmCfg *types.VMConfig, stream io.Reader, sourceSnapshotID, sourceLabel string, logger *log.Fields) error {
+	logger.Infof(ctx, "restoring VM %s from %s ...", vmRef, sourceLabel)
+
+	result, err := hyper.Restore(ctx, vmRef, vmCfg, stream, sourceSnapshotID)
 	if err != nil {
 		return fmt.Errorf("restore: %w", err)
 	}
+	publishPorts(ctx, result, logger)
+	reportClockSync(ctx, result, logger)
 
 	if done, jsonErr := cmdcore.MaybeOutputJSON(cmd, result); done {
 		return jsonErr
@@ -203,18 +226,19 @@ func (h Handler) Restore(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-// restoreFromDir runs DirectRestore over an envelope dir; a foreign snapshot ID requires --force so cross-lineage overwrite is opt-in.
+// restoreFromDir runs DirectRestore over an envelope dir (stream Restore when encrypted); a foreign snapshot ID requires --force so cross-lineage overwrite is opt-in.
 func (h Handler) restoreFromDir(ctx context.Context, cmd *cobra.Command, conf *config.Config, vmRef, dir string, logger *log.Fields) error {
-	cfg, err := snapshot.ReadSnapshotEnvelope(dir)
+	envelope, ids, err := loadEnvelopeDir(ctx, cmd, conf, dir, logger)
 	if err != nil {
-		return fmt.Errorf("load envelope: %w", err)
+		return err
 	}
+	cfg := envelope.Config
 	hyper, err := cmdcore.FindHypervisor(ctx, conf, vmRef)
 	if err != nil {
 		return fmt.Errorf("find VM %s: %w", vmRef, err)
 	}
 	dcr, ok := hyper.(hypervisor.Direct)
-	if !ok {
+	if !ok && envelope.Encryption == nil {
 		return fmt.Errorf("backend %s does not support direct restore", hyper.Type())
 	}
 	vm, err := hyper.Inspect(ctx, vmRef)
@@ -232,7 +256,15 @@ func (h Handler) restoreFromDir(ctx context.Context, cmd *cobra.Command, conf *c
 	if err != nil {
 		return err
 	}
-	return h.runDirectRestore(ctx, cmd, dcr, vmRef, vmCfg, dir, cfg.ID,
+	if envelope.Encryption != nil {
+		noVerify, _ := cmd.Flags().GetBool("no-verify")
+		stream := snapshot.DecryptDirStream(ctx, dir, envelope, ids, !noVerify)
+		defer stream.Close() //nolint:errcheck
+		defer cmdcore.CloseOnCancel(ctx, stream)()
+		return runStreamRestore(ctx, cmd, conf, hyper, vmRef, vmCfg, stream, cfg.ID,
+			fmt.Sprintf("encrypted dir %s", dir), logger)
+	}
+	return h.runDirectRestore(ctx, cmd, conf, dcr, vmRef, vmCfg, dir, cfg.ID,
 		fmt.Sprintf("dir %s", dir), logger)
 }
 
@@ -247,10 +279,11 @@ func (h Handler) cloneDirect(ctx context.Context, cmd *cobra.Command, conf *conf
 
 // cloneFromDir runs DirectClone over an envelope-bearing dir. The dir stays read-only across the call so concurrent clones of a golden image are safe.
 func (h Handler) cloneFromDir(ctx context.Context, cmd *cobra.Command, conf *config.Config, dir string, logger *log.Fields) error {
-	cfg, err := snapshot.ReadSnapshotEnvelope(dir)
+	envelope, ids, err := loadEnvelopeDir(ctx, cmd, conf, dir, logger)
 	if err != nil {
-		return fmt.Errorf("load envelope: %w", err)
+		return err
 	}
+	cfg := envelope.Config
 	// Local copy keeps backend flip from leaking to the caller's shared *config.Config.
 	localConf := *conf
 	if cfg.Hypervisor != "" {
@@ -260,6 +293,13 @@ func (h Handler) cloneFromDir(ctx context.Context, cmd *cobra.Command, conf *con
 	if err != nil {
 		return err
 	}
+	if envelope.Encryption != nil {
+		noVerify, _ := cmd.Flags().GetBool("no-verify")
+		stream := snapshot.DecryptDirStream(ctx, dir, envelope, ids, !noVerify)
+		defer stream.Close() //nolint:errcheck
+		defer cmdcore.CloseOnCancel(ctx, stream)()
+		return h.cloneFromStream(ctx, cmd, &localConf, hyper, cfg, stream, fmt.Sprintf("encrypted dir %s", dir), logger)
+	}
 	dcr, ok := hyper.(hypervisor.Direct)
 	if !ok {
 		return fmt.Errorf("backend %s does not support direct clone", hyper.Type())
@@ -268,6 +308,43 @@ func (h Handler) cloneFromDir(ctx context.Context, cmd *cobra.Command, conf *con
 		fmt.Sprintf("dir %s", dir), logger)
 }
 
+// loadEnvelopeDir reads dir's envelope and, unless --no-verify, checks data files against its manifest; v1 envelopes only warn.
+// Encrypted dirs require --decrypt-key; here only their file set is checked, and DecryptDirStream checks each file's
+// plaintext against the manifest as it decrypts, so there is no separate hash pass.
+func loadEnvelopeDir(ctx context.Context, cmd *cobra.Command, conf *config.Config, dir string, logger *log.Fields) (types.SnapshotExport, []age.Identity, error) {
+	envelope, err := snapshot.ReadEnvelope(dir)
+	if err != nil {
+		return types.SnapshotExport{}, nil, fmt.Errorf("load envelope: %w", err)
+	}
+	noVerify, _ := cmd.Flags().GetBool("no-verify")
+	if envelope.Encryption != nil {
+		ids, idErr := cmdcore.DecryptIdentities(cmd)
+		if idErr != nil {
+			return types.SnapshotExport{}, nil, idErr
+		}
+		if len(ids) == 0 {
+			return types.SnapshotExport{}, nil, fmt.Errorf("%s: %w: pass --decrypt-key", dir, snapshot.ErrEncrypted)
+		}
+		if !noVerify {
+			if err = snapshot.VerifyEncryptedDirLayout(dir, envelope.Files); err != nil {
+				return types.SnapshotExport{}, nil, fmt.Errorf("verify %s: %w", dir, err)
+			}
+		}
+		return envelope, ids, nil
+	}
+	if noVerify {
+		return envelope, nil, nil
+	}
+	if len(envelope.Files) == 0 {
+		logger.Warnf(ctx, "%s has a v1 envelope without manifest; skipping integrity check", dir)
+		return envelope, nil, nil
+	}
+	if err = snapshot.VerifyManifest(ctx, dir, envelope.Files, conf.EffectivePoolSize()); err != nil {
+		return types.SnapshotExport{}, nil, fmt.Errorf("verify %s: %w", dir, err)
+	}
+	return envelope, nil, nil
+}
+
 func (h Handler) cloneFromSrcDir(ctx context.Context, cmd *cobra.Command, conf *config.Config, dcr hypervisor.Direct, cfg types.SnapshotConfig, srcDir, sourceLabel string, logger *log.Fields) error {
 	vmCfg, vmID, netProvider, netSetup, err := h.prepareClone(ctx, cmd, conf, cfg)
 	if err != nil {
@@ -284,12 +361,18 @@ func (h Handler) cloneFromSrcDir(ctx context.Context, cmd *cobra.Command, conf *
 		rollbackNetwork(ctx, netProvider, vmID)
 		return fmt.Errorf("clone VM: %w", cloneErr)
 	}
+	publishPorts(ctx, vm, logger)
 
+	reportClockSync(ctx, vm, logger)
+	identityErr := resetCloneIdentity(ctx, cmd, conf, vm, logger)
+	installCloneSSHKeys(ctx, cmd, conf, vm, logger)
 	if wantJSON {
 		return cmdcore.OutputJSON(vm)
 	}
 	logger.Infof(ctx, "VM cloned: %s (name: %s)", vm.ID, vm.Config.Name)
-	printPostCloneHints(vm)
+	if identityErr != nil {
+		printPostCloneHints(vm)
+	}
 	return nil
 }
 
@@ -315,6 +398,13 @@ func (h Handler) prepareClone(ctx context.Context, cmd *cobra.Command, conf *con
 	}
 
 	bridgeDev, _ := cmd.Flags().GetString("bridge")
+	useVhostUser, _ := cmd.Flags().GetBool("vhost-user")
+	if useVhostUser {
+		flagNetwork, _ := cmd.Flags().GetString("network")
+		if err = checkVhostUser(conf, vmCfg, bridgeDev != "" || flagNetwork != ""); err != nil {
+			return nil, "", nil, types.NetSetup{}, err
+		}
+	}
 	nics := cfg.NICs
 	if cmd.Flags().Changed("nics") {
 		if conf.UseFirecracker {
@@ -322,7 +412,25 @@ func (h Handler) prepareClone(ctx context.Context, cmd *cobra.Command, conf *con
 		}
 		nics, _ = cmd.Flags().GetInt("nics")
 	}
-	netProvider, netSetup, err := initNetwork(ctx, conf, vmID, nics, vmCfg, tapQueues(vmCfg.CPU, conf.UseFirecracker), bridgeDev)
+	// The snapshot's NIC count is fixed unless --nics overrides it, so --nic cannot add NICs on its own; inherited
+	// attachments past a lowered count are dropped.
+	flagNICs, _ := cmd.Flags().GetStringArray("nic")
+	if nics, err = resolveNICCount(nics, true, len(flagNICs)); err != nil {
+		return nil, "", nil, types.NetSetup{}, err
+	}
+	if conf.UseFirecracker && slices.ContainsFunc(vmCfg.NICs, func(r types.NICSpec) bool { return r.MAC != "" }) {
+		return nil, "", nil, types.NetSetup{}, fmt.Errorf("--nic mac= on clone is Cloud Hypervisor only (FC restores the snapshot's guest MAC)")
+	}
+	if err = checkPublishTarget(vmCfg, nics, bridgeDev, false); err != nil {
+		return nil, "", nil, types.NetSetup{}, err
+	}
+	if err = checkPortConflicts(ctx, conf, "", vmCfg.Ports); err != nil {
+		return nil, "", nil, types.NetSetup{}, err
+	}
+	if err = checkMACConflicts(ctx, conf, vmCfg.NICs); err != nil {
+		return nil, "", nil, types.NetSetup{}, err
+	}
+	netProvider, netSetup, err := initNetwork(ctx, conf, vmID, nics, vmCfg, tapQueues(vmCfg.CPU, conf.UseFirecracker), netFlags{bridgeDev: bridgeDev, vhostUser: useVhostUser})
 	if err != nil {
 		return nil, "", nil, types.NetSetup{}, err
 	}
@@ -330,7 +438,7 @@ func (h Handler) prepareClone(ctx context.Context, cmd *cobra.Command, conf *con
 	return vmCfg, vmID, netProvider, netSetup, nil
 }
 
-func (h Handler) restoreDirect(ctx context.Context, cmd *cobra.Command, snapRef, vmRef string, vmCfg *types.VMConfig, snapBackend snapshot.Snapshot, hyper hypervisor.Hypervisor, logger *log.Fields) (bool, error) {
+func (h Handler) restoreDirect(ctx context.Context, cmd *cobra.Command, conf *config.Config, snapRef, vmRef string, vmCfg *types.VMConfig, snapBackend snapshot.Snapshot, hyper hypervisor.Hypervisor, logger *log.Fields) (bool, error) {
 	da, ok := snapBackend.(snapshot.Direct)
 	if !ok {
 		return false, nil
@@ -343,12 +451,12 @@ func (h Handler) restoreDirect(ctx context.Context, cmd *cobra.Command, snapRef,
 	if err != nil {
 		return true, fmt.Errorf("open snapshot: %w", err)
 	}
-	return true, h.runDirectRestore(ctx, cmd, dcr, vmRef, vmCfg, dataDir, snapCfg.ID,
+	return true, h.runDirectRestore(ctx, cmd, conf, dcr, vmRef, vmCfg, dataDir, snapCfg.ID,
 		fmt.Sprintf("snapshot %s", snapRef), logger)
 }
 
-// runDirectRestore is the shared tail for the snapshot-DB and --from-dir restore paths: log, DirectRestore, output.
-func (h Handler) runDirectRestore(ctx context.Context, cmd *cobra.Command, dcr hypervisor.Direct, vmRef string, vmCfg *types.VMConfig, srcDir, sourceSnapshotID, sourceLabel string, logger *log.Fields) error {
+// runDirectRestore is the shared tail for the snapshot-DB and --from-dir restore paths: log, DirectRestore, clock step, output.
+func (h Handler) runDirectRestore(ctx context.Context, cmd *cobra.Command, conf *config.Config, dcr hypervisor.Direct, vmRef string, vmCfg *types.VMConfig, srcDir, sourceSnapshotID, sourceLabel string, logger *log.Fields) error {
 	wantJSON := cmdcore.WantJSON(cmd)
 	if !wantJSON {
 		logger.Infof(ctx, "restoring VM %s from %s (direct) ...", vmRef, sourceLabel)
@@ -357,6 +465,8 @@ func (h Handler) runDirectRestore(ctx context.Context, cmd *cobra.Command, dcr h
 	if err != nil {
 		return fmt.Errorf("restore: %w", err)
 	}
+	publishPorts(ctx, result, logger)
+	reportClockSync(ctx, result, logger)
 	if wantJSON {
 		return cmdcore.OutputJSON(result)
 	}
@@ -389,6 +499,32 @@ func (h Handler) createVM(cmd *cobra.Command, image string) (context.Context, *t
 	if bridgeDev != "" && vmCfg.Network != "" {
 		return nil, nil, nil, fmt.Errorf("--bridge and --network are mutually exclusive")
 	}
+	if vmCfg.BridgeIPAM != "" && bridgeDev == "" {
+		return nil, nil, nil, fmt.Errorf("--bridge-ipam needs --bridge")
+	}
+	if bridgeDev != "" && slices.ContainsFunc(vmCfg.NICs, func(r types.NICSpec) bool { return r.Network != "" }) {
+		return nil, nil, nil, fmt.Errorf("--nic network= needs a CNI VM: drop --bridge and attach bridges per NIC with --nic bridge=")
+	}
+	usePasst, _ := cmd.Flags().GetBool("passt")
+	if usePasst {
+		if err = checkPasst(conf, vmCfg, bridgeDev); err != nil {
+			return nil, nil, nil, err
+		}
+		// CH reaches passt over vhost-user, which maps guest memory into the backend.
+		vmCfg.SharedMemory = true
+	}
+	macvtapSpec, _ := cmd.Flags().GetString("macvtap")
+	if macvtapSpec != "" {
+		if err = checkMacvtap(conf, vmCfg, macvtapSpec, bridgeDev, usePasst); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	useVhostUser, _ := cmd.Flags().GetBool("vhost-user")
+	if useVhostUser {
+		if err = checkVhostUser(conf, vmCfg, bridgeDev != "" || vmCfg.Network != "" || usePasst || macvtapSpec != ""); err != nil {
+			return nil, nil, nil, err
+		}
+	}
 
 	backends, hyper, err := cmdcore.InitBackends(ctx, conf)
 	if err != nil {
@@ -402,6 +538,9 @@ func (h Handler) createVM(cmd *cobra.Command, image string) (context.Context, *t
 	if vmCfg.Windows && bootCfg.KernelPath != "" {
 		return nil, nil, nil, fmt.Errorf("--windows requires cloudimg (UEFI boot), got OCI direct boot image")
 	}
+	if (len(vmCfg.UserData) > 0 || len(vmCfg.VendorData) > 0) && (vmCfg.Windows || bootCfg.KernelPath != "") {
+		return nil, nil, nil, fmt.Errorf("--user-data and --vendor-data need a cloudimg image (cloud-init reads them from cidata)")
+	}
 	if conf.UseFirecracker && bootCfg.KernelPath == "" {
 		return nil, nil, nil, fmt.Errorf("--fc requires OCI images (direct kernel boot): Firecracker does not support UEFI/cloudimg boot")
 	}
@@ -410,7 +549,23 @@ func (h Handler) createVM(cmd *cobra.Command, image string) (context.Context, *t
 	vmID := utils.GenerateID()
 
 	nics, _ := cmd.Flags().GetInt("nics")
-	netProvider, netSetup, err := initNetwork(ctx, conf, vmID, nics, vmCfg, tapQueues(vmCfg.CPU, conf.UseFirecracker), bridgeDev)
+	if nics, err = resolveNICCount(nics, cmd.Flags().Changed("nics"), len(vmCfg.NICs)); err != nil {
+		return nil, nil, nil, err
+	}
+	if usePasst && nics > 1 {
+		return nil, nil, nil, fmt.Errorf("--passt supports one NIC, got %d: every passt copies the host's address", nics)
+	}
+	if err = checkPublishTarget(vmCfg, nics, bridgeDev, usePasst); err != nil {
+		return nil, nil, nil, err
+	}
+	if err = checkPortConflicts(ctx, conf, "", vmCfg.Ports); err != nil {
+		return nil, nil, nil, err
+	}
+	if err = checkMACConflicts(ctx, conf, vmCfg.NICs); err != nil {
+		return nil, nil, nil, err
+	}
+	netProvider, netSetup, err := initNetwork(ctx, conf, vmID, nics, vmCfg, tapQueues(vmCfg.CPU, conf.UseFirecracker),
+		netFlags{bridgeDev: bridgeDev, passt: usePasst, macvtap: macvtapSpec, vhostUser: useVhostUser})
 	if err != nil {
 		return nil, nil, nil, err
 	}
@@ -446,12 +601,28 @@ func tapQueues(cpu int, useFC bool) int {
 	return cpu
 }
 
-func initNetwork(ctx context.Context, conf *config.Config, vmID string, nics int, vmCfg *types.VMConfig, queues int, bridgeDev string) (network.Network, types.NetSetup, error) {
+// netFlags is the VM-wide network choice of create or clone; the zero value is CNI.
+type netFlags struct {
+	bridgeDev string
+	passt     bool
+	macvtap   string
+	vhostUser bool
+}
+
+func initNetwork(ctx context.Context, conf *config.Config, vmID string, nics int, vmCfg *types.VMConfig, queues int, nf netFlags) (network.Network, types.NetSetup, error) {
+	cmdcore.EnsureDiscovery(ctx, conf)
 	var netProvider network.Network
 	var err error
-	if bridgeDev != "" {
-		netProvider, err = cmdcore.InitBridgeNetwork(conf, bridgeDev)
-	} else {
+	switch {
+	case nf.passt:
+		netProvider, err = cmdcore.InitPasstNetwork(conf)
+	case nf.macvtap != "":
+		netProvider, err = cmdcore.InitMacvtapNetwork(conf, nf.macvtap)
+	case nf.vhostUser:
+		netProvider, err = cmdcore.InitVhostUserNetwork(conf)
+	case nf.bridgeDev != "":
+		netProvider, err = cmdcore.InitBridgeNetwork(conf, nf.bridgeDev)
+	default:
 		netProvider, err = cmdcore.InitNetwork(conf)
 	}
 	if err != nil {
@@ -467,14 +638,14 @@ func initNetwork(ctx context.Context, conf *config.Config, vmID string, nics int
 	if nics <= 0 && backend == types.BackendCNI && nsPath == "" {
 		return netProvider, types.NetSetup{}, nil
 	}
-	setup := types.NetSetup{NetBackend: backend, NetnsPath: nsPath, NetBridgeDev: bridgeDev}
+	setup := types.NetSetup{NetBackend: backend, NetnsPath: nsPath, NetBridgeDev: nf.bridgeDev, NetMacvtap: nf.macvtap}
 	if nics <= 0 {
 		return netProvider, setup, nil
 	}
 	// FC needs 1 TAP queue, CH needs per-vCPU; network reads vmCfg.CPU.
 	origCPU := vmCfg.CPU
 	vmCfg.CPU = queues
-	configs, err := netProvider.Add(ctx, vmID, vmCfg, network.AddRange(0, nics)...)
+	configs, err := netProvider.Add(ctx, vmID, vmCfg, network.AddRequested(nics, vmCfg.NICs)...)
 	vmCfg.CPU = origCPU
 	if err != nil {
 		rollbackNetwork(ctx, netProvider, vmID)
@@ -484,6 +655,101 @@ func initNetwork(ctx context.Context, conf *config.Config, vmID string, nics int
 	return netProvider, setup, nil
 }
 
+// checkPasst rejects what passt NICs cannot do: they have no TAP to filter or host-side address to pin, and
+// Firecracker has no vhost-user net.
+func checkPasst(conf *config.Config, vmCfg *types.VMConfig, bridgeDev string) error {
+	switch {
+	case conf.UseFirecracker:
+		return fmt.Errorf("--fc and --passt are mutually exclusive: Firecracker has no vhost-user networking")
+	case bridgeDev != "" || vmCfg.Network != "":
+		return fmt.Errorf("--passt is mutually exclusive with --bridge and --network")
+	case !vmCfg.Firewall.Empty():
+		return fmt.Errorf("--firewall, --allow and --deny-egress need a TAP: passt NICs have none to filter")
+	case slices.ContainsFunc(vmCfg.NICs, func(r types.NICSpec) bool { return r.IP != "" || r.Network != "" || r.Bridge != "" }):
+		return fmt.Errorf("--passt NICs take only --nic mac=: passt's DHCP hands out the address")
+	}
+	return nil
+}
+
+// checkMacvtap rejects what macvtap NICs cannot do: they have no TAP to filter, their guests take addresses the
+// host does not track, and Firecracker opens its TAPs by name.
+func checkMacvtap(conf *config.Config, vmCfg *types.VMConfig, spec, bridgeDev string, usePasst bool) error {
+	if _, _, err := types.ParseMacvtap(spec); err != nil {
+		return err
+	}
+	switch {
+	case conf.UseFirecracker:
+		return fmt.Errorf("--fc and --macvtap are mutually exclusive: Firecracker opens TAPs by name and cannot take a macvtap's queues")
+	case bridgeDev != "" || vmCfg.Network != "" || usePasst:
+		return fmt.Errorf("--macvtap is mutually exclusive with --bridge, --network and --passt")
+	case !vmCfg.Firewall.Empty():
+		return fmt.Errorf("--firewall, --allow and --deny-egress need a TAP: macvtap NICs have none to filter")
+	case len(vmCfg.Ports) > 0:
+		return fmt.Errorf("--publish needs a host-known guest address: macvtap guests take theirs from the parent's network")
+	case slices.ContainsFunc(vmCfg.NICs, func(r types.NICSpec) bool { return r.IP != "" || r.Network != "" || r.Bridge != "" }):
+		return fmt.Errorf("--macvtap NICs take only --nic mac=: the parent's network hands out the address")
+	}
+	return nil
+}
+
+// checkVhostUser rejects what vhost-user NICs cannot do: the switch maps guest memory and owns the datapath, so
+// there is no TAP to filter or host-known address, and Firecracker has no vhost-user net. others reports another
+// VM-wide network choice.
+func checkVhostUser(conf *config.Config, vmCfg *types.VMConfig, others bool) error {
+	switch {
+	case conf.UseFirecracker:
+		return fmt.Errorf("--fc and --vhost-user are mutually exclusive: Firecracker has no vhost-user networking")
+	case others:
+		return fmt.Errorf("--vhost-user is mutually exclusive with --bridge, --network, --passt and --macvtap")
+	case !vmCfg.SharedMemory:
+		return fmt.Errorf("--vhost-user needs --shared-memory: the switch maps guest memory (a clone inherits it from the snapshot)")
+	case !vmCfg.Firewall.Empty():
+		return fmt.Errorf("--firewall, --allow and --deny-egress need a TAP: vhost-user NICs have none to filter")
+	case len(vmCfg.Ports) > 0:
+		return fmt.Errorf("--publish needs a host-known guest address: the switch's network owns vhost-user guests' addresses")
+	case slices.ContainsFunc(vmCfg.NICs, func(r types.NICSpec) bool { return r.IP != "" || r.Network != "" || r.Bridge != "" }):
+		return fmt.Errorf("--vhost-user NICs take only --nic mac=: the switch's network hands out the address")
+	}
+	return nil
+}
+
+// resolveNICCount reconciles the NIC count with the --nic flags, which describe the leading NICs: an implicit
+// count grows to cover them, an explicit one must already.
+func resolveNICCount(nics int, explicit bool, requested int) (int, error) {
+	switch {
+	case requested <= nics:
+		return nics, nil
+	case explicit:
+		return 0, fmt.Errorf("%d --nic flags for %d NICs: raise --nics", requested, nics)
+	}
+	return requested, nil
+}
+
+// checkMACConflicts rejects a --nic mac= another VM's NIC already uses; IPs are checked by the network provider.
+func checkMACConflicts(ctx context.Context, conf *config.Config, requests []types.NICSpec) error {
+	if !slices.ContainsFunc(requests, func(r types.NICSpec) bool { return r.MAC != "" }) {
+		return nil
+	}
+	hypers, err := cmdcore.InitAllHypervisors(ctx, conf)
+	if err != nil {
+		return err
+	}
+	vms, err := cmdcore.ListAllVMs(ctx, hypers)
+	if err != nil {
+		return err
+	}
+	for _, vm := range vms {
+		for _, nc := range vm.NetworkConfigs {
+			for _, r := range requests {
+				if nc != nil && r.MAC != "" && strings.EqualFold(nc.MAC, r.MAC) {
+					return fmt.Errorf("--nic mac=%s is already used by VM %s", r.MAC, vm.Config.Name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
 func rollbackNetwork(ctx context.Context, netProvider network.Network, vmID string) {
 	if netProvider == nil {
 		return
@@ -493,6 +759,41 @@ func rollbackNetwork(ctx context.Context, netProvider network.Network, vmID stri
 	}
 }
 
+// resetCloneIdentity waits for cocoon-agent and pushes the clone's hostname, machine-id, and network config
+// so it stops answering ARP for the source VM's IP; a non-nil error means the caller should print manual hints.
+func resetCloneIdentity(ctx context.Context, cmd *cobra.Command, conf *config.Config, vm *types.VM, logger *log.Fields) error {
+	timeout, _ := cmd.Flags().GetDuration("identity-timeout")
+	switch {
+	case timeout <= 0:
+		return errIdentityResetSkipped
+	case vm.Config.Windows:
+		return fmt.Errorf("%w: Windows guest", errIdentityResetSkipped)
+	}
+	dns, err := conf.GuestDNSServers()
+	if err != nil {
+		return err
+	}
+	hyper, err := cmdcore.FindHypervisor(ctx, conf, vm.ID)
+	if err != nil {
+		return err
+	}
+	info, err := hyper.Inspect(ctx, vm.ID)
+	if err != nil {
+		return err
+	}
+
+	logger.Infof(ctx, "waiting up to %s for cocoon-agent in %s to reset guest identity ...", timeout, vm.Config.Name)
+	if err = agent.Wait(ctx, info.VsockSocket, timeout); err == nil {
+		_, err = agent.Shell(ctx, info.VsockSocket, identityScript(newCloneIdentity(vm, dns)))
+	}
+	if err != nil {
+		logger.Warnf(ctx, "guest identity reset failed, finish setup manually: %v", err)
+		return err
+	}
+	logger.Infof(ctx, "guest identity reset: hostname %s, new machine-id, %d NIC(s) reconfigured", vm.Config.Name, len(vm.NetworkConfigs))
+	return nil
+}
+
 func printPostCloneHints(vm *types.VM) {
 	if vm.Config.Windows {
 		fmt.Println()
@@ -562,13 +863,13 @@ func printOCINetworkHints(vm *types.VM) {
 		if nc == nil || nc.MAC == "" {
 			continue
 		}
-		if nc.Network != nil && nc.Network.IP != "" {
-			staticNICs = append(staticNICs, nicHint{
-				mac:    nc.MAC,
-				ip:     nc.Network.IP,
-				prefix: nc.Network.Prefix,
-				gw:     nc.Network.Gateway,
-			})
+		if n := nc.Network; n.Static() {
+			var addrs []string
+			for _, a := range n.All() {
+				addrs = append(addrs, a.CIDR())
+			}
+			gws := strings.TrimSpace(n.Gateway + " " + n.Gateway6())
+			staticNICs = append(staticNICs, nicHint{mac: nc.MAC, addrs: strings.Join(addrs, " "), gws: gws})
 		} else {
 			dhcpMACs = append(dhcpMACs, nc.MAC)
 		}
@@ -580,19 +881,21 @@ func printOCINetworkHints(vm *types.VM) {
 
 	if len(staticNICs) > 0 {
 		printBashArray("macs", staticNICs, func(n nicHint) string { return n.mac })
-		printBashArray("addrs", staticNICs, func(n nicHint) string { return fmt.Sprintf("%s/%d", n.ip, n.prefix) })
+		printBashArray("addrs", staticNICs, func(n nicHint) string { return n.addrs })
 
-		hasGW := slices.ContainsFunc(staticNICs, func(n nicHint) bool { return n.gw != "" })
+		hasGW := slices.ContainsFunc(staticNICs, func(n nicHint) bool { return n.gws != "" })
 		if hasGW {
-			printBashArray("gws", staticNICs, func(n nicHint) string { return n.gw })
+			printBashArray("gws", staticNICs, func(n nicHint) string { return n.gws })
 		}
 
 		fmt.Println("  for i in \"${!macs[@]}\"; do")
 		fmt.Println("    f=\"/etc/systemd/network/10-${macs[$i]//:/}.network\"")
-		writeNet := `    printf '[Match]\nMACAddress=` + `%s\n\n[Network]\nAddress=%s\n' "${macs[$i]}" "${addrs[$i]}" > "$f"`
+		writeNet := `    printf '[Match]\nMACAddress=` + `%s\n\n[Network]\n' "${macs[$i]}" > "$f"`
 		fmt.Println(writeNet)
+		writeAddrs := `    for a in ${addrs[$i]}; do printf 'Address=` + `%s\n' "$a" >> "$f"; done`
+		fmt.Println(writeAddrs)
 		if hasGW {
-			writeGW := `    [ -n "${gws[$i]}" ] && printf 'Gateway=` + `%s\n' "${gws[$i]}" >> "$f"`
+			writeGW := `    for g in ${gws[$i]}; do printf 'Gateway=` + `%s\n' "$g" >> "$f"; done`
 			fmt.Println(writeGW)
 		}
 		fmt.Println("  done")
@@ -602,7 +905,7 @@ func printOCINetworkHints(vm *types.VM) {
 		fmt.Println("  # DHCP NICs")
 		for _, mac := range dhcpMACs {
 			sanitized := strings.ReplaceAll(mac, ":", "")
-			writeDHCP := fmt.Sprintf(`  printf '[Match]\nMACAddress=%s\n\n[Network]\nDHCP=ipv4\n'`+` > "/etc/systemd/network/10-%s.network"`, mac, sanitized)
+			writeDHCP := fmt.Sprintf(`  printf '[Match]\nMACAddress=%s\n\n[Network]\nDHCP=yes\n'`+` > "/etc/systemd/network/10-%s.network"`, mac, sanitized)
 			fmt.Println(writeDHCP)
 		}
 	}
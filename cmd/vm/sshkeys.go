@@ -0,0 +1,105 @@
+package vm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/projecteru2/core/log"
+	"github.com/spf13/cobra"
+
+	"github.com/cocoonstack/cocoon/agent"
+	cmdcore "github.com/cocoonstack/cocoon/cmd/core"
+	"github.com/cocoonstack/cocoon/config"
+	"github.com/cocoonstack/cocoon/hypervisor"
+	"github.com/cocoonstack/cocoon/types"
+)
+
+const (
+	// sshKeyAgentProbe bounds the wait for cocoon-agent: a booting OCI guest answers within a few seconds, and an
+	// image without the agent must not stall every start and run.
+	sshKeyAgentProbe = 10 * time.Second
+	// sshKeyTimeout bounds the agent wait plus the install; OCI images have no cloud-init to fall back on.
+	sshKeyTimeout = 30 * time.Second
+)
+
+// sshKeyScript appends each stdin line to root's authorized_keys unless already present, so reruns are no-ops.
+const sshKeyScript = `set -eu
+d=$(getent passwd root 2>/dev/null | cut -d: -f6) || true
+d=${d:-/root}/.ssh
+f=$d/authorized_keys
+mkdir -p "$d"
+chmod 700 "$d"
+touch "$f"
+chmod 600 "$f"
+n=0
+while IFS= read -r k; do
+	[ -n "$k" ] || continue
+	grep -qxF "$k" "$f" || { printf '%s\n' "$k" >> "$f"; n=$((n+1)); }
+done
+echo "$n"
+`
+
+// needsAgentSSHKeys reports whether vm's keys must go through cocoon-agent: OCI images boot without cloud-init.
+// Windows guests have no POSIX shell for the script.
+func needsAgentSSHKeys(vm *types.VM) bool {
+	return len(vm.Config.SSHKeys) > 0 && !vm.Config.Windows && vm.Config.ImageType == types.ImageTypeOCI
+}
+
+// installSSHKeysFor installs keys in the freshly started or cloned VMs ids, concurrently since each may wait for
+// its agent to come up. Only OCI VMs are touched unless anyImage is set (a clone given new --ssh-key).
+func installSSHKeysFor(ctx context.Context, hyper hypervisor.Hypervisor, ids []string, anyImage bool, logger *log.Fields) {
+	var wg sync.WaitGroup
+	for _, id := range ids {
+		vm, err := hyper.Inspect(ctx, id)
+		if err != nil {
+			logger.Warnf(ctx, "ssh keys not installed in %s: %v", id, err)
+			continue
+		}
+		if anyImage || needsAgentSSHKeys(vm) {
+			wg.Go(func() { installSSHKeys(ctx, vm, logger) })
+		}
+	}
+	wg.Wait()
+}
+
+// installCloneSSHKeys pushes a clone's keys when --ssh-key added new ones: a resumed guest never reruns cloud-init.
+func installCloneSSHKeys(ctx context.Context, cmd *cobra.Command, conf *config.Config, vm *types.VM, logger *log.Fields) {
+	if !cmd.Flags().Changed("ssh-key") {
+		return
+	}
+	hyper, err := cmdcore.FindHypervisor(ctx, conf, vm.ID)
+	if err != nil {
+		logger.Warnf(ctx, "ssh keys not installed in %s: %v", vm.Config.Name, err)
+		return
+	}
+	installSSHKeysFor(ctx, hyper, []string{vm.ID}, true, logger)
+}
+
+// installSSHKeys waits for cocoon-agent and adds vm's SSHKeys to root's authorized_keys. Failures are logged, not
+// returned: the VM is already running and still reachable via console and exec.
+func installSSHKeys(ctx context.Context, vm *types.VM, logger *log.Fields) {
+	if len(vm.Config.SSHKeys) == 0 || vm.Config.Windows {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, sshKeyTimeout)
+	defer cancel()
+	err := agent.Wait(ctx, vm.VsockSocket, sshKeyAgentProbe)
+	var stdout, stderr bytes.Buffer
+	if err == nil {
+		var code int
+		code, err = agent.Run(ctx, vm.VsockSocket, []string{"/bin/sh", "-c", sshKeyScript}, nil,
+			strings.NewReader(strings.Join(vm.Config.SSHKeys, "\n")+"\n"), &stdout, &stderr)
+		if err == nil && code != 0 {
+			err = fmt.Errorf("guest script exited %d: %s", code, strings.TrimSpace(stderr.String()))
+		}
+	}
+	if err != nil {
+		logger.Warnf(ctx, "ssh keys not installed in %s, add them via `cocoon vm exec`: %v", vm.Config.Name, err)
+		return
+	}
+	logger.Infof(ctx, "ssh keys installed in %s: %s new of %d", vm.Config.Name, strings.TrimSpace(stdout.String()), len(vm.Config.SSHKeys))
+}
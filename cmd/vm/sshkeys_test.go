@@ -0,0 +1,31 @@
+package vm
+
+import (
+	"testing"
+
+	"github.com/cocoonstack/cocoon/types"
+)
+
+func TestNeedsAgentSSHKeys(t *testing.T) {
+	keys := []string{"ssh-ed25519 AAAA"}
+	tests := []struct {
+		name string
+		cfg  types.Config
+		want bool
+	}{
+		{name: "oci with keys", cfg: types.Config{ImageType: types.ImageTypeOCI, SSHKeys: keys}, want: true},
+		{name: "cloudimg uses cloud-init", cfg: types.Config{ImageType: types.ImageTypeCloudImg, SSHKeys: keys}},
+		{name: "windows", cfg: types.Config{ImageType: types.ImageTypeOCI, Windows: true, SSHKeys: keys}},
+		{name: "no keys", cfg: types.Config{ImageType: types.ImageTypeOCI}},
+	}
+	for _, tt := range tests {
+		vm := &types.VM{Config: types.VMConfig{Config: tt.cfg}}
+		if got := needsAgentSSHKeys(vm); got != tt.want {
+			t.Errorf("%s: needsAgentSSHKeys = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSSHKeyScriptSyntax(t *testing.T) {
+	assertShellSyntax(t, sshKeyScript)
+}
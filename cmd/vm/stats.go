@@ -0,0 +1,224 @@
+package vm
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/moby/term"
+	"github.com/projecteru2/core/log"
+	"github.com/spf13/cobra"
+
+	cmdcore "github.com/cocoonstack/cocoon/cmd/core"
+	"github.com/cocoonstack/cocoon/hypervisor"
+	"github.com/cocoonstack/cocoon/types"
+)
+
+// statsTarget is one VM ref and the backend that samples it.
+type statsTarget struct {
+	ref    string
+	reader hypervisor.StatsReader
+}
+
+func (h Handler) Stats(cmd *cobra.Command, args []string) error {
+	ctx, conf, err := h.Init(cmd)
+	if err != nil {
+		return err
+	}
+	targets := make([]statsTarget, 0, len(args))
+	for _, ref := range args {
+		hyper, findErr := cmdcore.FindHypervisor(ctx, conf, ref)
+		if findErr != nil {
+			return fmt.Errorf("stats %s: %w", ref, findErr)
+		}
+		reader, ok := hyper.(hypervisor.StatsReader)
+		if !ok {
+			return fmt.Errorf("stats %s: %s does not report stats", ref, hyper.Type())
+		}
+		targets = append(targets, statsTarget{ref: ref, reader: reader})
+	}
+
+	format, _ := cmd.Flags().GetString("format")
+	if watch, _ := cmd.Flags().GetBool("watch"); !watch {
+		samples, sampleErr := sampleStats(ctx, targets)
+		if sampleErr != nil {
+			return sampleErr
+		}
+		return cmdcore.OutputFormatted(cmd, samples, func(w *tabwriter.Writer) {
+			printStats(w, samples, nil)
+		})
+	}
+
+	interval, _ := cmd.Flags().GetInt("interval")
+	if interval <= 0 {
+		interval = 2 //nolint:mnd
+	}
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+	if format == "json" {
+		statsJSONLoop(ctx, targets, ticker.C)
+	} else {
+		statsRefreshLoop(ctx, targets, ticker.C, term.IsTerminal(os.Stdout.Fd()))
+	}
+	return nil
+}
+
+// sampleStats samples every target once; the first failure aborts.
+func sampleStats(ctx context.Context, targets []statsTarget) ([]*types.VMStats, error) {
+	out := make([]*types.VMStats, 0, len(targets))
+	for _, t := range targets {
+		s, err := t.reader.Stats(ctx, t.ref)
+		if err != nil {
+			return nil, fmt.Errorf("stats %s: %w", t.ref, err)
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// sampleStatsLoop is sampleStats for polling ticks: a VM that stopped is warned about and skipped.
+func sampleStatsLoop(ctx context.Context, targets []statsTarget) []*types.VMStats {
+	out := make([]*types.VMStats, 0, len(targets))
+	for _, t := range targets {
+		s, err := t.reader.Stats(ctx, t.ref)
+		if err != nil {
+			log.WithFunc("cmd.vm.stats").Warnf(ctx, "stats %s: %v", t.ref, err)
+			continue
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// statsJSONLoop prints one JSON line per VM per tick.
+func statsJSONLoop(ctx context.Context, targets []statsTarget, tick <-chan time.Time) {
+	enc := json.NewEncoder(os.Stdout)
+	runLoop(ctx, nil, tick, func() {
+		for _, s := range sampleStatsLoop(ctx, targets) {
+			_ = enc.Encode(s)
+		}
+	})
+}
+
+// statsRefreshLoop redraws the tables each tick, adding per-second rates against the previous sample.
+func statsRefreshLoop(ctx context.Context, targets []statsTarget, tick <-chan time.Time, isTTY bool) {
+	prev := map[string]*types.VMStats{}
+	runLoop(ctx, nil, tick, func() {
+		samples := sampleStatsLoop(ctx, targets)
+		if isTTY {
+			fmt.Print("\033[H\033[2J") //nolint:errcheck
+		}
+		now := time.Now()
+		fmt.Printf("Every %s — press Ctrl+C to quit (%s)\n\n",
+			now.Format(time.TimeOnly), now.Format(time.DateOnly))
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		printStats(w, samples, prev)
+		_ = w.Flush()
+		prev = make(map[string]*types.VMStats, len(samples))
+		for _, s := range samples {
+			prev[s.ID] = s
+		}
+	})
+}
+
+// printStats writes the CPU, NIC and disk tables; with prev, counters get a per-second rate since that sample.
+func printStats(w io.Writer, samples []*types.VMStats, prev map[string]*types.VMStats) {
+	fmt.Fprintln(w, "VM\tVCPU TIME\tHOST TIME") //nolint:errcheck
+	for _, s := range samples {
+		r := newStatsRate(s, prev[s.ID])
+		fmt.Fprintf(w, "%s\t%s\t%s\n", statsVMName(s), //nolint:errcheck
+			r.seconds(s.CPU.VCPUSeconds, r.prev.CPU.VCPUSeconds), r.seconds(s.CPU.HostSeconds, r.prev.CPU.HostSeconds))
+	}
+
+	fmt.Fprintln(w)                                                                //nolint:errcheck
+	fmt.Fprintln(w, "VM\tNIC\tDEVICE\tRX\tTX\tRX PKTS\tTX PKTS\tRX DROP\tTX DROP") //nolint:errcheck
+	for _, s := range samples {
+		r := newStatsRate(s, prev[s.ID])
+		for _, n := range s.NICs {
+			var (
+				p  types.NICStats
+				nr statsRate // no rate for a NIC added since the previous sample
+			)
+			for _, pn := range r.prev.NICs {
+				if pn.Index == n.Index && pn.MAC == n.MAC {
+					p, nr = pn, r
+				}
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\t%s\t%d\t%d\n", //nolint:errcheck
+				statsVMName(s), n.Index, cmp.Or(n.Device, "-"),
+				nr.bytes(n.RxBytes, p.RxBytes), nr.bytes(n.TxBytes, p.TxBytes),
+				nr.count(n.RxPackets, p.RxPackets), nr.count(n.TxPackets, p.TxPackets),
+				n.RxDropped, n.TxDropped)
+		}
+	}
+
+	fmt.Fprintln(w)                                               //nolint:errcheck
+	fmt.Fprintln(w, "VM\tDISK\tREAD\tWRITE\tREAD OPS\tWRITE OPS") //nolint:errcheck
+	for _, s := range samples {
+		r := newStatsRate(s, prev[s.ID])
+		for _, d := range s.Disks {
+			var (
+				p  types.DiskStats
+				dr statsRate
+			)
+			for _, pd := range r.prev.Disks {
+				if pd.Path == d.Path {
+					p, dr = pd, r
+				}
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", //nolint:errcheck
+				statsVMName(s), d.Name,
+				dr.bytes(d.ReadBytes, p.ReadBytes), dr.bytes(d.WriteBytes, p.WriteBytes),
+				dr.count(d.ReadOps, p.ReadOps), dr.count(d.WriteOps, p.WriteOps))
+		}
+	}
+}
+
+func statsVMName(s *types.VMStats) string {
+	return cmp.Or(s.Name, s.ID)
+}
+
+// statsRate renders a counter, followed by its per-second rate when a previous sample of the same VM exists.
+type statsRate struct {
+	prev *types.VMStats
+	secs float64
+}
+
+func newStatsRate(cur, prev *types.VMStats) statsRate {
+	if prev == nil || !cur.At.After(prev.At) {
+		return statsRate{prev: &types.VMStats{}}
+	}
+	return statsRate{prev: prev, secs: cur.At.Sub(prev.At).Seconds()}
+}
+
+func (r statsRate) bytes(cur, prev uint64) string {
+	s := units.HumanSize(float64(cur))
+	if r.secs > 0 && cur >= prev {
+		s += " (" + units.HumanSize(float64(cur-prev)/r.secs) + "/s)"
+	}
+	return s
+}
+
+func (r statsRate) count(cur, prev uint64) string {
+	s := strconv.FormatUint(cur, 10)
+	if r.secs > 0 && cur >= prev {
+		s += fmt.Sprintf(" (%.0f/s)", float64(cur-prev)/r.secs)
+	}
+	return s
+}
+
+// seconds renders CPU time; the rate is in CPUs busy, e.g. 1.50 for one and a half cores.
+func (r statsRate) seconds(cur, prev float64) string {
+	s := (time.Duration(cur * float64(time.Second))).Round(10 * time.Millisecond).String() //nolint:mnd
+	if r.secs > 0 && cur >= prev {
+		s += fmt.Sprintf(" (%.2f CPU)", (cur-prev)/r.secs)
+	}
+	return s
+}
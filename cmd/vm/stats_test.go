@@ -0,0 +1,49 @@
+package vm
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cocoonstack/cocoon/types"
+)
+
+func TestPrintStats(t *testing.T) {
+	at := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	prev := &types.VMStats{
+		ID: "vm-a", Name: "web", At: at,
+		CPU:   types.CPUStats{VCPUSeconds: 10, HostSeconds: 12},
+		NICs:  []types.NICStats{{Index: 0, MAC: "52:54:00:00:00:01", Device: "tap0", RxBytes: 1000, RxPackets: 10}},
+		Disks: []types.DiskStats{{Name: "cow", Path: "/run/cow.raw", WriteOps: 100}},
+	}
+	cur := &types.VMStats{
+		ID: "vm-a", Name: "web", At: at.Add(2 * time.Second),
+		CPU: types.CPUStats{VCPUSeconds: 13, HostSeconds: 15.5},
+		NICs: []types.NICStats{
+			{Index: 0, MAC: "52:54:00:00:00:01", Device: "tap0", RxBytes: 5000, RxPackets: 30},
+			{Index: 1, MAC: "52:54:00:00:00:02", RxBytes: 800},
+		},
+		Disks: []types.DiskStats{{Name: "cow", Path: "/run/cow.raw", WriteOps: 300}},
+	}
+
+	var once strings.Builder
+	printStats(&once, []*types.VMStats{cur}, nil)
+	if strings.Contains(once.String(), "/s)") || strings.Contains(once.String(), "CPU)") {
+		t.Errorf("one-shot output has rates:\n%s", once.String())
+	}
+
+	var watch strings.Builder
+	printStats(&watch, []*types.VMStats{cur}, map[string]*types.VMStats{"vm-a": prev})
+	out := watch.String()
+	for _, want := range []string{
+		"13s (1.50 CPU)",
+		"15.5s (1.75 CPU)",
+		"web\t0\ttap0\t5kB (2kB/s)\t0B (0B/s)\t30 (10/s)",
+		"web\t1\t-\t800B\t0B\t0\t0", // added since prev: no rate
+		"web\tcow\t0B (0B/s)\t0B (0B/s)\t0 (0/s)\t300 (100/s)",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+}
@@ -29,9 +29,9 @@ type vmEvent struct {
 }
 
 type vmSnapshot struct {
-	id, name, state, ip, image string
-	cpu                        int
-	memory                     int64
+	id, name, state, health, ip, image string
+	cpu                                int
+	memory                             int64
 }
 
 type eventEmitter struct {
@@ -85,6 +85,9 @@ func (h Handler) Status(cmd *cobra.Command, args []string) error {
 		return statusOnce(ctx, hypers, args, format)
 	}
 
+	// A long-running status also evaluates --health-cmd checks, alongside any `vm health --watch`.
+	go superviseHealth(ctx, hypers, args)
+
 	watchCh := mergeWatchChannels(ctx, hypers)
 	ticker := time.NewTicker(time.Duration(interval) * time.Second)
 	defer ticker.Stop()
@@ -212,7 +215,7 @@ func statusRefreshLoop(ctx context.Context, hypers []hypervisor.Hypervisor, filt
 }
 
 func statusEventLoop(ctx context.Context, hypers []hypervisor.Hypervisor, filters []string, watchCh <-chan struct{}, tick <-chan time.Time) {
-	fmt.Println("EVENT\tID\tNAME\tSTATE\tCPU\tMEMORY\tIP\tIMAGE") //nolint:errcheck
+	fmt.Println("EVENT\tID\tNAME\tSTATE\tHEALTH\tCPU\tMEMORY\tIP\tIMAGE") //nolint:errcheck
 
 	var w *tabwriter.Writer
 	statusEventDiffLoop(ctx, hypers, filters, watchCh, tick, eventEmitter{
@@ -276,6 +279,7 @@ func takeSnapshot(vm *types.VM, state string) vmSnapshot {
 		id:     vm.ID,
 		name:   vm.Config.Name,
 		state:  state,
+		health: healthColumn(vm, state),
 		cpu:    vm.Config.CPU,
 		memory: vm.Config.Memory,
 		ip:     vmIPs(vm),
@@ -284,8 +288,8 @@ func takeSnapshot(vm *types.VM, state string) vmSnapshot {
 }
 
 func printEventRow(w *tabwriter.Writer, event string, snap vmSnapshot) {
-	fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\n", //nolint:errcheck
-		event, snap.id, snap.name, snap.state,
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\n", //nolint:errcheck
+		event, snap.id, snap.name, snap.state, snap.health,
 		snap.cpu, units.BytesSize(float64(snap.memory)),
 		snap.ip, snap.image)
 }
@@ -339,10 +343,11 @@ func sortVMs(vms []*types.VM) {
 }
 
 func printVMTable(w *tabwriter.Writer, vms []*types.VM) {
-	fmt.Fprintln(w, "ID\tNAME\tSTATE\tCPU\tMEMORY\tSTORAGE\tIP\tIMAGE\tCREATED") //nolint:errcheck
+	fmt.Fprintln(w, "ID\tNAME\tSTATE\tHEALTH\tCPU\tMEMORY\tSTORAGE\tIP\tIMAGE\tCREATED") //nolint:errcheck
 	for _, vm := range vms {
-		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\n", //nolint:errcheck
-			vm.ID, vm.Config.Name, cmdcore.ReconcileState(vm),
+		state := cmdcore.ReconcileState(vm)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\n", //nolint:errcheck
+			vm.ID, vm.Config.Name, state, healthColumn(vm, state),
 			vm.Config.CPU, units.BytesSize(float64(vm.Config.Memory)),
 			units.BytesSize(float64(vm.Config.Storage)),
 			vmIPs(vm), vm.Config.Image,
@@ -350,11 +355,22 @@ func printVMTable(w *tabwriter.Writer, vms []*types.VM) {
 	}
 }
 
+// healthColumn is "-" unless the VM has a --health-cmd and its process is really running.
+func healthColumn(vm *types.VM, state string) string {
+	if h := vm.HealthState(); h != "" && state == string(types.VMStateRunning) {
+		return h
+	}
+	return "-"
+}
+
 func vmIPs(vm *types.VM) string {
 	var ips []string
 	for _, nc := range vm.NetworkConfigs {
-		if nc != nil && nc.Network != nil && nc.Network.IP != "" {
-			ips = append(ips, nc.Network.IP)
+		if nc == nil {
+			continue
+		}
+		for _, a := range nc.Network.All() {
+			ips = append(ips, a.IP)
 		}
 	}
 	if len(ips) == 0 {
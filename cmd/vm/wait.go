@@ -0,0 +1,181 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/projecteru2/core/log"
+	"github.com/spf13/cobra"
+
+	"github.com/cocoonstack/cocoon/agent"
+	cmdcore "github.com/cocoonstack/cocoon/cmd/core"
+	"github.com/cocoonstack/cocoon/config"
+	"github.com/cocoonstack/cocoon/hypervisor"
+	"github.com/cocoonstack/cocoon/types"
+	"github.com/cocoonstack/cocoon/utils"
+)
+
+// waitProbeTimeout bounds one guest probe so a wedged agent session cannot eat the whole --timeout budget.
+const waitProbeTimeout = 5 * time.Second
+
+// errWaitUnsatisfiable marks probe failures that retrying cannot fix (e.g. healthy on a VM without --health-cmd).
+var errWaitUnsatisfiable = errors.New("unsatisfiable")
+
+const (
+	condRunning = "running"
+	condAgent   = "agent"
+	condHealthy = "healthy"
+	condTCP     = "tcp"
+	condExec    = "exec"
+)
+
+// waitCond is one parsed --for condition; Arg is the port for tcp and the command for exec.
+type waitCond struct {
+	Kind string
+	Arg  string
+}
+
+func (c waitCond) String() string {
+	if c.Arg == "" {
+		return c.Kind
+	}
+	return c.Kind + ":" + c.Arg
+}
+
+// Wait blocks until every --for condition holds, in order, sharing one --timeout budget.
+func (h Handler) Wait(cmd *cobra.Command, args []string) error {
+	ctx, conf, err := h.Init(cmd)
+	if err != nil {
+		return err
+	}
+	logger := log.WithFunc("cmd.vm.wait")
+
+	specs, _ := cmd.Flags().GetStringArray("for")
+	conds, err := parseWaitConds(specs)
+	if err != nil {
+		return err
+	}
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	interval, _ := cmd.Flags().GetDuration("interval")
+	if timeout <= 0 || interval <= 0 {
+		return fmt.Errorf("wait: --timeout and --interval must be positive")
+	}
+
+	ref := args[0]
+	deadline := time.Now().Add(timeout)
+	for _, c := range conds {
+		var last error
+		waitErr := utils.WaitFor(ctx, time.Until(deadline), interval, func() (bool, error) {
+			ok, probeErr := probeWaitCond(ctx, conf, ref, c)
+			if probeErr != nil && !errors.Is(probeErr, errWaitUnsatisfiable) {
+				last = probeErr
+				return false, nil
+			}
+			return ok, probeErr
+		})
+		if waitErr != nil {
+			if last != nil && !errors.Is(waitErr, errWaitUnsatisfiable) {
+				return fmt.Errorf("wait: %s not met: %w (last: %v)", c, waitErr, last)
+			}
+			return fmt.Errorf("wait: %s not met: %w", c, waitErr)
+		}
+		logger.Infof(ctx, "%s: %s met", ref, c)
+	}
+	return nil
+}
+
+// probeWaitCond evaluates c once. The VM is re-resolved every time so a wait issued before `vm run` finishes
+// (or across a restart) sees the current vsock path.
+func probeWaitCond(ctx context.Context, conf *config.Config, ref string, c waitCond) (bool, error) {
+	hyper, err := cmdcore.FindHypervisor(ctx, conf, ref)
+	if err != nil {
+		return false, err
+	}
+	vm, err := hyper.Inspect(ctx, ref)
+	if err != nil {
+		return false, err
+	}
+	if state := cmdcore.ReconcileState(vm); state != string(types.VMStateRunning) {
+		return false, fmt.Errorf("vm is %s", state)
+	}
+	if c.Kind == condRunning {
+		return true, nil
+	}
+	if vm.VsockSocket == "" {
+		return false, fmt.Errorf("%w: %w (recreate the VM to enable cocoon-agent)", errWaitUnsatisfiable, agent.ErrVsockNotConfigured)
+	}
+
+	switch c.Kind {
+	case condHealthy:
+		if vm.Config.HealthCmd == "" {
+			return false, fmt.Errorf("%w: vm has no --health-cmd", errWaitUnsatisfiable)
+		}
+		health := runHealthCheck(ctx, vm)
+		recordHealth(ctx, []hypervisor.Hypervisor{hyper}, vm, health)
+		if health.Status != types.HealthHealthy {
+			return false, fmt.Errorf("%s (streak %d): %s", health.Status, health.FailingStreak, health.Output)
+		}
+		return true, nil
+	default:
+		probeCtx, cancel := context.WithTimeout(ctx, waitProbeTimeout)
+		defer cancel()
+		if c.Kind == condAgent {
+			code, runErr := agent.Run(probeCtx, vm.VsockSocket, []string{"true"}, nil, strings.NewReader(""), io.Discard, io.Discard)
+			if runErr == nil && code != 0 {
+				runErr = fmt.Errorf("probe exited %d", code)
+			}
+			return runErr == nil, runErr
+		}
+		_, runErr := agent.Shell(probeCtx, vm.VsockSocket, waitScript(c))
+		return runErr == nil, runErr
+	}
+}
+
+// waitScript is the guest-side probe for tcp and exec conditions.
+func waitScript(c waitCond) string {
+	if c.Kind == condExec {
+		return c.Arg
+	}
+	return fmt.Sprintf(`if command -v nc >/dev/null 2>&1; then exec nc -z -w 2 127.0.0.1 %[1]s
+elif command -v bash >/dev/null 2>&1; then exec bash -c 'exec 3<>/dev/tcp/127.0.0.1/%[1]s'
+fi
+echo "no tcp probe available in guest (install nc or bash)" >&2
+exit 127
+`, c.Arg)
+}
+
+// parseWaitConds accepts running, agent, healthy, tcp:PORT and exec:CMD; no --for means running.
+func parseWaitConds(specs []string) ([]waitCond, error) {
+	if len(specs) == 0 {
+		return []waitCond{{Kind: condRunning}}, nil
+	}
+	out := make([]waitCond, 0, len(specs))
+	for _, spec := range specs {
+		kind, arg, _ := strings.Cut(spec, ":")
+		switch kind {
+		case condRunning, condAgent, condHealthy:
+			if arg != "" {
+				return nil, fmt.Errorf("wait: condition %q takes no argument", kind)
+			}
+		case condTCP:
+			port, err := parsePort(arg, false)
+			if err != nil {
+				return nil, fmt.Errorf("wait: invalid condition %q: %w", spec, err)
+			}
+			arg = strconv.Itoa(port)
+		case condExec:
+			if strings.TrimSpace(arg) == "" {
+				return nil, fmt.Errorf("wait: exec condition needs a command (exec:CMD)")
+			}
+		default:
+			return nil, fmt.Errorf("wait: unknown condition %q (want running, agent, healthy, tcp:PORT or exec:CMD)", spec)
+		}
+		out = append(out, waitCond{Kind: kind, Arg: arg})
+	}
+	return out, nil
+}
@@ -0,0 +1,44 @@
+package vm
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseWaitConds(t *testing.T) {
+	got, err := parseWaitConds([]string{"running", "agent", "tcp:22", "exec:systemctl is-system-running --wait", "healthy"})
+	if err != nil {
+		t.Fatalf("parseWaitConds: %v", err)
+	}
+	want := []waitCond{
+		{Kind: condRunning},
+		{Kind: condAgent},
+		{Kind: condTCP, Arg: "22"},
+		{Kind: condExec, Arg: "systemctl is-system-running --wait"},
+		{Kind: condHealthy},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("parseWaitConds = %+v, want %+v", got, want)
+	}
+
+	if got, _ := parseWaitConds(nil); !slices.Equal(got, []waitCond{{Kind: condRunning}}) {
+		t.Errorf("no --for = %+v, want running", got)
+	}
+	for _, bad := range []string{"up", "tcp:", "tcp:0", "tcp:70000", "exec:", "exec: ", "agent:1"} {
+		if _, err := parseWaitConds([]string{bad}); err == nil {
+			t.Errorf("parseWaitConds(%q) should fail", bad)
+		}
+	}
+}
+
+func TestWaitScript(t *testing.T) {
+	script := waitScript(waitCond{Kind: condTCP, Arg: "5432"})
+	if !strings.Contains(script, "nc -z -w 2 127.0.0.1 5432") || !strings.Contains(script, "/dev/tcp/127.0.0.1/5432") {
+		t.Errorf("tcp probe missing port:\n%s", script)
+	}
+	assertShellSyntax(t, script)
+	if got := waitScript(waitCond{Kind: condExec, Arg: "test -f /ready"}); got != "test -f /ready" {
+		t.Errorf("exec probe = %q", got)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net"
 	"runtime"
+	"slices"
 	"strings"
 
 	coretypes "github.com/projecteru2/core/types"
@@ -12,6 +13,9 @@ import (
 const (
 	HypervisorCH          HypervisorType = "cloud-hypervisor"
 	HypervisorFirecracker HypervisorType = "firecracker"
+
+	SnapshotBackendLocalFile = "localfile"
+	SnapshotBackendS3        = "s3"
 )
 
 // HypervisorType identifies the selected hypervisor backend.
@@ -33,6 +37,12 @@ type Config struct {
 	// FCBinary is the path or name of the firecracker executable.
 	// Default: "firecracker".
 	FCBinary string `json:"fc_binary" mapstructure:"fc_binary"`
+	// PasstBinary is the path or name of the passt executable (--passt networking).
+	// Default: "passt".
+	PasstBinary string `json:"passt_binary" mapstructure:"passt_binary"`
+	// VhostUserHook is the executable that creates and removes userspace-switch ports (--vhost-user networking).
+	// Default: "" (--vhost-user unavailable).
+	VhostUserHook string `json:"vhost_user_hook" mapstructure:"vhost_user_hook"`
 	// UseFirecracker selects Firecracker as the hypervisor backend.
 	// Set via --fc flag. Default: false (use Cloud Hypervisor).
 	UseFirecracker bool `json:"use_firecracker,omitempty" mapstructure:"use_firecracker"`
@@ -49,16 +59,42 @@ type Config struct {
 	CNIBinDir string `json:"cni_bin_dir" mapstructure:"cni_bin_dir"`
 	// DNS: comma/semicolon-separated DNS servers injected into VM net config. Env: COCOON_DNS. Default: "8.8.8.8,1.1.1.1".
 	DNS string `json:"dns" mapstructure:"dns"`
+	// DiscoveryDNS: host IPv4 where cocoon's VM-name DNS forwarder listens, handed to VMs ahead of DNS.
+	// Env: COCOON_DISCOVERY_DNS. Default: "" (no forwarder).
+	DiscoveryDNS string `json:"discovery_dns,omitempty" mapstructure:"discovery_dns"`
 	// SocketWaitTimeoutSeconds is how long to wait for the CH API socket
 	// after process start. Default: 5. Increase for slow storage.
 	SocketWaitTimeoutSeconds int `json:"socket_wait_timeout_seconds" mapstructure:"socket_wait_timeout_seconds"`
 	// TerminateGracePeriodSeconds is the SIGTERM→SIGKILL window when
 	// force-killing a CH process. Default: 5.
 	TerminateGracePeriodSeconds int `json:"terminate_grace_period_seconds" mapstructure:"terminate_grace_period_seconds"`
+	// SnapshotBackend selects the snapshot store: "localfile" or "s3".
+	// Env: COCOON_SNAPSHOT_BACKEND. Default: "localfile".
+	SnapshotBackend string `json:"snapshot_backend,omitempty" mapstructure:"snapshot_backend"`
+	// S3 configures the s3 snapshot backend; required when SnapshotBackend is "s3".
+	S3 *S3Config `json:"s3,omitempty" mapstructure:"s3"`
 	// Log configuration, uses eru core's ServerLogConfig.
 	Log *coretypes.ServerLogConfig `json:"log" mapstructure:"log"`
 }
 
+// S3Config points the s3 snapshot backend at an S3-compatible bucket.
+// Empty credentials fall back to AWS_*/MINIO_* env, ~/.aws/credentials, then instance IAM.
+type S3Config struct {
+	// Endpoint is host[:port] without scheme, e.g. "s3.us-east-1.amazonaws.com" or "127.0.0.1:9000".
+	Endpoint string `json:"endpoint" mapstructure:"endpoint"`
+	Region   string `json:"region,omitempty" mapstructure:"region"`
+	Bucket   string `json:"bucket" mapstructure:"bucket"`
+	// Prefix namespaces all keys so several clusters can share a bucket.
+	Prefix          string `json:"prefix,omitempty" mapstructure:"prefix"`
+	AccessKeyID     string `json:"access_key_id,omitempty" mapstructure:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key,omitempty" mapstructure:"secret_access_key"`
+	// Insecure talks plain HTTP (local MinIO and other test stand-ins).
+	Insecure bool `json:"insecure,omitempty" mapstructure:"insecure"`
+	// PartSizeMB is the multipart upload part size. Default: 64. A snapshot upload buffers up to
+	// min(pool_size, 4) parts in memory, 256 MiB at the default.
+	PartSizeMB int `json:"part_size_mb,omitempty" mapstructure:"part_size_mb"`
+}
+
 // Hypervisor returns the selected hypervisor backend type.
 func (c *Config) Hypervisor() HypervisorType {
 	if c.UseFirecracker {
@@ -93,10 +129,26 @@ func (c *Config) Validate() error {
 	if _, err := c.DNSServers(); err != nil {
 		return fmt.Errorf("dns: %w", err)
 	}
+	if c.DiscoveryDNS != "" && net.ParseIP(c.DiscoveryDNS).To4() == nil {
+		return fmt.Errorf("discovery_dns: %q is not an IPv4 address", c.DiscoveryDNS)
+	}
+	switch c.SnapshotBackend {
+	case "", SnapshotBackendLocalFile:
+	case SnapshotBackendS3:
+		if c.S3 == nil || c.S3.Endpoint == "" || c.S3.Bucket == "" {
+			return fmt.Errorf("snapshot_backend %q requires s3.endpoint and s3.bucket", SnapshotBackendS3)
+		}
+		if c.S3.PartSizeMB < 0 {
+			return fmt.Errorf("s3.part_size_mb must be >= 0, got %d", c.S3.PartSizeMB)
+		}
+	default:
+		return fmt.Errorf("unknown snapshot_backend %q (want %s or %s)", c.SnapshotBackend, SnapshotBackendLocalFile, SnapshotBackendS3)
+	}
 	return nil
 }
 
 // DNSServers parses the DNS string into a slice of server addresses.
+// IPv6 entries may be bracketed ("[2606:4700:4700::1111]") and come back bare.
 // Returns an error if any entry is not a valid IP address.
 func (c *Config) DNSServers() ([]string, error) {
 	if c.DNS == "" {
@@ -109,10 +161,25 @@ func (c *Config) DNSServers() ([]string, error) {
 		if s == "" {
 			continue
 		}
-		if net.ParseIP(s) == nil {
+		addr := s
+		if strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
+			addr = s[1 : len(s)-1]
+		}
+		ip := net.ParseIP(addr)
+		if ip == nil {
 			return nil, fmt.Errorf("invalid DNS server address %q", s)
 		}
-		servers = append(servers, s)
+		servers = append(servers, ip.String())
 	}
 	return servers, nil
 }
+
+// GuestDNSServers is DNSServers with the discovery forwarder first, the list VMs are configured with.
+func (c *Config) GuestDNSServers() ([]string, error) {
+	servers, err := c.DNSServers()
+	if err != nil || c.DiscoveryDNS == "" {
+		return servers, err
+	}
+	fwd := net.ParseIP(c.DiscoveryDNS).String()
+	return append([]string{fwd}, slices.DeleteFunc(servers, func(s string) bool { return s == fwd })...), nil
+}
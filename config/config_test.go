@@ -1,6 +1,7 @@
 package config
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -78,6 +79,9 @@ func TestDNSServers(t *testing.T) {
 		{"with spaces", " 8.8.8.8 , 1.1.1.1 ", 2, false},
 		{"invalid", "not-an-ip", 0, true},
 		{"mixed valid invalid", "8.8.8.8,bad", 0, true},
+		{"ipv6", "2606:4700:4700::1111,8.8.8.8", 2, false},
+		{"bracketed ipv6", "[2001:4860:4860::8888]", 1, false},
+		{"unbalanced brackets", "[2001:4860:4860::8888", 0, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -98,3 +102,76 @@ func TestDNSServers(t *testing.T) {
 		})
 	}
 }
+
+func TestGuestDNSServers(t *testing.T) {
+	tests := []struct {
+		name      string
+		dns       string
+		discovery string
+		want      string
+	}{
+		{"no forwarder", "8.8.8.8,1.1.1.1", "", "8.8.8.8,1.1.1.1"},
+		{"forwarder first", "8.8.8.8,1.1.1.1", "10.88.0.1", "10.88.0.1,8.8.8.8,1.1.1.1"},
+		{"forwarder not repeated", "8.8.8.8,10.88.0.1", "10.88.0.1", "10.88.0.1,8.8.8.8"},
+		{"forwarder only", "", "10.88.0.1", "10.88.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Config{DNS: tt.dns, DiscoveryDNS: tt.discovery}
+			got, err := c.GuestDNSServers()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if strings.Join(got, ",") != tt.want {
+				t.Errorf("got %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate_DiscoveryDNS(t *testing.T) {
+	c := &Config{
+		RootDir:            "/var/lib/cocoon",
+		RunDir:             "/var/lib/cocoon/run",
+		LogDir:             "/var/log/cocoon",
+		StopTimeoutSeconds: 30,
+		DiscoveryDNS:       "fd00::1",
+	}
+	if err := c.Validate(); err == nil {
+		t.Fatal("expected error for IPv6 discovery_dns")
+	}
+	c.DiscoveryDNS = "10.88.0.1"
+	if err := c.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestValidate_SnapshotBackend(t *testing.T) {
+	base := Config{
+		RootDir:            "/var/lib/cocoon",
+		RunDir:             "/var/lib/cocoon/run",
+		LogDir:             "/var/log/cocoon",
+		StopTimeoutSeconds: 30,
+	}
+	tests := []struct {
+		name    string
+		backend string
+		s3      *S3Config
+		wantErr bool
+	}{
+		{name: "default", backend: ""},
+		{name: "localfile", backend: SnapshotBackendLocalFile},
+		{name: "s3", backend: SnapshotBackendS3, s3: &S3Config{Endpoint: "127.0.0.1:9000", Bucket: "snaps"}},
+		{name: "s3 without config", backend: SnapshotBackendS3, wantErr: true},
+		{name: "s3 without bucket", backend: SnapshotBackendS3, s3: &S3Config{Endpoint: "127.0.0.1:9000"}, wantErr: true},
+		{name: "unknown", backend: "nfs", wantErr: true},
+	}
+	for _, tt := range tests {
+		c := base
+		c.SnapshotBackend = tt.backend
+		c.S3 = tt.s3
+		if err := c.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate() = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -35,6 +35,26 @@ func Relay(rw io.ReadWriter, escapeKeys []byte) error {
 	return err
 }
 
+// DetachReader wraps r with escape-sequence detection: once escapeKeys are typed it calls detach and reports EOF.
+func DetachReader(r io.Reader, escapeKeys []byte, detach func()) io.Reader {
+	return detachReader{r: term.NewEscapeProxy(r, escapeKeys), detach: detach}
+}
+
+type detachReader struct {
+	r      io.Reader
+	detach func()
+}
+
+func (d detachReader) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	var escErr term.EscapeError
+	if errors.As(err, &escErr) {
+		d.detach()
+		return n, io.EOF
+	}
+	return n, err
+}
+
 func FormatEscapeChar(b byte) string {
 	if b >= 1 && b <= 0x1F {
 		return "^" + string(rune(b+'@'))
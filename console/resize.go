@@ -18,12 +18,17 @@ func HandleResize(localFd, remoteFd uintptr) func() {
 		}
 	}
 	syncSize()
+	return OnResize(syncSize)
+}
 
+// OnResize runs fn on every SIGWINCH (serially, coalescing bursts) until the returned cleanup is called.
+// For remote terminals that are not a local fd, e.g. a guest PTY reached through cocoon-agent.
+func OnResize(fn func()) func() {
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGWINCH)
 	go func() {
 		for range sigCh {
-			syncSize()
+			fn()
 		}
 	}()
 
@@ -136,6 +136,7 @@ bin_to_pkg() {
         qemu-img)   echo "qemu-utils" ;;
         mkfs.erofs) echo "erofs-utils" ;;
         mkfs.ext4)  echo "e2fsprogs" ;;
+        passt)      echo "passt" ;;
         *)          echo "" ;;
     esac
 }
@@ -152,6 +153,8 @@ check_binary() {
             zstd)             ver=$("$name" --version 2>/dev/null | head -1) || true ;;
             mkfs.ext4)        ver=$("$name" -V 2>&1 | head -1) || true ;;
             mkfs.erofs)       ver=$("$name" --version 2>&1 | head -1) || true ;;
+            nft)              ver=$("$name" --version 2>/dev/null | head -1) || true ;;
+            passt)            ver=$("$name" --version 2>/dev/null | head -1) || true ;;
         esac
         pass "${name}${ver:+ ($ver)}"
     else
@@ -183,6 +186,18 @@ else
 fi
 check_binary mkfs.ext4
 check_binary mkfs.erofs
+# nft is optional — only needed for --publish / vm port.
+if command -v nft &>/dev/null; then
+    check_binary nft
+else
+    warn "nft not found (optional, needed for --publish port publishing)"
+fi
+# passt is optional — only needed for --passt user-mode networking.
+if command -v passt &>/dev/null; then
+    check_binary passt
+else
+    warn "passt not found (optional, needed for --passt networking)"
+fi
 
 # ---------------------------------------------------------------------------
 # 2. Firmware
@@ -8,6 +8,7 @@ import (
 	"os/exec"
 	"time"
 
+	"github.com/cocoonstack/cocoon/agent"
 	"github.com/cocoonstack/cocoon/lock"
 	"github.com/cocoonstack/cocoon/lock/flock"
 	"github.com/cocoonstack/cocoon/metering"
@@ -24,7 +25,7 @@ const (
 	// VsockGuestCID is constant — per-VM isolation comes from distinct UDS paths.
 	VsockGuestCID = 3
 	// VsockAgentPort is the cocoon-agent listen port.
-	VsockAgentPort = 1024
+	VsockAgentPort = agent.Port
 
 	// CowSerial is the well-known virtio serial for the COW disk attached to OCI VMs.
 	CowSerial = "cocoon-cow"
@@ -0,0 +1,133 @@
+package hypervisor
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/projecteru2/core/log"
+
+	"github.com/cocoonstack/cocoon/agent"
+	"github.com/cocoonstack/cocoon/types"
+)
+
+const (
+	// clockAgentProbe bounds the wait for cocoon-agent; a resumed guest that has one answers at once,
+	// so images without the agent skip the sync quickly instead of stalling every clone and restore.
+	clockAgentProbe = 5 * time.Second
+	// clockSyncTimeout bounds the probe plus the step itself; a resumed guest that misses it keeps its stale clock.
+	clockSyncTimeout = 30 * time.Second
+)
+
+// ptpClockScript steps the guest clock from the KVM PTP clock (ptp_kvm reads the host's clock directly, no RTT skew).
+const ptpClockScript = `set -eu
+modprobe ptp_kvm 2>/dev/null || true
+dev=
+for c in /sys/class/ptp/ptp*; do
+	if [ "$(cat "$c/clock_name" 2>/dev/null)" = "KVM virtual PTP" ]; then dev=/dev/${c##*/}; break; fi
+done
+[ -n "$dev" ] || { echo "no KVM PTP clock (ptp_kvm not available)" >&2; exit 1; }
+command -v phc_ctl >/dev/null 2>&1 || { echo "phc_ctl not installed (linuxptp)" >&2; exit 1; }
+t=$(phc_ctl "$dev" get | sed -n 's/.*clock time is \([0-9.]*\).*/\1/p')
+[ -n "$t" ] || { echo "cannot read $dev" >&2; exit 1; }
+before=$(date +%s.%N)
+date -u -s "@$t" >/dev/null
+echo "$before $(date +%s.%N)"
+`
+
+// SyncGuestClock steps a just-resumed guest's wall clock, which is frozen at snapshot time, and records the outcome
+// on the VM record and vm.LastClockSync. Both modes run through cocoon-agent; failures are recorded, never returned:
+// the VM is already running and usable.
+func (b *Backend) SyncGuestClock(ctx context.Context, vm *types.VM) {
+	mode := cmp.Or(vm.Config.ClockSync, types.ClockSyncAgent)
+	if mode == types.ClockSyncOff || vm.Config.Windows {
+		return
+	}
+	result := types.ClockSyncResult{Method: mode}
+	offset, err := b.stepGuestClock(ctx, vm.ID, mode)
+	result.At = time.Now().UTC()
+	if err != nil {
+		result.Error = err.Error()
+	} else {
+		result.OffsetSeconds = offset
+	}
+	if recErr := b.RecordClockSync(ctx, vm.ID, result); recErr != nil {
+		log.WithFunc(b.Typ+".SyncGuestClock").Warnf(ctx, "record clock sync for %s: %v", vm.ID, recErr)
+	}
+	vm.LastClockSync = &result
+}
+
+func (b *Backend) stepGuestClock(ctx context.Context, vmID, mode string) (float64, error) {
+	rec, err := b.LoadRecord(ctx, vmID)
+	if err != nil {
+		return 0, err
+	}
+	vsock := b.ToVM(&rec).VsockSocket
+	ctx, cancel := context.WithTimeout(ctx, clockSyncTimeout)
+	defer cancel()
+	if err = agent.Wait(ctx, vsock, clockAgentProbe); err != nil {
+		return 0, fmt.Errorf("skipped, no cocoon-agent: %w", err)
+	}
+	script := ptpClockScript
+	if mode == types.ClockSyncAgent {
+		// Rendered after the agent answers so the pushed timestamp is as fresh as possible.
+		script = agentClockScript(time.Now())
+	}
+	out, err := agent.Shell(ctx, vsock, script)
+	if err != nil {
+		return 0, err
+	}
+	return parseClockStep(out)
+}
+
+// agentClockScript sets the guest clock to now; busybox date lacks sub-second @ input, hence the whole-second fallback.
+func agentClockScript(now time.Time) string {
+	ts := fmt.Sprintf("%d.%09d", now.Unix(), now.Nanosecond())
+	return fmt.Sprintf(`set -eu
+before=$(date +%%s.%%N)
+date -u -s @%s >/dev/null 2>&1 || date -u -s @%d >/dev/null
+echo "$before $(date +%%s.%%N)"
+`, ts, now.Unix())
+}
+
+// parseClockStep turns the scripts' "BEFORE AFTER" epoch pair into the applied offset.
+func parseClockStep(out string) (float64, error) {
+	fields := strings.Fields(out)
+	if len(fields) != 2 {
+		return 0, fmt.Errorf("unexpected clock step output %q", strings.TrimSpace(out))
+	}
+	before, err := parseEpoch(fields[0])
+	if err != nil {
+		return 0, err
+	}
+	after, err := parseEpoch(fields[1])
+	if err != nil {
+		return 0, err
+	}
+	return after - before, nil
+}
+
+// parseEpoch accepts "%s.%N" output; busybox prints a literal "N" for %N, which is dropped.
+func parseEpoch(s string) (float64, error) {
+	s = strings.TrimSuffix(s, ".N")
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse guest time %q: %w", s, err)
+	}
+	return v, nil
+}
+
+// RecordClockSync stores the latest guest clock-step outcome on the VM record.
+func (b *Backend) RecordClockSync(ctx context.Context, vmID string, result types.ClockSyncResult) error {
+	return b.DB.Update(ctx, func(idx *VMIndex) error {
+		r, err := idx.GetRecord(vmID)
+		if err != nil {
+			return err
+		}
+		r.LastClockSync = &result
+		return nil
+	})
+}
@@ -0,0 +1,90 @@
+package hypervisor
+
+import (
+	"math"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cocoonstack/cocoon/types"
+)
+
+func TestAgentClockScript(t *testing.T) {
+	script := agentClockScript(time.Unix(1767225600, 5_000_000))
+	for _, want := range []string{
+		"date -u -s @1767225600.005000000 >/dev/null 2>&1 || date -u -s @1767225600 >/dev/null",
+		`echo "$before $(date +%s.%N)"`,
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("script missing %q:\n%s", want, script)
+		}
+	}
+	assertShellSyntax(t, script)
+}
+
+func TestPTPClockScript(t *testing.T) {
+	if !strings.Contains(ptpClockScript, `"KVM virtual PTP"`) {
+		t.Error("PTP script must select the KVM clock")
+	}
+	assertShellSyntax(t, ptpClockScript)
+}
+
+func TestParseClockStep(t *testing.T) {
+	tests := []struct {
+		out     string
+		want    float64
+		wantErr bool
+	}{
+		{out: "1767225000.250000000 1767225600.500000000\n", want: 600.25},
+		{out: "1767225600.N 1767225500.N", want: -100},
+		{out: "1767225600.1", wantErr: true},
+		{out: "abc def", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseClockStep(tt.out)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseClockStep(%q) err = %v, wantErr %v", tt.out, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && math.Abs(got-tt.want) > 1e-6 {
+			t.Errorf("parseClockStep(%q) = %v, want %v", tt.out, got, tt.want)
+		}
+	}
+}
+
+func TestSyncGuestClockRecordsOutcome(t *testing.T) {
+	b, _ := newMeteringTestBackend(t)
+	ctx := t.Context()
+	seedVMRecord(t, b, "vm1", 2, 2<<30, 20<<30, true)
+
+	vm := &types.VM{ID: "vm1"}
+	b.SyncGuestClock(ctx, vm)
+	if r := vm.LastClockSync; r == nil || r.Method != types.ClockSyncAgent || !strings.Contains(r.Error, "no cocoon-agent") {
+		t.Fatalf("LastClockSync = %+v, want an agent-mode skip", r)
+	}
+	loaded, err := b.LoadRecord(ctx, "vm1")
+	if err != nil {
+		t.Fatalf("LoadRecord: %v", err)
+	}
+	if loaded.LastClockSync == nil || loaded.LastClockSync.Error != vm.LastClockSync.Error {
+		t.Errorf("persisted LastClockSync %+v, want %+v", loaded.LastClockSync, vm.LastClockSync)
+	}
+
+	off := &types.VM{ID: "vm1", Config: types.VMConfig{Config: types.Config{ClockSync: types.ClockSyncOff}}}
+	b.SyncGuestClock(ctx, off)
+	if off.LastClockSync != nil {
+		t.Errorf("clock-sync off still stepped: %+v", off.LastClockSync)
+	}
+}
+
+func assertShellSyntax(t *testing.T, script string) {
+	t.Helper()
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no sh on PATH")
+	}
+	if out, err := exec.Command(sh, "-n", "-c", script).CombinedOutput(); err != nil { //nolint:gosec
+		t.Errorf("sh -n: %v: %s", err, out)
+	}
+}
@@ -85,8 +85,10 @@ func (b *Backend) CloneFromStream(
 	return afterExtract(ctx, vmID, vmCfg, net, runDir, logDir, now, snapshotConfig.ID)
 }
 
-// FinalizeClone persists the record and emits the clone open-interval pair.
+// FinalizeClone persists the record (stamping its source snapshot for lineage), emits the clone open-interval pair,
+// and steps the resumed guest's clock.
 func (b *Backend) FinalizeClone(ctx context.Context, vmID string, info *types.VM, bootCfg *types.BootConfig, blobIDs map[string]struct{}, sourceSnapshotID string) error {
+	info.SourceSnapshotID = sourceSnapshotID
 	if err := b.DB.Update(ctx, func(idx *VMIndex) error {
 		r, err := idx.GetRecord(vmID)
 		if err != nil {
@@ -103,5 +105,6 @@ func (b *Backend) FinalizeClone(ctx context.Context, vmID string, info *types.VM
 		return err
 	}
 	b.emitOpenInterval(ctx, info, metering.ReasonClone, sourceSnapshotID, time.Now())
+	b.SyncGuestClock(ctx, info)
 	return nil
 }
@@ -21,11 +21,17 @@ type chVMConfig struct {
 
 type chNet struct {
 	ID        string `json:"id,omitempty"`
-	TAP       string `json:"tap"`
+	TAP       string `json:"tap,omitempty"`
 	MAC       string `json:"mac,omitempty"`
 	NumQueues int    `json:"num_queues,omitempty"`
 	QueueSize int    `json:"queue_size,omitempty"`
 
+	FDs []int `json:"fds,omitempty"` // inherited macvtap queue fds, CLI only (vm.add-net takes them over SCM_RIGHTS)
+
+	VhostUser   bool   `json:"vhost_user,omitempty"`
+	VhostSocket string `json:"vhost_socket,omitempty"`
+	VhostMode   string `json:"vhost_mode,omitempty"` // "Server" when CH listens on VhostSocket; CH defaults to "Client"
+
 	OffloadTSO  bool `json:"offload_tso,omitempty"`
 	OffloadUFO  bool `json:"offload_ufo,omitempty"`
 	OffloadCsum bool `json:"offload_csum,omitempty"`
@@ -119,7 +125,11 @@ type chVMInfoConfig struct {
 	Serial  chRuntimeFile `json:"serial"`
 	Console chRuntimeFile `json:"console"`
 	Memory  chMemory      `json:"memory"`
+	Disks   []chDisk      `json:"disks,omitempty"`
 	Fs      []chFs        `json:"fs,omitempty"`
 	Devices []chDevice    `json:"devices,omitempty"`
 	Nets    []chNet       `json:"net,omitempty"`
 }
+
+// chCounters is the vm.counters response: device id → counter name → cumulative value.
+type chCounters map[string]map[string]uint64
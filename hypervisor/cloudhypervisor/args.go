@@ -170,6 +170,28 @@ func buildCLIArgs(cfg *chVMConfig, socketPath string) []string {
 }
 
 func networkConfigToNet(nc *types.NetworkConfig) chNet {
+	if nc.VhostSocket != "" {
+		// Offloads are negotiated with the vhost-user backend, not set on a TAP.
+		return chNet{
+			MAC:         nc.MAC,
+			NumQueues:   nc.NumQueues,
+			QueueSize:   nc.QueueSize,
+			VhostUser:   true,
+			VhostSocket: nc.VhostSocket,
+			VhostMode:   vhostMode(nc.VhostMode),
+		}
+	}
+	if nc.Backend == types.BackendMacvtap {
+		// CH cannot open a macvtap by name; its queues are passed as fds (macvtapFiles, hotAddNIC).
+		return chNet{
+			MAC:         nc.MAC,
+			NumQueues:   nc.NumQueues,
+			QueueSize:   nc.QueueSize,
+			OffloadTSO:  true,
+			OffloadUFO:  true,
+			OffloadCsum: true,
+		}
+	}
 	return chNet{
 		TAP:         nc.TAP,
 		MAC:         nc.MAC,
@@ -181,6 +203,14 @@ func networkConfigToNet(nc *types.NetworkConfig) chNet {
 	}
 }
 
+// vhostMode maps NetworkConfig.VhostMode to CH's enum.
+func vhostMode(mode string) string {
+	if mode == types.VhostServer {
+		return "Server"
+	}
+	return ""
+}
+
 // cocoonNetID is the deterministic CH device id for a cocoon-managed NIC.
 func cocoonNetID(mac string) string {
 	return cocoonNetIDPrefix + strings.ReplaceAll(mac, ":", "")
@@ -244,7 +274,20 @@ func diskToCLIArg(d chDisk) string {
 
 func netToCLIArg(n chNet) string {
 	var b kvBuilder
-	b.add("tap=" + n.TAP)
+	switch {
+	case n.VhostUser:
+		b.add("vhost_user=on")
+		b.add("socket=" + n.VhostSocket)
+		b.addIf(n.VhostMode != "", "vhost_mode="+strings.ToLower(n.VhostMode))
+	case len(n.FDs) > 0:
+		fds := make([]string, len(n.FDs))
+		for i, fd := range n.FDs {
+			fds[i] = strconv.Itoa(fd)
+		}
+		b.add("fd=[" + strings.Join(fds, ",") + "]")
+	default:
+		b.add("tap=" + n.TAP)
+	}
 	b.addIf(n.MAC != "", "mac="+n.MAC)
 	b.addIf(n.NumQueues > 0, fmt.Sprintf("num_queues=%d", n.NumQueues))
 	b.addIf(n.QueueSize > 0, fmt.Sprintf("queue_size=%d", n.QueueSize))
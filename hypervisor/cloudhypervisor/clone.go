@@ -85,6 +85,7 @@ func (ch *CloudHypervisor) cloneAfterExtract(ctx context.Context, vmID string, v
 		directBoot:     directBoot,
 		diskQueueSize:  vmCfg.DiskQueueSize,
 		noDirectIO:     vmCfg.NoDirectIO,
+		vhostNets:      networkConfigs,
 	}); err != nil {
 		return nil, fmt.Errorf("patch CH config: %w", err)
 	}
@@ -95,7 +96,7 @@ func (ch *CloudHypervisor) cloneAfterExtract(ctx context.Context, vmID string, v
 	}
 
 	if directBoot && bootCfg != nil {
-		dns, dnsErr := ch.conf.DNSServers()
+		dns, dnsErr := ch.conf.GuestDNSServers()
 		if dnsErr != nil {
 			return nil, fmt.Errorf("parse DNS servers: %w", dnsErr)
 		}
@@ -285,6 +285,45 @@ func TestPatchCHConfig_DiskCountMismatch(t *testing.T) {
 	}
 }
 
+func TestPatchCHConfig_VhostNets(t *testing.T) {
+	vhostCfg := func() map[string]any {
+		cfg := baseCHConfig()
+		cfg["net"] = append(cfg["net"].([]any), map[string]any{
+			"id":           "_net1",
+			"mac":          "aa:bb:cc:dd:ee:f1",
+			"vhost_user":   true,
+			"vhost_socket": "/run/src-1.sock",
+			"vhost_mode":   "Server",
+		})
+		return cfg
+	}
+	clonedNets := []*types.NetworkConfig{
+		{TAP: "new-tap0", Backend: types.BackendBridge},
+		{Backend: types.BackendVhostUser, VhostSocket: "/var/run/openvswitch/vhu-clone"},
+	}
+
+	path := writeCHConfig(t, t.TempDir(), vhostCfg())
+	opts := basePatchOpts()
+	opts.vhostNets = clonedNets
+	if err := patchCHConfig(path, opts); err != nil {
+		t.Fatal(err)
+	}
+	nets := readRawJSON(t, path)["net"].([]any)
+	if tap := nets[0].(map[string]any)["tap"]; tap != "old-tap0" {
+		t.Errorf("TAP NIC touched: tap=%v", tap)
+	}
+	net1 := nets[1].(map[string]any)
+	if net1["vhost_socket"] != "/var/run/openvswitch/vhu-clone" || net1["vhost_mode"] != "Client" || net1["id"] != "_net1" {
+		t.Errorf("vhost NIC not retargeted: %v", net1)
+	}
+
+	path = writeCHConfig(t, t.TempDir(), vhostCfg())
+	opts.vhostNets = clonedNets[:1]
+	if err := patchCHConfig(path, opts); err == nil || !strings.Contains(err.Error(), "--vhost-user") {
+		t.Errorf("clone without a vhost-user NIC in place: %v", err)
+	}
+}
+
 // updateCOWPath
 
 func TestUpdateCOWPath_OCI(t *testing.T) {
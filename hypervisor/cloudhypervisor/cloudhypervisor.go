@@ -13,9 +13,12 @@ const typ = "cloud-hypervisor"
 
 // compile-time interface checks.
 var (
-	_ hypervisor.Hypervisor = (*CloudHypervisor)(nil)
-	_ hypervisor.Direct     = (*CloudHypervisor)(nil)
-	_ hypervisor.Watchable  = (*CloudHypervisor)(nil)
+	_ hypervisor.Hypervisor       = (*CloudHypervisor)(nil)
+	_ hypervisor.Direct           = (*CloudHypervisor)(nil)
+	_ hypervisor.Watchable        = (*CloudHypervisor)(nil)
+	_ hypervisor.HealthRecorder   = (*CloudHypervisor)(nil)
+	_ hypervisor.PortRecorder     = (*CloudHypervisor)(nil)
+	_ hypervisor.FirewallRecorder = (*CloudHypervisor)(nil)
 )
 
 // CloudHypervisor implements hypervisor.Hypervisor.
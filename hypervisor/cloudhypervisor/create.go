@@ -40,7 +40,7 @@ func (ch *CloudHypervisor) prepareOCI(ctx context.Context, vmID string, vmCfg *t
 		return nil, err
 	}
 	storageConfigs = append(storageConfigs, dataDisks...)
-	dns, err := ch.conf.DNSServers()
+	dns, err := ch.conf.GuestDNSServers()
 	if err != nil {
 		return nil, fmt.Errorf("parse DNS servers: %w", err)
 	}
@@ -90,7 +90,7 @@ func (ch *CloudHypervisor) prepareCloudimg(ctx context.Context, vmID string, vmC
 
 // generateCidata writes the NoCloud cidata image. storageConfigs lets cidata pick up Role==Data disks for auto-mount via /dev/disk/by-id/virtio-<serial>.
 func (ch *CloudHypervisor) generateCidata(vmID string, vmCfg *types.VMConfig, networkConfigs []*types.NetworkConfig, storageConfigs []*types.StorageConfig) error {
-	dns, err := ch.conf.DNSServers()
+	dns, err := ch.conf.GuestDNSServers()
 	if err != nil {
 		return fmt.Errorf("parse DNS servers: %w", err)
 	}
@@ -99,6 +99,9 @@ func (ch *CloudHypervisor) generateCidata(vmID string, vmCfg *types.VMConfig, ne
 		Hostname:   vmCfg.Name,
 		Username:   vmCfg.User,
 		Password:   vmCfg.Password,
+		SSHKeys:    vmCfg.SSHKeys,
+		UserData:   vmCfg.UserData,
+		VendorData: vmCfg.VendorData,
 		DNS:        dns,
 		Mounts:     buildMountSpecs(storageConfigs),
 	}
@@ -111,6 +114,10 @@ func (ch *CloudHypervisor) generateCidata(vmID string, vmCfg *types.VMConfig, ne
 			ni.IP = n.Network.IP
 			ni.Prefix = n.Network.Prefix
 			ni.Gateway = n.Network.Gateway
+			ni.Gateway6 = n.Network.Gateway6()
+			for _, a := range n.Network.Addresses {
+				ni.Addresses = append(ni.Addresses, a.CIDR())
+			}
 		}
 		metaCfg.Networks = append(metaCfg.Networks, ni)
 	}
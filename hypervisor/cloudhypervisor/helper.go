@@ -226,6 +226,19 @@ func getVMInfo(ctx context.Context, hc *http.Client) (*chVMInfoResponse, error)
 	return &info, nil
 }
 
+// getVMCounters fetches vm.counters, the per-device I/O counters of every virtio device CH emulates.
+func getVMCounters(ctx context.Context, hc *http.Client) (chCounters, error) {
+	body, err := utils.DoAPI(ctx, hc, http.MethodGet, "http://localhost/api/v1/vm.counters", nil, http.StatusOK)
+	if err != nil {
+		return nil, fmt.Errorf("query vm.counters: %w", err)
+	}
+	var counters chCounters
+	if err := json.Unmarshal(body, &counters); err != nil {
+		return nil, fmt.Errorf("decode vm.counters: %w", err)
+	}
+	return counters, nil
+}
+
 func decodePciDeviceInfo(resp []byte) (chPciDeviceInfo, error) {
 	if len(resp) == 0 {
 		return chPciDeviceInfo{}, nil
@@ -0,0 +1,48 @@
+package cloudhypervisor
+
+import (
+	"context"
+	"net/http"
+	"os"
+
+	"github.com/cocoonstack/cocoon/network"
+	"github.com/cocoonstack/cocoon/types"
+	"github.com/cocoonstack/cocoon/utils"
+)
+
+// firstExtraFD is the fd number of cmd.ExtraFiles[0] in the child.
+const firstExtraFD = 3
+
+// macvtapFiles opens the queues of each macvtap NIC and points its --net at them, numbered as CH's ExtraFiles.
+// cfg.Nets follows ncs; the caller closes the files once CH has started.
+func macvtapFiles(cfg *chVMConfig, ncs []*types.NetworkConfig) ([]*os.File, error) {
+	var files []*os.File
+	for i, nc := range ncs {
+		if nc.Backend != types.BackendMacvtap {
+			continue
+		}
+		queues, err := network.OpenMacvtap(nc.TAP, nc.NumQueues/2) //nolint:mnd
+		if err != nil {
+			utils.CloseFiles(files)
+			return nil, err
+		}
+		for _, q := range queues {
+			cfg.Nets[i].FDs = append(cfg.Nets[i].FDs, firstExtraFD+len(files))
+			files = append(files, q)
+		}
+	}
+	return files, nil
+}
+
+// hotAddNIC is addCocoonNIC for a NIC plumbed on a running VM: a macvtap's queues travel with the request.
+func hotAddNIC(ctx context.Context, hc *http.Client, sockPath string, nc *types.NetworkConfig) (string, error) {
+	if nc.Backend != types.BackendMacvtap {
+		return addCocoonNIC(ctx, hc, nc)
+	}
+	queues, err := network.OpenMacvtap(nc.TAP, nc.NumQueues/2) //nolint:mnd
+	if err != nil {
+		return "", err
+	}
+	defer utils.CloseFiles(queues)
+	return addCocoonNIC(ctx, utils.NewSocketHTTPClientWithFiles(sockPath, queues), nc)
+}
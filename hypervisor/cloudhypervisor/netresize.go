@@ -33,7 +33,7 @@ func (ch *CloudHypervisor) NetResize(ctx context.Context, vmRef string, spec net
 	case spec.Target == current:
 		return res, nil
 	case spec.Target > current:
-		return ch.netResizeAdd(ctx, hc, vmID, &rec.Config, plumbing, current, spec.Target, res)
+		return ch.netResizeAdd(ctx, hc, hypervisor.SocketPath(rec.RunDir), vmID, &rec.Config, plumbing, current, spec.Target, res)
 	default:
 		info, infoErr := getVMInfo(ctx, hc)
 		if infoErr != nil {
@@ -43,7 +43,7 @@ func (ch *CloudHypervisor) NetResize(ctx context.Context, vmRef string, spec net
 	}
 }
 
-func (ch *CloudHypervisor) netResizeAdd(ctx context.Context, hc *http.Client, vmID string, vmCfg *types.VMConfig, plumbing netresize.Plumbing, from, target int, res netresize.Result) (netresize.Result, error) {
+func (ch *CloudHypervisor) netResizeAdd(ctx context.Context, hc *http.Client, sockPath, vmID string, vmCfg *types.VMConfig, plumbing netresize.Plumbing, from, target int, res netresize.Result) (netresize.Result, error) {
 	logger := log.WithFunc("cloudhypervisor.NetResize.add")
 	res.Added = make([]netresize.NIC, 0, target-from)
 	for i := from; i < target; i++ {
@@ -55,7 +55,7 @@ func (ch *CloudHypervisor) netResizeAdd(ctx context.Context, hc *http.Client, vm
 			return res, fmt.Errorf("nic %d: plumbing returned %d configs", i, len(ncs))
 		}
 		nc := ncs[0]
-		chID, err := addCocoonNIC(ctx, hc, nc)
+		chID, err := hotAddNIC(ctx, hc, sockPath, nc)
 		if err != nil {
 			if rmErr := plumbing.Remove(ctx, vmID, i); rmErr != nil {
 				logger.Warnf(ctx, "rollback host plumbing for nic %d: %v", i, rmErr)
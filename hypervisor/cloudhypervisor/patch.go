@@ -2,6 +2,7 @@ package cloudhypervisor
 
 import (
 	"bytes"
+	"cmp"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -17,6 +18,9 @@ type patchOptions struct {
 	directBoot     bool
 	diskQueueSize  int
 	noDirectIO     bool
+	// vhostNets retargets the snapshot's vhost-user NICs at these NICs' sockets (by index), so vm.restore
+	// reaches the VM's own switch ports; a clone's hotSwapNets then replaces the devices.
+	vhostNets []*types.NetworkConfig
 }
 
 // patchCHConfig patches specific fields in config.json while preserving all unknown fields that CH adds internally (platform, cpus.topology, etc.).
@@ -64,9 +68,34 @@ func patchCHConfig(path string, opts *patchOptions) error {
 		}
 	}
 
+	if netRaw, ok := raw["net"]; ok {
+		patched, patchErr := patchVhostNets(netRaw, opts.vhostNets)
+		if patchErr != nil {
+			return fmt.Errorf("patch net: %w", patchErr)
+		}
+		raw["net"] = patched
+	}
+
 	return utils.AtomicWriteJSON(path, raw)
 }
 
+func patchVhostNets(netRaw json.RawMessage, ncs []*types.NetworkConfig) (json.RawMessage, error) {
+	return patchRawArray(netRaw, rawArrayLen(netRaw), func(i int, elem map[string]json.RawMessage) error {
+		var vhost bool
+		if _, ok := elem["vhost_user"]; !ok || json.Unmarshal(elem["vhost_user"], &vhost) != nil || !vhost {
+			return nil
+		}
+		if i >= len(ncs) || ncs[i].Backend != types.BackendVhostUser {
+			return fmt.Errorf("snapshot NIC %d is vhost-user: the clone needs a --vhost-user NIC in its place", i)
+		}
+		mode := cmp.Or(vhostMode(ncs[i].VhostMode), "Client")
+		if e := setField(elem, "vhost_socket", ncs[i].VhostSocket); e != nil {
+			return e
+		}
+		return setField(elem, "vhost_mode", mode)
+	})
+}
+
 func patchDisks(diskRaw json.RawMessage, opts *patchOptions) (json.RawMessage, error) {
 	diskQueueSize := opts.diskQueueSize
 	if diskQueueSize <= 0 {
@@ -65,6 +65,7 @@ func (ch *CloudHypervisor) restoreAfterExtract(ctx context.Context, vmID string,
 		directBoot:     directBoot,
 		diskQueueSize:  vmCfg.DiskQueueSize,
 		noDirectIO:     vmCfg.NoDirectIO,
+		vhostNets:      rec.NetworkConfigs,
 	}); err != nil {
 		return nil, fmt.Errorf("patch config: %w", err)
 	}
@@ -0,0 +1,72 @@
+package cloudhypervisor
+
+import (
+	"context"
+	"strings"
+
+	"github.com/cocoonstack/cocoon/hypervisor"
+	"github.com/cocoonstack/cocoon/types"
+	"github.com/cocoonstack/cocoon/utils"
+)
+
+// Stats samples a running VM; disk counters and those of NICs without a host link (passt, vhost-user) come from
+// vm.counters, matched to devices through vm.info.
+func (ch *CloudHypervisor) Stats(ctx context.Context, ref string) (*types.VMStats, error) {
+	return ch.StatsSequence(ctx, ref, func(ctx context.Context, rec *hypervisor.VMRecord, stats *types.VMStats) error {
+		hc := utils.NewSocketHTTPClient(hypervisor.SocketPath(rec.RunDir))
+		info, err := getVMInfo(ctx, hc)
+		if err != nil {
+			return err
+		}
+		counters, err := getVMCounters(ctx, hc)
+		if err != nil {
+			return err
+		}
+		stats.Disks = diskStats(info.Config.Disks, counters)
+		stats.NICs = append(stats.NICs, vhostNICStats(rec.NetworkConfigs, info.Config.Nets, counters)...)
+		return nil
+	})
+}
+
+func diskStats(disks []chDisk, counters chCounters) []types.DiskStats {
+	out := make([]types.DiskStats, 0, len(disks))
+	for _, d := range disks {
+		c := counters[d.ID]
+		out = append(out, types.DiskStats{
+			Name:       hypervisor.DiskName(d.Serial, d.Path),
+			Path:       d.Path,
+			ReadBytes:  c["read_bytes"],
+			WriteBytes: c["write_bytes"],
+			ReadOps:    c["read_ops"],
+			WriteOps:   c["write_ops"],
+		})
+	}
+	return out
+}
+
+// vhostNICStats covers the NICs whose datapath has no host link; a backend CH keeps no counters for is left out.
+func vhostNICStats(configs []*types.NetworkConfig, nets []chNet, counters chCounters) []types.NICStats {
+	macToID := make(map[string]string, len(nets))
+	for _, n := range nets {
+		macToID[strings.ToLower(n.MAC)] = n.ID
+	}
+	var out []types.NICStats
+	for i, nc := range configs {
+		if nc.TAP != "" {
+			continue
+		}
+		c, ok := counters[macToID[strings.ToLower(nc.MAC)]]
+		if !ok {
+			continue
+		}
+		out = append(out, types.NICStats{
+			Index:     i,
+			MAC:       nc.MAC,
+			RxBytes:   c["rx_bytes"],
+			RxPackets: c["rx_frames"],
+			TxBytes:   c["tx_bytes"],
+			TxPackets: c["tx_frames"],
+		})
+	}
+	return out
+}
@@ -15,6 +15,7 @@ import (
 const (
 	actionInstanceStart  = "InstanceStart"
 	actionSendCtrlAltDel = "SendCtrlAltDel"
+	actionFlushMetrics   = "FlushMetrics"
 	vmStatePaused        = "Paused"
 	vmStateResumed       = "Resumed"
 	memBackendTypeFile   = "File"
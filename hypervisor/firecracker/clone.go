@@ -63,7 +63,7 @@ func (fc *Firecracker) cloneAfterExtract(ctx context.Context, vmID string, vmCfg
 		return nil, fmt.Errorf("verify base files: %w", verifyErr)
 	}
 	if bootCfg != nil {
-		dns, dnsErr := fc.conf.DNSServers()
+		dns, dnsErr := fc.conf.GuestDNSServers()
 		if dnsErr != nil {
 			return nil, fmt.Errorf("parse DNS servers: %w", dnsErr)
 		}
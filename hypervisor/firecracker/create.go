@@ -47,7 +47,7 @@ func (fc *Firecracker) prepareOCI(ctx context.Context, vmID string, vmCfg *types
 		}
 		boot.KernelPath = vmlinuxPath
 	}
-	dns, err := fc.conf.DNSServers()
+	dns, err := fc.conf.GuestDNSServers()
 	if err != nil {
 		return nil, fmt.Errorf("parse DNS servers: %w", err)
 	}
@@ -13,9 +13,12 @@ const typ = "firecracker"
 
 // compile-time interface checks.
 var (
-	_ hypervisor.Hypervisor = (*Firecracker)(nil)
-	_ hypervisor.Watchable  = (*Firecracker)(nil)
-	_ hypervisor.Direct     = (*Firecracker)(nil)
+	_ hypervisor.Hypervisor       = (*Firecracker)(nil)
+	_ hypervisor.Watchable        = (*Firecracker)(nil)
+	_ hypervisor.Direct           = (*Firecracker)(nil)
+	_ hypervisor.HealthRecorder   = (*Firecracker)(nil)
+	_ hypervisor.PortRecorder     = (*Firecracker)(nil)
+	_ hypervisor.FirewallRecorder = (*Firecracker)(nil)
 )
 
 // Firecracker implements hypervisor.Hypervisor using the Firecracker VMM.
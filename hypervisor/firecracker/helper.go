@@ -11,7 +11,7 @@ import (
 
 const pidFileName = "fc.pid"
 
-var runtimeFiles = []string{hypervisor.APISocketName, pidFileName, hypervisor.ConsoleSockName, hypervisor.VsockSockName}
+var runtimeFiles = []string{hypervisor.APISocketName, pidFileName, hypervisor.ConsoleSockName, hypervisor.VsockSockName, metricsFIFOName, metricsTotalsName}
 
 func (fc *Firecracker) preflightRestore(srcDir string, rec *hypervisor.VMRecord) error {
 	return hypervisor.PreflightRestore(srcDir, fc.conf.RootDir, fc.conf.Config.RunDir, rec, snapshotIntegrity)
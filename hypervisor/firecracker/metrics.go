@@ -0,0 +1,162 @@
+package firecracker
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/cocoonstack/cocoon/hypervisor"
+	"github.com/cocoonstack/cocoon/types"
+	"github.com/cocoonstack/cocoon/utils"
+)
+
+const (
+	metricsFIFOName   = "metrics.fifo"
+	metricsTotalsName = "metrics.json"
+
+	// blockMetricsPrefix keys FC's per-drive metrics: "block_" + drive id.
+	blockMetricsPrefix = "block_"
+
+	// metricsLineMax bounds one metrics flush; a line carries every device's counters.
+	metricsLineMax = 1 << 20
+
+	flushWaitTimeout  = 2 * time.Second
+	flushPollInterval = 50 * time.Millisecond
+)
+
+// fcMetricsTotals is what the console relay sums from FC's metrics FIFO: FC writes each counter's delta since its
+// previous flush, so the totals only exist while someone keeps reading.
+type fcMetricsTotals struct {
+	Flushes uint64                       `json:"flushes"`
+	Block   map[string]map[string]uint64 `json:"block"` // drive id → counter → total
+}
+
+// add sums one flushed metrics line; non-counter fields (latency aggregates) are skipped.
+func (t *fcMetricsTotals) add(line []byte) error {
+	var top map[string]json.RawMessage
+	if err := json.Unmarshal(line, &top); err != nil {
+		return err
+	}
+	for key, raw := range top {
+		drive, ok := strings.CutPrefix(key, blockMetricsPrefix)
+		if !ok {
+			continue
+		}
+		var fields map[string]json.RawMessage
+		if json.Unmarshal(raw, &fields) != nil {
+			continue
+		}
+		if t.Block == nil {
+			t.Block = map[string]map[string]uint64{}
+		}
+		if t.Block[drive] == nil {
+			t.Block[drive] = map[string]uint64{}
+		}
+		for name, v := range fields {
+			var n uint64
+			if json.Unmarshal(v, &n) == nil {
+				t.Block[drive][name] += n
+			}
+		}
+	}
+	t.Flushes++
+	return nil
+}
+
+// createMetricsFIFO makes FC's metrics FIFO and opens it read-write, so FC's open never waits for a reader and the
+// relay that inherits it never sees EOF.
+func createMetricsFIFO(runDir string) (*os.File, error) {
+	path := filepath.Join(runDir, metricsFIFOName)
+	_ = os.Remove(path)
+	if err := syscall.Mkfifo(path, 0o600); err != nil {
+		return nil, fmt.Errorf("mkfifo %s: %w", path, err)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR, 0) //nolint:gosec
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	return f, nil
+}
+
+// collectMetrics runs in the console relay for FC's lifetime, rewriting totalsPath after every flush.
+func collectMetrics(fifo io.Reader, totalsPath string) {
+	var totals fcMetricsTotals
+	if utils.AtomicWriteJSON(totalsPath, totals) != nil {
+		return
+	}
+	sc := bufio.NewScanner(fifo)
+	sc.Buffer(make([]byte, 0, 64<<10), metricsLineMax) //nolint:mnd
+	for sc.Scan() {
+		if totals.add(sc.Bytes()) == nil {
+			_ = utils.AtomicWriteJSON(totalsPath, totals)
+		}
+	}
+}
+
+// flushMetrics asks FC to flush and waits for the relay to sum the line; on timeout the totals are as of the last
+// periodic flush (FC flushes every minute on its own).
+func flushMetrics(ctx context.Context, hc *http.Client, runDir string) (*fcMetricsTotals, error) {
+	path := filepath.Join(runDir, metricsTotalsName)
+	var before fcMetricsTotals
+	if err := utils.ReadJSONFile(path, &before); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("no metrics for this VM: it was started without a metrics FIFO or its console relay failed; restart it")
+		}
+		return nil, err
+	}
+	body, err := json.Marshal(fcAction{ActionType: actionFlushMetrics})
+	if err != nil {
+		return nil, fmt.Errorf("marshal action: %w", err)
+	}
+	if err = fcAPIOnce(ctx, hc, http.MethodPut, "/actions", body, http.StatusNoContent, http.StatusOK); err != nil {
+		return nil, fmt.Errorf("flush metrics: %w", err)
+	}
+
+	deadline := time.Now().Add(flushWaitTimeout)
+	for {
+		var after fcMetricsTotals
+		if utils.ReadJSONFile(path, &after) == nil && after.Flushes > before.Flushes {
+			return &after, nil
+		}
+		if time.Now().After(deadline) {
+			return &before, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(flushPollInterval):
+		}
+	}
+}
+
+// Stats samples a running VM; disk counters come from the totals the console relay keeps of FC's metrics.
+func (fc *Firecracker) Stats(ctx context.Context, ref string) (*types.VMStats, error) {
+	return fc.StatsSequence(ctx, ref, func(ctx context.Context, rec *hypervisor.VMRecord, stats *types.VMStats) error {
+		totals, err := flushMetrics(ctx, utils.NewSocketHTTPClient(hypervisor.SocketPath(rec.RunDir)), rec.RunDir)
+		if err != nil {
+			return err
+		}
+		for i, sc := range rec.StorageConfigs {
+			c := totals.Block[fmt.Sprintf(driveIDFmt, i)]
+			stats.Disks = append(stats.Disks, types.DiskStats{
+				Name:       hypervisor.DiskName(sc.Serial, sc.Path),
+				Path:       sc.Path,
+				ReadBytes:  c["read_bytes"],
+				WriteBytes: c["write_bytes"],
+				ReadOps:    c["read_count"],
+				WriteOps:   c["write_count"],
+			})
+		}
+		return nil
+	})
+}
@@ -0,0 +1,36 @@
+package firecracker
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cocoonstack/cocoon/utils"
+)
+
+func TestMetricsTotals(t *testing.T) {
+	lines := []string{
+		`{"utc_timestamp_ms":1,"block":{"read_bytes":9},"block_drive_0":{"read_bytes":4096,"read_count":1,"read_agg":{"min_us":3}},"net_eth0":{"rx_bytes_count":7}}`,
+		`{"utc_timestamp_ms":2,"block_drive_0":{"read_bytes":1024,"write_bytes":512,"write_count":1},"block_drive_1":{"write_count":2}}`,
+	}
+	totalsPath := filepath.Join(t.TempDir(), metricsTotalsName)
+	collectMetrics(strings.NewReader(strings.Join(append(lines, "not json"), "\n")+"\n"), totalsPath)
+
+	var got fcMetricsTotals
+	if err := utils.ReadJSONFile(totalsPath, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Flushes != 2 {
+		t.Errorf("flushes = %d, want 2", got.Flushes)
+	}
+	d0 := got.Block["drive_0"]
+	if d0["read_bytes"] != 5120 || d0["read_count"] != 1 || d0["write_bytes"] != 512 || d0["write_count"] != 1 {
+		t.Errorf("drive_0 = %v", d0)
+	}
+	if got.Block["drive_1"]["write_count"] != 2 {
+		t.Errorf("drive_1 = %v", got.Block["drive_1"])
+	}
+	if _, ok := got.Block[""]; ok || len(got.Block) != 2 {
+		t.Errorf("unexpected drives %v", got.Block)
+	}
+}
@@ -17,10 +17,13 @@ import (
 const (
 	relayEnvKey    = "_COCOON_CONSOLE_RELAY"
 	relayPIDEnvKey = "_COCOON_FC_PID"
+	// relayMetricsEnvKey is where the relay keeps the metrics totals.
+	relayMetricsEnvKey = "_COCOON_FC_METRICS"
 
-	// fd offsets for ExtraFiles (fd 3 = ExtraFiles[0], fd 4 = ExtraFiles[1])
+	// fd offsets for ExtraFiles (fd 3 = ExtraFiles[0], fd 4 = ExtraFiles[1], fd 5 = ExtraFiles[2])
 	relayMasterFD   = 3
 	relayListenerFD = 4
+	relayMetricsFD  = 5
 
 	relayPollInterval = time.Second
 	relayBufSize      = 4096
@@ -65,7 +68,7 @@ func IsRelayMode() bool {
 	return os.Getenv(relayEnvKey) == "1"
 }
 
-// RunRelay runs the console relay loop. Inherits fd 3 (PTY master), fd 4 (console.sock listener), $_COCOON_FC_PID.
+// RunRelay runs the console relay loop. Inherits fd 3 (PTY master), fd 4 (console.sock listener), fd 5 (metrics FIFO), $_COCOON_FC_PID.
 // A single persistent goroutine reads the PTY and broadcasts to the active session so disconnects don't strand readers.
 func RunRelay(ctx context.Context) {
 	master := os.NewFile(relayMasterFD, "pty-master")
@@ -86,6 +89,10 @@ func RunRelay(ctx context.Context) {
 		return
 	}
 
+	if totalsPath := os.Getenv(relayMetricsEnvKey); totalsPath != "" {
+		go collectMetrics(os.NewFile(relayMetricsFD, "metrics-fifo"), totalsPath)
+	}
+
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
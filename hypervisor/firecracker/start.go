@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strconv"
 	"syscall"
 
@@ -134,11 +135,20 @@ func (fc *Firecracker) launchProcess(ctx context.Context, rec *hypervisor.VMReco
 	}
 	defer slave.Close() //nolint:errcheck
 
+	// FC writes counter deltas to the FIFO; the relay sums them for `vm stats`.
+	metrics, err := createMetricsFIFO(rec.RunDir)
+	if err != nil {
+		_ = master.Close()
+		return 0, err
+	}
+	defer metrics.Close() //nolint:errcheck
+
 	// shell out: the firecracker binary is the authoritative VMM.
 	fcCmd := exec.Command(fc.conf.FCBinary, //nolint:gosec
 		"--api-sock", sockPath,
 		"--log-path", fcLog,
 		"--level", "Warning",
+		"--metrics-path", metrics.Name(),
 		"--id", rec.ID,
 	)
 	fcCmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
@@ -158,7 +168,7 @@ func (fc *Firecracker) launchProcess(ctx context.Context, rec *hypervisor.VMReco
 
 	// Start console relay as a background process (self-exec).
 	// The relay holds the PTY master and listens on console.sock.
-	relayOK := fc.startConsoleRelay(ctx, rec.RunDir, master, pid) == nil
+	relayOK := fc.startConsoleRelay(ctx, rec.RunDir, master, metrics, pid) == nil
 	if relayOK {
 		// Master fd ownership transferred to relay; close parent's copy.
 		_ = master.Close()
@@ -177,8 +187,9 @@ func (fc *Firecracker) launchProcess(ctx context.Context, rec *hypervisor.VMReco
 	return pid, nil
 }
 
-// startConsoleRelay forks a relay that holds the PTY master, serves console.sock, and exits when fcPID dies.
-func (fc *Firecracker) startConsoleRelay(_ context.Context, runDir string, master *os.File, fcPID int) error {
+// startConsoleRelay forks a relay that holds the PTY master, serves console.sock, sums the metrics FIFO, and exits
+// when fcPID dies.
+func (fc *Firecracker) startConsoleRelay(_ context.Context, runDir string, master, metrics *os.File, fcPID int) error {
 	consoleSock := hypervisor.ConsoleSockPath(runDir)
 
 	listener, err := net.Listen("unix", consoleSock)
@@ -204,8 +215,9 @@ func (fc *Firecracker) startConsoleRelay(_ context.Context, runDir string, maste
 	relayCmd.Env = []string{
 		relayEnvKey + "=1",
 		relayPIDEnvKey + "=" + strconv.Itoa(fcPID),
+		relayMetricsEnvKey + "=" + filepath.Join(runDir, metricsTotalsName),
 	}
-	relayCmd.ExtraFiles = []*os.File{master, listenerFile}
+	relayCmd.ExtraFiles = []*os.File{master, listenerFile, metrics}
 	relayCmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 
 	if startErr := relayCmd.Start(); startErr != nil {
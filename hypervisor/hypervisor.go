@@ -39,6 +39,26 @@ type Watchable interface {
 	WatchPath() string
 }
 
+// HealthRecorder is optionally implemented by hypervisors that persist --health-cmd results for inspect and status.
+type HealthRecorder interface {
+	RecordHealth(ctx context.Context, vmID string, health types.HealthStatus) error
+}
+
+// PortRecorder is optionally implemented by hypervisors that persist --publish mappings edited by `vm port`.
+type PortRecorder interface {
+	RecordPorts(ctx context.Context, vmID string, ports []types.PortMapping) error
+}
+
+// FirewallRecorder is optionally implemented by hypervisors that persist firewalls replaced by `vm firewall apply`.
+type FirewallRecorder interface {
+	RecordFirewall(ctx context.Context, vmID string, fw *types.Firewall) error
+}
+
+// StatsReader is optionally implemented by hypervisors that sample a running VM's CPU, NIC and disk counters.
+type StatsReader interface {
+	Stats(ctx context.Context, ref string) (*types.VMStats, error)
+}
+
 // Direct is an optional interface for hypervisors that support clone/restore from a local snapshot directory.
 type Direct interface {
 	DirectClone(ctx context.Context, vmID string, vmCfg *types.VMConfig, net types.NetSetup, snapshotConfig *types.SnapshotConfig, srcDir string) (*types.VM, error)
@@ -48,6 +48,7 @@ func (b *Backend) FinalizeRestore(ctx context.Context, vmID string, vmCfg *types
 			return err
 		}
 		r.Config = *vmCfg
+		r.SourceSnapshotID = rec.SourceSnapshotID
 		r.State = types.VMStateRunning
 		r.StartedAt = &now
 		r.StoppedAt = nil
@@ -76,6 +77,7 @@ func (b *Backend) RestoreSequence(ctx context.Context, vmRef string, spec Restor
 	if err != nil {
 		return nil, err
 	}
+	adoptRestoreSource(rec, spec.SourceSnapshotID)
 
 	stagingDir, cleanupStaging, err := PrepareStagingDir(rec.RunDir, spec.Snapshot)
 	if err != nil {
@@ -114,6 +116,7 @@ func (b *Backend) RestoreSequence(ctx context.Context, vmRef string, spec Restor
 	} else if err := inner(); err != nil {
 		return nil, err
 	}
+	b.SyncGuestClock(ctx, result)
 	b.emitRestoreSuccess(ctx, result, oldShape, spec.SourceSnapshotID)
 	return result, nil
 }
@@ -127,6 +130,7 @@ func (b *Backend) DirectRestoreSequence(ctx context.Context, vmRef string, spec
 	if err != nil {
 		return nil, err
 	}
+	adoptRestoreSource(rec, spec.SourceSnapshotID)
 
 	if preflightErr := spec.Preflight(spec.SrcDir, rec); preflightErr != nil {
 		return nil, fmt.Errorf("snapshot preflight: %w", preflightErr)
@@ -154,10 +158,18 @@ func (b *Backend) DirectRestoreSequence(ctx context.Context, vmRef string, spec
 	} else if innerErr := inner(); innerErr != nil {
 		return nil, innerErr
 	}
+	b.SyncGuestClock(ctx, result)
 	b.emitRestoreSuccess(ctx, result, oldShape, spec.SourceSnapshotID)
 	return result, nil
 }
 
+// adoptRestoreSource re-parents rec under a foreign source snapshot; restoring one of the VM's own snapshots keeps its lineage (and avoids a VM→snapshot→VM cycle).
+func adoptRestoreSource(rec *VMRecord, sourceSnapshotID string) {
+	if _, owned := rec.SnapshotIDs[sourceSnapshotID]; sourceSnapshotID != "" && !owned {
+		rec.SourceSnapshotID = sourceSnapshotID
+	}
+}
+
 // emitRestoreComputeStop closes the compute interval after a confirmed kill; fail-closed on DB error and skip on vanished record so the ledger never gets a phantom entry.
 func (b *Backend) emitRestoreComputeStop(ctx context.Context, vmID string, oldShape metering.Shape, sourceSnapshotID string) {
 	now := time.Now()
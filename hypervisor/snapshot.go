@@ -146,11 +146,12 @@ func (b *Backend) RecordSnapshot(ctx context.Context, vmID string) (string, erro
 
 func (b *Backend) BuildSnapshotConfig(snapID string, rec *VMRecord) *types.SnapshotConfig {
 	cfg := &types.SnapshotConfig{
-		ID:           snapID,
-		Hypervisor:   b.Typ,
-		NICs:         len(rec.NetworkConfigs),
-		ImageBlobIDs: maps.Clone(rec.ImageBlobIDs),
-		Config:       rec.Config.Config,
+		ID:             snapID,
+		Hypervisor:     b.Typ,
+		NICs:           len(rec.NetworkConfigs),
+		NICAttachments: rec.NICAttachments(),
+		ImageBlobIDs:   maps.Clone(rec.ImageBlobIDs),
+		Config:         rec.Config.Config,
 	}
 	return cfg
 }
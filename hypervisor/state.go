@@ -88,6 +88,42 @@ func (b *Backend) WithPausedVM(ctx context.Context, rec *VMRecord, pause, resume
 	})
 }
 
+// RecordHealth stores the latest health-check outcome on the VM record.
+func (b *Backend) RecordHealth(ctx context.Context, vmID string, health types.HealthStatus) error {
+	return b.DB.Update(ctx, func(idx *VMIndex) error {
+		r, err := idx.GetRecord(vmID)
+		if err != nil {
+			return err
+		}
+		r.Health = &health
+		return nil
+	})
+}
+
+// RecordPorts replaces the VM's published port mappings.
+func (b *Backend) RecordPorts(ctx context.Context, vmID string, ports []types.PortMapping) error {
+	return b.DB.Update(ctx, func(idx *VMIndex) error {
+		r, err := idx.GetRecord(vmID)
+		if err != nil {
+			return err
+		}
+		r.Config.Ports = ports
+		return nil
+	})
+}
+
+// RecordFirewall replaces the VM's firewall; nil removes it.
+func (b *Backend) RecordFirewall(ctx context.Context, vmID string, fw *types.Firewall) error {
+	return b.DB.Update(ctx, func(idx *VMIndex) error {
+		r, err := idx.GetRecord(vmID)
+		if err != nil {
+			return err
+		}
+		r.Config.Firewall = fw
+		return nil
+	})
+}
+
 // UpdateStates flips ids to Stopped or Error and emits compute.stop on Running→Stopped (Error paths can't prove the process is dead so the interval stays open until a confirmed-dead helper closes it). To open a fresh interval, use BatchMarkStarted — UpdateStates intentionally rejects Running to avoid silent ledger drift.
 func (b *Backend) UpdateStates(ctx context.Context, ids []string, state types.VMState) error {
 	if len(ids) == 0 {
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"path/filepath"
+	"slices"
 	"testing"
 	"time"
 
@@ -303,6 +304,114 @@ func TestFinalizeCloneEmitsCloneEntries(t *testing.T) {
 	if entries[0].Kind != metering.KindVMStorageStart || entries[1].Kind != metering.KindVMComputeStart {
 		t.Errorf("ordering wrong: %s then %s", entries[0].Kind, entries[1].Kind)
 	}
+	loaded, err := b.LoadRecord(ctx, "vm1")
+	if err != nil {
+		t.Fatalf("LoadRecord: %v", err)
+	}
+	if loaded.SourceSnapshotID != "snap-source" {
+		t.Errorf("persisted SourceSnapshotID %q, want snap-source", loaded.SourceSnapshotID)
+	}
+}
+
+func TestAdoptRestoreSourceKeepsLineageForOwnSnapshots(t *testing.T) {
+	rec := &VMRecord{VM: types.VM{SourceSnapshotID: "golden", SnapshotIDs: map[string]struct{}{"own": {}}}}
+	adoptRestoreSource(rec, "own")
+	if rec.SourceSnapshotID != "golden" {
+		t.Errorf("own-snapshot restore re-parented VM to %q", rec.SourceSnapshotID)
+	}
+	adoptRestoreSource(rec, "foreign")
+	if rec.SourceSnapshotID != "foreign" {
+		t.Errorf("forced foreign restore left source %q, want foreign", rec.SourceSnapshotID)
+	}
+}
+
+func TestRecordClockSyncPersists(t *testing.T) {
+	b, _ := newMeteringTestBackend(t)
+	ctx := t.Context()
+	seedVMRecord(t, b, "vm1", 2, 2<<30, 20<<30, true)
+
+	want := types.ClockSyncResult{Method: types.ClockSyncAgent, At: time.Now().UTC(), OffsetSeconds: 3600.5}
+	if err := b.RecordClockSync(ctx, "vm1", want); err != nil {
+		t.Fatalf("RecordClockSync: %v", err)
+	}
+	loaded, err := b.LoadRecord(ctx, "vm1")
+	if err != nil {
+		t.Fatalf("LoadRecord: %v", err)
+	}
+	if got := loaded.LastClockSync; got == nil || got.Method != want.Method || got.OffsetSeconds != want.OffsetSeconds {
+		t.Errorf("persisted LastClockSync %+v, want %+v", got, want)
+	}
+	if err := b.RecordClockSync(ctx, "missing", want); err == nil {
+		t.Error("RecordClockSync on an unknown VM should fail")
+	}
+}
+
+func TestRecordHealthPersists(t *testing.T) {
+	b, _ := newMeteringTestBackend(t)
+	ctx := t.Context()
+	seedVMRecord(t, b, "vm1", 2, 2<<30, 20<<30, true)
+
+	want := types.HealthStatus{Status: types.HealthUnhealthy, FailingStreak: 3, CheckedAt: time.Now().UTC(), Output: "connection refused"}
+	if err := b.RecordHealth(ctx, "vm1", want); err != nil {
+		t.Fatalf("RecordHealth: %v", err)
+	}
+	loaded, err := b.LoadRecord(ctx, "vm1")
+	if err != nil {
+		t.Fatalf("LoadRecord: %v", err)
+	}
+	if got := loaded.Health; got == nil || got.Status != want.Status || got.FailingStreak != want.FailingStreak || got.Output != want.Output {
+		t.Errorf("persisted Health %+v, want %+v", got, want)
+	}
+	if err := b.RecordHealth(ctx, "missing", want); err == nil {
+		t.Error("RecordHealth on an unknown VM should fail")
+	}
+}
+
+func TestRecordPortsPersists(t *testing.T) {
+	b, _ := newMeteringTestBackend(t)
+	ctx := t.Context()
+	seedVMRecord(t, b, "vm1", 2, 2<<30, 20<<30, true)
+
+	want := []types.PortMapping{{HostPort: 8080, GuestPort: 80, Protocol: types.ProtocolTCP}}
+	if err := b.RecordPorts(ctx, "vm1", want); err != nil {
+		t.Fatalf("RecordPorts: %v", err)
+	}
+	loaded, err := b.LoadRecord(ctx, "vm1")
+	if err != nil {
+		t.Fatalf("LoadRecord: %v", err)
+	}
+	if !slices.Equal(loaded.Config.Ports, want) {
+		t.Errorf("persisted Ports %v, want %v", loaded.Config.Ports, want)
+	}
+	if err := b.RecordPorts(ctx, "missing", want); err == nil {
+		t.Error("RecordPorts on an unknown VM should fail")
+	}
+}
+
+func TestRecordFirewallPersists(t *testing.T) {
+	b, _ := newMeteringTestBackend(t)
+	ctx := t.Context()
+	seedVMRecord(t, b, "vm1", 2, 2<<30, 20<<30, true)
+
+	fw := &types.Firewall{Ingress: types.FirewallDeny, Rules: []types.FirewallRule{
+		{Action: types.FirewallAllow, Direction: types.DirectionIngress, Protocol: types.ProtocolTCP, Ports: "22"},
+	}}
+	if err := b.RecordFirewall(ctx, "vm1", fw); err != nil {
+		t.Fatalf("RecordFirewall: %v", err)
+	}
+	loaded, err := b.LoadRecord(ctx, "vm1")
+	if err != nil {
+		t.Fatalf("LoadRecord: %v", err)
+	}
+	if got := loaded.Config.Firewall; got == nil || got.Ingress != fw.Ingress || !slices.Equal(got.Rules, fw.Rules) {
+		t.Errorf("persisted Firewall %+v, want %+v", got, fw)
+	}
+	if err := b.RecordFirewall(ctx, "vm1", nil); err != nil {
+		t.Fatalf("RecordFirewall(nil): %v", err)
+	}
+	if loaded, _ = b.LoadRecord(ctx, "vm1"); loaded.Config.Firewall != nil {
+		t.Errorf("cleared Firewall persisted as %+v", loaded.Config.Firewall)
+	}
 }
 
 func seedRunningVM(t *testing.T, b *Backend, id string, cpu int, mem, storage int64) {
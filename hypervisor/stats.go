@@ -0,0 +1,115 @@
+package hypervisor
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/projecteru2/core/log"
+
+	"github.com/cocoonstack/cocoon/network"
+	"github.com/cocoonstack/cocoon/types"
+)
+
+// clockTicks is USER_HZ, the unit of /proc/<pid>/stat times; fixed at 100 by the Linux ABI.
+const clockTicks = 100
+
+// StatsSequence samples a running VM: CPU from /proc, TAP-backed NICs from their host links, then devices adds the
+// disks and the NICs only the hypervisor counts.
+func (b *Backend) StatsSequence(ctx context.Context, ref string, devices func(ctx context.Context, rec *VMRecord, stats *types.VMStats) error) (*types.VMStats, error) {
+	_, rec, err := b.ResolveAndLoad(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	var stats *types.VMStats
+	err = b.WithRunningVM(ctx, &rec, func(pid int) error {
+		cpu, cpuErr := ProcessCPU(pid)
+		if cpuErr != nil {
+			return cpuErr
+		}
+		stats = &types.VMStats{ID: rec.ID, Name: rec.Config.Name, At: time.Now(), CPU: cpu}
+		for i, nc := range rec.NetworkConfigs {
+			if nc.TAP == "" {
+				continue
+			}
+			s, nicErr := network.NICStats(nc)
+			if nicErr != nil {
+				log.WithFunc(b.Typ+".StatsSequence").Warnf(ctx, "VM %s NIC %d: %v", rec.ID, i, nicErr)
+				continue
+			}
+			s.Index = i
+			stats.NICs = append(stats.NICs, s)
+		}
+		if err := devices(ctx, &rec, stats); err != nil {
+			return fmt.Errorf("device counters: %w", err)
+		}
+		slices.SortFunc(stats.NICs, func(a, b types.NICStats) int { return cmp.Compare(a.Index, b.Index) })
+		return nil
+	})
+	return stats, err
+}
+
+// DiskName labels a disk in stats: its serial, or the image file name.
+func DiskName(serial, path string) string {
+	if serial != "" {
+		return serial
+	}
+	return filepath.Base(path)
+}
+
+// ProcessCPU reads pid's CPU time; threads named after vCPUs ("vcpu0", "fc_vcpu 0") count as guest time.
+func ProcessCPU(pid int) (types.CPUStats, error) {
+	procDir := fmt.Sprintf("/proc/%d", pid)
+	stat, err := os.ReadFile(filepath.Join(procDir, "stat")) //nolint:gosec
+	if err != nil {
+		return types.CPUStats{}, fmt.Errorf("read stat of %d: %w", pid, err)
+	}
+	// The process line also covers threads that already exited.
+	_, host, ok := parseStatCPU(string(stat))
+	if !ok {
+		return types.CPUStats{}, fmt.Errorf("parse stat of %d", pid)
+	}
+	tids, err := os.ReadDir(filepath.Join(procDir, "task"))
+	if err != nil {
+		return types.CPUStats{}, fmt.Errorf("read threads of %d: %w", pid, err)
+	}
+	var vcpu uint64
+	for _, t := range tids {
+		stat, readErr := os.ReadFile(filepath.Join(procDir, "task", t.Name(), "stat")) //nolint:gosec
+		if readErr != nil {
+			continue // thread exited
+		}
+		if comm, ticks, ok := parseStatCPU(string(stat)); ok && strings.Contains(comm, "vcpu") {
+			vcpu += ticks
+		}
+	}
+	return types.CPUStats{
+		VCPUSeconds: float64(vcpu) / clockTicks,
+		HostSeconds: float64(host) / clockTicks,
+	}, nil
+}
+
+// parseStatCPU returns the comm and utime+stime of a /proc stat line. comm may hold spaces and parentheses, so the
+// fields are counted from the last ')'.
+func parseStatCPU(stat string) (string, uint64, bool) {
+	open, end := strings.IndexByte(stat, '('), strings.LastIndexByte(stat, ')')
+	if open < 0 || end < open {
+		return "", 0, false
+	}
+	fields := strings.Fields(stat[end+1:])
+	if len(fields) < 13 { //nolint:mnd // state is field 3, utime 14, stime 15
+		return "", 0, false
+	}
+	utime, uErr := strconv.ParseUint(fields[11], 10, 64)
+	stime, sErr := strconv.ParseUint(fields[12], 10, 64)
+	if uErr != nil || sErr != nil {
+		return "", 0, false
+	}
+	return stat[open+1 : end], utime + stime, true
+}
@@ -0,0 +1,34 @@
+package hypervisor
+
+import "testing"
+
+func TestParseStatCPU(t *testing.T) {
+	tests := []struct {
+		name     string
+		stat     string
+		wantComm string
+		want     uint64
+		ok       bool
+	}{
+		{
+			name:     "vcpu thread",
+			stat:     "4242 (vcpu0) S 1 4242 4242 0 -1 4194560 120 0 0 0 1500 250 0 0 20 0 9 0 100 0",
+			wantComm: "vcpu0", want: 1750, ok: true,
+		},
+		{
+			name:     "comm with space and paren",
+			stat:     "4243 (fc_vcpu (0)) R 1 4242 4242 0 -1 4194560 120 0 0 0 7 3 0 0 20 0 9 0 100 0",
+			wantComm: "fc_vcpu (0)", want: 10, ok: true,
+		},
+		{name: "truncated", stat: "4244 (vmm) S 1 4242"},
+		{name: "no comm", stat: "garbage"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comm, ticks, ok := parseStatCPU(tt.stat)
+			if ok != tt.ok || comm != tt.wantComm || ticks != tt.want {
+				t.Errorf("parseStatCPU = %q, %d, %v; want %q, %d, %v", comm, ticks, ok, tt.wantComm, tt.want, tt.ok)
+			}
+		})
+	}
+}
@@ -99,34 +99,63 @@ func BuildBaseCmdline(prefix, layers, cow string, networkConfigs []*types.Networ
 	return b.String()
 }
 
+// BuildIPParams renders per-NIC ip= for the primary IPv4. The kernel's ip= is IPv4-only and splits on ':', so IPv6
+// DNS servers and other addresses go in cocoon.dns6=, cocoon.addr=eth<i>,CIDR and cocoon.gw6=eth<i>,GW for the
+// initramfs network script.
 func BuildIPParams(networkConfigs []*types.NetworkConfig, vmName string, dnsServers []string) string {
 	var params strings.Builder
 	fmt.Fprintf(&params, " cocoon.hostname=%s", vmName)
+	dns4, dns6 := SplitDNS(dnsServers)
 	var dns0, dns1 string
-	if len(dnsServers) > 0 {
-		dns0 = dnsServers[0]
+	if len(dns4) > 0 {
+		dns0 = dns4[0]
 	}
-	if len(dnsServers) > 1 {
-		dns1 = dnsServers[1]
+	if len(dns4) > 1 {
+		dns1 = dns4[1]
 	}
+	static := false
 	for i, n := range networkConfigs {
-		if n.Network == nil || n.Network.IP == "" {
+		if !n.Network.Static() {
 			continue
 		}
-		param := fmt.Sprintf(" ip=%s::%s:%s:%s:eth%d:off",
-			n.Network.IP, n.Network.Gateway,
-			PrefixToNetmask(n.Network.Prefix), vmName, i)
-		if dns0 != "" {
-			param += ":" + dns0
-			if dns1 != "" {
-				param += ":" + dns1
+		static = true
+		if n.Network.IP != "" {
+			param := fmt.Sprintf(" ip=%s::%s:%s:%s:eth%d:off",
+				n.Network.IP, n.Network.Gateway,
+				PrefixToNetmask(n.Network.Prefix), vmName, i)
+			if dns0 != "" {
+				param += ":" + dns0
+				if dns1 != "" {
+					param += ":" + dns1
+				}
 			}
+			params.WriteString(param)
+		}
+		for _, a := range n.Network.Addresses {
+			fmt.Fprintf(&params, " cocoon.addr=eth%d,%s", i, a.CIDR())
 		}
-		params.WriteString(param)
+		if gw6 := n.Network.Gateway6(); gw6 != "" {
+			fmt.Fprintf(&params, " cocoon.gw6=eth%d,%s", i, gw6)
+		}
+	}
+	if static && len(dns6) > 0 {
+		fmt.Fprintf(&params, " cocoon.dns6=%s", strings.Join(dns6, ","))
 	}
 	return params.String()
 }
 
+// SplitDNS partitions DNS servers into IPv4 and IPv6, preserving order.
+func SplitDNS(servers []string) (v4, v6 []string) {
+	for _, s := range servers {
+		if strings.Contains(s, ":") {
+			v6 = append(v6, s)
+		} else {
+			v4 = append(v4, s)
+		}
+	}
+	return v4, v6
+}
+
 func CopyFile(dst, src string) (err error) {
 	srcFile, err := os.Open(src) //nolint:gosec
 	if err != nil {
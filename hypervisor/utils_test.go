@@ -190,6 +190,12 @@ func TestBuildBaseCmdline(t *testing.T) {
 	nics := []*types.NetworkConfig{
 		{Network: &types.Network{IP: "10.0.0.2", Gateway: "10.0.0.1", Prefix: 24}},
 	}
+	dualNICs := []*types.NetworkConfig{
+		{Network: &types.Network{IP: "10.0.0.2", Gateway: "10.0.0.1", Prefix: 24,
+			Addresses: []types.Address{{IP: "fd00::2", Prefix: 64, Gateway: "fd00::1"}}}},
+		{Network: &types.Network{Addresses: []types.Address{{IP: "fd01::2", Prefix: 64}}}},
+		{},
+	}
 
 	tests := []struct {
 		name, prefix, layers, cow string
@@ -209,6 +215,13 @@ func TestBuildBaseCmdline(t *testing.T) {
 			name: "ch with nic + dns", prefix: chPrefix, layers: "L", cow: "C", nics: nics, dns: []string{"1.1.1.1"},
 			want: "console=hvc0 loglevel=3 boot=cocoon-overlay cocoon.layers=L cocoon.cow=C clocksource=kvm-clock rw net.ifnames=0 cocoon.hostname=vm ip=10.0.0.2::10.0.0.1:255.255.255.0:vm:eth0:off:1.1.1.1",
 		},
+		{
+			name: "dual-stack nic + v6-only nic", prefix: chPrefix, layers: "L", cow: "C", nics: dualNICs,
+			dns: []string{"2606:4700:4700::1111", "1.1.1.1"},
+			want: "console=hvc0 loglevel=3 boot=cocoon-overlay cocoon.layers=L cocoon.cow=C clocksource=kvm-clock rw net.ifnames=0 cocoon.hostname=vm" +
+				" ip=10.0.0.2::10.0.0.1:255.255.255.0:vm:eth0:off:1.1.1.1 cocoon.addr=eth0,fd00::2/64 cocoon.gw6=eth0,fd00::1" +
+				" cocoon.addr=eth1,fd01::2/64 cocoon.dns6=2606:4700:4700::1111",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -6,8 +6,11 @@ import (
 	"os"
 
 	"github.com/cocoonstack/cocoon/cmd"
+	cmdcore "github.com/cocoonstack/cocoon/cmd/core"
 	cmdvm "github.com/cocoonstack/cocoon/cmd/vm"
 	"github.com/cocoonstack/cocoon/hypervisor/firecracker"
+	bridgenet "github.com/cocoonstack/cocoon/network/bridge"
+	"github.com/cocoonstack/cocoon/network/discovery"
 )
 
 func main() {
@@ -18,6 +21,16 @@ func main() {
 		firecracker.RunRelay(ctx)
 		return
 	}
+	// Internal: DHCP/DNS responder of a --bridge-ipam bridge, started by the bridge network provider.
+	if bridgenet.IsResponderMode() {
+		bridgenet.RunResponder(ctx)
+		return
+	}
+	// Internal: VM-name DNS forwarder (--discovery-dns), started by VM create, clone and start.
+	if discovery.IsForwarderMode() {
+		cmdcore.RunDiscoveryForwarder(ctx)
+		return
+	}
 	if err := cmd.Execute(ctx); err != nil {
 		var exitErr *cmdvm.ExecExitError
 		if errors.As(err, &exitErr) {
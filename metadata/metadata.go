@@ -29,6 +29,14 @@ chpasswd:
   list:
     - '{{.Username}}:{{yamlQuote .Password}}'
 ssh_pwauth: true
+{{- end}}
+{{- if .SSHKeys}}
+ssh_authorized_keys:
+{{- range .SSHKeys}}
+  - '{{yamlQuote .}}'
+{{- end}}
+{{- end}}
+{{- if or .Password .SSHKeys}}
 {{- if eq .Username "root"}}
 disable_root: false
 {{- end}}
@@ -36,8 +44,13 @@ disable_root: false
 runcmd:
   - [sh, -c, 'id {{.Username}} >/dev/null 2>&1 || useradd -m -s /bin/bash -N {{.Username}}']
   - [usermod, -aG, sudo, '{{.Username}}']
+{{- if .Password}}
   - [sh, -c, 'echo ''{{.Username}}:{{.Password}}'' | chpasswd']
+{{- end}}
   - [sh, -c, 'echo ''{{.Username}} ALL=(ALL) NOPASSWD:ALL'' > /etc/sudoers.d/cocoon-{{.Username}}']
+{{- if .SSHKeys}}
+  - [sh, -c, 'h=$(getent passwd {{.Username}} | cut -d: -f6) && install -d -m 700 -o {{.Username}} "$h/.ssh" && cat {{.KeysFile}} >> "$h/.ssh/authorized_keys" && chown {{.Username}} "$h/.ssh/authorized_keys" && chmod 600 "$h/.ssh/authorized_keys"']
+{{- end}}
 {{- end}}
 {{- end}}
 {{- if .Mounts}}
@@ -46,8 +59,17 @@ mounts:
   - ['{{yamlQuote .Device}}', '{{yamlQuote .MountPoint}}', '{{yamlQuote .FSType}}', '{{yamlQuote .Options}}', '0', '2']
 {{- end}}
 {{- end}}
-{{- if .Networks}}
+{{- if or .Networks .KeysFile}}
 write_files:
+{{- if .KeysFile}}
+  - path: {{.KeysFile}}
+    owner: root:root
+    permissions: '0644'
+    content: |
+{{- range .SSHKeys}}
+      {{.}}
+{{- end}}
+{{- end}}
 {{- range $i, $n := .Networks}}
   - path: /etc/systemd/network/15-cocoon-id{{$i}}.network
     owner: root:root
@@ -57,16 +79,21 @@ write_files:
       MACAddress={{$n.MAC}}
 
       [Network]
-{{- if $n.IP}}
-      Address={{$n.IP}}/{{$n.Prefix}}
+{{- if $n.Static}}
+{{- range $n.CIDRs}}
+      Address={{.}}
+{{- end}}
 {{- if $n.Gateway}}
       Gateway={{$n.Gateway}}
 {{- end}}
+{{- if $n.Gateway6}}
+      Gateway={{$n.Gateway6}}
+{{- end}}
 {{- range $.DNS}}
       DNS={{.}}
 {{- end}}
 {{- else}}
-      DHCP=ipv4
+      DHCP=yes
 {{- end}}
 {{- if eq $i 0}}
       RequiredForOnline=yes
@@ -85,14 +112,22 @@ ethernets:
   id{{$i}}:
     match:
       macaddress: "{{$n.MAC}}"
-{{- if $n.IP}}
+{{- if $n.Static}}
     addresses:
-      - {{$n.IP}}/{{$n.Prefix}}
-{{- if $n.Gateway}}
+{{- range $n.CIDRs}}
+      - {{.}}
+{{- end}}
+{{- if or $n.Gateway $n.Gateway6}}
     routes:
+{{- if $n.Gateway}}
       - to: default
         via: {{$n.Gateway}}
 {{- end}}
+{{- if $n.Gateway6}}
+      - to: default
+        via: {{$n.Gateway6}}
+{{- end}}
+{{- end}}
 {{- if $.DNS}}
     nameservers:
       addresses:
@@ -102,12 +137,14 @@ ethernets:
 {{- end}}
 {{- else}}
     dhcp4: true
+    dhcp6: true
 {{- end}}
 {{- end}}
   zfallback:
     match:
       name: "e*"
     dhcp4: true
+    dhcp6: true
     optional: true
 `))
 )
@@ -120,15 +157,43 @@ type Config struct {
 	Password   string
 	Networks   []NetworkInfo
 	Mounts     []MountSpec // optional fstab entries written by cloud-init
-	DNS        []string    // e.g. ["8.8.8.8", "8.8.4.4"]
+	DNS        []string    // e.g. ["8.8.8.8", "2606:4700:4700::1111"]
+	SSHKeys    []string    // authorized_keys lines for the default user, root (when Username is root) and Username
+	UserData   []byte      // user-supplied user-data, merged after cocoon's cloud-config as multipart MIME
+	VendorData []byte      // written verbatim as NoCloud vendor-data
+}
+
+// KeysFile is where user-data stages SSHKeys for a non-root Username (cloud-init's ssh_authorized_keys only covers
+// the image's default user and root); empty when not needed.
+func (c *Config) KeysFile() string {
+	if len(c.SSHKeys) == 0 || c.Username == "" || c.Username == "root" {
+		return ""
+	}
+	return "/etc/cocoon/authorized_keys"
 }
 
 // NetworkInfo describes a single guest network interface for cloud-init.
 type NetworkInfo struct {
-	IP      string // e.g. "10.0.0.2"
-	Prefix  int    // CIDR prefix length, e.g. 24
-	Gateway string // e.g. "10.0.0.1"
-	MAC     string // MAC address for match:macaddress in network-config
+	IP        string   // primary IPv4, e.g. "10.0.0.2"; empty on an IPv6-only NIC
+	Prefix    int      // CIDR prefix length, e.g. 24
+	Gateway   string   // IPv4 default route, e.g. "10.0.0.1"
+	Addresses []string // further addresses in CIDR form (IPv6, secondary IPv4), e.g. "fd00::2/64"
+	Gateway6  string   // IPv6 default route, e.g. "fd00::1"
+	MAC       string   // MAC address for match:macaddress in network-config
+}
+
+// Static reports whether the NIC has any address; otherwise it is rendered as DHCP.
+func (n NetworkInfo) Static() bool {
+	return n.IP != "" || len(n.Addresses) > 0
+}
+
+// CIDRs returns every address of the NIC, primary IPv4 first.
+func (n NetworkInfo) CIDRs() []string {
+	var out []string
+	if n.IP != "" {
+		out = append(out, fmt.Sprintf("%s/%d", n.IP, n.Prefix))
+	}
+	return append(out, n.Addresses...)
 }
 
 // MountSpec is one cloud-init `mounts:` row. Options defaults to
@@ -154,7 +219,18 @@ func Generate(w io.Writer, cfg *Config) error {
 	if err := userDataTmpl.Execute(&buf, cfg); err != nil {
 		return fmt.Errorf("render user-data: %w", err)
 	}
-	files["user-data"] = bytes.Clone(buf.Bytes())
+	userData, err := mergeUserData(buf.Bytes(), cfg.UserData)
+	if err != nil {
+		return err
+	}
+	files["user-data"] = userData
+
+	if len(cfg.VendorData) > 0 {
+		if _, err := UserDataType(cfg.VendorData); err != nil {
+			return fmt.Errorf("vendor-data: %w", err)
+		}
+		files["vendor-data"] = cfg.VendorData
+	}
 
 	if len(cfg.Networks) > 0 {
 		buf.Reset()
@@ -145,6 +145,51 @@ func TestNetworkConfig_MultiNIC(t *testing.T) {
 	}
 }
 
+func TestNetworkConfig_DualStack(t *testing.T) {
+	cfg := &Config{
+		Networks: []NetworkInfo{
+			{IP: "10.0.0.2", Prefix: 24, Gateway: "10.0.0.1", Addresses: []string{"fd00::2/64"}, Gateway6: "fd00::1", MAC: "aa:bb:cc:dd:ee:f0"},
+			{Addresses: []string{"fd01::2/64"}, MAC: "11:22:33:44:55:66"},
+			{MAC: "22:33:44:55:66:77"},
+		},
+		DNS: []string{"2606:4700:4700::1111"},
+	}
+
+	var buf bytes.Buffer
+	if err := networkConfigTmpl.Execute(&buf, cfg); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"      - 10.0.0.2/24\n      - fd00::2/64\n",
+		"via: 10.0.0.1",
+		"via: fd00::1",
+		"      - fd01::2/64\n",
+		"- 2606:4700:4700::1111",
+		"id2:\n    match:\n      macaddress: \"22:33:44:55:66:77\"\n    dhcp4: true\n    dhcp6: true\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q: %s", want, out)
+		}
+	}
+	// The v6-only NIC is static, not DHCP.
+	if strings.Count(out, "dhcp6: true") != 2 {
+		t.Errorf("only the DHCP NIC and zfallback should request dhcp6: %s", out)
+	}
+
+	buf.Reset()
+	if err := userDataTmpl.Execute(&buf, cfg); err != nil {
+		t.Fatal(err)
+	}
+	ud := buf.String()
+	for _, want := range []string{"Address=10.0.0.2/24", "Address=fd00::2/64", "Gateway=fd00::1", "Address=fd01::2/64", "DNS=2606:4700:4700::1111", "DHCP=yes"} {
+		if !strings.Contains(ud, want) {
+			t.Errorf("networkd fallback missing %q: %s", want, ud)
+		}
+	}
+}
+
 func TestNetworkConfig_GatewayOptional(t *testing.T) {
 	cfg := &Config{
 		Networks: []NetworkInfo{
@@ -291,3 +336,75 @@ func TestUserData_MountsYAMLEscape(t *testing.T) {
 		t.Errorf("single quote not escaped: %s", buf.String())
 	}
 }
+
+func TestUserData_SSHKeysRoot(t *testing.T) {
+	cfg := &Config{Username: "root", SSHKeys: []string{"ssh-ed25519 AAAAC3Nza it's-me"}}
+
+	var buf bytes.Buffer
+	if err := userDataTmpl.Execute(&buf, cfg); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	if !strings.Contains(out, "ssh_authorized_keys:\n  - 'ssh-ed25519 AAAAC3Nza it''s-me'") {
+		t.Errorf("ssh_authorized_keys missing or unescaped: %s", out)
+	}
+	if !strings.Contains(out, "disable_root: false") {
+		t.Errorf("key-only root login needs disable_root: false: %s", out)
+	}
+	if strings.Contains(out, "chpasswd") || strings.Contains(out, "ssh_pwauth") {
+		t.Errorf("no password set, chpasswd/ssh_pwauth should not appear: %s", out)
+	}
+	if strings.Contains(out, "write_files:") {
+		t.Errorf("root keys need no staged keys file: %s", out)
+	}
+}
+
+func TestUserData_SSHKeysNamedUser(t *testing.T) {
+	cfg := &Config{Username: "dev", SSHKeys: []string{"ssh-ed25519 AAAAC3Nza dev@laptop", "ssh-rsa AAAAB3Nza"}}
+
+	var buf bytes.Buffer
+	if err := userDataTmpl.Execute(&buf, cfg); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"useradd -m -s /bin/bash -N dev",
+		"path: /etc/cocoon/authorized_keys",
+		"      ssh-ed25519 AAAAC3Nza dev@laptop\n      ssh-rsa AAAAB3Nza",
+		`cat /etc/cocoon/authorized_keys >> "$h/.ssh/authorized_keys"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("user-data missing %q: %s", want, out)
+		}
+	}
+	if strings.Contains(out, "chpasswd") {
+		t.Errorf("no password set, chpasswd should not appear: %s", out)
+	}
+}
+
+func TestGenerate_UserAndVendorData(t *testing.T) {
+	cfg := &Config{
+		InstanceID: "test-id",
+		Hostname:   "test-vm",
+		UserData:   []byte("#cloud-config\npackages: [htop]\n"),
+		VendorData: []byte("#!/bin/sh\necho vendor\n"),
+	}
+
+	var buf bytes.Buffer
+	if err := Generate(&buf, cfg); err != nil {
+		t.Fatal(err)
+	}
+	raw := buf.String()
+	for _, want := range []string{"multipart/mixed", "packages: [htop]", "Merge-Type: " + userMergeType, "echo vendor"} {
+		if !strings.Contains(raw, want) {
+			t.Errorf("cidata missing %q", want)
+		}
+	}
+
+	cfg.VendorData = []byte("plain text")
+	if err := Generate(&buf, cfg); err == nil {
+		t.Error("unrecognized vendor-data should fail")
+	}
+}
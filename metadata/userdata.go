@@ -0,0 +1,82 @@
+package metadata
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+)
+
+// userMergeType makes user cloud-config lists (runcmd, write_files, packages, ...) extend cocoon's instead of
+// replacing them, while user scalars still win.
+const userMergeType = "dict(recurse_array,replace)+list(append)+str()"
+
+// userDataTypes maps cloud-init's first-line markers to the MIME type of a multipart part.
+var userDataTypes = []struct{ prefix, mimeType string }{
+	{"#cloud-config", "text/cloud-config"},
+	{"#cloud-boothook", "text/cloud-boothook"},
+	{"#include", "text/x-include-url"},
+	{"#part-handler", "text/part-handler"},
+	{"## template: jinja", "text/jinja2"},
+	{"#!", "text/x-shellscript"},
+}
+
+// UserDataType returns the MIME type cloud-init would infer for data. MIME documents and gzip are rejected:
+// cocoon wraps user-data in its own multipart envelope.
+func UserDataType(data []byte) (string, error) {
+	for _, t := range userDataTypes {
+		if bytes.HasPrefix(data, []byte(t.prefix)) {
+			return t.mimeType, nil
+		}
+	}
+	first, _, _ := strings.Cut(string(data), "\n")
+	if strings.HasPrefix(strings.ToLower(first), "content-type:") {
+		return "", fmt.Errorf("MIME multipart user-data is not supported (pass the parts as separate cloud-config or script files)")
+	}
+	return "", fmt.Errorf("unrecognized user-data format (want #cloud-config, #!script, #cloud-boothook, #include, #part-handler or jinja)")
+}
+
+// mergeUserData returns cocoon's cloud-config alone, or a multipart/mixed document with the user's part after it.
+func mergeUserData(cocoon, user []byte) ([]byte, error) {
+	if len(user) == 0 {
+		return bytes.Clone(cocoon), nil
+	}
+	userType, err := UserDataType(user)
+	if err != nil {
+		return nil, fmt.Errorf("user-data: %w", err)
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	parts := []struct {
+		mimeType, filename string
+		data               []byte
+	}{
+		{"text/cloud-config", "cocoon.cfg", cocoon},
+		{userType, "user-data", user},
+	}
+	for _, p := range parts {
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Type", p.mimeType+`; charset="utf-8"`)
+		h.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", p.filename))
+		if p.filename == "user-data" {
+			h.Set("Merge-Type", userMergeType)
+		}
+		w, partErr := mw.CreatePart(h)
+		if partErr != nil {
+			return nil, partErr
+		}
+		if _, partErr = w.Write(p.data); partErr != nil {
+			return nil, partErr
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "Content-Type: multipart/mixed; boundary=%q\r\nMIME-Version: 1.0\r\n\r\n", mw.Boundary())
+	out.Write(body.Bytes())
+	return out.Bytes(), nil
+}
@@ -0,0 +1,79 @@
+package metadata
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"testing"
+)
+
+func TestUserDataType(t *testing.T) {
+	tests := []struct {
+		data, want string
+		wantErr    bool
+	}{
+		{data: "#cloud-config\nruncmd: []\n", want: "text/cloud-config"},
+		{data: "#!/bin/bash\necho hi\n", want: "text/x-shellscript"},
+		{data: "#cloud-boothook\n", want: "text/cloud-boothook"},
+		{data: "#include\nhttps://example.com/a\n", want: "text/x-include-url"},
+		{data: "## template: jinja\n#cloud-config\n", want: "text/jinja2"},
+		{data: "Content-Type: multipart/mixed; boundary=x\n", wantErr: true},
+		{data: "\x1f\x8b\x08", wantErr: true},
+		{data: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := UserDataType([]byte(tt.data))
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("UserDataType(%q) = %q, %v; want %q, err=%v", tt.data, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestMergeUserData(t *testing.T) {
+	cocoon := []byte("#cloud-config\nssh_pwauth: true\n")
+	if got, err := mergeUserData(cocoon, nil); err != nil || !bytes.Equal(got, cocoon) {
+		t.Fatalf("no user data should pass cocoon's config through, got %q, %v", got, err)
+	}
+
+	user := []byte("#!/bin/sh\ntouch /ready\n")
+	merged, err := mergeUserData(cocoon, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(merged))
+	if err != nil {
+		t.Fatalf("parse MIME: %v", err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("top-level type %q, %v", mediaType, err)
+	}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	want := []struct {
+		mimeType, mergeType string
+		body                []byte
+	}{
+		{"text/cloud-config", "", cocoon},
+		{"text/x-shellscript", userMergeType, user},
+	}
+	for i, w := range want {
+		part, partErr := mr.NextPart()
+		if partErr != nil {
+			t.Fatalf("part %d: %v", i, partErr)
+		}
+		if mt, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type")); mt != w.mimeType {
+			t.Errorf("part %d type %q, want %q", i, mt, w.mimeType)
+		}
+		if got := part.Header.Get("Merge-Type"); got != w.mergeType {
+			t.Errorf("part %d Merge-Type %q, want %q", i, got, w.mergeType)
+		}
+		if body, _ := io.ReadAll(part); !bytes.Equal(body, w.body) {
+			t.Errorf("part %d body %q, want %q", i, body, w.body)
+		}
+	}
+	if _, err := mr.NextPart(); err != io.EOF {
+		t.Errorf("expected exactly two parts, got err %v", err)
+	}
+}
@@ -4,9 +4,7 @@ package bridge
 
 import (
 	"context"
-	"crypto/rand"
 	"fmt"
-	"net"
 
 	"github.com/projecteru2/core/log"
 	"github.com/vishvananda/netlink"
@@ -14,6 +12,8 @@ import (
 	"github.com/cocoonstack/cocoon/config"
 	"github.com/cocoonstack/cocoon/gc"
 	"github.com/cocoonstack/cocoon/network"
+	"github.com/cocoonstack/cocoon/network/firewall"
+	"github.com/cocoonstack/cocoon/storage"
 	"github.com/cocoonstack/cocoon/types"
 )
 
@@ -21,11 +21,13 @@ const typ = "bridge"
 
 var _ network.Network = (*Bridge)(nil)
 
-// Bridge is TAP-on-bridge; requires a pre-existing bridge with DHCP + routing.
+// Bridge is TAP-on-bridge; requires a pre-existing bridge with routing, and DHCP unless cocoon manages its
+// addresses (--bridge-ipam).
 type Bridge struct {
 	conf      *config.Config
 	bridgeDev string
 	bridgeIdx int
+	leases    storage.Store[leaseIndex]
 }
 
 // New: the bridge device must already exist.
@@ -43,19 +45,40 @@ func New(conf *config.Config, bridgeDev string) (*Bridge, error) {
 	if br.Type() != "bridge" {
 		return nil, fmt.Errorf("%s is not a bridge (type: %s)", bridgeDev, br.Type())
 	}
+	leases, err := newLeaseStore(conf.RootDir)
+	if err != nil {
+		return nil, fmt.Errorf("lease store: %w", err)
+	}
 	return &Bridge{
 		conf:      conf,
 		bridgeDev: bridgeDev,
 		bridgeIdx: br.Attrs().Index,
+		leases:    leases,
 	}, nil
 }
 
 func (b *Bridge) Type() string { return typ }
 
-func (b *Bridge) Verify(_ context.Context, vmID string) error {
+// Verify checks the VM's first TAP. It also restarts the responder of any managed bridge the VM leases on (logged,
+// not failed: the TAPs are fine, and re-adding them would not help).
+func (b *Bridge) Verify(ctx context.Context, vmID string) error {
 	if _, err := netlink.LinkByName(tapName(vmID, 0)); err != nil {
 		return fmt.Errorf("tap %s: %w", tapName(vmID, 0), err)
 	}
+	managed := map[string]bridgeLeases{}
+	_ = b.leases.With(ctx, func(idx *leaseIndex) error {
+		for dev, bl := range idx.Bridges {
+			for _, l := range bl.Leases {
+				if l.VMID == vmID {
+					managed[dev] = *bl
+				}
+			}
+		}
+		return nil
+	})
+	if err := b.startManaged(managed); err != nil {
+		log.WithFunc("bridge.Verify").Warnf(ctx, "%s: %v", vmID, err)
+	}
 	return nil
 }
 
@@ -70,26 +93,55 @@ func (b *Bridge) Add(ctx context.Context, vmID string, vmCfg *types.VMConfig, sp
 	}
 	logger := log.WithFunc("bridge.Add")
 
-	br, err := netlink.LinkByIndex(b.bridgeIdx)
-	if err != nil {
-		return nil, fmt.Errorf("find bridge: %w", err)
+	// Each NIC may join its own bridge; resolve them all before creating any TAP.
+	bridges := make([]netlink.Link, len(specs))
+	macs := make([]string, len(specs))
+	for i, spec := range specs {
+		if spec.Request != nil && spec.Request.Network != "" {
+			return nil, fmt.Errorf("nic %d: network=%s needs a CNI VM: drop --bridge and attach bridges per NIC with --nic bridge=", spec.Index, spec.Request.Network)
+		}
+		br, brErr := b.bridgeFor(spec)
+		if brErr != nil {
+			return nil, fmt.Errorf("nic %d: %w", spec.Index, brErr)
+		}
+		bridges[i] = br
+		macs[i] = network.GenerateMAC()
+		switch {
+		case spec.Existing != nil:
+			macs[i] = spec.Existing.MAC
+		case spec.Request != nil && spec.Request.MAC != "":
+			macs[i] = spec.Request.MAC
+		}
 	}
 
+	nets, managed, err := b.leaseNICs(ctx, vmID, vmCfg, specs, bridges, macs)
+	if err != nil {
+		return nil, err
+	}
+	var fresh []int
+	for _, spec := range specs {
+		if spec.Existing == nil {
+			fresh = append(fresh, spec.Index)
+		}
+	}
 	added := make([]int, 0, len(specs))
 	defer func() {
-		if retErr == nil || len(added) == 0 {
+		if retErr == nil {
 			return
 		}
 		_ = tearDownTAPs(vmID, added, true)
+		if len(managed) > 0 && len(fresh) > 0 {
+			_ = releaseLeases(context.WithoutCancel(ctx), b.leases, vmID, fresh)
+		}
 	}()
+	if err = b.startManaged(managed); err != nil {
+		return nil, err
+	}
 
 	configs = make([]*types.NetworkConfig, 0, len(specs))
-	for _, spec := range specs {
-		name := tapName(vmID, spec.Index)
-		mac := generateMAC()
-		if spec.Existing != nil {
-			mac = spec.Existing.MAC
-		}
+	for i, spec := range specs {
+		br := bridges[i]
+		name, mac := tapName(vmID, spec.Index), macs[i]
 		queues := network.NetNumQueues(vmCfg.CPU)
 		if cErr := createTAP(name, queues); cErr != nil {
 			return nil, fmt.Errorf("create tap %s: %w", name, cErr)
@@ -102,7 +154,7 @@ func (b *Bridge) Add(ctx context.Context, vmID string, vmCfg *types.VMConfig, sp
 		}
 
 		if mErr := netlink.LinkSetMaster(tap, br); mErr != nil {
-			return nil, fmt.Errorf("add %s to %s: %w", name, b.bridgeDev, mErr)
+			return nil, fmt.Errorf("add %s to %s: %w", name, br.Attrs().Name, mErr)
 		}
 
 		_ = netlink.LinkSetLearning(tap, false)
@@ -111,6 +163,10 @@ func (b *Bridge) Add(ctx context.Context, vmID string, vmCfg *types.VMConfig, sp
 		}
 		_ = network.TuneTAP(tap)
 
+		// Filter before the port comes up so the guest never sees unfiltered traffic.
+		if fwErr := firewall.Apply(firewall.NIC{TAP: name}, vmCfg.Firewall); fwErr != nil {
+			return nil, fmt.Errorf("firewall %s: %w", name, fwErr)
+		}
 		if uErr := netlink.LinkSetUp(tap); uErr != nil {
 			return nil, fmt.Errorf("set %s up: %w", name, uErr)
 		}
@@ -121,19 +177,51 @@ func (b *Bridge) Add(ctx context.Context, vmID string, vmCfg *types.VMConfig, sp
 			NumQueues: queues,
 			QueueSize: network.ResolveQueueSize(vmCfg.QueueSize),
 			Backend:   types.BackendBridge,
-			BridgeDev: b.bridgeDev,
+			BridgeDev: br.Attrs().Name,
+			Network:   nets[i],
 		})
-		logger.Debugf(ctx, "NIC %d: tap=%s mac=%s bridge=%s", spec.Index, name, mac, b.bridgeDev)
+		logger.Debugf(ctx, "NIC %d: tap=%s mac=%s bridge=%s", spec.Index, name, mac, br.Attrs().Name)
 	}
 	return configs, nil
 }
 
-func (b *Bridge) Remove(_ context.Context, vmID string, indices ...int) error {
-	return tearDownTAPs(vmID, indices, false)
+// bridgeFor returns the bridge a NIC joins: its persisted or requested device, else the provider's own.
+func (b *Bridge) bridgeFor(spec network.AddSpec) (netlink.Link, error) {
+	dev := b.bridgeDev
+	switch {
+	case spec.Existing != nil && spec.Existing.BridgeDev != "":
+		dev = spec.Existing.BridgeDev
+	case spec.Request != nil && spec.Request.Bridge != "":
+		dev = spec.Request.Bridge
+	}
+	if dev == b.bridgeDev {
+		br, err := netlink.LinkByIndex(b.bridgeIdx)
+		if err != nil {
+			return nil, fmt.Errorf("find bridge: %w", err)
+		}
+		return br, nil
+	}
+	br, err := netlink.LinkByName(dev)
+	if err != nil {
+		return nil, fmt.Errorf("bridge %s: %w", dev, err)
+	}
+	if br.Type() != "bridge" {
+		return nil, fmt.Errorf("%s is not a bridge (type: %s)", dev, br.Type())
+	}
+	return br, nil
+}
+
+func (b *Bridge) Remove(ctx context.Context, vmID string, indices ...int) error {
+	if err := tearDownTAPs(vmID, indices, false); err != nil {
+		return err
+	}
+	return releaseLeases(ctx, b.leases, vmID, indices)
 }
 
-func (b *Bridge) Delete(_ context.Context, vmIDs []string) ([]string, error) {
-	return CleanupTAPs(vmIDs), nil
+func (b *Bridge) Delete(ctx context.Context, vmIDs []string) ([]string, error) {
+	cleaned := CleanupTAPs(vmIDs)
+	ReleaseLeases(ctx, b.conf.RootDir, cleaned)
+	return cleaned, nil
 }
 
 // Inspect: bridge has no persistent records.
@@ -215,10 +303,3 @@ func createTAP(name string, numQueues int) error {
 func tapName(vmID string, nic int) string {
 	return fmt.Sprintf("%s%s-%d", tapPrefix, network.VMIDPrefix(vmID), nic)
 }
-
-func generateMAC() string {
-	buf := make([]byte, 6) //nolint:mnd
-	_, _ = rand.Read(buf)
-	buf[0] = (buf[0] | 0x02) & 0xfe
-	return net.HardwareAddr(buf).String()
-}
@@ -1,6 +1,7 @@
 //go:build !linux
 
-// Package bridge: non-Linux stubs. All Bridge methods return errUnsupported; CleanupTAPs is a no-op.
+// Package bridge: non-Linux stubs. All Bridge methods return errUnsupported; CleanupTAPs, ReleaseLeases and
+// RunResponder are no-ops.
 package bridge
 
 import (
@@ -46,3 +47,9 @@ func (b *Bridge) Inspect(_ context.Context, _ string) (*types.Network, error) {
 func (b *Bridge) List(_ context.Context) ([]*types.Network, error) { return nil, errUnsupported }
 
 func CleanupTAPs(_ []string) []string { return nil }
+
+func ReleaseLeases(_ context.Context, _ string, _ []string) {}
+
+func IsResponderMode() bool { return false }
+
+func RunResponder(_ context.Context) {}
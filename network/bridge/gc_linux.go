@@ -4,6 +4,7 @@ package bridge
 
 import (
 	"context"
+	"os"
 	"path/filepath"
 	"slices"
 	"strings"
@@ -19,13 +20,13 @@ import (
 
 const tapPrefix = "bt"
 
-// bridgeSnapshot holds the set of VM ID prefixes that own bt* TAP devices.
+// bridgeSnapshot holds the set of VM ID prefixes that own bt* TAP devices or managed-bridge leases.
 type bridgeSnapshot struct {
 	prefixes map[string]struct{}
 }
 
-// GCModule returns a GC module that reclaims orphan bt* TAP devices.
-// It does not require a Bridge instance — only rootDir for the lock file.
+// GCModule returns a GC module that reclaims orphan bt* TAP devices and leases.
+// It does not require a Bridge instance — only rootDir for the lock and lease files.
 func GCModule(rootDir string) gc.Module[bridgeSnapshot] {
 	lockPath := filepath.Join(rootDir, "bridge", "gc.lock")
 	_ = utils.EnsureDirs(filepath.Dir(lockPath))
@@ -33,7 +34,7 @@ func GCModule(rootDir string) gc.Module[bridgeSnapshot] {
 	return gc.Module[bridgeSnapshot]{
 		Name:   typ,
 		Locker: flock.New(lockPath),
-		ReadDB: func(_ context.Context) (bridgeSnapshot, error) {
+		ReadDB: func(ctx context.Context) (bridgeSnapshot, error) {
 			snap := bridgeSnapshot{prefixes: make(map[string]struct{})}
 
 			links, err := netlink.LinkList()
@@ -45,6 +46,9 @@ func GCModule(rootDir string) gc.Module[bridgeSnapshot] {
 					snap.prefixes[prefix] = struct{}{}
 				}
 			}
+			for _, vmID := range leaseHolders(ctx, rootDir) {
+				snap.prefixes[network.VMIDPrefix(vmID)] = struct{}{}
+			}
 			return snap, nil
 		},
 		Resolve: func(_ context.Context, snap bridgeSnapshot, others map[string]any) []string {
@@ -92,11 +96,40 @@ func GCModule(rootDir string) gc.Module[bridgeSnapshot] {
 					logger.Infof(ctx, "collected id=%s iface=%s reason=orphan-tap", prefix, name)
 				}
 			}
+			for _, vmID := range leaseHolders(ctx, rootDir) {
+				if _, orphan := orphanSet[network.VMIDPrefix(vmID)]; orphan {
+					ReleaseLeases(ctx, rootDir, []string{vmID})
+					logger.Infof(ctx, "collected id=%s reason=orphan-lease", vmID)
+				}
+			}
 			return nil
 		},
 	}
 }
 
+// leaseHolders lists the VMs holding managed-bridge leases; none when no bridge was ever managed.
+func leaseHolders(ctx context.Context, rootDir string) []string {
+	if _, err := os.Stat(leaseFile(rootDir)); err != nil {
+		return nil
+	}
+	store, err := newLeaseStore(rootDir)
+	if err != nil {
+		return nil
+	}
+	var ids []string
+	_ = store.With(ctx, func(idx *leaseIndex) error {
+		for _, bl := range idx.Bridges {
+			for _, l := range bl.Leases {
+				if !slices.Contains(ids, l.VMID) {
+					ids = append(ids, l.VMID)
+				}
+			}
+		}
+		return nil
+	})
+	return ids
+}
+
 // parseTAPName extracts the vmID prefix from a bridge TAP name like "bt<prefix>-<nic>".
 // Returns the prefix and true, or ("", false) if the name doesn't match.
 func parseTAPName(name string) (string, bool) {
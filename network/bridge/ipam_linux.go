@@ -0,0 +1,191 @@
+//go:build linux
+
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/projecteru2/core/log"
+	"github.com/vishvananda/netlink"
+
+	"github.com/cocoonstack/cocoon/lock/flock"
+	"github.com/cocoonstack/cocoon/network"
+	"github.com/cocoonstack/cocoon/storage"
+	storejson "github.com/cocoonstack/cocoon/storage/json"
+	"github.com/cocoonstack/cocoon/types"
+	"github.com/cocoonstack/cocoon/utils"
+)
+
+// leaseDuration is what DHCP clients are told; leases are static, so renewals just confirm them.
+const leaseDuration = 12 * time.Hour
+
+func newLeaseStore(rootDir string) (storage.Store[leaseIndex], error) {
+	if err := utils.EnsureDirs(filepath.Dir(leaseFile(rootDir))); err != nil {
+		return nil, err
+	}
+	return storejson.New[leaseIndex](leaseFile(rootDir), flock.New(leaseLock(rootDir))), nil
+}
+
+// leaseNICs reserves managed-bridge addresses for specs (the recorded or --nic ip= one when given), registering the
+// VM's own bridge first when --bridge-ipam asks for it. NICs on unmanaged bridges keep their recorded config (nil
+// for fresh ones): the bridge's own DHCP serves them. The returned map holds the managed bridges the NICs join.
+func (b *Bridge) leaseNICs(ctx context.Context, vmID string, vmCfg *types.VMConfig, specs []network.AddSpec, bridges []netlink.Link, macs []string) ([]*types.Network, map[string]bridgeLeases, error) {
+	var (
+		subnet  netip.Prefix
+		gateway netip.Addr
+		owned   bool
+	)
+	if vmCfg.BridgeIPAM != "" {
+		var err error
+		if subnet, err = types.ParseBridgeIPAM(vmCfg.BridgeIPAM); err != nil {
+			return nil, nil, err
+		}
+		if gateway, owned, err = gatewayFor(b.bridgeDev, subnet); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	nets := make([]*types.Network, len(specs))
+	managed := map[string]bridgeLeases{}
+	err := b.leases.Update(ctx, func(idx *leaseIndex) error {
+		if vmCfg.BridgeIPAM != "" {
+			if err := idx.manage(b.bridgeDev, subnet, gateway, owned); err != nil {
+				return err
+			}
+		}
+		for i, spec := range specs {
+			var want string
+			switch {
+			case spec.Existing != nil:
+				nets[i] = spec.Existing.Network
+				if spec.Existing.Network != nil {
+					want = spec.Existing.Network.IP
+				}
+			case spec.Request != nil:
+				want = spec.Request.IP
+			}
+			dev := bridges[i].Attrs().Name
+			bl := idx.Bridges[dev]
+			if bl == nil {
+				if spec.Request != nil && spec.Request.IP != "" {
+					return fmt.Errorf("nic %d: ip=%s needs a CNI network or --bridge-ipam: %s's own DHCP server picks the address", spec.Index, spec.Request.IP, dev)
+				}
+				continue
+			}
+			ip, err := bl.allocate(lease{VMID: vmID, VMName: vmCfg.Name, NIC: spec.Index, MAC: macs[i]}, want)
+			if err != nil {
+				return fmt.Errorf("nic %d on %s: %w", spec.Index, dev, err)
+			}
+			nets[i] = bl.network(ip)
+			managed[dev] = *bl
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return nets, managed, nil
+}
+
+// startManaged brings up what the managed bridges need to serve their leases: the gateway address and the responder.
+func (b *Bridge) startManaged(managed map[string]bridgeLeases) error {
+	for dev, bl := range managed {
+		if err := ensureGateway(dev, bl); err != nil {
+			return err
+		}
+		if err := ensureResponder(b.conf, dev); err != nil {
+			return fmt.Errorf("start responder for %s: %w", dev, err)
+		}
+	}
+	return nil
+}
+
+// releaseLeases frees vmID's leases on nics (all when nil); bridges left without leases lose the gateway cocoon
+// assigned, and their responders exit on their own.
+func releaseLeases(ctx context.Context, store storage.Store[leaseIndex], vmID string, nics []int) error {
+	var emptied map[string]*bridgeLeases
+	if err := store.Update(ctx, func(idx *leaseIndex) error {
+		emptied = idx.release(vmID, nics)
+		return nil
+	}); err != nil {
+		return fmt.Errorf("release leases of %s: %w", vmID, err)
+	}
+	for dev, bl := range emptied {
+		if bl.OwnsGateway {
+			dropGateway(ctx, dev, *bl)
+		}
+	}
+	return nil
+}
+
+// ReleaseLeases frees the managed-bridge leases of deleted VMs; safe without a Bridge instance, and a no-op when no
+// bridge was ever managed.
+func ReleaseLeases(ctx context.Context, rootDir string, vmIDs []string) {
+	if _, err := os.Stat(leaseFile(rootDir)); err != nil {
+		return
+	}
+	store, err := newLeaseStore(rootDir)
+	if err != nil {
+		return
+	}
+	for _, vmID := range vmIDs {
+		if err := releaseLeases(ctx, store, vmID, nil); err != nil {
+			log.WithFunc("bridge.ReleaseLeases").Warnf(ctx, "%v", err)
+		}
+	}
+}
+
+// gatewayFor picks the managed subnet's gateway: an address dev already has in it, else the first host, which cocoon
+// then assigns (owned).
+func gatewayFor(dev string, subnet netip.Prefix) (netip.Addr, bool, error) {
+	link, err := netlink.LinkByName(dev)
+	if err != nil {
+		return netip.Addr{}, false, fmt.Errorf("bridge %s: %w", dev, err)
+	}
+	addrs, err := netlink.AddrList(link, netlink.FAMILY_V4)
+	if err != nil {
+		return netip.Addr{}, false, fmt.Errorf("list addresses of %s: %w", dev, err)
+	}
+	for _, a := range addrs {
+		if ip, ok := netip.AddrFromSlice(a.IP.To4()); ok && subnet.Contains(ip) {
+			return ip, false, nil
+		}
+	}
+	return subnet.Addr().Next(), true, nil
+}
+
+// ensureGateway assigns bl's gateway to dev unless it is there already (a host reboot drops cocoon's address).
+func ensureGateway(dev string, bl bridgeLeases) error {
+	link, err := netlink.LinkByName(dev)
+	if err != nil {
+		return fmt.Errorf("bridge %s: %w", dev, err)
+	}
+	addr := gatewayAddr(bl)
+	if err = netlink.AddrAdd(link, addr); err != nil && !errors.Is(err, syscall.EEXIST) {
+		return fmt.Errorf("assign %s to %s: %w", addr.IPNet, dev, err)
+	}
+	return nil
+}
+
+func dropGateway(ctx context.Context, dev string, bl bridgeLeases) {
+	link, err := netlink.LinkByName(dev)
+	if err != nil {
+		return
+	}
+	if err = netlink.AddrDel(link, gatewayAddr(bl)); err != nil && !errors.Is(err, syscall.EADDRNOTAVAIL) {
+		log.WithFunc("bridge.dropGateway").Warnf(ctx, "remove %s from %s: %v", bl.Gateway, dev, err)
+	}
+}
+
+func gatewayAddr(bl bridgeLeases) *netlink.Addr {
+	bits := netip.MustParsePrefix(bl.Subnet).Bits()
+	return &netlink.Addr{IPNet: &net.IPNet{IP: net.ParseIP(bl.Gateway).To4(), Mask: net.CIDRMask(bits, 32)}} //nolint:mnd
+}
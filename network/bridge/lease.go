@@ -0,0 +1,140 @@
+package bridge
+
+import (
+	"fmt"
+	"net/netip"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/cocoonstack/cocoon/types"
+)
+
+// leaseIndex is the IPAM DB of managed bridges (--bridge-ipam): per bridge, its subnet and the static lease of every
+// cocoon NIC on it. The bridge's responder serves DHCP and DNS straight from this file.
+type leaseIndex struct {
+	Bridges map[string]*bridgeLeases `json:"bridges"`
+}
+
+// bridgeLeases is one managed bridge; it is dropped with its last lease.
+type bridgeLeases struct {
+	Subnet  string `json:"subnet"`  // masked CIDR, e.g. "192.168.100.0/24"
+	Gateway string `json:"gateway"` // the bridge's address: one it already had in the subnet, else the first host
+	// OwnsGateway records that cocoon assigned Gateway, so it is removed again with the last lease.
+	OwnsGateway bool              `json:"owns_gateway,omitempty"`
+	Leases      map[string]*lease `json:"leases"` // IP → lease
+}
+
+// lease reserves one address for one VM NIC.
+type lease struct {
+	VMID   string `json:"vm_id"`
+	VMName string `json:"vm_name"`
+	NIC    int    `json:"nic"`
+	MAC    string `json:"mac"`
+}
+
+// Init implements storage.Initer.
+func (idx *leaseIndex) Init() {
+	if idx.Bridges == nil {
+		idx.Bridges = make(map[string]*bridgeLeases)
+	}
+}
+
+// manage registers dev with subnet and its gateway; re-registering the same subnet is a no-op, another one is an
+// error while leases remain. owned marks a gateway cocoon assigns to the bridge itself.
+func (idx *leaseIndex) manage(dev string, subnet netip.Prefix, gateway netip.Addr, owned bool) error {
+	if bl := idx.Bridges[dev]; bl != nil {
+		if bl.Subnet != subnet.String() {
+			return fmt.Errorf("--bridge-ipam %s: bridge %s is already managed with %s", subnet, dev, bl.Subnet)
+		}
+		return nil
+	}
+	idx.Bridges[dev] = &bridgeLeases{
+		Subnet:      subnet.String(),
+		Gateway:     gateway.String(),
+		OwnsGateway: owned,
+		Leases:      make(map[string]*lease),
+	}
+	return nil
+}
+
+// allocate reserves an address for l: want when the NIC already had one (recovery keeps it), else the lowest free
+// host other than the gateway.
+func (bl *bridgeLeases) allocate(l lease, want string) (string, error) {
+	prefix := netip.MustParsePrefix(bl.Subnet)
+	if want != "" {
+		addr, err := netip.ParseAddr(want)
+		if err != nil || !prefix.Contains(addr) || want == bl.Gateway {
+			return "", fmt.Errorf("address %s is not a guest address of %s", want, bl.Subnet)
+		}
+		if held := bl.Leases[want]; held != nil && (held.VMID != l.VMID || held.NIC != l.NIC) {
+			return "", fmt.Errorf("address %s is leased to %s", want, held.VMName)
+		}
+		bl.Leases[want] = &l
+		return want, nil
+	}
+	last := broadcastAddr(prefix)
+	for addr := prefix.Addr().Next(); addr.Less(last); addr = addr.Next() {
+		if _, taken := bl.Leases[addr.String()]; !taken && addr.String() != bl.Gateway {
+			bl.Leases[addr.String()] = &l
+			return addr.String(), nil
+		}
+	}
+	return "", fmt.Errorf("subnet %s has no free address", bl.Subnet)
+}
+
+// network is the guest config of the lease on ip.
+func (bl *bridgeLeases) network(ip string) *types.Network {
+	return &types.Network{IP: ip, Gateway: bl.Gateway, Prefix: netip.MustParsePrefix(bl.Subnet).Bits()}
+}
+
+// byMAC returns the lease of mac and its address; nil when none.
+func (bl *bridgeLeases) byMAC(mac string) (string, *lease) {
+	for ip, l := range bl.Leases {
+		if strings.EqualFold(l.MAC, mac) {
+			return ip, l
+		}
+	}
+	return "", nil
+}
+
+// byName returns the address of the lowest NIC the VM named name has on this bridge, "" when none. Lookups stay
+// within one bridge so a guest cannot discover VMs on bridges it is not attached to.
+func (bl *bridgeLeases) byName(name string) string {
+	found, nic := "", -1
+	for ip, l := range bl.Leases {
+		if strings.EqualFold(l.VMName, name) && (nic < 0 || l.NIC < nic) {
+			found, nic = ip, l.NIC
+		}
+	}
+	return found
+}
+
+// release drops vmID's leases on NICs nics (all of them when nics is nil) and returns the bridges left without
+// leases, which are no longer managed.
+func (idx *leaseIndex) release(vmID string, nics []int) map[string]*bridgeLeases {
+	emptied := map[string]*bridgeLeases{}
+	for dev, bl := range idx.Bridges {
+		for ip, l := range bl.Leases {
+			if l.VMID == vmID && (nics == nil || slices.Contains(nics, l.NIC)) {
+				delete(bl.Leases, ip)
+			}
+		}
+		if len(bl.Leases) == 0 {
+			delete(idx.Bridges, dev)
+			emptied[dev] = bl
+		}
+	}
+	return emptied
+}
+
+func broadcastAddr(prefix netip.Prefix) netip.Addr {
+	b := prefix.Addr().As4()
+	for i := prefix.Bits(); i < 32; i++ { //nolint:mnd
+		b[i/8] |= 0x80 >> (i % 8) //nolint:mnd
+	}
+	return netip.AddrFrom4(b)
+}
+
+func leaseFile(rootDir string) string { return filepath.Join(rootDir, "bridge", "db", "leases.json") }
+func leaseLock(rootDir string) string { return filepath.Join(rootDir, "bridge", "db", "leases.lock") }
@@ -0,0 +1,130 @@
+package bridge
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/cocoonstack/cocoon/types"
+)
+
+func managedIndex(t *testing.T, cidr, gateway string) (*leaseIndex, *bridgeLeases) {
+	t.Helper()
+	idx := &leaseIndex{}
+	idx.Init()
+	if err := idx.manage("br0", netip.MustParsePrefix(cidr), netip.MustParseAddr(gateway), true); err != nil {
+		t.Fatal(err)
+	}
+	return idx, idx.Bridges["br0"]
+}
+
+func TestLeaseAllocate(t *testing.T) {
+	idx, bl := managedIndex(t, "192.168.100.0/29", "192.168.100.1")
+
+	// .2-.6 are the guest addresses of a /29 with .1 as gateway.
+	var got []string
+	for nic := range 5 {
+		ip, err := bl.allocate(lease{VMID: "vm-a", VMName: "a", NIC: nic}, "")
+		if err != nil {
+			t.Fatalf("nic %d: %v", nic, err)
+		}
+		got = append(got, ip)
+	}
+	if want := "192.168.100.2 192.168.100.3 192.168.100.4 192.168.100.5 192.168.100.6"; strings.Join(got, " ") != want {
+		t.Errorf("allocated %v, want %s", got, want)
+	}
+	if _, err := bl.allocate(lease{VMID: "vm-b", NIC: 0}, ""); err == nil {
+		t.Error("expected exhaustion error")
+	}
+
+	// Releasing frees the address for the next VM; recovery re-claims its own.
+	idx.release("vm-a", []int{1})
+	if ip, err := bl.allocate(lease{VMID: "vm-b", VMName: "b", NIC: 0}, ""); err != nil || ip != "192.168.100.3" {
+		t.Errorf("after release got %q, %v; want 192.168.100.3", ip, err)
+	}
+	if _, err := bl.allocate(lease{VMID: "vm-a", VMName: "a", NIC: 0}, "192.168.100.2"); err != nil {
+		t.Errorf("re-claim own address: %v", err)
+	}
+	if _, err := bl.allocate(lease{VMID: "vm-c", NIC: 0}, "192.168.100.2"); err == nil || !strings.Contains(err.Error(), "leased to a") {
+		t.Errorf("claim of a held address: %v", err)
+	}
+	if _, err := bl.allocate(lease{VMID: "vm-c", NIC: 0}, "192.168.100.1"); err == nil {
+		t.Error("expected the gateway to be refused")
+	}
+	if _, err := bl.allocate(lease{VMID: "vm-c", NIC: 0}, "10.0.0.5"); err == nil {
+		t.Error("expected an address outside the subnet to be refused")
+	}
+}
+
+func TestLeaseGatewayNotFirstHost(t *testing.T) {
+	_, bl := managedIndex(t, "10.9.0.0/30", "10.9.0.2")
+	ip, err := bl.allocate(lease{VMID: "vm-a"}, "")
+	if err != nil || ip != "10.9.0.1" {
+		t.Fatalf("got %q, %v; want 10.9.0.1", ip, err)
+	}
+	want := types.Network{IP: "10.9.0.1", Gateway: "10.9.0.2", Prefix: 30}
+	if got := bl.network(ip); got.IP != want.IP || got.Gateway != want.Gateway || got.Prefix != want.Prefix {
+		t.Errorf("network = %+v, want %+v", got, want)
+	}
+}
+
+func TestLeaseManage(t *testing.T) {
+	idx, _ := managedIndex(t, "192.168.100.0/24", "192.168.100.1")
+	if err := idx.manage("br0", netip.MustParsePrefix("192.168.100.0/24"), netip.MustParseAddr("192.168.100.1"), true); err != nil {
+		t.Errorf("same subnet again: %v", err)
+	}
+	if err := idx.manage("br0", netip.MustParsePrefix("192.168.200.0/24"), netip.MustParseAddr("192.168.200.1"), true); err == nil {
+		t.Error("expected a different subnet on a managed bridge to be refused")
+	}
+}
+
+func TestLeaseLookupAndRelease(t *testing.T) {
+	idx, bl := managedIndex(t, "192.168.100.0/24", "192.168.100.1")
+	ipA1, _ := bl.allocate(lease{VMID: "vm-a", VMName: "web", NIC: 1, MAC: "52:54:00:00:00:02"}, "")
+	ipA0, _ := bl.allocate(lease{VMID: "vm-a", VMName: "web", NIC: 0, MAC: "52:54:00:00:00:01"}, "")
+	ipB, _ := bl.allocate(lease{VMID: "vm-b", VMName: "db", NIC: 0, MAC: "52:54:00:00:00:03"}, "")
+
+	if got := bl.byName("WEB"); got != ipA0 {
+		t.Errorf("byName(web) = %q, want NIC 0's %s (NIC 1 has %s)", got, ipA0, ipA1)
+	}
+	if ip, l := bl.byMAC("52:54:00:00:00:03"); ip != ipB || l.VMName != "db" {
+		t.Errorf("byMAC = %q, %+v", ip, l)
+	}
+	if ip, l := bl.byMAC("52:54:00:00:00:09"); ip != "" || l != nil {
+		t.Errorf("unknown MAC matched %q", ip)
+	}
+
+	if emptied := idx.release("vm-a", nil); len(emptied) != 0 {
+		t.Errorf("bridge emptied while vm-b holds a lease: %v", emptied)
+	}
+	if bl.byName("web") != "" {
+		t.Error("web still resolves after release")
+	}
+	emptied := idx.release("vm-b", nil)
+	if emptied["br0"] == nil || !emptied["br0"].OwnsGateway || idx.Bridges["br0"] != nil {
+		t.Errorf("last release should unmanage br0: emptied=%v bridges=%v", emptied, idx.Bridges)
+	}
+}
+
+func TestLeaseByNameStaysOnBridge(t *testing.T) {
+	idx, br0 := managedIndex(t, "192.168.100.0/24", "192.168.100.1")
+	if err := idx.manage("br1", netip.MustParsePrefix("192.168.200.0/24"), netip.MustParseAddr("192.168.200.1"), true); err != nil {
+		t.Fatal(err)
+	}
+	br1 := idx.Bridges["br1"]
+	ipWeb, _ := br0.allocate(lease{VMID: "vm-a", VMName: "web", MAC: "52:54:00:00:00:01"}, "")
+	ipDB, _ := br1.allocate(lease{VMID: "vm-b", VMName: "db", MAC: "52:54:00:00:00:02"}, "")
+
+	if got := br0.byName("web"); got != ipWeb {
+		t.Errorf("br0 byName(web) = %q, want %s", got, ipWeb)
+	}
+	if got := br1.byName("db"); got != ipDB {
+		t.Errorf("br1 byName(db) = %q, want %s", got, ipDB)
+	}
+	if got := br0.byName("db"); got != "" {
+		t.Errorf("br0 resolved db on br1 to %s", got)
+	}
+	if got := br1.byName("web"); got != "" {
+		t.Errorf("br1 resolved web on br0 to %s", got)
+	}
+}
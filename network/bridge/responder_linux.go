@@ -0,0 +1,246 @@
+//go:build linux
+
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/projecteru2/core/log"
+	"golang.org/x/sys/unix"
+
+	"github.com/cocoonstack/cocoon/config"
+	"github.com/cocoonstack/cocoon/lock/flock"
+	"github.com/cocoonstack/cocoon/network/responder"
+	"github.com/cocoonstack/cocoon/storage"
+	"github.com/cocoonstack/cocoon/utils"
+)
+
+const (
+	responderEnvKey     = "_COCOON_BRIDGE_RESPONDER" // bridge device
+	responderRootEnvKey = "_COCOON_ROOT_DIR"
+	responderRunEnvKey  = "_COCOON_RUN_DIR"
+	responderDNSEnvKey  = "_COCOON_DNS"
+
+	responderPollInterval = 5 * time.Second
+	packetBufSize         = 1500
+)
+
+// IsResponderMode returns true when the process was started as a bridge's DHCP/DNS responder.
+func IsResponderMode() bool {
+	return os.Getenv(responderEnvKey) != ""
+}
+
+// ensureResponder starts dev's responder unless one is running. Concurrent starts are harmless: the responder holds
+// a per-bridge flock and a second one exits at once.
+func ensureResponder(conf *config.Config, dev string) error {
+	if pid, err := utils.ReadPIDFile(responderPIDFile(conf.RunDir, dev)); err == nil && utils.IsProcessAlive(pid) {
+		return nil
+	}
+	if err := utils.EnsureDirs(filepath.Join(conf.RunDir, "bridge"), filepath.Join(conf.LogDir, "bridge")); err != nil {
+		return err
+	}
+	logFile, err := os.OpenFile(filepath.Join(conf.LogDir, "bridge", dev+"-responder.log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600) //nolint:gosec
+	if err != nil {
+		return err
+	}
+	defer logFile.Close() //nolint:errcheck
+
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("os.Executable: %w", err)
+	}
+	// shell out because self-exec spawns a detached responder that outlives this command.
+	cmd := exec.Command(self) //nolint:gosec
+	cmd.Env = []string{
+		responderEnvKey + "=" + dev,
+		responderRootEnvKey + "=" + conf.RootDir,
+		responderRunEnvKey + "=" + conf.RunDir,
+		responderDNSEnvKey + "=" + conf.DNS,
+	}
+	cmd.Stdout, cmd.Stderr = logFile, logFile
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait() //nolint:errcheck
+	return nil
+}
+
+// RunResponder serves DHCP on the bridge named by $_COCOON_BRIDGE_RESPONDER and DNS on its gateway address, both
+// from the lease store, until the bridge stops being managed.
+func RunResponder(ctx context.Context) {
+	dev := os.Getenv(responderEnvKey)
+	runDir := os.Getenv(responderRunEnvKey)
+	logger := log.WithFunc("bridge.RunResponder")
+
+	single := flock.New(filepath.Join(runDir, "bridge", dev+".lock"))
+	if ok, err := single.TryLock(ctx); err != nil || !ok {
+		return // another responder serves dev
+	}
+	defer single.Unlock(ctx) //nolint:errcheck
+	pidFile := responderPIDFile(runDir, dev)
+	if err := utils.WritePIDFile(pidFile, os.Getpid()); err != nil {
+		logger.Warnf(ctx, "write pid file: %v", err)
+	}
+	defer os.Remove(pidFile) //nolint:errcheck
+
+	store, err := newLeaseStore(os.Getenv(responderRootEnvKey))
+	if err != nil {
+		logger.Warnf(ctx, "open lease store: %v", err)
+		return
+	}
+	bl, ok := loadBridge(ctx, store, dev)
+	if !ok {
+		return
+	}
+	gateway := net.ParseIP(bl.Gateway).To4()
+	upstreams, _ := (&config.Config{DNS: os.Getenv(responderDNSEnvKey)}).DNSServers()
+
+	dhcpConn, err := listenUDP(ctx, dev, ":67")
+	if err != nil {
+		logger.Warnf(ctx, "dhcp on %s: %v", dev, err)
+		return
+	}
+	defer dhcpConn.Close() //nolint:errcheck
+	dnsConn, err := listenUDP(ctx, dev, net.JoinHostPort(bl.Gateway, "53"))
+	if err != nil {
+		logger.Warnf(ctx, "dns on %s: %v", dev, err)
+		return
+	}
+	defer dnsConn.Close() //nolint:errcheck
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go serveDHCP(ctx, store, dev, gateway, dhcpConn)
+	go serveDNS(ctx, store, dev, dnsConn, upstreams)
+	logger.Infof(ctx, "serving %s on %s", bl.Subnet, dev)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(responderPollInterval):
+		}
+		if _, ok = loadBridge(ctx, store, dev); !ok {
+			logger.Infof(ctx, "%s has no leases left, exiting", dev)
+			return
+		}
+	}
+}
+
+func serveDHCP(ctx context.Context, store storage.Store[leaseIndex], dev string, gateway net.IP, conn net.PacketConn) {
+	logger := log.WithFunc("bridge.serveDHCP")
+	buf := make([]byte, packetBufSize)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Warnf(ctx, "read: %v", err)
+			}
+			return
+		}
+		req, err := responder.ParseDHCP(buf[:n])
+		if err != nil {
+			continue
+		}
+		lease := dhcpLease(ctx, store, dev, req.CHAddr.String())
+		typ := responder.Respond(req, gateway, lease)
+		if typ == 0 {
+			continue
+		}
+		dst := &net.UDPAddr{IP: net.IPv4bcast, Port: 68} //nolint:mnd
+		if !responder.Broadcast(req, typ) {
+			dst.IP = req.CIAddr
+		}
+		if _, err = conn.WriteTo(responder.BuildReply(req, typ, gateway, lease), dst); err != nil {
+			logger.Warnf(ctx, "reply to %s: %v", req.CHAddr, err)
+		}
+	}
+}
+
+// dhcpLease builds mac's DHCP lease on dev from the store; nil when the MAC has no reservation.
+func dhcpLease(ctx context.Context, store storage.Store[leaseIndex], dev, mac string) *responder.Lease {
+	var out *responder.Lease
+	_ = store.With(ctx, func(idx *leaseIndex) error {
+		bl := idx.Bridges[dev]
+		if bl == nil {
+			return nil
+		}
+		ip, l := bl.byMAC(mac)
+		if l == nil {
+			return nil
+		}
+		nw := bl.network(ip)
+		gw := net.ParseIP(nw.Gateway).To4()
+		out = &responder.Lease{
+			IP:       net.ParseIP(ip).To4(),
+			Mask:     net.CIDRMask(nw.Prefix, 32), //nolint:mnd
+			Router:   gw,
+			DNS:      []net.IP{gw},
+			Domain:   responder.Domain,
+			Hostname: l.VMName,
+			Duration: leaseDuration,
+		}
+		return nil
+	})
+	return out
+}
+
+// serveDNS answers VM names from dev's leases: only VMs on the same managed bridge resolve. conn is bound to dev,
+// so only that bridge's guests reach it and no source filter is needed.
+func serveDNS(ctx context.Context, store storage.Store[leaseIndex], dev string, conn net.PacketConn, upstreams []string) {
+	responder.ServeDNS(ctx, conn, func(name string) net.IP {
+		var ip string
+		_ = store.With(ctx, func(idx *leaseIndex) error {
+			if bl := idx.Bridges[dev]; bl != nil {
+				ip = bl.byName(name)
+			}
+			return nil
+		})
+		return net.ParseIP(ip)
+	}, upstreams, nil)
+}
+
+func loadBridge(ctx context.Context, store storage.Store[leaseIndex], dev string) (bridgeLeases, bool) {
+	var (
+		bl bridgeLeases
+		ok bool
+	)
+	_ = store.With(ctx, func(idx *leaseIndex) error {
+		if p := idx.Bridges[dev]; p != nil {
+			bl, ok = *p, true
+		}
+		return nil
+	})
+	return bl, ok
+}
+
+// listenUDP binds addr on dev only, so a responder per bridge can share the DHCP port and replies broadcast on dev.
+func listenUDP(ctx context.Context, dev, addr string) (net.PacketConn, error) {
+	lc := net.ListenConfig{Control: func(_, _ string, rc syscall.RawConn) error {
+		var sockErr error
+		err := rc.Control(func(fd uintptr) {
+			if sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEADDR, 1); sockErr != nil {
+				return
+			}
+			if sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_BROADCAST, 1); sockErr != nil {
+				return
+			}
+			sockErr = unix.BindToDevice(int(fd), dev)
+		})
+		return errors.Join(err, sockErr)
+	}}
+	return lc.ListenPacket(ctx, "udp4", addr)
+}
+
+func responderPIDFile(runDir, dev string) string {
+	return filepath.Join(runDir, "bridge", dev+"-responder.pid")
+}
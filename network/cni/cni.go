@@ -3,6 +3,7 @@ package cni
 import (
 	"cmp"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/fs"
@@ -24,7 +25,12 @@ import (
 	"github.com/cocoonstack/cocoon/utils"
 )
 
-const typ = "cni"
+const (
+	typ = "cni"
+
+	// bridgeConfListPrefix names the conflists synthesized for --nic bridge= NICs of a CNI VM.
+	bridgeConfListPrefix = "cocoon-bridge-"
+)
 
 var _ network.Network = (*CNI)(nil)
 
@@ -195,18 +201,52 @@ func (c *CNI) deleteRecords(ctx context.Context, ids []string) error {
 }
 
 // confListByName resolves a conflist by name.
-// Empty name returns the default (first alphabetically).
+// Empty name returns the default (first alphabetically); a bridgeConfListPrefix name no file defines is synthesized.
 func (c *CNI) confListByName(name string) (*libcni.NetworkConfigList, error) {
 	if len(c.confLists) == 0 {
 		return nil, fmt.Errorf("%w: no conflist found in %s", network.ErrNotConfigured, c.conf.CNIConfDir)
 	}
 	cl, ok := c.confLists[cmp.Or(name, c.defaultName)]
 	if !ok {
+		if dev, isBridge := strings.CutPrefix(name, bridgeConfListPrefix); isBridge && dev != "" {
+			return bridgeConfList(dev)
+		}
 		return nil, fmt.Errorf("conflist %q not found (available: %s)", name, strings.Join(slices.Sorted(maps.Keys(c.confLists)), ", "))
 	}
 	return cl, nil
 }
 
+// confListForNIC resolves the conflist one NIC attaches to: its persisted or requested one, else the VM's default.
+func (c *CNI) confListForNIC(spec network.AddSpec, vmNetwork string) (*libcni.NetworkConfigList, error) {
+	name := vmNetwork
+	switch {
+	case spec.Existing != nil:
+		name = cmp.Or(spec.Existing.CNINetwork, vmNetwork)
+	case spec.Request != nil && spec.Request.Bridge != "":
+		if err := checkBridge(spec.Request.Bridge); err != nil {
+			return nil, err
+		}
+		name = bridgeConfListPrefix + spec.Request.Bridge
+	case spec.Request != nil && spec.Request.Network != "":
+		name = spec.Request.Network
+	}
+	return c.confListByName(name)
+}
+
+// bridgeConfList builds a layer-2 conflist for dev: the bridge plugin's veth joins it and, without IPAM, the guest
+// takes a lease from whatever serves DHCP on that bridge.
+func bridgeConfList(dev string) (*libcni.NetworkConfigList, error) {
+	raw, err := json.Marshal(map[string]any{
+		"cniVersion": "1.0.0",
+		"name":       bridgeConfListPrefix + dev,
+		"plugins":    []map[string]any{{"type": "bridge", "bridge": dev, "ipam": map[string]any{}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return libcni.ConfListFromBytes(raw)
+}
+
 // loadConfLists loads all .conflist files from dir.
 // Returns the map of name→conflist and the default name (first file, alphabetically).
 func loadConfLists(dir string) (map[string]*libcni.NetworkConfigList, string, error) {
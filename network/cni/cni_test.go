@@ -1,10 +1,16 @@
 package cni
 
 import (
+	"net"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+
+	current "github.com/containernetworking/cni/pkg/types/100"
+
+	"github.com/cocoonstack/cocoon/types"
 )
 
 const (
@@ -108,3 +114,124 @@ func TestLoadConfLists(t *testing.T) {
 		}
 	})
 }
+
+func TestConfListByName(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "10-bridge.conflist"), bridgeConflist)
+	writeFile(t, filepath.Join(dir, "20-macvlan.conflist"), macvlanConflist)
+	lists, def, err := loadConfLists(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &CNI{confLists: lists, defaultName: def}
+
+	tests := []struct {
+		name     string
+		lookup   string
+		want     string
+		wantType string
+		wantErr  bool
+	}{
+		{name: "empty is the default", want: "cni-bridge", wantType: "bridge"},
+		{name: "by name", lookup: "cni-macvlan", want: "cni-macvlan", wantType: "macvlan"},
+		{name: "bridge attachment synthesized", lookup: "cocoon-bridge-br-data", want: "cocoon-bridge-br-data", wantType: "bridge"},
+		{name: "bare prefix", lookup: "cocoon-bridge-", wantErr: true},
+		{name: "unknown", lookup: "storage", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl, err := c.confListByName(tt.lookup)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err=%v wantErr=%v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if cl.Name != tt.want || len(cl.Plugins) == 0 || cl.Plugins[0].Network.Type != tt.wantType {
+				t.Errorf("got %s (%d plugins), want %s of type %s", cl.Name, len(cl.Plugins), tt.want, tt.wantType)
+			}
+		})
+	}
+}
+
+func TestExtractNetworkInfo(t *testing.T) {
+	mustCIDR := func(s string) net.IPNet {
+		ip, n, err := net.ParseCIDR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n.IP = ip
+		return *n
+	}
+	res := &current.Result{
+		CNIVersion: "1.0.0",
+		IPs: []*current.IPConfig{
+			{Address: mustCIDR("fd00::2/64"), Gateway: net.ParseIP("fd00::1")},
+			{Address: mustCIDR("10.0.0.2/24"), Gateway: net.ParseIP("10.0.0.1")},
+			{Address: mustCIDR("10.0.1.2/24")},
+		},
+	}
+	got, err := extractNetworkInfo(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &types.Network{
+		IP: "10.0.0.2", Prefix: 24, Gateway: "10.0.0.1",
+		Addresses: []types.Address{
+			{IP: "fd00::2", Prefix: 64, Gateway: "fd00::1"},
+			{IP: "10.0.1.2", Prefix: 24},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("extractNetworkInfo = %+v, want %+v", got, want)
+	}
+
+	v6only := &current.Result{CNIVersion: "1.0.0", IPs: []*current.IPConfig{{Address: mustCIDR("fd00::3/64")}}}
+	got, err = extractNetworkInfo(v6only)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.IP != "" || len(got.Addresses) != 1 || !got.Static() {
+		t.Errorf("v6-only NIC = %+v, want no primary IPv4 and one address", got)
+	}
+}
+
+func TestHolderOf(t *testing.T) {
+	idx := &networkIndex{Networks: map[string]*networkRecord{
+		"n1": {ID: "n1", Type: "mgmt", VMID: "vm1", IfName: "eth0", Network: types.Network{IP: "10.22.0.50", Prefix: 24}},
+		"n2": {ID: "n2", Type: "mgmt", VMID: "vm2", IfName: "eth1", Network: types.Network{
+			IP: "10.22.0.51", Prefix: 24, Addresses: []types.Address{{IP: "fd00::51", Prefix: 64}},
+		}},
+		"n3": nil,
+	}}
+	tests := []struct {
+		network, ip, except string
+		want                string
+	}{
+		{"mgmt", "10.22.0.50", "", "n1"},
+		{"mgmt", "fd00::51", "vm3", "n2"},
+		{"mgmt", "10.22.0.50", "vm1", ""}, // a VM re-adding its own address
+		{"storage", "10.22.0.50", "", ""},
+		{"mgmt", "10.22.0.99", "", ""},
+	}
+	for _, tt := range tests {
+		var got string
+		if rec := idx.holderOf(tt.network, tt.ip, tt.except); rec != nil {
+			got = rec.ID
+		}
+		if got != tt.want {
+			t.Errorf("holderOf(%s, %s, %q) = %q, want %q", tt.network, tt.ip, tt.except, got, tt.want)
+		}
+	}
+}
+
+func TestPinIPArgs(t *testing.T) {
+	if got := pinIPArgs(nil); got != nil {
+		t.Errorf("pinIPArgs(nil) = %v, want nil", got)
+	}
+	got := pinIPArgs([]string{"10.22.0.50", "fd00::50"})
+	want := [][2]string{{"IgnoreUnknown", "1"}, {"IP", "10.22.0.50,fd00::50"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("pinIPArgs(dual-stack) = %v, want %v", got, want)
+	}
+}
@@ -41,3 +41,18 @@ func (idx *networkIndex) byVMID(vmID string) []networkRecord {
 	}
 	return out
 }
+
+// holderOf returns the record of a VM other than exceptVMID that holds ip on conflist netName, or nil.
+func (idx *networkIndex) holderOf(netName, ip, exceptVMID string) *networkRecord {
+	for _, rec := range idx.Networks {
+		if rec == nil || rec.Type != netName || rec.VMID == exceptVMID {
+			continue
+		}
+		for _, a := range rec.All() {
+			if a.IP == ip {
+				return rec
+			}
+		}
+	}
+	return nil
+}
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"io/fs"
 	"os"
+	"slices"
+	"strings"
 
 	"github.com/containernetworking/cni/libcni"
 	cnitypes "github.com/containernetworking/cni/pkg/types"
@@ -13,6 +15,7 @@ import (
 	"github.com/projecteru2/core/log"
 
 	"github.com/cocoonstack/cocoon/network"
+	"github.com/cocoonstack/cocoon/network/firewall"
 	"github.com/cocoonstack/cocoon/types"
 	"github.com/cocoonstack/cocoon/utils"
 )
@@ -38,13 +41,24 @@ func (c *CNI) Add(ctx context.Context, vmID string, vmCfg *types.VMConfig, specs
 	if len(specs) == 0 {
 		return nil, nil
 	}
-	confList, err := c.confListByName(vmCfg.Network)
+	defaultList, err := c.confListByName(vmCfg.Network)
 	if err != nil {
 		return nil, err
 	}
-	vmCfg.Network = confList.Name
+	vmCfg.Network = defaultList.Name
 	logger := log.WithFunc("cni.Add")
 
+	// Each NIC may attach to its own conflist; resolve them all before touching the host.
+	confLists := make([]*libcni.NetworkConfigList, len(specs))
+	for i, spec := range specs {
+		if confLists[i], err = c.confListForNIC(spec, vmCfg.Network); err != nil {
+			return nil, fmt.Errorf("nic %d: %w", spec.Index, err)
+		}
+	}
+	if err = c.checkRequestedIPs(ctx, vmID, specs, confLists); err != nil {
+		return nil, err
+	}
+
 	nsName := netnsName(vmID)
 	nsPath := netnsPath(vmID)
 
@@ -58,9 +72,9 @@ func (c *CNI) Add(ctx context.Context, vmID string, vmCfg *types.VMConfig, specs
 		if retErr == nil {
 			return
 		}
-		for _, i := range addedIdx {
+		for n, i := range addedIdx {
 			ifn := fmt.Sprintf("eth%d", i)
-			if delErr := c.cniDel(ctx, confList, vmID, nsPath, ifn); delErr != nil {
+			if delErr := c.cniDel(ctx, confLists[n], vmID, nsPath, ifn); delErr != nil {
 				logger.Warnf(ctx, "rollback CNI DEL %s/%s: %v", vmID, ifn, delErr)
 			}
 			// setupTCRedirect creates the TAP; it would leak if the netns persists.
@@ -76,24 +90,37 @@ func (c *CNI) Add(ctx context.Context, vmID string, vmCfg *types.VMConfig, specs
 	}()
 
 	type freshNIC struct {
-		index int
-		cfg   *types.NetworkConfig
+		index    int
+		confList string
+		cfg      *types.NetworkConfig
 	}
 	configs = make([]*types.NetworkConfig, 0, len(specs))
 	fresh := make([]freshNIC, 0, len(specs))
-	for _, spec := range specs {
+	for n, spec := range specs {
+		confList := confLists[n]
 		ifName := fmt.Sprintf("eth%d", spec.Index)
 		tapName := tapNameForVM(vmID, spec.Index)
 
 		rt := &libcni.RuntimeConf{ContainerID: vmID, NetNS: nsPath, IfName: ifName}
-		if spec.Existing != nil {
+		var pinIPs []string
+		var overrideMAC string
+		switch {
+		case spec.Existing != nil:
 			if delErr := c.cniDel(ctx, confList, vmID, nsPath, ifName); delErr != nil {
 				logger.Warnf(ctx, "pre-recovery CNI DEL %s/%s: %v (continuing)", vmID, ifName, delErr)
 			}
-			if spec.Existing.Network != nil && spec.Existing.Network.IP != "" {
-				rt.Args = [][2]string{{"IgnoreUnknown", "1"}, {"IP", spec.Existing.Network.IP}}
+			// Every recorded address is pinned, so a dual-stack NIC keeps its IPv6 address too.
+			for _, a := range spec.Existing.Network.All() {
+				pinIPs = append(pinIPs, a.IP)
+			}
+			overrideMAC = spec.Existing.MAC
+		case spec.Request != nil:
+			if spec.Request.IP != "" {
+				pinIPs = []string{spec.Request.IP}
 			}
+			overrideMAC = spec.Request.MAC
 		}
+		rt.Args = pinIPArgs(pinIPs)
 
 		cniResult, addErr := c.cniConf.AddNetworkList(ctx, confList, rt)
 		if addErr != nil {
@@ -105,37 +132,43 @@ func (c *CNI) Add(ctx context.Context, vmID string, vmCfg *types.VMConfig, specs
 		if parseErr != nil {
 			return nil, fmt.Errorf("parse CNI result: %w", parseErr)
 		}
-
-		var overrideMAC string
-		if spec.Existing != nil {
-			overrideMAC = spec.Existing.MAC
+		// IgnoreUnknown lets an IPAM without IP-arg support hand out another address; a requested IP must stick.
+		if spec.Request != nil && spec.Request.IP != "" && !hasIP(netInfo, spec.Request.IP) {
+			return nil, fmt.Errorf("nic %d: IPAM of network %s ignored the requested ip %s (host-local honors it)", spec.Index, confList.Name, spec.Request.IP)
 		}
+
 		mac, setupErr := setupTCRedirect(nsPath, ifName, tapName, network.NetNumQueues(vmCfg.CPU), overrideMAC)
 		if setupErr != nil {
 			return nil, fmt.Errorf("setup tc-redirect %s: %w", vmID, setupErr)
 		}
+		if fwErr := firewall.Apply(firewall.NIC{NetnsPath: nsPath, Device: ifName, TAP: tapName}, vmCfg.Firewall); fwErr != nil {
+			return nil, fmt.Errorf("firewall %s: %w", tapName, fwErr)
+		}
 
 		cfg := &types.NetworkConfig{
-			TAP:       tapName,
-			MAC:       mac,
-			NumQueues: network.NetNumQueues(vmCfg.CPU),
-			QueueSize: network.ResolveQueueSize(vmCfg.QueueSize),
-			Backend:   types.BackendCNI,
-			NetnsPath: nsPath,
-			Network:   netInfo,
+			TAP:        tapName,
+			MAC:        mac,
+			NumQueues:  network.NetNumQueues(vmCfg.CPU),
+			QueueSize:  network.ResolveQueueSize(vmCfg.QueueSize),
+			Backend:    types.BackendCNI,
+			CNINetwork: confList.Name,
+			NetnsPath:  nsPath,
+			Network:    netInfo,
+		}
+		if dev, isBridge := strings.CutPrefix(confList.Name, bridgeConfListPrefix); isBridge {
+			cfg.BridgeDev = dev
 		}
 		configs = append(configs, cfg)
 		if spec.Existing == nil {
-			fresh = append(fresh, freshNIC{index: spec.Index, cfg: cfg})
+			fresh = append(fresh, freshNIC{index: spec.Index, confList: confList.Name, cfg: cfg})
 		}
 
-		var logIP, logGW string
-		if netInfo != nil {
-			logIP = netInfo.IP
-			logGW = netInfo.Gateway
+		var logIPs []string
+		for _, a := range netInfo.All() {
+			logIPs = append(logIPs, a.CIDR())
 		}
-		logger.Debugf(ctx, "NIC %d: %s ip=%s gw=%s tap=%s mac=%s",
-			spec.Index, ifName, logIP, logGW, tapName, mac)
+		logger.Debugf(ctx, "NIC %d: %s network=%s ip=%s tap=%s mac=%s",
+			spec.Index, ifName, confList.Name, strings.Join(logIPs, ","), tapName, mac)
 	}
 
 	return configs, c.store.Update(ctx, func(idx *networkIndex) error {
@@ -147,7 +180,7 @@ func (c *CNI) Add(ctx context.Context, vmID string, vmCfg *types.VMConfig, specs
 			}
 			idx.Networks[netID] = &networkRecord{
 				ID:      netID,
-				Type:    confList.Name,
+				Type:    f.confList,
 				Network: net,
 				VMID:    vmID,
 				IfName:  fmt.Sprintf("eth%d", f.index),
@@ -194,6 +227,42 @@ func (c *CNI) cniDel(ctx context.Context, confList *libcni.NetworkConfigList, vm
 	return c.cniConf.DelNetworkList(ctx, confList, rt)
 }
 
+// checkRequestedIPs rejects --nic addresses another VM already holds on the NIC's network.
+func (c *CNI) checkRequestedIPs(ctx context.Context, vmID string, specs []network.AddSpec, confLists []*libcni.NetworkConfigList) error {
+	if !slices.ContainsFunc(specs, func(s network.AddSpec) bool { return s.Request != nil && s.Request.IP != "" }) {
+		return nil
+	}
+	return c.store.With(ctx, func(idx *networkIndex) error {
+		for i, spec := range specs {
+			if spec.Request == nil || spec.Request.IP == "" {
+				continue
+			}
+			netName := confLists[i].Name
+			if rec := idx.holderOf(netName, spec.Request.IP, vmID); rec != nil {
+				return fmt.Errorf("ip %s on network %s is held by VM %s (%s)", spec.Request.IP, netName, rec.VMID, rec.IfName)
+			}
+		}
+		return nil
+	})
+}
+
+// pinIPArgs builds the CNI_ARGS that make host-local hand out exactly ips, one per range (comma-separated IP arg).
+func pinIPArgs(ips []string) [][2]string {
+	if len(ips) == 0 {
+		return nil
+	}
+	return [][2]string{{"IgnoreUnknown", "1"}, {"IP", strings.Join(ips, ",")}}
+}
+
+func hasIP(info *types.Network, ip string) bool {
+	for _, a := range info.All() {
+		if a.IP == ip {
+			return true
+		}
+	}
+	return false
+}
+
 func tapNameForVM(vmID string, nic int) string {
 	return fmt.Sprintf("tap%s-%d", network.VMIDPrefix(vmID), nic)
 }
@@ -211,7 +280,8 @@ func ensureNetns(name, nsPath string) (bool, error) {
 	return true, nil
 }
 
-// extractNetworkInfo converts a CNI ADD result into types.Network.
+// extractNetworkInfo converts a CNI ADD result into types.Network. The first IPv4 becomes the primary address;
+// every other IP (IPv6, secondary IPv4) is kept in Addresses so dual-stack results survive.
 func extractNetworkInfo(result cnitypes.Result) (*types.Network, error) {
 	newResult, err := current.NewResultFromResult(result)
 	if err != nil {
@@ -221,18 +291,18 @@ func extractNetworkInfo(result cnitypes.Result) (*types.Network, error) {
 		return nil, nil
 	}
 
+	info := &types.Network{}
 	for _, ipCfg := range newResult.IPs {
-		if ipCfg.Address.IP.To4() != nil {
-			ones, _ := ipCfg.Address.Mask.Size()
-			info := &types.Network{
-				IP:     ipCfg.Address.IP.String(),
-				Prefix: ones,
-			}
-			if ipCfg.Gateway != nil {
-				info.Gateway = ipCfg.Gateway.String()
-			}
-			return info, nil
+		ones, _ := ipCfg.Address.Mask.Size()
+		var gw string
+		if ipCfg.Gateway != nil {
+			gw = ipCfg.Gateway.String()
+		}
+		if ipCfg.Address.IP.To4() != nil && info.IP == "" {
+			info.IP, info.Prefix, info.Gateway = ipCfg.Address.IP.String(), ones, gw
+			continue
 		}
+		info.Addresses = append(info.Addresses, types.Address{IP: ipCfg.Address.IP.String(), Prefix: ones, Gateway: gw})
 	}
-	return nil, nil
+	return info, nil
 }
@@ -7,7 +7,6 @@ import (
 	"io/fs"
 	"net"
 	"runtime"
-	"syscall"
 	"time"
 
 	cns "github.com/containernetworking/plugins/pkg/ns"
@@ -15,6 +14,7 @@ import (
 	"github.com/vishvananda/netns"
 
 	"github.com/cocoonstack/cocoon/network"
+	"github.com/cocoonstack/cocoon/network/firewall"
 	"github.com/cocoonstack/cocoon/utils"
 )
 
@@ -167,28 +167,19 @@ func tcRedirectInNS(ifName, tapName string, queues int, overrideMAC string) (str
 	return mac, nil
 }
 
-// addTCRedirect redirects all ingress packets from one link to another.
+// addTCRedirect redirects all ingress packets from one link to another, behind any firewall filters.
 func addTCRedirect(from, to netlink.Link) error {
-	filter := &netlink.U32{
-		FilterAttrs: netlink.FilterAttrs{
-			LinkIndex: from.Attrs().Index,
-			Parent:    netlink.HANDLE_INGRESS,
-			Priority:  1,
-			Protocol:  syscall.ETH_P_ALL,
-		},
-		Sel: &netlink.TcU32Sel{
-			Flags: netlink.TC_U32_TERMINAL,
-			Keys: []netlink.TcU32Key{
-				{Mask: 0x0, Val: 0x0, Off: 0, OffMask: 0x0},
-			},
-		},
-		Actions: []netlink.Action{
-			&netlink.MirredAction{
-				ActionAttrs:  netlink.ActionAttrs{Action: netlink.TC_ACT_STOLEN},
-				MirredAction: netlink.TCA_EGRESS_REDIR,
-				Ifindex:      to.Attrs().Index,
-			},
-		},
+	return netlink.FilterAdd(firewall.Redirect(from, to))
+}
+
+// checkBridge makes sure dev is an existing bridge; the CNI bridge plugin would otherwise create it on a typo.
+func checkBridge(dev string) error {
+	link, err := netlink.LinkByName(dev)
+	if err != nil {
+		return fmt.Errorf("bridge %s: %w", dev, err)
+	}
+	if link.Type() != "bridge" {
+		return fmt.Errorf("%s is not a bridge (type: %s)", dev, link.Type())
 	}
-	return netlink.FilterAdd(filter)
+	return nil
 }
@@ -0,0 +1,97 @@
+// Package discovery runs the optional VM-name DNS forwarder (--discovery-dns): one host-wide process that answers
+// <vmname>.cocoon.internal from the VM index of every hypervisor and relays every other query upstream. VMs get its
+// address ahead of the configured DNS servers.
+package discovery
+
+import (
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/cocoonstack/cocoon/network/responder"
+	"github.com/cocoonstack/cocoon/types"
+)
+
+// Names maps each VM's lower-cased name to the first static IPv4 of its lowest NIC. VMs on DHCP have no address in
+// the index and are left out; when two VMs share a name, a running one wins.
+func Names(vms []*types.VM) map[string]net.IP {
+	out := make(map[string]net.IP, len(vms))
+	running := map[string]bool{}
+	for _, vm := range vms {
+		ip := primaryIPv4(vm)
+		if ip == nil {
+			continue
+		}
+		name := strings.ToLower(vm.Config.Name)
+		isRunning := vm.State == types.VMStateRunning
+		if _, taken := out[name]; taken && (running[name] || !isRunning) {
+			continue
+		}
+		out[name], running[name] = ip, isRunning
+	}
+	return out
+}
+
+func primaryIPv4(vm *types.VM) net.IP {
+	for _, nc := range vm.NetworkConfigs {
+		if nc == nil || nc.Network == nil {
+			continue
+		}
+		if ip := net.ParseIP(nc.Network.IP).To4(); ip != nil {
+			return ip
+		}
+	}
+	return nil
+}
+
+// Sources returns the subnets VM queries come from: the subnet of every address in the index, and the subnets of
+// the bridges NICs join, as bridgeAddrs reports them, which covers DHCP guests with no address in the index.
+func Sources(vms []*types.VM, bridgeAddrs func(dev string) []netip.Prefix) []netip.Prefix {
+	var out []netip.Prefix
+	seen := map[string]bool{}
+	for _, vm := range vms {
+		for _, nc := range vm.NetworkConfigs {
+			if nc == nil {
+				continue
+			}
+			if nc.BridgeDev != "" && !seen[nc.BridgeDev] {
+				seen[nc.BridgeDev] = true
+				out = append(out, bridgeAddrs(nc.BridgeDev)...)
+			}
+			if nc.Network == nil {
+				continue
+			}
+			for _, a := range nc.Network.All() {
+				addr, err := netip.ParseAddr(a.IP)
+				// A zero prefix would admit every address.
+				if err != nil || a.Prefix <= 0 || a.Prefix > addr.BitLen() {
+					continue
+				}
+				out = append(out, netip.PrefixFrom(addr, a.Prefix).Masked())
+			}
+		}
+	}
+	return out
+}
+
+// sourceFilter admits clients inside one of sources, so the forwarder never acts as an open resolver for the
+// networks its address may be reachable from.
+func sourceFilter(sources func() []netip.Prefix) responder.Filter {
+	return func(client net.Addr) bool {
+		ua, ok := client.(*net.UDPAddr)
+		if !ok {
+			return false
+		}
+		ip, ok := netip.AddrFromSlice(ua.IP)
+		if !ok {
+			return false
+		}
+		ip = ip.Unmap()
+		for _, p := range sources() {
+			if p.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+}
@@ -0,0 +1,110 @@
+package discovery
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"slices"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/cocoonstack/cocoon/network/responder"
+	"github.com/cocoonstack/cocoon/types"
+)
+
+func TestNames(t *testing.T) {
+	vm := func(name string, state types.VMState, ips ...string) *types.VM {
+		v := &types.VM{State: state, Config: types.VMConfig{Name: name}}
+		for _, ip := range ips {
+			nc := &types.NetworkConfig{}
+			if ip != "" {
+				nc.Network = &types.Network{IP: ip, Prefix: 24}
+			}
+			v.NetworkConfigs = append(v.NetworkConfigs, nc)
+		}
+		return v
+	}
+	names := Names([]*types.VM{
+		vm("Web", types.VMStateRunning, "10.88.0.2", "10.89.0.2"),
+		vm("dhcp", types.VMStateRunning, ""),
+		vm("second-nic", types.VMStateStopped, "", "10.88.0.3"),
+		vm("v6", types.VMStateRunning, "fd00::2"),
+		vm("dup", types.VMStateStopped, "10.88.0.4"),
+		vm("dup", types.VMStateRunning, "10.88.0.5"),
+		vm("dup", types.VMStateStopped, "10.88.0.6"),
+	})
+	want := map[string]string{
+		"web":        "10.88.0.2",
+		"second-nic": "10.88.0.3",
+		"dup":        "10.88.0.5",
+	}
+	if len(names) != len(want) {
+		t.Fatalf("got %v, want %v", names, want)
+	}
+	for name, ip := range want {
+		if got := names[name].String(); got != ip {
+			t.Errorf("%s: got %s, want %s", name, got, ip)
+		}
+	}
+}
+
+func TestSources(t *testing.T) {
+	cni := &types.VM{}
+	cni.NetworkConfigs = []*types.NetworkConfig{{Network: &types.Network{
+		IP: "10.88.0.2", Prefix: 16, Addresses: []types.Address{{IP: "fd00::2", Prefix: 64}, {IP: "10.99.0.2"}},
+	}}}
+	dhcp := &types.VM{}
+	dhcp.NetworkConfigs = []*types.NetworkConfig{{BridgeDev: "br0"}, nil}
+	got := Sources([]*types.VM{cni, dhcp, dhcp}, func(string) []netip.Prefix {
+		return []netip.Prefix{netip.MustParsePrefix("192.168.50.0/24")}
+	})
+	want := []netip.Prefix{
+		netip.MustParsePrefix("10.88.0.0/16"),
+		netip.MustParsePrefix("fd00::/64"),
+		netip.MustParsePrefix("192.168.50.0/24"),
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Sources = %v, want %v (no zero-prefix entry, bridge listed once)", got, want)
+	}
+}
+
+// TestSourceFilterDropsOffSubnetQuery serves a known name and checks that only an on-subnet client gets an answer.
+func TestSourceFilterDropsOffSubnetQuery(t *testing.T) {
+	for _, tt := range []struct {
+		source     string
+		wantAnswer bool
+	}{
+		{source: "127.0.0.0/8", wantAnswer: true},
+		{source: "10.88.0.0/16", wantAnswer: false},
+	} {
+		ctx, cancel := context.WithCancel(t.Context())
+		conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		sources := []netip.Prefix{netip.MustParsePrefix(tt.source)}
+		go responder.ServeDNS(ctx, conn, func(string) net.IP { return net.IPv4(10, 88, 0, 2) }, nil,
+			sourceFilter(func() []netip.Prefix { return sources }))
+
+		b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: 7})
+		_ = b.StartQuestions()
+		_ = b.Question(dnsmessage.Question{Name: dnsmessage.MustNewName("web.cocoon.internal."), Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET})
+		query, _ := b.Finish()
+
+		client, err := net.Dial("udp4", conn.LocalAddr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = client.Write(query)
+		_ = client.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+		_, readErr := client.Read(make([]byte, 512))
+		if gotAnswer := readErr == nil; gotAnswer != tt.wantAnswer {
+			t.Errorf("sources %s: answered = %v (%v), want %v", tt.source, gotAnswer, readErr, tt.wantAnswer)
+		}
+		_ = client.Close()
+		cancel()
+		_ = conn.Close()
+	}
+}
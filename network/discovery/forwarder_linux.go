@@ -0,0 +1,253 @@
+//go:build linux
+
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/projecteru2/core/log"
+	"golang.org/x/sys/unix"
+
+	"github.com/cocoonstack/cocoon/config"
+	"github.com/cocoonstack/cocoon/lock/flock"
+	"github.com/cocoonstack/cocoon/network/responder"
+	"github.com/cocoonstack/cocoon/types"
+	"github.com/cocoonstack/cocoon/utils"
+)
+
+const (
+	forwarderEnvKey = "_COCOON_DISCOVERY_FORWARDER" // listen address
+	rootEnvKey      = "_COCOON_ROOT_DIR"
+	runEnvKey       = "_COCOON_RUN_DIR"
+	logEnvKey       = "_COCOON_LOG_DIR"
+	dnsEnvKey       = "_COCOON_DNS"
+
+	// idleCheckInterval is how often the forwarder re-reads the index regardless of watch events, and exits once it
+	// finds no VMs; it also gives a VM being created time to reach the index.
+	idleCheckInterval = 30 * time.Second
+	watchDebounce     = 200 * time.Millisecond
+)
+
+// IsForwarderMode returns true when the process was started as the discovery forwarder.
+func IsForwarderMode() bool {
+	return os.Getenv(forwarderEnvKey) != ""
+}
+
+// ForwarderConfig rebuilds, in forwarder mode, the config the forwarder was started with.
+func ForwarderConfig() *config.Config {
+	return &config.Config{
+		RootDir:      os.Getenv(rootEnvKey),
+		RunDir:       os.Getenv(runEnvKey),
+		LogDir:       os.Getenv(logEnvKey),
+		DNS:          os.Getenv(dnsEnvKey),
+		DiscoveryDNS: os.Getenv(forwarderEnvKey),
+	}
+}
+
+// Ensure starts the forwarder unless --discovery-dns is unset or one is running. Concurrent starts are harmless: the
+// forwarder holds a flock and a second one exits at once.
+func Ensure(conf *config.Config) error {
+	if conf.DiscoveryDNS == "" {
+		return nil
+	}
+	if pid, err := utils.ReadPIDFile(pidFile(conf.RunDir)); err == nil && utils.IsProcessAlive(pid) {
+		return nil
+	}
+	if err := utils.EnsureDirs(filepath.Join(conf.RunDir, "discovery"), filepath.Join(conf.LogDir, "discovery")); err != nil {
+		return err
+	}
+	logFile, err := os.OpenFile(filepath.Join(conf.LogDir, "discovery", "forwarder.log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600) //nolint:gosec
+	if err != nil {
+		return err
+	}
+	defer logFile.Close() //nolint:errcheck
+
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("os.Executable: %w", err)
+	}
+	// shell out because self-exec spawns a detached forwarder that outlives this command.
+	cmd := exec.Command(self) //nolint:gosec
+	cmd.Env = []string{
+		forwarderEnvKey + "=" + conf.DiscoveryDNS,
+		rootEnvKey + "=" + conf.RootDir,
+		runEnvKey + "=" + conf.RunDir,
+		logEnvKey + "=" + conf.LogDir,
+		dnsEnvKey + "=" + conf.DNS,
+	}
+	cmd.Stdout, cmd.Stderr = logFile, logFile
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait() //nolint:errcheck
+	return nil
+}
+
+// RunForwarder serves DNS on conf.DiscoveryDNS from the VMs list returns, re-listing whenever a file in watchPaths
+// changes, until a periodic check finds no VMs left.
+func RunForwarder(ctx context.Context, conf *config.Config, list func(context.Context) ([]*types.VM, error), watchPaths []string) {
+	logger := log.WithFunc("discovery.RunForwarder")
+
+	single := flock.New(filepath.Join(conf.RunDir, "discovery", "forwarder.lock"))
+	if ok, err := single.TryLock(ctx); err != nil || !ok {
+		return // another forwarder is running
+	}
+	defer single.Unlock(ctx) //nolint:errcheck
+	pid := pidFile(conf.RunDir)
+	if err := utils.WritePIDFile(pid, os.Getpid()); err != nil {
+		logger.Warnf(ctx, "write pid file: %v", err)
+	}
+	defer os.Remove(pid) //nolint:errcheck
+
+	var (
+		names   atomic.Pointer[map[string]net.IP]
+		sources atomic.Pointer[[]netip.Prefix]
+	)
+	reload := func() int {
+		vms, err := list(ctx)
+		if err != nil {
+			logger.Warnf(ctx, "list VMs: %v", err)
+			return -1
+		}
+		m := Names(vms)
+		names.Store(&m)
+		// passt guests and host processes query from the host's own addresses.
+		src := append(Sources(vms, bridgeAddrs), hostAddrs()...)
+		sources.Store(&src)
+		return len(vms)
+	}
+	reload()
+
+	conn, err := listenUDP(ctx, net.JoinHostPort(conf.DiscoveryDNS, "53"))
+	if err != nil {
+		logger.Warnf(ctx, "dns on %s: %v", conf.DiscoveryDNS, err)
+		return
+	}
+	defer conn.Close() //nolint:errcheck
+
+	// Never relay to ourselves: a --dns list that includes the forwarder would loop.
+	upstreams, _ := conf.DNSServers()
+	upstreams = slices.DeleteFunc(upstreams, func(s string) bool { return s == conf.DiscoveryDNS })
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go responder.ServeDNS(ctx, conn, func(name string) net.IP {
+		if m := names.Load(); m != nil {
+			return (*m)[name]
+		}
+		return nil
+	}, upstreams, sourceFilter(func() []netip.Prefix {
+		if p := sources.Load(); p != nil {
+			return *p
+		}
+		return nil
+	}))
+	logger.Infof(ctx, "serving %s on %s", responder.Domain, conf.DiscoveryDNS)
+
+	changed := watchAll(ctx, watchPaths)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-changed:
+			reload()
+		case <-time.After(idleCheckInterval):
+			if reload() == 0 {
+				logger.Infof(ctx, "no VMs left, exiting")
+				return
+			}
+		}
+	}
+}
+
+// watchAll merges the change notifications of paths; a path that cannot be watched is left to the periodic check.
+func watchAll(ctx context.Context, paths []string) <-chan struct{} {
+	out := make(chan struct{}, 1)
+	for _, p := range paths {
+		ch, err := utils.WatchFile(ctx, p, watchDebounce)
+		if err != nil {
+			log.WithFunc("discovery.watchAll").Warnf(ctx, "watch %s: %v", p, err)
+			continue
+		}
+		go func() {
+			for range ch {
+				select {
+				case out <- struct{}{}:
+				default:
+				}
+			}
+		}()
+	}
+	return out
+}
+
+// bridgeAddrs returns the subnets assigned to bridge dev, none when it is gone.
+func bridgeAddrs(dev string) []netip.Prefix {
+	iface, err := net.InterfaceByName(dev)
+	if err != nil {
+		return nil
+	}
+	addrs, _ := iface.Addrs()
+	return prefixes(addrs, false)
+}
+
+// hostAddrs returns the host's own addresses, each as a single-address prefix.
+func hostAddrs() []netip.Prefix {
+	addrs, _ := net.InterfaceAddrs()
+	return prefixes(addrs, true)
+}
+
+func prefixes(addrs []net.Addr, single bool) []netip.Prefix {
+	var out []netip.Prefix
+	for _, a := range addrs {
+		ipNet, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		ip, ok := netip.AddrFromSlice(ipNet.IP)
+		if !ok {
+			continue
+		}
+		ip = ip.Unmap()
+		bits, _ := ipNet.Mask.Size()
+		if single {
+			bits = ip.BitLen()
+		}
+		if bits > 0 && bits <= ip.BitLen() {
+			out = append(out, netip.PrefixFrom(ip, bits).Masked())
+		}
+	}
+	return out
+}
+
+// listenUDP binds addr with IP_FREEBIND, so the forwarder can start before its address exists: the CNI bridge
+// plugin assigns the gateway address only when the first container joins.
+func listenUDP(ctx context.Context, addr string) (net.PacketConn, error) {
+	lc := net.ListenConfig{Control: func(_, _ string, rc syscall.RawConn) error {
+		var sockErr error
+		err := rc.Control(func(fd uintptr) {
+			if sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEADDR, 1); sockErr != nil {
+				return
+			}
+			sockErr = unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_FREEBIND, 1)
+		})
+		return errors.Join(err, sockErr)
+	}}
+	return lc.ListenPacket(ctx, "udp4", addr)
+}
+
+func pidFile(runDir string) string {
+	return filepath.Join(runDir, "discovery", "forwarder.pid")
+}
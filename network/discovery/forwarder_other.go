@@ -0,0 +1,20 @@
+//go:build !linux
+
+package discovery
+
+import (
+	"context"
+
+	"github.com/cocoonstack/cocoon/config"
+	"github.com/cocoonstack/cocoon/types"
+)
+
+func IsForwarderMode() bool { return false }
+
+func ForwarderConfig() *config.Config { return &config.Config{} }
+
+// Ensure is a no-op: the forwarder serves VMs on Linux hosts only.
+func Ensure(_ *config.Config) error { return nil }
+
+func RunForwarder(_ context.Context, _ *config.Config, _ func(context.Context) ([]*types.VM, error), _ []string) {
+}
@@ -0,0 +1,273 @@
+package firewall
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"syscall"
+
+	cns "github.com/containernetworking/plugins/pkg/ns"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+
+	"github.com/cocoonstack/cocoon/types"
+)
+
+// Apply replaces nic's firewall with fw; nil or empty fw removes it.
+func Apply(nic NIC, fw *types.Firewall) error {
+	rs, err := Compile(fw)
+	if err != nil {
+		return err
+	}
+	if nic.NetnsPath == "" {
+		return applyBridge(nic.TAP, rs)
+	}
+	if _, err = os.Stat(nic.NetnsPath); errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: netns %s", ErrNICMissing, nic.NetnsPath)
+	}
+	return cns.WithNetNSPath(nic.NetnsPath, func(_ cns.NetNS) error {
+		return applyCNI(nic.Device, nic.TAP, rs)
+	})
+}
+
+// Redirect returns the catch-all filter that steals from's ingress packets onto to's egress.
+func Redirect(from, to netlink.Link) *netlink.U32 {
+	return &netlink.U32{
+		FilterAttrs: netlink.FilterAttrs{
+			LinkIndex: from.Attrs().Index,
+			Parent:    netlink.HANDLE_INGRESS,
+			Priority:  RedirectPriority,
+			Protocol:  syscall.ETH_P_ALL,
+		},
+		Sel: &netlink.TcU32Sel{
+			Flags: netlink.TC_U32_TERMINAL,
+			Keys: []netlink.TcU32Key{
+				{Mask: 0x0, Val: 0x0, Off: 0, OffMask: 0x0},
+			},
+		},
+		Actions: []netlink.Action{redirectAction(to)},
+	}
+}
+
+// applyCNI filters on the veth (toward the guest) and TAP (from the guest) ingress hooks; allowed packets take the
+// same redirect the catch-all would.
+func applyCNI(device, tap string, rs Ruleset) error {
+	link, err := linkByName(device)
+	if err != nil {
+		return err
+	}
+	tapLink, err := linkByName(tap)
+	if err != nil {
+		return err
+	}
+	if err = swapFilters(link, netlink.HANDLE_INGRESS, rs.ToGuest, tapLink); err != nil {
+		return fmt.Errorf("%s: %w", device, err)
+	}
+	if err = swapFilters(tapLink, netlink.HANDLE_INGRESS, rs.FromGuest, link); err != nil {
+		return fmt.Errorf("%s: %w", tap, err)
+	}
+	return nil
+}
+
+// applyBridge filters on a clsact qdisc of the bridge port: its ingress sees the guest's packets, its egress what the
+// bridge forwards to the guest. Allowed packets continue through the bridge.
+func applyBridge(tap string, rs Ruleset) error {
+	link, err := linkByName(tap)
+	if err != nil {
+		return err
+	}
+	if len(rs.ToGuest) > 0 || len(rs.FromGuest) > 0 {
+		qdisc := &netlink.Clsact{QdiscAttrs: netlink.QdiscAttrs{LinkIndex: link.Attrs().Index, Handle: netlink.HANDLE_CLSACT, Parent: netlink.HANDLE_CLSACT}}
+		if err = netlink.QdiscAdd(qdisc); err != nil && !errors.Is(err, syscall.EEXIST) {
+			return fmt.Errorf("add clsact qdisc on %s: %w", tap, err)
+		}
+	}
+	if err = swapFilters(link, netlink.HANDLE_MIN_INGRESS, rs.FromGuest, nil); err != nil {
+		return fmt.Errorf("%s ingress: %w", tap, err)
+	}
+	if err = swapFilters(link, netlink.HANDLE_MIN_EGRESS, rs.ToGuest, nil); err != nil {
+		return fmt.Errorf("%s egress: %w", tap, err)
+	}
+	return nil
+}
+
+// swapFilters installs filters in the idle band, then deletes the active band. redirectTo is the CNI peer (nil for
+// bridge ports); for CNI, a pre-firewall redirect at priority 1 is first moved behind the bands.
+func swapFilters(link netlink.Link, parent uint32, filters []Filter, redirectTo netlink.Link) error {
+	existing, err := netlink.FilterList(link, parent)
+	if err != nil {
+		if len(filters) == 0 {
+			return nil // no qdisc, so nothing to remove
+		}
+		return fmt.Errorf("list filters: %w", err)
+	}
+	if redirectTo != nil {
+		if existing, err = migrateRedirect(link, redirectTo, existing); err != nil {
+			return err
+		}
+	}
+
+	next := bandA
+	for _, f := range existing {
+		if inBand(f.Attrs().Priority, bandA) {
+			next = bandB
+			break
+		}
+	}
+	for i, f := range filters {
+		fl := flower(link, parent, next+uint16(i), f, redirectTo) //nolint:gosec // len(filters) <= bandWidth
+		var addErr error
+		if f.SYN {
+			addErr = addSYNFlower(fl)
+		} else {
+			addErr = netlink.FilterAdd(fl)
+		}
+		if addErr != nil {
+			return fmt.Errorf("add filter %q: %w", f, addErr)
+		}
+	}
+	for _, f := range existing {
+		if p := f.Attrs().Priority; !inBand(p, next) && (inBand(p, bandA) || inBand(p, bandB)) {
+			if delErr := netlink.FilterDel(f); delErr != nil {
+				return fmt.Errorf("delete filter prio %d: %w", p, delErr)
+			}
+		}
+	}
+	return nil
+}
+
+// migrateRedirect re-adds a redirect installed before firewalls existed (priority 1, ahead of every band) at
+// RedirectPriority, then drops the old one; both redirect, so traffic never stalls.
+func migrateRedirect(link, to netlink.Link, existing []netlink.Filter) ([]netlink.Filter, error) {
+	var legacy []netlink.Filter
+	kept := existing[:0:0]
+	for _, f := range existing {
+		if f.Attrs().Priority < bandA {
+			legacy = append(legacy, f)
+		} else {
+			kept = append(kept, f)
+		}
+	}
+	if len(legacy) == 0 {
+		return existing, nil
+	}
+	if err := netlink.FilterAdd(Redirect(link, to)); err != nil && !errors.Is(err, syscall.EEXIST) {
+		return nil, fmt.Errorf("move redirect: %w", err)
+	}
+	for _, f := range legacy {
+		if err := netlink.FilterDel(f); err != nil {
+			return nil, fmt.Errorf("delete legacy redirect: %w", err)
+		}
+	}
+	return kept, nil
+}
+
+func flower(link netlink.Link, parent uint32, prio uint16, f Filter, redirectTo netlink.Link) *netlink.Flower {
+	fl := &netlink.Flower{
+		FilterAttrs: netlink.FilterAttrs{
+			LinkIndex: link.Attrs().Index,
+			Parent:    parent,
+			Priority:  prio,
+			Protocol:  f.EthType,
+		},
+		EthType: f.EthType,
+	}
+	if f.Proto != 0 {
+		proto := nl.IPProto(f.Proto)
+		fl.IPProto = &proto
+	}
+	if f.Src != nil {
+		fl.SrcIP, fl.SrcIPMask = f.Src.IP, f.Src.Mask
+	}
+	if f.Dst != nil {
+		fl.DestIP, fl.DestIPMask = f.Dst.IP, f.Dst.Mask
+	}
+	// Flower rejects a range whose min equals its max, so single ports use the exact-match keys.
+	switch pr := f.SrcPorts; {
+	case pr.From == 0:
+	case pr.From == pr.To:
+		fl.SrcPort = pr.From
+	default:
+		fl.SrcPortRangeMin, fl.SrcPortRangeMax = pr.From, pr.To
+	}
+	switch pr := f.DstPorts; {
+	case pr.From == 0:
+	case pr.From == pr.To:
+		fl.DestPort = pr.From
+	default:
+		fl.DstPortRangeMin, fl.DstPortRangeMax = pr.From, pr.To
+	}
+
+	switch {
+	case !f.Allow:
+		fl.Actions = []netlink.Action{&netlink.GenericAction{ActionAttrs: netlink.ActionAttrs{Action: netlink.TC_ACT_SHOT}}}
+	case redirectTo != nil:
+		fl.Actions = []netlink.Action{redirectAction(redirectTo)}
+	default:
+		fl.Actions = []netlink.Action{&netlink.GenericAction{ActionAttrs: netlink.ActionAttrs{Action: netlink.TC_ACT_OK}}}
+	}
+	return fl
+}
+
+// addSYNFlower adds fl matching only TCP segments with SYN set and ACK clear. netlink.Flower has no TCP flags key,
+// so the request is built here; it carries the keys Compile sets on SYN filters (eth type, protocol, destination
+// ports) and fl's actions.
+func addSYNFlower(fl *netlink.Flower) error {
+	req := nl.NewNetlinkRequest(unix.RTM_NEWTFILTER, unix.NLM_F_CREATE|unix.NLM_F_EXCL|unix.NLM_F_ACK)
+	req.AddData(&nl.TcMsg{
+		Family:  nl.FAMILY_ALL,
+		Ifindex: int32(fl.LinkIndex), //nolint:gosec // kernel ifindex
+		Parent:  fl.Parent,
+		Info:    netlink.MakeHandle(fl.Priority, nl.Swap16(fl.Protocol)),
+	})
+	req.AddData(nl.NewRtAttr(nl.TCA_KIND, nl.ZeroTerminated(fl.Type())))
+	options := nl.NewRtAttr(nl.TCA_OPTIONS, nil)
+	options.AddRtAttr(nl.TCA_FLOWER_KEY_ETH_TYPE, be16(fl.EthType))
+	options.AddRtAttr(nl.TCA_FLOWER_KEY_IP_PROTO, nl.IPPROTO_TCP.Serialize())
+	if fl.DestPort != 0 {
+		options.AddRtAttr(nl.TCA_FLOWER_KEY_TCP_DST, be16(fl.DestPort))
+	}
+	if fl.DstPortRangeMin != 0 {
+		options.AddRtAttr(nl.TCA_FLOWER_KEY_PORT_DST_MIN, be16(fl.DstPortRangeMin))
+		options.AddRtAttr(nl.TCA_FLOWER_KEY_PORT_DST_MAX, be16(fl.DstPortRangeMax))
+	}
+	options.AddRtAttr(nl.TCA_FLOWER_KEY_TCP_FLAGS, be16(tcpFlagSYN))
+	options.AddRtAttr(nl.TCA_FLOWER_KEY_TCP_FLAGS_MASK, be16(tcpFlagSYN|tcpFlagACK))
+	if err := netlink.EncodeActions(options.AddRtAttr(nl.TCA_FLOWER_ACT, nil), fl.Actions); err != nil {
+		return err
+	}
+	req.AddData(options)
+	_, err := req.Execute(unix.NETLINK_ROUTE, 0)
+	return err
+}
+
+func be16(v uint16) []byte {
+	return binary.BigEndian.AppendUint16(nil, v)
+}
+
+func redirectAction(to netlink.Link) *netlink.MirredAction {
+	return &netlink.MirredAction{
+		ActionAttrs:  netlink.ActionAttrs{Action: netlink.TC_ACT_STOLEN},
+		MirredAction: netlink.TCA_EGRESS_REDIR,
+		Ifindex:      to.Attrs().Index,
+	}
+}
+
+func inBand(prio, band uint16) bool {
+	return prio >= band && prio < band+bandWidth
+}
+
+func linkByName(name string) (netlink.Link, error) {
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		var notFound netlink.LinkNotFoundError
+		if errors.As(err, &notFound) {
+			return nil, fmt.Errorf("%w: %s", ErrNICMissing, name)
+		}
+		return nil, fmt.Errorf("find %s: %w", name, err)
+	}
+	return link, nil
+}
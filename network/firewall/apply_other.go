@@ -0,0 +1,18 @@
+//go:build !linux
+
+package firewall
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/cocoonstack/cocoon/types"
+)
+
+// Apply accepts only an empty firewall: TC filters need Linux.
+func Apply(_ NIC, fw *types.Firewall) error {
+	if fw.Empty() {
+		return nil
+	}
+	return fmt.Errorf("vm firewall requires Linux (running on %s)", runtime.GOOS)
+}
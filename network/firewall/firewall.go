@@ -0,0 +1,325 @@
+// Package firewall compiles a VM's types.Firewall into TC flower filters on the host side of each NIC: the veth and
+// TAP ingress hooks inside the CNI netns (ahead of the veth<->TAP redirect), or a clsact qdisc on a bridge TAP.
+// TC runs before netfilter would, so the rules hold even though redirected packets never reach the netns stack.
+// Filtering is stateless; replies are let through by port (see Compile). TCP connection openings (SYN without ACK)
+// toward the ephemeral ports are dropped, but UDP has no handshake to key on: with ingress deny, any peer can still
+// reach a guest UDP socket bound in 32768-60999.
+package firewall
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/cocoonstack/cocoon/types"
+)
+
+const (
+	// RedirectPriority is the CNI veth<->TAP redirect's TC priority, after every firewall filter.
+	RedirectPriority uint16 = 0xF000
+
+	// Compiled filters alternate between two priority bands so a new ruleset is fully installed before the old one
+	// is deleted: no packet ever sees an empty or half-built ruleset.
+	bandA     uint16 = 0x1000
+	bandB     uint16 = 0x5000
+	bandWidth        = 0x4000
+
+	ethIPv4 uint16 = 0x0800
+	ethIPv6 uint16 = 0x86DD
+
+	protoICMP   uint8 = 1
+	protoTCP    uint8 = 6
+	protoUDP    uint8 = 17
+	protoICMPv6 uint8 = 58
+
+	tcpFlagSYN uint16 = 0x02
+	tcpFlagACK uint16 = 0x10
+)
+
+var (
+	// ErrNICMissing means the NIC's netns or device does not exist (VM never started, or the host rebooted);
+	// network recovery applies the recorded firewall when it rebuilds the NIC.
+	ErrNICMissing = errors.New("nic not plumbed")
+
+	// ephemeralPorts is Linux's default ip_local_port_range: replies to guest-initiated connections arrive there.
+	ephemeralPorts = types.PortRange{From: 32768, To: 60999}
+)
+
+// NIC locates one VM NIC's host side: Device is the CNI veth inside NetnsPath; bridge NICs have only a TAP.
+type NIC struct {
+	NetnsPath string
+	Device    string
+	TAP       string
+}
+
+// NICs returns the host side of each of vm's NICs.
+func NICs(vm *types.VM) []NIC {
+	out := make([]NIC, 0, len(vm.NetworkConfigs))
+	for i, nc := range vm.NetworkConfigs {
+		if nc == nil {
+			continue
+		}
+		nic := NIC{TAP: nc.TAP}
+		if nc.Backend != types.BackendBridge {
+			nic.NetnsPath = cmp.Or(nc.NetnsPath, vm.NetnsPath)
+			nic.Device = fmt.Sprintf("eth%d", i)
+		}
+		out = append(out, nic)
+	}
+	return out
+}
+
+// ApplyVM applies fw to every plumbed NIC of vm; NICs that are not plumbed pick it up on recovery.
+func ApplyVM(vm *types.VM, fw *types.Firewall) error {
+	for _, nic := range NICs(vm) {
+		if err := Apply(nic, fw); err != nil && !errors.Is(err, ErrNICMissing) {
+			return fmt.Errorf("firewall %s: %w", nic.TAP, err)
+		}
+	}
+	return nil
+}
+
+// Filter is one compiled match; a direction's filters are evaluated in order and the first match wins.
+type Filter struct {
+	EthType            uint16
+	Proto              uint8 // 0 = any
+	Src, Dst           *net.IPNet
+	SrcPorts, DstPorts types.PortRange // zero = any
+	SYN                bool            // TCP only: match connection openings (SYN set, ACK clear)
+	Allow              bool
+}
+
+// Ruleset is a compiled firewall, split by hook.
+type Ruleset struct {
+	ToGuest, FromGuest []Filter
+}
+
+// Compile turns fw into filters. A deny policy appends the stateless reply allowances before its drops: ICMP and
+// DHCP both ways, inbound TCP/UDP to the guest's ephemeral ports (replies to guest-initiated connections) minus TCP
+// SYNs opening a connection there, and outbound TCP/UDP from ports an ingress allow rule opens (replies from guest
+// services).
+func Compile(fw *types.Firewall) (Ruleset, error) {
+	var rs Ruleset
+	if fw.Empty() {
+		return rs, nil
+	}
+	if err := fw.Validate(); err != nil {
+		return rs, err
+	}
+	var replies []Filter
+	for _, r := range fw.Rules {
+		toGuest := r.Direction == types.DirectionIngress
+		filters := ruleFilters(r, toGuest)
+		if toGuest {
+			rs.ToGuest = append(rs.ToGuest, filters...)
+		} else {
+			rs.FromGuest = append(rs.FromGuest, filters...)
+		}
+		if toGuest && r.Action == types.FirewallAllow {
+			replies = append(replies, replyFilters(filters)...)
+		}
+	}
+	if fw.Ingress == types.FirewallDeny {
+		for _, eth := range []uint16{ethIPv4, ethIPv6} {
+			rs.ToGuest = append(rs.ToGuest,
+				Filter{EthType: eth, Proto: icmpFor(eth), Allow: true},
+				Filter{EthType: eth, Proto: protoUDP, DstPorts: dhcpClientPort(eth), Allow: true},
+				Filter{EthType: eth, Proto: protoTCP, DstPorts: ephemeralPorts, SYN: true},
+				Filter{EthType: eth, Proto: protoTCP, DstPorts: ephemeralPorts, Allow: true},
+				Filter{EthType: eth, Proto: protoUDP, DstPorts: ephemeralPorts, Allow: true},
+				Filter{EthType: eth})
+		}
+	}
+	if fw.Egress == types.FirewallDeny {
+		rs.FromGuest = append(rs.FromGuest, replies...)
+		for _, eth := range []uint16{ethIPv4, ethIPv6} {
+			rs.FromGuest = append(rs.FromGuest,
+				Filter{EthType: eth, Proto: icmpFor(eth), Allow: true},
+				Filter{EthType: eth, Proto: protoUDP, DstPorts: dhcpServerPort(eth), Allow: true},
+				Filter{EthType: eth})
+		}
+	}
+	if len(rs.ToGuest) > bandWidth || len(rs.FromGuest) > bandWidth {
+		return rs, fmt.Errorf("firewall compiles to more than %d filters per direction", bandWidth)
+	}
+	return rs, nil
+}
+
+// ruleFilters expands one rule over its address families and port ranges; the peer is the source toward the guest.
+func ruleFilters(r types.FirewallRule, toGuest bool) []Filter {
+	peer, _ := r.Peer()
+	ports, _ := r.PortRanges()
+	families := []uint16{ethIPv4, ethIPv6}
+	if peer != nil {
+		families = families[:1]
+		if peer.IP.To4() == nil {
+			families = []uint16{ethIPv6}
+		}
+	}
+	if len(ports) == 0 {
+		ports = []types.PortRange{{}}
+	}
+	var out []Filter
+	for _, eth := range families {
+		for _, pr := range ports {
+			f := Filter{EthType: eth, DstPorts: pr, Allow: r.Action == types.FirewallAllow}
+			switch r.Protocol {
+			case types.ProtocolTCP:
+				f.Proto = protoTCP
+			case types.ProtocolUDP:
+				f.Proto = protoUDP
+			case types.ProtocolICMP:
+				f.Proto = icmpFor(eth)
+			}
+			if toGuest {
+				f.Src = peer
+			} else {
+				f.Dst = peer
+			}
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// replyFilters mirrors ingress allow filters with ports into egress allowances for the guest's replies.
+func replyFilters(ingress []Filter) []Filter {
+	var out []Filter
+	for _, f := range ingress {
+		if f.DstPorts == (types.PortRange{}) {
+			continue
+		}
+		out = append(out, Filter{EthType: f.EthType, Proto: f.Proto, Dst: f.Src, SrcPorts: f.DstPorts, Allow: true})
+	}
+	return out
+}
+
+// String renders the filter nft-style, for logs and tests.
+func (f Filter) String() string {
+	var b strings.Builder
+	b.WriteString("ip")
+	if f.EthType == ethIPv6 {
+		b.WriteString("6")
+	}
+	switch f.Proto {
+	case protoTCP:
+		b.WriteString(" tcp")
+	case protoUDP:
+		b.WriteString(" udp")
+	case protoICMP:
+		b.WriteString(" icmp")
+	case protoICMPv6:
+		b.WriteString(" icmpv6")
+	}
+	if f.Src != nil {
+		fmt.Fprintf(&b, " saddr %s", f.Src)
+	}
+	if f.Dst != nil {
+		fmt.Fprintf(&b, " daddr %s", f.Dst)
+	}
+	writePorts(&b, "sport", f.SrcPorts)
+	writePorts(&b, "dport", f.DstPorts)
+	if f.SYN {
+		b.WriteString(" flags syn / syn,ack")
+	}
+	if f.Allow {
+		b.WriteString(" allow")
+	} else {
+		b.WriteString(" drop")
+	}
+	return b.String()
+}
+
+// ParseAllow reads an inline --allow "PROTO[:PORTS][@CIDR]" (e.g. tcp:22,443 or udp:53@10.0.0.0/8) as an ingress
+// allow rule.
+func ParseAllow(spec string) (types.FirewallRule, error) {
+	r := types.FirewallRule{Action: types.FirewallAllow, Direction: types.DirectionIngress}
+	body, cidr, _ := strings.Cut(spec, "@")
+	r.CIDR = cidr
+	r.Protocol, r.Ports, _ = strings.Cut(body, ":")
+	if err := r.Validate(); err != nil {
+		return r, fmt.Errorf("--allow %q: %w", spec, err)
+	}
+	return r, nil
+}
+
+// FromInline builds a firewall from --allow and --deny-egress: any --allow makes ingress default-deny, each
+// --deny-egress value is a comma-separated CIDR list. Nil when both are empty.
+func FromInline(allow, denyEgress []string) (*types.Firewall, error) {
+	if len(allow) == 0 && len(denyEgress) == 0 {
+		return nil, nil
+	}
+	fw := &types.Firewall{}
+	for _, spec := range allow {
+		r, err := ParseAllow(spec)
+		if err != nil {
+			return nil, err
+		}
+		fw.Rules = append(fw.Rules, r)
+		fw.Ingress = types.FirewallDeny
+	}
+	for _, list := range denyEgress {
+		for cidr := range strings.SplitSeq(list, ",") {
+			r := types.FirewallRule{Action: types.FirewallDeny, Direction: types.DirectionEgress, CIDR: strings.TrimSpace(cidr)}
+			if err := r.Validate(); err != nil {
+				return nil, fmt.Errorf("--deny-egress %q: %w", list, err)
+			}
+			fw.Rules = append(fw.Rules, r)
+		}
+	}
+	return fw, nil
+}
+
+// Load reads a --firewall JSON file; unknown fields are rejected so a typo cannot silently open a port.
+func Load(path string) (*types.Firewall, error) {
+	data, err := os.ReadFile(path) //nolint:gosec // user-supplied firewall file
+	if err != nil {
+		return nil, fmt.Errorf("--firewall: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var fw types.Firewall
+	if err = dec.Decode(&fw); err != nil {
+		return nil, fmt.Errorf("--firewall %s: %w", path, err)
+	}
+	if err = fw.Validate(); err != nil {
+		return nil, fmt.Errorf("--firewall %s: %w", path, err)
+	}
+	return &fw, nil
+}
+
+func writePorts(b *strings.Builder, label string, pr types.PortRange) {
+	switch {
+	case pr.From == 0:
+	case pr.From == pr.To:
+		fmt.Fprintf(b, " %s %d", label, pr.From)
+	default:
+		fmt.Fprintf(b, " %s %d-%d", label, pr.From, pr.To)
+	}
+}
+
+func icmpFor(eth uint16) uint8 {
+	if eth == ethIPv6 {
+		return protoICMPv6
+	}
+	return protoICMP
+}
+
+func dhcpClientPort(eth uint16) types.PortRange {
+	if eth == ethIPv6 {
+		return types.PortRange{From: 546, To: 546}
+	}
+	return types.PortRange{From: 68, To: 68}
+}
+
+func dhcpServerPort(eth uint16) types.PortRange {
+	if eth == ethIPv6 {
+		return types.PortRange{From: 547, To: 547}
+	}
+	return types.PortRange{From: 67, To: 67}
+}
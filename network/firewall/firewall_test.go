@@ -0,0 +1,127 @@
+package firewall
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cocoonstack/cocoon/types"
+)
+
+func TestCompile(t *testing.T) {
+	fw := &types.Firewall{
+		Ingress: types.FirewallDeny,
+		Egress:  types.FirewallDeny,
+		Rules: []types.FirewallRule{
+			{Action: types.FirewallAllow, Direction: types.DirectionIngress, Protocol: types.ProtocolTCP, Ports: "22,8000-8100", CIDR: "10.0.0.0/8"},
+			{Action: types.FirewallAllow, Direction: types.DirectionIngress, Protocol: types.ProtocolICMP},
+			{Action: types.FirewallAllow, Direction: types.DirectionEgress, Protocol: types.ProtocolUDP, Ports: "53", CIDR: "1.1.1.1"},
+		},
+	}
+	rs, err := Compile(fw)
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	wantTo := `ip tcp saddr 10.0.0.0/8 dport 22 allow
+ip tcp saddr 10.0.0.0/8 dport 8000-8100 allow
+ip icmp allow
+ip6 icmpv6 allow
+ip icmp allow
+ip udp dport 68 allow
+ip tcp dport 32768-60999 flags syn / syn,ack drop
+ip tcp dport 32768-60999 allow
+ip udp dport 32768-60999 allow
+ip drop
+ip6 icmpv6 allow
+ip6 udp dport 546 allow
+ip6 tcp dport 32768-60999 flags syn / syn,ack drop
+ip6 tcp dport 32768-60999 allow
+ip6 udp dport 32768-60999 allow
+ip6 drop`
+	wantFrom := `ip udp daddr 1.1.1.1/32 dport 53 allow
+ip tcp daddr 10.0.0.0/8 sport 22 allow
+ip tcp daddr 10.0.0.0/8 sport 8000-8100 allow
+ip icmp allow
+ip udp dport 67 allow
+ip drop
+ip6 icmpv6 allow
+ip6 udp dport 547 allow
+ip6 drop`
+	if got := render(rs.ToGuest); got != wantTo {
+		t.Errorf("ToGuest:\n%s\nwant:\n%s", got, wantTo)
+	}
+	if got := render(rs.FromGuest); got != wantFrom {
+		t.Errorf("FromGuest:\n%s\nwant:\n%s", got, wantFrom)
+	}
+}
+
+func TestCompileEmpty(t *testing.T) {
+	for _, fw := range []*types.Firewall{nil, {}, {Ingress: types.FirewallAllow}} {
+		rs, err := Compile(fw)
+		if err != nil || len(rs.ToGuest) != 0 || len(rs.FromGuest) != 0 {
+			t.Errorf("Compile(%+v) = %+v, %v; want no filters", fw, rs, err)
+		}
+	}
+}
+
+func TestFromInline(t *testing.T) {
+	fw, err := FromInline([]string{"tcp:22,443", "udp:53@10.0.0.0/8"}, []string{"10.0.0.0/8, 192.168.0.0/16"})
+	if err != nil {
+		t.Fatalf("FromInline: %v", err)
+	}
+	if fw.Ingress != types.FirewallDeny || fw.Egress != "" {
+		t.Errorf("policies = %q/%q, want deny/default", fw.Ingress, fw.Egress)
+	}
+	want := []types.FirewallRule{
+		{Action: "allow", Direction: "ingress", Protocol: "tcp", Ports: "22,443"},
+		{Action: "allow", Direction: "ingress", Protocol: "udp", Ports: "53", CIDR: "10.0.0.0/8"},
+		{Action: "deny", Direction: "egress", CIDR: "10.0.0.0/8"},
+		{Action: "deny", Direction: "egress", CIDR: "192.168.0.0/16"},
+	}
+	if len(fw.Rules) != len(want) {
+		t.Fatalf("rules = %+v, want %+v", fw.Rules, want)
+	}
+	for i := range want {
+		if fw.Rules[i] != want[i] {
+			t.Errorf("rule %d = %+v, want %+v", i, fw.Rules[i], want[i])
+		}
+	}
+
+	if fw, err = FromInline(nil, nil); fw != nil || err != nil {
+		t.Errorf("FromInline(nil, nil) = %+v, %v; want nil", fw, err)
+	}
+	for _, spec := range []string{"sctp:9", "tcp:0", "icmp:8", "tcp:22@nowhere"} {
+		if _, err = FromInline([]string{spec}, nil); err == nil {
+			t.Errorf("FromInline(--allow %q) should fail", spec)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.json")
+	if err := os.WriteFile(good, []byte(`{"ingress":"deny","rules":[{"action":"allow","direction":"ingress","protocol":"tcp","ports":"22"}]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	fw, err := Load(good)
+	if err != nil || fw.Ingress != types.FirewallDeny || len(fw.Rules) != 1 {
+		t.Errorf("Load = %+v, %v", fw, err)
+	}
+
+	typo := filepath.Join(dir, "typo.json")
+	if err = os.WriteFile(typo, []byte(`{"ingress":"deny","rules":[{"action":"allow","direction":"ingress","port":"22"}]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Load(typo); err == nil || !strings.Contains(err.Error(), "unknown field") {
+		t.Errorf("Load(typo) error = %v, want unknown field", err)
+	}
+}
+
+func render(filters []Filter) string {
+	lines := make([]string, len(filters))
+	for i, f := range filters {
+		lines[i] = f.String()
+	}
+	return strings.Join(lines, "\n")
+}
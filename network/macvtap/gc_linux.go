@@ -0,0 +1,79 @@
+//go:build linux
+
+package macvtap
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+
+	"github.com/projecteru2/core/log"
+	"github.com/vishvananda/netlink"
+
+	"github.com/cocoonstack/cocoon/gc"
+	"github.com/cocoonstack/cocoon/lock/flock"
+	"github.com/cocoonstack/cocoon/network"
+	"github.com/cocoonstack/cocoon/utils"
+)
+
+// macvtapSnapshot maps the VM ID prefixes owning mt* macvtap devices to those devices.
+type macvtapSnapshot struct {
+	devices map[string][]string
+}
+
+// GCModule returns a GC module that reclaims orphan mt* macvtap devices.
+// It does not require a Macvtap instance — only rootDir for the lock file.
+func GCModule(rootDir string) gc.Module[macvtapSnapshot] {
+	lockPath := filepath.Join(rootDir, typ, "gc.lock")
+	_ = utils.EnsureDirs(filepath.Dir(lockPath))
+
+	return gc.Module[macvtapSnapshot]{
+		Name:   typ,
+		Locker: flock.New(lockPath),
+		ReadDB: func(_ context.Context) (macvtapSnapshot, error) {
+			snap := macvtapSnapshot{devices: make(map[string][]string)}
+			links, err := netlink.LinkList()
+			if err != nil {
+				return snap, err
+			}
+			for _, l := range links {
+				if l.Type() != "macvtap" {
+					continue
+				}
+				if prefix, ok := parseDevName(l.Attrs().Name); ok {
+					snap.devices[prefix] = append(snap.devices[prefix], l.Attrs().Name)
+				}
+			}
+			return snap, nil
+		},
+		Resolve: func(_ context.Context, snap macvtapSnapshot, others map[string]any) []string {
+			active := gc.Collect(others, gc.VMIDs)
+			activePrefixes := make(map[string]struct{}, len(active))
+			for id := range active {
+				activePrefixes[network.VMIDPrefix(id)] = struct{}{}
+			}
+
+			var orphans []string
+			for prefix := range snap.devices {
+				if _, ok := activePrefixes[prefix]; !ok {
+					orphans = append(orphans, prefix)
+				}
+			}
+			slices.Sort(orphans)
+			return orphans
+		},
+		Collect: func(ctx context.Context, prefixes []string, snap macvtapSnapshot) error {
+			logger := log.WithFunc("gc.macvtap")
+			for _, prefix := range prefixes {
+				for _, name := range snap.devices[prefix] {
+					if err := deleteDev(name); err != nil {
+						logger.Warnf(ctx, "delete orphan macvtap %s: %v", name, err)
+					} else {
+						logger.Infof(ctx, "collected id=%s iface=%s reason=orphan-macvtap", prefix, name)
+					}
+				}
+			}
+			return nil
+		},
+	}
+}
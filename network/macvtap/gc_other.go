@@ -0,0 +1,30 @@
+//go:build !linux
+
+package macvtap
+
+import (
+	"context"
+
+	"github.com/cocoonstack/cocoon/gc"
+	"github.com/cocoonstack/cocoon/lock/flock"
+)
+
+// macvtapSnapshot is a placeholder for non-Linux.
+type macvtapSnapshot struct{}
+
+// GCModule returns a no-op GC module on non-Linux — macvtap devices don't exist.
+func GCModule(_ string) gc.Module[macvtapSnapshot] {
+	return gc.Module[macvtapSnapshot]{
+		Name:   typ,
+		Locker: flock.New("/dev/null"),
+		ReadDB: func(_ context.Context) (macvtapSnapshot, error) {
+			return macvtapSnapshot{}, nil
+		},
+		Resolve: func(_ context.Context, _ macvtapSnapshot, _ map[string]any) []string {
+			return nil
+		},
+		Collect: func(_ context.Context, _ []string, _ macvtapSnapshot) error {
+			return nil
+		},
+	}
+}
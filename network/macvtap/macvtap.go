@@ -0,0 +1,33 @@
+// Package macvtap is the host-L2 network provider: each NIC is a macvtap device on a parent interface, so the
+// guest appears directly on that segment (VPC/ENI-style) without a Linux bridge.
+package macvtap
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cocoonstack/cocoon/network"
+	"github.com/cocoonstack/cocoon/types"
+)
+
+const (
+	typ       = types.BackendMacvtap
+	devPrefix = "mt"
+)
+
+func devName(vmID string, nic int) string {
+	return fmt.Sprintf("%s%s-%d", devPrefix, network.VMIDPrefix(vmID), nic)
+}
+
+// parseDevName extracts the vmID prefix from a device name like "mt<prefix>-<nic>".
+func parseDevName(name string) (string, bool) {
+	rest, ok := strings.CutPrefix(name, devPrefix)
+	if !ok {
+		return "", false
+	}
+	idx := strings.LastIndex(rest, "-")
+	if idx <= 0 || idx == len(rest)-1 {
+		return "", false
+	}
+	return rest[:idx], true
+}
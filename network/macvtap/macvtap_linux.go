@@ -0,0 +1,187 @@
+//go:build linux
+
+package macvtap
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/projecteru2/core/log"
+	"github.com/vishvananda/netlink"
+
+	"github.com/cocoonstack/cocoon/config"
+	"github.com/cocoonstack/cocoon/gc"
+	"github.com/cocoonstack/cocoon/network"
+	"github.com/cocoonstack/cocoon/types"
+)
+
+var _ network.Network = (*Macvtap)(nil)
+
+// Macvtap puts each NIC on the parent interface's L2 segment through its own macvtap device; the hypervisor gets
+// the device's queues as descriptors (network.OpenMacvtap). The guest's address comes from the parent's network.
+type Macvtap struct {
+	conf   *config.Config
+	parent string
+	mode   netlink.MacvlanMode
+}
+
+// New: spec is a --macvtap value; its parent interface must already exist.
+func New(conf *config.Config, spec string) (*Macvtap, error) {
+	if conf == nil {
+		return nil, fmt.Errorf("config is nil")
+	}
+	parent, mode, err := types.ParseMacvtap(spec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = netlink.LinkByName(parent); err != nil {
+		return nil, fmt.Errorf("macvtap parent %s: %w", parent, err)
+	}
+	m := &Macvtap{conf: conf, parent: parent, mode: netlink.MACVLAN_MODE_BRIDGE}
+	if mode == types.MacvtapPassthru {
+		m.mode = netlink.MACVLAN_MODE_PASSTHRU
+	}
+	return m, nil
+}
+
+func (m *Macvtap) Type() string { return typ }
+
+// Verify checks the VM's first macvtap; devices do not survive a host reboot.
+func (m *Macvtap) Verify(_ context.Context, vmID string) error {
+	if _, err := netlink.LinkByName(devName(vmID, 0)); err != nil {
+		return fmt.Errorf("macvtap %s: %w", devName(vmID, 0), err)
+	}
+	return nil
+}
+
+// Prepare is a no-op (macvtap has no netns).
+func (m *Macvtap) Prepare(_ context.Context, _ string, _ *types.VMConfig) (string, error) {
+	return "", nil
+}
+
+// Add creates a macvtap per spec on the parent, replacing a stale one on recovery. The device carries the guest
+// MAC, which in passthru mode defaults to the parent's own.
+func (m *Macvtap) Add(ctx context.Context, vmID string, vmCfg *types.VMConfig, specs ...network.AddSpec) (configs []*types.NetworkConfig, retErr error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	logger := log.WithFunc("macvtap.Add")
+	parent, err := netlink.LinkByName(m.parent)
+	if err != nil {
+		return nil, fmt.Errorf("macvtap parent %s: %w", m.parent, err)
+	}
+
+	added := make([]int, 0, len(specs))
+	defer func() {
+		if retErr != nil {
+			_ = tearDown(vmID, added, true)
+		}
+	}()
+	configs = make([]*types.NetworkConfig, 0, len(specs))
+	for _, spec := range specs {
+		mac := network.GenerateMAC()
+		if m.mode == netlink.MACVLAN_MODE_PASSTHRU {
+			mac = parent.Attrs().HardwareAddr.String()
+		}
+		switch {
+		case spec.Request != nil && (spec.Request.IP != "" || spec.Request.Network != "" || spec.Request.Bridge != ""):
+			return nil, fmt.Errorf("nic %d: macvtap NICs take only mac=: the address comes from %s's network", spec.Index, m.parent)
+		case spec.Existing != nil:
+			mac = spec.Existing.MAC
+		case spec.Request != nil && spec.Request.MAC != "":
+			mac = spec.Request.MAC
+		}
+		hw, parseErr := net.ParseMAC(mac)
+		if parseErr != nil {
+			return nil, fmt.Errorf("nic %d: mac %q: %w", spec.Index, mac, parseErr)
+		}
+
+		name := devName(vmID, spec.Index)
+		_ = tearDown(vmID, []int{spec.Index}, true)
+		link := &netlink.Macvtap{Macvlan: netlink.Macvlan{
+			LinkAttrs: netlink.LinkAttrs{Name: name, ParentIndex: parent.Attrs().Index, HardwareAddr: hw, MTU: parent.Attrs().MTU},
+			Mode:      m.mode,
+		}}
+		if addErr := netlink.LinkAdd(link); addErr != nil {
+			return nil, fmt.Errorf("create macvtap %s on %s: %w", name, m.parent, addErr)
+		}
+		added = append(added, spec.Index)
+		_ = network.TuneTAP(link)
+		if upErr := netlink.LinkSetUp(link); upErr != nil {
+			return nil, fmt.Errorf("set %s up: %w", name, upErr)
+		}
+
+		configs = append(configs, &types.NetworkConfig{
+			TAP:       name,
+			MAC:       mac,
+			NumQueues: network.NetNumQueues(vmCfg.CPU),
+			QueueSize: network.ResolveQueueSize(vmCfg.QueueSize),
+			Backend:   typ,
+		})
+		logger.Debugf(ctx, "NIC %d: macvtap=%s mac=%s parent=%s", spec.Index, name, mac, m.parent)
+	}
+	return configs, nil
+}
+
+func (m *Macvtap) Remove(_ context.Context, vmID string, indices ...int) error {
+	return tearDown(vmID, indices, false)
+}
+
+func (m *Macvtap) Delete(_ context.Context, vmIDs []string) ([]string, error) {
+	return Cleanup(vmIDs), nil
+}
+
+// Inspect: macvtap has no persistent records.
+func (m *Macvtap) Inspect(_ context.Context, _ string) (*types.Network, error) {
+	return nil, nil
+}
+
+// List: macvtap has no persistent records.
+func (m *Macvtap) List(_ context.Context) ([]*types.Network, error) {
+	return nil, nil
+}
+
+// RegisterGC reclaims orphan mt* macvtap devices.
+func (m *Macvtap) RegisterGC(orch *gc.Orchestrator) {
+	gc.Register(orch, GCModule(m.conf.RootDir))
+}
+
+// Cleanup removes the macvtap devices of vmIDs; safe without a Macvtap instance.
+func Cleanup(vmIDs []string) []string {
+	cleaned := make([]string, 0, len(vmIDs))
+	for _, vmID := range vmIDs {
+		var indices []int
+		for i := 0; ; i++ {
+			if _, err := netlink.LinkByName(devName(vmID, i)); err != nil {
+				break
+			}
+			indices = append(indices, i)
+		}
+		_ = tearDown(vmID, indices, true)
+		cleaned = append(cleaned, vmID)
+	}
+	return cleaned
+}
+
+func tearDown(vmID string, indices []int, bestEffort bool) error {
+	for _, i := range indices {
+		if err := deleteDev(devName(vmID, i)); err != nil && !bestEffort {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteDev removes a macvtap and its /dev/tapN node.
+func deleteDev(name string) error {
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		return fmt.Errorf("find macvtap %s: %w", name, err)
+	}
+	if err = netlink.LinkDel(link); err != nil {
+		return fmt.Errorf("delete macvtap %s: %w", name, err)
+	}
+	network.RemoveMacvtapNode(link.Attrs().Index)
+	return nil
+}
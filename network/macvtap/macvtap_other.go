@@ -0,0 +1,47 @@
+//go:build !linux
+
+package macvtap
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+
+	"github.com/cocoonstack/cocoon/config"
+	"github.com/cocoonstack/cocoon/gc"
+	"github.com/cocoonstack/cocoon/network"
+	"github.com/cocoonstack/cocoon/types"
+)
+
+var errUnsupported = fmt.Errorf("macvtap networking requires Linux (running on %s)", runtime.GOOS)
+
+type Macvtap struct{}
+
+func New(_ *config.Config, _ string) (*Macvtap, error) {
+	return nil, errUnsupported
+}
+
+func (m *Macvtap) Type() string                             { return typ }
+func (m *Macvtap) Verify(_ context.Context, _ string) error { return errUnsupported }
+func (m *Macvtap) Remove(_ context.Context, _ string, _ ...int) error {
+	return errUnsupported
+}
+func (m *Macvtap) RegisterGC(_ *gc.Orchestrator) {}
+
+func (m *Macvtap) Prepare(_ context.Context, _ string, _ *types.VMConfig) (string, error) {
+	return "", errUnsupported
+}
+
+func (m *Macvtap) Add(_ context.Context, _ string, _ *types.VMConfig, _ ...network.AddSpec) ([]*types.NetworkConfig, error) {
+	return nil, errUnsupported
+}
+
+func (m *Macvtap) Delete(_ context.Context, _ []string) ([]string, error) { return nil, errUnsupported }
+
+func (m *Macvtap) Inspect(_ context.Context, _ string) (*types.Network, error) {
+	return nil, errUnsupported
+}
+
+func (m *Macvtap) List(_ context.Context) ([]*types.Network, error) { return nil, errUnsupported }
+
+func Cleanup(_ []string) []string { return nil }
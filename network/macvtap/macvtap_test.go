@@ -0,0 +1,34 @@
+package macvtap
+
+import "testing"
+
+func TestDevName(t *testing.T) {
+	if got := devName("0123456789abcdef", 3); got != "mt01234567-3" {
+		t.Errorf("devName = %q, want mt01234567-3", got)
+	}
+	if got := len(devName("0123456789abcdef", 15)); got > 15 { //nolint:mnd // IFNAMSIZ-1
+		t.Errorf("devName length %d exceeds IFNAMSIZ", got)
+	}
+}
+
+func TestParseDevName(t *testing.T) {
+	tests := []struct {
+		name       string
+		wantPrefix string
+		wantOK     bool
+	}{
+		{name: "mt12345678-0", wantPrefix: "12345678", wantOK: true},
+		{name: "mt12345678-12", wantPrefix: "12345678", wantOK: true},
+		{name: "bt12345678-0"},
+		{name: "mt-0"},
+		{name: "mt12345678-"},
+		{name: "mt12345678"},
+		{name: ""},
+	}
+	for _, tt := range tests {
+		prefix, ok := parseDevName(tt.name)
+		if ok != tt.wantOK || prefix != tt.wantPrefix {
+			t.Errorf("parseDevName(%q) = %q, %v; want %q, %v", tt.name, prefix, ok, tt.wantPrefix, tt.wantOK)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+//go:build linux
+
+package network
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+
+	"github.com/cocoonstack/cocoon/utils"
+)
+
+// macvtapFlags: macvtap accepts TUNSETIFF only as a TAP without packet info; each open of a multi-queue
+// device adds a queue pair.
+const macvtapFlags = unix.IFF_TAP | unix.IFF_NO_PI | unix.IFF_VNET_HDR | unix.IFF_MULTI_QUEUE
+
+// OpenMacvtap opens queuePairs queues of the macvtap device name. The VMM cannot open a macvtap by name as it
+// does a TAP, so it is handed these descriptors instead; the caller closes them once the VMM holds its copies.
+func OpenMacvtap(name string, queuePairs int) (files []*os.File, retErr error) {
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("find macvtap %s: %w", name, err)
+	}
+	dev, err := macvtapDevice(name, link.Attrs().Index)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if retErr != nil {
+			utils.CloseFiles(files)
+			files = nil
+		}
+	}()
+	for range max(1, queuePairs) {
+		f, openErr := os.OpenFile(dev, os.O_RDWR, 0) //nolint:gosec
+		if openErr != nil {
+			return files, fmt.Errorf("open %s: %w", dev, openErr)
+		}
+		files = append(files, f)
+		ifr, ifrErr := unix.NewIfreq("")
+		if ifrErr != nil {
+			return files, ifrErr
+		}
+		ifr.SetUint16(macvtapFlags)
+		if ioErr := unix.IoctlIfreq(int(f.Fd()), unix.TUNSETIFF, ifr); ioErr != nil {
+			return files, fmt.Errorf("set %s queue flags: %w", dev, ioErr)
+		}
+	}
+	return files, nil
+}
+
+// RemoveMacvtapNode removes the /dev/tapN node of a deleted macvtap; udev does so itself, a node
+// macvtapDevice created does not go away on its own.
+func RemoveMacvtapNode(ifindex int) {
+	_ = os.Remove(macvtapPath(ifindex))
+}
+
+// macvtapDevice returns /dev/tap<ifindex>, creating the node from sysfs on hosts without udev.
+func macvtapDevice(name string, ifindex int) (string, error) {
+	path := macvtapPath(ifindex)
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		return path, err
+	}
+	raw, err := os.ReadFile(filepath.Join("/sys/class/net", name, "macvtap", fmt.Sprintf("tap%d", ifindex), "dev"))
+	if err != nil {
+		return "", fmt.Errorf("macvtap %s device number: %w", name, err)
+	}
+	var major, minor uint32
+	if _, err = fmt.Sscanf(strings.TrimSpace(string(raw)), "%d:%d", &major, &minor); err != nil {
+		return "", fmt.Errorf("macvtap %s device number %q: %w", name, raw, err)
+	}
+	if err = unix.Mknod(path, unix.S_IFCHR|0o600, int(unix.Mkdev(major, minor))); err != nil && !errors.Is(err, os.ErrExist) { //nolint:gosec
+		return "", fmt.Errorf("create %s: %w", path, err)
+	}
+	return path, nil
+}
+
+func macvtapPath(ifindex int) string {
+	return fmt.Sprintf("/dev/tap%d", ifindex)
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package network
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// OpenMacvtap: macvtap devices exist only on Linux.
+func OpenMacvtap(name string, _ int) ([]*os.File, error) {
+	return nil, fmt.Errorf("macvtap %s: requires Linux (running on %s)", name, runtime.GOOS)
+}
+
+// RemoveMacvtapNode is a no-op off Linux.
+func RemoveMacvtapNode(_ int) {}
@@ -13,10 +13,11 @@ var (
 	ErrNotConfigured = errors.New("network provider not configured")
 )
 
-// AddSpec is one NIC's add request; Existing != nil reuses MAC/IP for recovery.
+// AddSpec is one NIC's add request; Existing != nil reuses MAC/IP for recovery, Request pins them for a fresh NIC.
 type AddSpec struct {
 	Index    int
 	Existing *types.NetworkConfig
+	Request  *types.NICSpec
 }
 
 // Network is the per-VM host-side networking provider (CNI, bridge, ...).
@@ -42,6 +43,15 @@ func AddRange(from, count int) []AddSpec {
 	return out
 }
 
+// AddRequested builds AddSpecs for count fresh NICs from index 0; the leading ones carry the --nic requests.
+func AddRequested(count int, requests []types.NICSpec) []AddSpec {
+	out := AddRange(0, count)
+	for i := range min(count, len(requests)) {
+		out[i].Request = &requests[i]
+	}
+	return out
+}
+
 // AddRecover builds AddSpecs for re-creating existing NICs (post-reboot recovery).
 func AddRecover(existing []*types.NetworkConfig) []AddSpec {
 	out := make([]AddSpec, len(existing))
@@ -0,0 +1,62 @@
+package passt
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+
+	"github.com/projecteru2/core/log"
+
+	"github.com/cocoonstack/cocoon/config"
+	"github.com/cocoonstack/cocoon/gc"
+	"github.com/cocoonstack/cocoon/lock/flock"
+	"github.com/cocoonstack/cocoon/utils"
+)
+
+// passtSnapshot holds the VM IDs that have passt state in RunDir.
+type passtSnapshot struct {
+	vmIDs []string
+}
+
+// GCModule returns a GC module that stops the passt daemons of VMs that no longer exist (e.g. rm interrupted
+// before the network cleanup). It does not require the passt binary.
+func GCModule(conf *config.Config) gc.Module[passtSnapshot] {
+	lockPath := filepath.Join(conf.RootDir, typ, "gc.lock")
+	_ = utils.EnsureDirs(filepath.Dir(lockPath))
+
+	return gc.Module[passtSnapshot]{
+		Name:   typ,
+		Locker: flock.New(lockPath),
+		ReadDB: func(_ context.Context) (passtSnapshot, error) {
+			matches, err := filepath.Glob(filepath.Join(conf.RunDir, typ, "*.pid"))
+			if err != nil {
+				return passtSnapshot{}, err
+			}
+			var snap passtSnapshot
+			for _, m := range matches {
+				if id, _, ok := parseStateFile(filepath.Base(m)); ok && !slices.Contains(snap.vmIDs, id) {
+					snap.vmIDs = append(snap.vmIDs, id)
+				}
+			}
+			return snap, nil
+		},
+		Resolve: func(_ context.Context, snap passtSnapshot, others map[string]any) []string {
+			active := gc.Collect(others, gc.VMIDs)
+			var orphans []string
+			for _, id := range snap.vmIDs {
+				if _, ok := active[id]; !ok {
+					orphans = append(orphans, id)
+				}
+			}
+			slices.Sort(orphans)
+			return orphans
+		},
+		Collect: func(ctx context.Context, ids []string, _ passtSnapshot) error {
+			logger := log.WithFunc("gc.passt")
+			for _, id := range Cleanup(ctx, conf, ids) {
+				logger.Infof(ctx, "collected id=%s reason=orphan-passt", id)
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,263 @@
+// Package passt is the user-mode network provider: a passt process for the VM's single NIC, reached by Cloud
+// Hypervisor over vhost-user, gives the guest outbound NAT, DHCP and port forwarding without netns, TAP or netlink
+// changes.
+package passt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/projecteru2/core/log"
+
+	"github.com/cocoonstack/cocoon/config"
+	"github.com/cocoonstack/cocoon/gc"
+	"github.com/cocoonstack/cocoon/network"
+	"github.com/cocoonstack/cocoon/types"
+	"github.com/cocoonstack/cocoon/utils"
+)
+
+const (
+	typ = types.BackendPasst
+
+	// numQueues: passt serves one vhost-user queue pair.
+	numQueues = 2
+
+	stopGracePeriod = 2 * time.Second
+)
+
+var _ network.Network = (*Passt)(nil)
+
+// ErrSingleNIC rejects a second passt NIC: every passt copies the host's address, so two NICs would carry the same one.
+var ErrSingleNIC = errors.New("passt VMs have a single NIC")
+
+// Passt runs a passt daemon per NIC; its state is the pid file and socket in RunDir/passt.
+type Passt struct {
+	conf *config.Config
+}
+
+// New checks that the passt binary is available.
+func New(conf *config.Config) (*Passt, error) {
+	if conf == nil {
+		return nil, fmt.Errorf("config is nil")
+	}
+	if _, err := exec.LookPath(conf.PasstBinary); err != nil {
+		return nil, fmt.Errorf("passt binary %q: %w", conf.PasstBinary, err)
+	}
+	if err := utils.EnsureDirs(filepath.Join(conf.RunDir, typ), filepath.Join(conf.LogDir, typ)); err != nil {
+		return nil, err
+	}
+	return &Passt{conf: conf}, nil
+}
+
+func (p *Passt) Type() string { return typ }
+
+// Verify checks that every NIC's passt is running.
+func (p *Passt) Verify(_ context.Context, vmID string) error {
+	nics := NICs(p.conf.RunDir, vmID)
+	if len(nics) == 0 {
+		return fmt.Errorf("no passt for %s", vmID)
+	}
+	for _, nic := range nics {
+		if !p.running(vmID, nic) {
+			return fmt.Errorf("passt for %s nic %d is not running", vmID, nic)
+		}
+	}
+	return nil
+}
+
+// Prepare is a no-op (passt has no netns).
+func (p *Passt) Prepare(_ context.Context, _ string, _ *types.VMConfig) (string, error) {
+	return "", nil
+}
+
+// Add starts a passt per spec, replacing a stale one on recovery. NIC 0 carries the published ports; guests take
+// their address from passt's DHCP.
+func (p *Passt) Add(ctx context.Context, vmID string, vmCfg *types.VMConfig, specs ...network.AddSpec) (configs []*types.NetworkConfig, retErr error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	logger := log.WithFunc("passt.Add")
+	dns, err := p.conf.GuestDNSServers()
+	if err != nil {
+		return nil, err
+	}
+
+	started := make([]int, 0, len(specs))
+	defer func() {
+		if retErr != nil {
+			p.stop(context.WithoutCancel(ctx), vmID, started)
+		}
+	}()
+	configs = make([]*types.NetworkConfig, 0, len(specs))
+	for _, spec := range specs {
+		if spec.Index > 0 {
+			return nil, fmt.Errorf("nic %d: %w", spec.Index, ErrSingleNIC)
+		}
+		mac := network.GenerateMAC()
+		switch {
+		case spec.Request != nil && (spec.Request.IP != "" || spec.Request.Network != "" || spec.Request.Bridge != ""):
+			return nil, fmt.Errorf("nic %d: passt NICs take only mac=: the address comes from passt's DHCP", spec.Index)
+		case spec.Existing != nil:
+			mac = spec.Existing.MAC
+		case spec.Request != nil && spec.Request.MAC != "":
+			mac = spec.Request.MAC
+		}
+		var ports []types.PortMapping
+		if spec.Index == 0 {
+			ports = vmCfg.Ports
+		}
+
+		p.stop(ctx, vmID, []int{spec.Index})
+		if err = p.start(ctx, vmID, spec.Index, Args(p.socket(vmID, spec.Index), p.pidFile(vmID, spec.Index), p.logFile(vmID, spec.Index), dns, ports)); err != nil {
+			return nil, fmt.Errorf("nic %d: %w", spec.Index, err)
+		}
+		started = append(started, spec.Index)
+
+		configs = append(configs, &types.NetworkConfig{
+			MAC:         mac,
+			NumQueues:   numQueues,
+			QueueSize:   network.ResolveQueueSize(vmCfg.QueueSize),
+			Backend:     typ,
+			VhostSocket: p.socket(vmID, spec.Index),
+		})
+		logger.Debugf(ctx, "NIC %d: passt socket=%s mac=%s", spec.Index, p.socket(vmID, spec.Index), mac)
+	}
+	return configs, nil
+}
+
+func (p *Passt) Remove(ctx context.Context, vmID string, indices ...int) error {
+	p.stop(ctx, vmID, indices)
+	return nil
+}
+
+func (p *Passt) Delete(ctx context.Context, vmIDs []string) ([]string, error) {
+	return Cleanup(ctx, p.conf, vmIDs), nil
+}
+
+// Inspect: passt has no persistent records.
+func (p *Passt) Inspect(_ context.Context, _ string) (*types.Network, error) {
+	return nil, nil
+}
+
+// List: passt has no persistent records.
+func (p *Passt) List(_ context.Context) ([]*types.Network, error) {
+	return nil, nil
+}
+
+// RegisterGC reclaims passt daemons of deleted VMs.
+func (p *Passt) RegisterGC(orch *gc.Orchestrator) {
+	gc.Register(orch, GCModule(p.conf))
+}
+
+// Cleanup stops every passt of vmIDs; safe without a Passt instance or the binary.
+func Cleanup(ctx context.Context, conf *config.Config, vmIDs []string) []string {
+	p := &Passt{conf: conf}
+	for _, vmID := range vmIDs {
+		p.stop(ctx, vmID, NICs(conf.RunDir, vmID))
+	}
+	return vmIDs
+}
+
+// NICs returns the NIC indices vmID has passt state for, in RunDir.
+func NICs(runDir, vmID string) []int {
+	matches, _ := filepath.Glob(filepath.Join(runDir, typ, vmID+"-*.pid"))
+	var out []int
+	for _, m := range matches {
+		if id, nic, ok := parseStateFile(filepath.Base(m)); ok && id == vmID {
+			out = append(out, nic)
+		}
+	}
+	return out
+}
+
+// Args builds passt's command line: vhost-user on sock, daemonized with its pid in pidFile; ports are the
+// --publish mappings passt forwards from the host.
+func Args(sock, pidFile, logFile string, dns []string, ports []types.PortMapping) []string {
+	args := []string{"--vhost-user", "--socket", sock, "--pid", pidFile, "--log-file", logFile}
+	for _, d := range dns {
+		args = append(args, "--dns", d)
+	}
+	for _, m := range ports {
+		flag := "--tcp-ports"
+		if m.Protocol == "udp" {
+			flag = "--udp-ports"
+		}
+		spec := fmt.Sprintf("%d:%d", m.HostPort, m.GuestPort)
+		if m.HostIP != "" {
+			spec = m.HostIP + "/" + spec
+		}
+		args = append(args, flag, spec)
+	}
+	return args
+}
+
+// start runs passt, which daemonizes once its socket listens, so a nil return means CH can connect.
+func (p *Passt) start(ctx context.Context, vmID string, nic int, args []string) error {
+	_ = os.Remove(p.socket(vmID, nic))
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, p.conf.PasstBinary, args...) //nolint:gosec
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("start passt: %w: %s", err, msg)
+		}
+		return fmt.Errorf("start passt: %w", err)
+	}
+	return nil
+}
+
+// stop terminates the passt of each NIC and removes its state files.
+func (p *Passt) stop(ctx context.Context, vmID string, nics []int) {
+	for _, nic := range nics {
+		if pid, err := utils.ReadPIDFile(p.pidFile(vmID, nic)); err == nil {
+			if err = utils.TerminateProcess(ctx, pid, filepath.Base(p.conf.PasstBinary), p.socket(vmID, nic), stopGracePeriod); err != nil {
+				log.WithFunc("passt.stop").Warnf(ctx, "stop passt %d of %s: %v", pid, vmID, err)
+			}
+		}
+		_ = os.Remove(p.pidFile(vmID, nic))
+		_ = os.Remove(p.socket(vmID, nic))
+	}
+}
+
+func (p *Passt) running(vmID string, nic int) bool {
+	pid, err := utils.ReadPIDFile(p.pidFile(vmID, nic))
+	return err == nil && utils.VerifyProcessCmdline(pid, filepath.Base(p.conf.PasstBinary), p.socket(vmID, nic))
+}
+
+func (p *Passt) socket(vmID string, nic int) string {
+	return filepath.Join(p.conf.RunDir, typ, stateName(vmID, nic)+".sock")
+}
+
+func (p *Passt) pidFile(vmID string, nic int) string {
+	return filepath.Join(p.conf.RunDir, typ, stateName(vmID, nic)+".pid")
+}
+
+func (p *Passt) logFile(vmID string, nic int) string {
+	return filepath.Join(p.conf.LogDir, typ, stateName(vmID, nic)+".log")
+}
+
+func stateName(vmID string, nic int) string {
+	return fmt.Sprintf("%s-%d", vmID, nic)
+}
+
+// parseStateFile splits "<vmID>-<nic>.<ext>"; VM IDs carry no dash.
+func parseStateFile(name string) (string, int, bool) {
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	vmID, nicStr, ok := strings.Cut(base, "-")
+	if !ok || vmID == "" {
+		return "", 0, false
+	}
+	nic, err := strconv.Atoi(nicStr)
+	if err != nil || nic < 0 {
+		return "", 0, false
+	}
+	return vmID, nic, true
+}
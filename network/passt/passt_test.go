@@ -0,0 +1,97 @@
+package passt
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/cocoonstack/cocoon/config"
+	"github.com/cocoonstack/cocoon/network"
+	"github.com/cocoonstack/cocoon/types"
+)
+
+func TestArgs(t *testing.T) {
+	tests := []struct {
+		name  string
+		dns   []string
+		ports []types.PortMapping
+		want  string
+	}{
+		{
+			name: "bare",
+			want: "--vhost-user --socket s --pid p --log-file l",
+		},
+		{
+			name: "dns and ports",
+			dns:  []string{"1.1.1.1", "2606:4700:4700::1111"},
+			ports: []types.PortMapping{
+				{HostPort: 8080, GuestPort: 80, Protocol: "tcp"},
+				{HostIP: "127.0.0.1", HostPort: 5353, GuestPort: 53, Protocol: "udp"},
+			},
+			want: "--vhost-user --socket s --pid p --log-file l --dns 1.1.1.1 --dns 2606:4700:4700::1111 " +
+				"--tcp-ports 8080:80 --udp-ports 127.0.0.1/5353:53",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := strings.Join(Args("s", "p", "l", tt.dns, tt.ports), " "); got != tt.want {
+				t.Errorf("Args = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseStateFile(t *testing.T) {
+	tests := []struct {
+		name   string
+		wantID string
+		nic    int
+		ok     bool
+	}{
+		{name: "ABCDEF-0.pid", wantID: "ABCDEF", nic: 0, ok: true},
+		{name: "ABCDEF-12.sock", wantID: "ABCDEF", nic: 12, ok: true},
+		{name: "ABCDEF.pid"},
+		{name: "-1.pid"},
+		{name: "ABCDEF-x.pid"},
+		{name: "ABCDEF--1.pid"},
+	}
+	for _, tt := range tests {
+		id, nic, ok := parseStateFile(tt.name)
+		if ok != tt.ok || id != tt.wantID || nic != tt.nic {
+			t.Errorf("parseStateFile(%q) = %q, %d, %v", tt.name, id, nic, ok)
+		}
+	}
+}
+
+func TestNICs(t *testing.T) {
+	runDir := t.TempDir()
+	dir := filepath.Join(runDir, typ)
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"VMA-0.pid", "VMA-0.sock", "VMA-2.pid", "VMB-1.pid", "gc.lock"} {
+		if err := os.WriteFile(filepath.Join(dir, f), nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := NICs(runDir, "VMA")
+	slices.Sort(got)
+	if !slices.Equal(got, []int{0, 2}) {
+		t.Errorf("NICs(VMA) = %v, want [0 2]", got)
+	}
+	if got := NICs(runDir, "VMC"); len(got) != 0 {
+		t.Errorf("NICs(VMC) = %v, want none", got)
+	}
+}
+
+func TestAddRejectsSecondNIC(t *testing.T) {
+	p := &Passt{conf: &config.Config{RunDir: t.TempDir(), LogDir: t.TempDir(), PasstBinary: "/nonexistent/passt"}}
+	_, err := p.Add(context.Background(), "VMA", &types.VMConfig{}, network.AddSpec{Index: 1})
+	if !errors.Is(err, ErrSingleNIC) {
+		t.Errorf("Add(nic 1) error = %v, want ErrSingleNIC", err)
+	}
+}
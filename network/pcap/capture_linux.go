@@ -0,0 +1,108 @@
+//go:build linux
+
+package pcap
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"golang.org/x/net/bpf"
+	"golang.org/x/sys/unix"
+)
+
+// Capture is an AF_PACKET socket on one link; reads go through the runtime poller, so deadlines and Close unblock them.
+type Capture struct {
+	f *os.File
+}
+
+// Open captures on dev in the calling thread's netns; the socket stays in that netns after the thread leaves it.
+// The filter is attached before the socket is bound, so no unfiltered packet is queued.
+func Open(dev string, filter []bpf.Instruction) (*Capture, error) {
+	link, err := net.InterfaceByName(dev)
+	if err != nil {
+		return nil, fmt.Errorf("link %s: %w", dev, err)
+	}
+	raw, err := bpf.Assemble(filter)
+	if err != nil {
+		return nil, fmt.Errorf("assemble filter: %w", err)
+	}
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW|unix.SOCK_NONBLOCK|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("packet socket: %w", err)
+	}
+	prog := make([]unix.SockFilter, len(raw))
+	for i, ins := range raw {
+		prog[i] = unix.SockFilter{Code: ins.Op, Jt: ins.Jt, Jf: ins.Jf, K: ins.K}
+	}
+	if err = unix.SetsockoptSockFprog(fd, unix.SOL_SOCKET, unix.SO_ATTACH_FILTER, &unix.SockFprog{Len: uint16(len(prog)), Filter: &prog[0]}); err != nil { //nolint:gosec // Compile caps the length
+		_ = unix.Close(fd)
+		return nil, fmt.Errorf("attach filter: %w", err)
+	}
+	if err = unix.Bind(fd, &unix.SockaddrLinklayer{Protocol: htons(unix.ETH_P_ALL), Ifindex: link.Index}); err != nil {
+		_ = unix.Close(fd)
+		return nil, fmt.Errorf("bind %s: %w", dev, err)
+	}
+	return &Capture{f: os.NewFile(uintptr(fd), "pcap-"+dev)}, nil
+}
+
+// Read fills buf with the next packet and returns the captured and original lengths; outbound is true for a packet
+// the link sent (toward the guest on a TAP).
+func (c *Capture) Read(buf []byte) (n, origLen int, outbound bool, err error) {
+	rc, err := c.f.SyscallConn()
+	if err != nil {
+		return 0, 0, false, err
+	}
+	var (
+		from    unix.Sockaddr
+		recvErr error
+	)
+	err = rc.Read(func(fd uintptr) bool {
+		origLen, from, recvErr = unix.Recvfrom(int(fd), buf, unix.MSG_TRUNC)
+		return !errors.Is(recvErr, unix.EAGAIN)
+	})
+	if err == nil {
+		err = recvErr
+	}
+	if err != nil {
+		return 0, 0, false, err
+	}
+	if ll, ok := from.(*unix.SockaddrLinklayer); ok {
+		outbound = ll.Pkttype == unix.PACKET_OUTGOING
+	}
+	return min(origLen, len(buf)), origLen, outbound, nil
+}
+
+// Stats returns the packets received and dropped for lack of buffer space since the previous call.
+func (c *Capture) Stats() (received, dropped uint32, err error) {
+	rc, err := c.f.SyscallConn()
+	if err != nil {
+		return 0, 0, err
+	}
+	var st *unix.TpacketStats
+	ctrlErr := rc.Control(func(fd uintptr) {
+		st, err = unix.GetsockoptTpacketStats(int(fd), unix.SOL_PACKET, unix.PACKET_STATISTICS)
+	})
+	if ctrlErr != nil {
+		return 0, 0, ctrlErr
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("packet statistics: %w", err)
+	}
+	return st.Packets, st.Drops, nil
+}
+
+// SetReadDeadline makes a pending or later Read fail with os.ErrDeadlineExceeded once t passes.
+func (c *Capture) SetReadDeadline(t time.Time) error {
+	return c.f.SetReadDeadline(t)
+}
+
+func (c *Capture) Close() error {
+	return c.f.Close()
+}
+
+func htons(v uint16) uint16 {
+	return v<<8 | v>>8 //nolint:mnd
+}
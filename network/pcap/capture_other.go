@@ -0,0 +1,31 @@
+//go:build !linux
+
+package pcap
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+
+	"golang.org/x/net/bpf"
+)
+
+// Capture: AF_PACKET sockets exist only on Linux.
+type Capture struct{}
+
+// Open: AF_PACKET sockets exist only on Linux.
+func Open(dev string, _ []bpf.Instruction) (*Capture, error) {
+	return nil, fmt.Errorf("capture on %s: requires Linux (running on %s)", dev, runtime.GOOS)
+}
+
+func (c *Capture) Read(_ []byte) (n, origLen int, outbound bool, err error) {
+	return 0, 0, false, fmt.Errorf("capture requires Linux")
+}
+
+func (c *Capture) Stats() (received, dropped uint32, err error) {
+	return 0, 0, fmt.Errorf("capture requires Linux")
+}
+
+func (c *Capture) SetReadDeadline(_ time.Time) error { return nil }
+
+func (c *Capture) Close() error { return nil }
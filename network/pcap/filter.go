@@ -0,0 +1,443 @@
+// Package pcap captures a VM NIC's traffic from its host link: an AF_PACKET socket with a classic BPF filter,
+// written out as a pcapng stream that Wireshark and tcpdump read.
+package pcap
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/bpf"
+)
+
+// Ethernet frame offsets; VLAN tags are not looked through.
+const (
+	offEtherDst  = 0
+	offEtherSrc  = 6
+	offEtherType = 12
+	offL3        = 14
+
+	offIPv4Frag  = offL3 + 6
+	offIPv4Proto = offL3 + 9
+	offIPv4Src   = offL3 + 12
+	offIPv4Dst   = offL3 + 16
+	offARPSrc    = offL3 + 14
+	offARPDst    = offL3 + 24
+	offIPv6Next  = offL3 + 6
+	offIPv6Src   = offL3 + 8
+	offIPv6Dst   = offL3 + 24
+	offIPv6Ports = offL3 + 40
+
+	etherIPv4 = 0x0800
+	etherARP  = 0x0806
+	etherIPv6 = 0x86dd
+
+	protoICMP   = 1
+	protoTCP    = 6
+	protoUDP    = 17
+	protoICMPv6 = 58
+
+	ipv4FragMask = 0x1fff
+
+	// maxSkip is how far a conditional jump reaches; longer filters are refused.
+	maxSkip = 255
+)
+
+// node is a filter expression lowered to comparisons of packet fields.
+type node interface{ isNode() }
+
+type (
+	andNode struct{ l, r node }
+	orNode  struct{ l, r node }
+	notNode struct{ n node }
+	// cmpNode loads a field, optionally masks it, and tests it against val.
+	cmpNode struct {
+		load []bpf.Instruction
+		mask uint32
+		val  uint32
+	}
+)
+
+func (andNode) isNode() {}
+func (orNode) isNode()  {}
+func (notNode) isNode() {}
+func (cmpNode) isNode() {}
+
+// Compile turns a tcpdump-style expression into a classic BPF program over Ethernet frames that keeps snaplen bytes
+// of a matching packet. It accepts only a subset of tcpdump's language: ip, ip6, arp, tcp, udp, icmp, icmp6,
+// [src|dst] host, [src|dst] net, [tcp|udp] [src|dst] port, ether [src|dst] host, joined with and/or/not and
+// parentheses. Any other primitive is an error. An empty expression matches everything.
+func Compile(expr string, snaplen uint32) ([]bpf.Instruction, error) {
+	if strings.TrimSpace(expr) == "" {
+		return []bpf.Instruction{bpf.RetConstant{Val: snaplen}}, nil
+	}
+	p := &parser{toks: tokenize(expr)}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, fmt.Errorf("filter %q: %w", expr, err)
+	}
+	if tok := p.peek(); tok != "" {
+		return nil, fmt.Errorf("filter %q: unexpected %q", expr, tok)
+	}
+	prog, err := assemble(root, snaplen)
+	if err != nil {
+		return nil, fmt.Errorf("filter %q: %w", expr, err)
+	}
+	return prog, nil
+}
+
+func tokenize(expr string) []string {
+	r := strings.NewReplacer("(", " ( ", ")", " ) ", "&&", " and ", "||", " or ", "!", " not ")
+	return strings.Fields(r.Replace(expr))
+}
+
+type parser struct {
+	toks []string
+	pos  int
+}
+
+func (p *parser) peek() string {
+	if p.pos < len(p.toks) {
+		return p.toks[p.pos]
+	}
+	return ""
+}
+
+func (p *parser) next() string {
+	tok := p.peek()
+	if tok != "" {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) parseOr() (node, error) {
+	n, err := p.parseAnd()
+	for err == nil && p.peek() == "or" {
+		p.next()
+		var r node
+		if r, err = p.parseAnd(); err == nil {
+			n = orNode{n, r}
+		}
+	}
+	return n, err
+}
+
+func (p *parser) parseAnd() (node, error) {
+	n, err := p.parseUnary()
+	for err == nil && p.peek() == "and" {
+		p.next()
+		var r node
+		if r, err = p.parseUnary(); err == nil {
+			n = andNode{n, r}
+		}
+	}
+	return n, err
+}
+
+func (p *parser) parseUnary() (node, error) {
+	switch p.peek() {
+	case "not":
+		p.next()
+		n, err := p.parseUnary()
+		return notNode{n}, err
+	case "(":
+		p.next()
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		return n, nil
+	case "":
+		return nil, fmt.Errorf("unexpected end")
+	}
+	return p.parsePrimitive()
+}
+
+// parsePrimitive reads [ether|tcp|udp] [src|dst] [host|net|port] VALUE, or a bare protocol.
+func (p *parser) parsePrimitive() (node, error) {
+	proto := ""
+	switch tok := p.peek(); tok {
+	case "ip", "ip6", "arp", "icmp", "icmp6":
+		p.next()
+		return protoNode(tok), nil
+	case "tcp", "udp", "ether":
+		p.next()
+		proto = tok
+	}
+	dir := ""
+	if tok := p.peek(); tok == "src" || tok == "dst" {
+		dir = p.next()
+	}
+	kind := "host"
+	if tok := p.peek(); tok == "host" || tok == "net" || tok == "port" {
+		kind = p.next()
+	} else if dir == "" {
+		if proto == "tcp" || proto == "udp" {
+			return protoNode(proto), nil
+		}
+		if proto == "ether" {
+			return nil, fmt.Errorf("ether needs [src|dst] host MAC")
+		}
+		return nil, fmt.Errorf("unknown primitive %q", tok)
+	}
+	val := p.next()
+	switch val {
+	case "", "and", "or", "not", "(", ")":
+		return nil, fmt.Errorf("%s needs a value", kind)
+	}
+
+	switch {
+	case proto == "ether":
+		if kind != "host" {
+			return nil, fmt.Errorf("ether %s is not supported", kind)
+		}
+		return etherHostNode(val, dir)
+	case kind == "port":
+		return portNode(val, dir, proto)
+	case proto != "":
+		return nil, fmt.Errorf("%s %s is not supported", proto, kind)
+	case kind == "net":
+		return netNode(val, dir)
+	default:
+		return hostNode(val, dir)
+	}
+}
+
+func field(off, size int) []bpf.Instruction {
+	return []bpf.Instruction{bpf.LoadAbsolute{Off: uint32(off), Size: size}} //nolint:gosec // small constant offsets
+}
+
+func eq(off, size int, val uint32) node {
+	return cmpNode{load: field(off, size), val: val}
+}
+
+func all(nodes ...node) node {
+	n := nodes[0]
+	for _, r := range nodes[1:] {
+		n = andNode{n, r}
+	}
+	return n
+}
+
+func anyOf(nodes ...node) node {
+	n := nodes[0]
+	for _, r := range nodes[1:] {
+		n = orNode{n, r}
+	}
+	return n
+}
+
+// either matches src, dst or both depending on the src/dst qualifier.
+func either(dir string, src, dst node) node {
+	switch dir {
+	case "src":
+		return src
+	case "dst":
+		return dst
+	}
+	return orNode{src, dst}
+}
+
+func protoNode(proto string) node {
+	ipv4, ipv6, arp := eq(offEtherType, 2, etherIPv4), eq(offEtherType, 2, etherIPv6), eq(offEtherType, 2, etherARP)
+	switch proto {
+	case "ip":
+		return ipv4
+	case "ip6":
+		return ipv6
+	case "arp":
+		return arp
+	case "icmp":
+		return all(ipv4, eq(offIPv4Proto, 1, protoICMP))
+	case "icmp6":
+		return all(ipv6, eq(offIPv6Next, 1, protoICMPv6))
+	case "tcp":
+		return anyOf(all(ipv4, eq(offIPv4Proto, 1, protoTCP)), all(ipv6, eq(offIPv6Next, 1, protoTCP)))
+	default: // udp
+		return anyOf(all(ipv4, eq(offIPv4Proto, 1, protoUDP)), all(ipv6, eq(offIPv6Next, 1, protoUDP)))
+	}
+}
+
+func hostNode(val, dir string) (node, error) {
+	addr, err := netip.ParseAddr(val)
+	if err != nil {
+		return nil, fmt.Errorf("host %q: not an IP address", val)
+	}
+	return netNode(netip.PrefixFrom(addr, addr.BitLen()).String(), dir)
+}
+
+// netNode matches an IPv4 prefix against IP and ARP addresses, or an IPv6 prefix against IPv6 ones.
+func netNode(val, dir string) (node, error) {
+	prefix, err := netip.ParsePrefix(val)
+	if err != nil {
+		return nil, fmt.Errorf("net %q: %w", val, err)
+	}
+	prefix = prefix.Masked()
+	addr := prefix.Addr().Unmap().AsSlice()
+	match := func(off int) node {
+		var words []node
+		for i := 0; i < len(addr); i += 4 {
+			bits := min(max(prefix.Bits()-i*8, 0), 32) //nolint:mnd
+			if bits == 0 {
+				break
+			}
+			mask := ^uint32(0) << (32 - bits) //nolint:mnd
+			words = append(words, cmpNode{
+				load: field(off+i, 4),
+				mask: mask,
+				val:  uint32(addr[i])<<24 | uint32(addr[i+1])<<16 | uint32(addr[i+2])<<8 | uint32(addr[i+3]),
+			})
+		}
+		if len(words) == 0 {
+			return eq(offEtherType, 2, etherTypeOf(prefix)) // /0 matches the whole family
+		}
+		return all(words...)
+	}
+	if prefix.Addr().Is4() {
+		return anyOf(
+			all(eq(offEtherType, 2, etherIPv4), either(dir, match(offIPv4Src), match(offIPv4Dst))),
+			all(eq(offEtherType, 2, etherARP), either(dir, match(offARPSrc), match(offARPDst))),
+		), nil
+	}
+	return all(eq(offEtherType, 2, etherIPv6), either(dir, match(offIPv6Src), match(offIPv6Dst))), nil
+}
+
+func etherTypeOf(prefix netip.Prefix) uint32 {
+	if prefix.Addr().Is4() {
+		return etherIPv4
+	}
+	return etherIPv6
+}
+
+// portNode matches TCP or UDP ports; IPv4 non-first fragments carry no ports, IPv6 extension headers are not walked.
+func portNode(val, dir, proto string) (node, error) {
+	port, err := strconv.ParseUint(val, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("port %q: not a port number", val)
+	}
+	protos := []uint32{protoTCP, protoUDP}
+	switch proto {
+	case "tcp":
+		protos = []uint32{protoTCP}
+	case "udp":
+		protos = []uint32{protoUDP}
+	}
+	l4 := func(off int) []node {
+		var out []node
+		for _, p := range protos {
+			out = append(out, eq(off, 1, p))
+		}
+		return out
+	}
+	// The IPv4 header length varies: ldxb 4*([14]&0xf) puts it in X for an indirect load.
+	port4 := func(off int) node {
+		return cmpNode{
+			load: []bpf.Instruction{bpf.LoadMemShift{Off: offL3}, bpf.LoadIndirect{Off: uint32(offL3 + off), Size: 2}}, //nolint:gosec
+			val:  uint32(port),
+		}
+	}
+	v4 := all(
+		eq(offEtherType, 2, etherIPv4),
+		anyOf(l4(offIPv4Proto)...),
+		cmpNode{load: field(offIPv4Frag, 2), mask: ipv4FragMask, val: 0},
+		either(dir, port4(0), port4(2)),
+	)
+	v6 := all(
+		eq(offEtherType, 2, etherIPv6),
+		anyOf(l4(offIPv6Next)...),
+		either(dir, eq(offIPv6Ports, 2, uint32(port)), eq(offIPv6Ports+2, 2, uint32(port))),
+	)
+	return orNode{v4, v6}, nil
+}
+
+func etherHostNode(val, dir string) (node, error) {
+	hw, err := net.ParseMAC(val)
+	if err != nil || len(hw) != 6 { //nolint:mnd
+		return nil, fmt.Errorf("ether host %q: not an Ethernet address", val)
+	}
+	match := func(off int) node {
+		return all(
+			eq(off, 4, uint32(hw[0])<<24|uint32(hw[1])<<16|uint32(hw[2])<<8|uint32(hw[3])),
+			eq(off+4, 2, uint32(hw[4])<<8|uint32(hw[5])),
+		)
+	}
+	return either(dir, match(offEtherSrc), match(offEtherDst)), nil
+}
+
+// assembler lowers the tree to straight-line code: every comparison jumps to the true or false label of its parent,
+// and the program ends in accept/reject returns.
+type assembler struct {
+	prog   []asmInsn
+	labels []int
+}
+
+type asmInsn struct {
+	ins    bpf.Instruction
+	jump   bool
+	val    uint32
+	jt, jf int
+}
+
+func assemble(root node, snaplen uint32) ([]bpf.Instruction, error) {
+	a := &assembler{}
+	accept, reject := a.label(), a.label()
+	a.gen(root, accept, reject)
+	a.place(accept)
+	a.prog = append(a.prog, asmInsn{ins: bpf.RetConstant{Val: snaplen}})
+	a.place(reject)
+	a.prog = append(a.prog, asmInsn{ins: bpf.RetConstant{Val: 0}})
+
+	out := make([]bpf.Instruction, len(a.prog))
+	for i, in := range a.prog {
+		if !in.jump {
+			out[i] = in.ins
+			continue
+		}
+		skipTrue, skipFalse := a.labels[in.jt]-i-1, a.labels[in.jf]-i-1
+		if skipTrue > maxSkip || skipFalse > maxSkip {
+			return nil, fmt.Errorf("too complex: a jump exceeds %d instructions", maxSkip)
+		}
+		out[i] = bpf.JumpIf{Cond: bpf.JumpEqual, Val: in.val, SkipTrue: uint8(skipTrue), SkipFalse: uint8(skipFalse)} //nolint:gosec // bounded above
+	}
+	return out, nil
+}
+
+func (a *assembler) label() int {
+	a.labels = append(a.labels, -1)
+	return len(a.labels) - 1
+}
+
+func (a *assembler) place(l int) {
+	a.labels[l] = len(a.prog)
+}
+
+func (a *assembler) gen(n node, t, f int) {
+	switch n := n.(type) {
+	case andNode:
+		mid := a.label()
+		a.gen(n.l, mid, f)
+		a.place(mid)
+		a.gen(n.r, t, f)
+	case orNode:
+		mid := a.label()
+		a.gen(n.l, t, mid)
+		a.place(mid)
+		a.gen(n.r, t, f)
+	case notNode:
+		a.gen(n.n, f, t)
+	case cmpNode:
+		for _, ins := range n.load {
+			a.prog = append(a.prog, asmInsn{ins: ins})
+		}
+		if n.mask != 0 {
+			a.prog = append(a.prog, asmInsn{ins: bpf.ALUOpConstant{Op: bpf.ALUOpAnd, Val: n.mask}})
+		}
+		a.prog = append(a.prog, asmInsn{jump: true, val: n.val, jt: t, jf: f})
+	}
+}
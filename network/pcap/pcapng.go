@@ -0,0 +1,109 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+// pcapng block types and option codes (draft-ietf-opsawg-pcapng).
+const (
+	blockSHB = 0x0A0D0D0A
+	blockIDB = 0x00000001
+	blockEPB = 0x00000006
+
+	byteOrderMagic = 0x1A2B3C4D
+	linkTypeEther  = 1
+
+	optEnd         = 0
+	optSHBUserAppl = 4
+	optIfName      = 2
+	optIfDesc      = 3
+	optIfTsResol   = 9
+	optEPBFlags    = 2
+
+	tsResolNanos = 9
+
+	// EPB flag direction bits, relative to the captured interface.
+	flagInbound  = 1
+	flagOutbound = 2
+)
+
+// Writer streams a single-interface pcapng section with nanosecond timestamps.
+type Writer struct {
+	w   io.Writer
+	buf []byte
+}
+
+// NewWriter writes the section and interface headers; name and desc become if_name and if_description.
+func NewWriter(w io.Writer, name, desc string, snaplen uint32) (*Writer, error) {
+	pw := &Writer{w: w}
+
+	var shb []byte
+	shb = binary.LittleEndian.AppendUint32(shb, byteOrderMagic)
+	shb = binary.LittleEndian.AppendUint16(shb, 1) // major
+	shb = binary.LittleEndian.AppendUint16(shb, 0) // minor
+	shb = binary.LittleEndian.AppendUint64(shb, ^uint64(0))
+	shb = appendOption(shb, optSHBUserAppl, []byte("cocoon"))
+	shb = appendOption(shb, optEnd, nil)
+	if err := pw.block(blockSHB, shb); err != nil {
+		return nil, err
+	}
+
+	var idb []byte
+	idb = binary.LittleEndian.AppendUint16(idb, linkTypeEther)
+	idb = binary.LittleEndian.AppendUint16(idb, 0)
+	idb = binary.LittleEndian.AppendUint32(idb, snaplen)
+	idb = appendOption(idb, optIfName, []byte(name))
+	idb = appendOption(idb, optIfDesc, []byte(desc))
+	idb = appendOption(idb, optIfTsResol, []byte{tsResolNanos})
+	idb = appendOption(idb, optEnd, nil)
+	if err := pw.block(blockIDB, idb); err != nil {
+		return nil, err
+	}
+	return pw, nil
+}
+
+// WritePacket appends data, captured from a packet of origLen bytes; outbound marks a packet the interface sent.
+func (pw *Writer) WritePacket(ts time.Time, data []byte, origLen int, outbound bool) error {
+	nanos := uint64(ts.UnixNano()) //nolint:gosec // capture times are after 1970
+	flags := uint32(flagInbound)
+	if outbound {
+		flags = flagOutbound
+	}
+	epb := pw.buf[:0]
+	epb = binary.LittleEndian.AppendUint32(epb, 0) // interface id
+	epb = binary.LittleEndian.AppendUint32(epb, uint32(nanos>>32))
+	epb = binary.LittleEndian.AppendUint32(epb, uint32(nanos)) //nolint:gosec // low half
+	epb = binary.LittleEndian.AppendUint32(epb, uint32(len(data)))
+	epb = binary.LittleEndian.AppendUint32(epb, uint32(origLen)) //nolint:gosec
+	epb = append(epb, data...)
+	epb = append(epb, make([]byte, pad4(len(data)))...)
+	epb = appendOption(epb, optEPBFlags, binary.LittleEndian.AppendUint32(nil, flags))
+	epb = appendOption(epb, optEnd, nil)
+	pw.buf = epb
+	return pw.block(blockEPB, epb)
+}
+
+// block frames body with the type and the leading and trailing total length.
+func (pw *Writer) block(typ uint32, body []byte) error {
+	total := uint32(12 + len(body)) //nolint:mnd,gosec // type + 2 lengths
+	var b []byte
+	b = binary.LittleEndian.AppendUint32(b, typ)
+	b = binary.LittleEndian.AppendUint32(b, total)
+	b = append(b, body...)
+	b = binary.LittleEndian.AppendUint32(b, total)
+	_, err := pw.w.Write(b)
+	return err
+}
+
+func appendOption(b []byte, code uint16, val []byte) []byte {
+	b = binary.LittleEndian.AppendUint16(b, code)
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(val))) //nolint:gosec // short strings
+	b = append(b, val...)
+	return append(b, make([]byte, pad4(len(val)))...)
+}
+
+func pad4(n int) int {
+	return (4 - n%4) % 4 //nolint:mnd
+}
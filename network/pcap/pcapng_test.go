@@ -0,0 +1,92 @@
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// readBlocks splits a pcapng stream into (type, body) pairs, checking that both length fields agree.
+func readBlocks(t *testing.T, b []byte) (types []uint32, bodies [][]byte) {
+	t.Helper()
+	for len(b) > 0 {
+		if len(b) < 12 {
+			t.Fatalf("truncated block: % x", b)
+		}
+		total := binary.LittleEndian.Uint32(b[4:8])
+		if total%4 != 0 || int(total) > len(b) || binary.LittleEndian.Uint32(b[total-4:total]) != total {
+			t.Fatalf("bad block length %d", total)
+		}
+		types = append(types, binary.LittleEndian.Uint32(b[:4]))
+		bodies = append(bodies, b[8:total-4])
+		b = b[total:]
+	}
+	return types, bodies
+}
+
+// options decodes an option list into code → value.
+func options(b []byte) map[uint16][]byte {
+	out := map[uint16][]byte{}
+	for len(b) >= 4 {
+		code, n := binary.LittleEndian.Uint16(b), int(binary.LittleEndian.Uint16(b[2:]))
+		if code == optEnd {
+			break
+		}
+		out[code] = b[4 : 4+n]
+		b = b[4+n+pad4(n):]
+	}
+	return out
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, "tap0", "vm web (vm-a) nic 0", 262144)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := time.Unix(1700000000, 123456789)
+	if err = w.WritePacket(ts, []byte{1, 2, 3, 4, 5}, 60, true); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.WritePacket(ts, []byte{6, 7, 8, 9}, 4, false); err != nil {
+		t.Fatal(err)
+	}
+
+	types, bodies := readBlocks(t, buf.Bytes())
+	if len(types) != 4 || types[0] != blockSHB || types[1] != blockIDB || types[2] != blockEPB || types[3] != blockEPB {
+		t.Fatalf("block types %x", types)
+	}
+	if binary.LittleEndian.Uint32(bodies[0]) != byteOrderMagic {
+		t.Error("bad byte-order magic")
+	}
+
+	idb := bodies[1]
+	if binary.LittleEndian.Uint16(idb) != linkTypeEther || binary.LittleEndian.Uint32(idb[4:]) != 262144 {
+		t.Errorf("idb header % x", idb[:8])
+	}
+	opts := options(idb[8:])
+	if string(opts[optIfName]) != "tap0" || string(opts[optIfDesc]) != "vm web (vm-a) nic 0" || !bytes.Equal(opts[optIfTsResol], []byte{tsResolNanos}) {
+		t.Errorf("idb options %q", opts)
+	}
+
+	for i, want := range []struct {
+		data     []byte
+		origLen  uint32
+		outbound bool
+	}{{[]byte{1, 2, 3, 4, 5}, 60, true}, {[]byte{6, 7, 8, 9}, 4, false}} {
+		epb := bodies[2+i]
+		nanos := uint64(binary.LittleEndian.Uint32(epb[4:]))<<32 | uint64(binary.LittleEndian.Uint32(epb[8:]))
+		capLen := binary.LittleEndian.Uint32(epb[12:])
+		if nanos != uint64(ts.UnixNano()) || capLen != uint32(len(want.data)) || binary.LittleEndian.Uint32(epb[16:]) != want.origLen {
+			t.Errorf("epb %d header % x", i, epb[:20])
+		}
+		if !bytes.Equal(epb[20:20+capLen], want.data) {
+			t.Errorf("epb %d data % x", i, epb[20:20+capLen])
+		}
+		flags := binary.LittleEndian.Uint32(options(epb[20+int(capLen)+pad4(int(capLen)):])[optEPBFlags])
+		if (flags == flagOutbound) != want.outbound {
+			t.Errorf("epb %d flags %d", i, flags)
+		}
+	}
+}
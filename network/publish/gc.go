@@ -0,0 +1,83 @@
+package publish
+
+import (
+	"bufio"
+	"context"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/projecteru2/core/log"
+
+	"github.com/cocoonstack/cocoon/gc"
+	"github.com/cocoonstack/cocoon/lock/flock"
+	"github.com/cocoonstack/cocoon/utils"
+)
+
+const typ = "publish"
+
+// publishSnapshot holds the VM IDs that own a cocoon_pub_* table.
+type publishSnapshot struct {
+	vmIDs []string
+}
+
+// GCModule returns a GC module that drops port-publish tables whose VM no longer exists (e.g. rm interrupted between
+// the record delete and the unpublish). Hosts without nft have nothing to collect.
+func GCModule(rootDir string) gc.Module[publishSnapshot] {
+	lockPath := filepath.Join(rootDir, typ, "gc.lock")
+	_ = utils.EnsureDirs(filepath.Dir(lockPath))
+
+	return gc.Module[publishSnapshot]{
+		Name:   typ,
+		Locker: flock.New(lockPath),
+		ReadDB: func(ctx context.Context) (publishSnapshot, error) {
+			if _, err := exec.LookPath("nft"); err != nil {
+				return publishSnapshot{}, nil
+			}
+			out, err := exec.CommandContext(ctx, "nft", "list", "tables", "ip").Output()
+			if err != nil {
+				return publishSnapshot{}, err
+			}
+			return publishSnapshot{vmIDs: parseTables(string(out))}, nil
+		},
+		Resolve: func(_ context.Context, snap publishSnapshot, others map[string]any) []string {
+			active := gc.Collect(others, gc.VMIDs)
+			var orphans []string
+			for _, id := range snap.vmIDs {
+				if _, ok := active[id]; !ok {
+					orphans = append(orphans, id)
+				}
+			}
+			slices.Sort(orphans)
+			return orphans
+		},
+		Collect: func(ctx context.Context, ids []string, _ publishSnapshot) error {
+			logger := log.WithFunc("gc.publish")
+			for _, id := range ids {
+				if err := Remove(ctx, id); err != nil {
+					logger.Warnf(ctx, "delete orphan table %s: %v", Table(id), err)
+				} else {
+					logger.Infof(ctx, "collected id=%s table=%s reason=orphan-publish", id, Table(id))
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// parseTables extracts VM IDs from `nft list tables ip` output ("table ip cocoon_pub_<id>" per line).
+func parseTables(out string) []string {
+	var ids []string
+	sc := bufio.NewScanner(strings.NewReader(out))
+	for sc.Scan() {
+		f := strings.Fields(sc.Text())
+		if len(f) != 3 || f[0] != "table" || f[1] != "ip" {
+			continue
+		}
+		if id, ok := strings.CutPrefix(f[2], tablePrefix); ok && id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,229 @@
+// Package publish exposes guest ports on host addresses (--publish, `vm port`) with one nftables table per VM,
+// so a VM's rules are replaced or dropped atomically without touching anyone else's.
+package publish
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/cocoonstack/cocoon/types"
+)
+
+// tablePrefix names the per-VM table (family ip): cocoon_pub_<vmID>.
+const tablePrefix = "cocoon_pub_"
+
+// ErrNoGuestIP means the VM has no host-known IPv4 to DNAT to (bridge/DHCP NICs, --nics 0).
+var ErrNoGuestIP = errors.New("vm has no CNI-assigned IPv4 address")
+
+// Table returns the nftables table holding vmID's rules.
+func Table(vmID string) string {
+	return tablePrefix + vmID
+}
+
+// Parse reads "[hostIP:]hostPort:guestPort[/tcp|udp]"; the protocol defaults to tcp.
+func Parse(spec string) (types.PortMapping, error) {
+	m, parts, err := parseSpec(spec)
+	if err != nil {
+		return m, err
+	}
+	switch len(parts) {
+	case 2:
+	case 3:
+		if m.HostIP, err = parseHostIP(spec, parts[0]); err != nil {
+			return m, err
+		}
+		parts = parts[1:]
+	default:
+		return m, fmt.Errorf("--publish %q: want [HOST_IP:]HOST_PORT:GUEST_PORT[/tcp|udp]", spec)
+	}
+	if m.HostPort, err = parsePort(parts[0]); err != nil {
+		return m, fmt.Errorf("--publish %q: host port: %w", spec, err)
+	}
+	if m.GuestPort, err = parsePort(parts[1]); err != nil {
+		return m, fmt.Errorf("--publish %q: guest port: %w", spec, err)
+	}
+	return m, nil
+}
+
+// ParseHost reads the host side alone, "[hostIP:]hostPort[/tcp|udp]", as `vm port rm` accepts; GuestPort stays 0.
+func ParseHost(spec string) (types.PortMapping, error) {
+	m, parts, err := parseSpec(spec)
+	if err != nil {
+		return m, err
+	}
+	switch len(parts) {
+	case 1:
+	case 2:
+		if m.HostIP, err = parseHostIP(spec, parts[0]); err != nil {
+			return m, err
+		}
+		parts = parts[1:]
+	default:
+		return m, fmt.Errorf("port %q: want [HOST_IP:]HOST_PORT[/tcp|udp]", spec)
+	}
+	if m.HostPort, err = parsePort(parts[0]); err != nil {
+		return m, fmt.Errorf("port %q: %w", spec, err)
+	}
+	return m, nil
+}
+
+// CheckDNAT rejects mappings nftables cannot DNAT to a VM: loopback host addresses. passt binds those itself.
+func CheckDNAT(ports []types.PortMapping) error {
+	for _, m := range ports {
+		if ip := net.ParseIP(m.HostIP); ip != nil && ip.IsLoopback() {
+			return fmt.Errorf("--publish %s: loopback cannot be DNATed to a VM, use --passt or `cocoon vm port-forward`", m)
+		}
+	}
+	return nil
+}
+
+// ParseAll parses every spec in order.
+func ParseAll(specs []string) ([]types.PortMapping, error) {
+	var out []types.PortMapping
+	for _, s := range specs {
+		m, err := Parse(s)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+// GuestNetwork returns the DNAT target: the first NIC with a primary IPv4. Publishing is IPv4-only, so a VM whose
+// NICs only carry IPv6 gets an error that says so rather than a bare ErrNoGuestIP.
+func GuestNetwork(vm *types.VM) (*types.Network, error) {
+	ipv6Only := false
+	for _, nc := range vm.NetworkConfigs {
+		if nc == nil || nc.Network == nil {
+			continue
+		}
+		if nc.Network.IP != "" {
+			return nc.Network, nil
+		}
+		ipv6Only = ipv6Only || len(nc.Network.Addresses) > 0
+	}
+	if ipv6Only {
+		return nil, fmt.Errorf("%w: its NICs are IPv6-only and ports are published over IPv4 only", ErrNoGuestIP)
+	}
+	return nil, ErrNoGuestIP
+}
+
+// Ruleset renders an nft script that atomically replaces vmID's table. Traffic to a local host address is DNATed
+// in prerouting (remote clients) and output (host processes); guests on the same subnet reaching a published port
+// are masqueraded so replies hairpin back through the host.
+func Ruleset(vmID string, guest *types.Network, ports []types.PortMapping) string {
+	var b strings.Builder
+	table := Table(vmID)
+	// Declaring before deleting makes the delete safe when the table does not exist yet.
+	fmt.Fprintf(&b, "table ip %s\ndelete table ip %s\n", table, table)
+	if len(ports) == 0 {
+		return b.String()
+	}
+
+	// Host processes dialing 127.0.0.0/8 are left alone: a loopback source cannot be routed to the guest.
+	dnatRules := func(local string) string {
+		var r strings.Builder
+		for _, p := range ports {
+			match := local
+			if p.HostIP != "" {
+				match = "ip daddr " + p.HostIP
+			}
+			fmt.Fprintf(&r, "\t\t%s %s dport %d dnat to %s:%d\n", match, p.Protocol, p.HostPort, guest.IP, p.GuestPort)
+		}
+		return r.String()
+	}
+	fmt.Fprintf(&b, "table ip %s {\n", table)
+	fmt.Fprintf(&b, "\tchain prerouting {\n\t\ttype nat hook prerouting priority dstnat; policy accept;\n%s\t}\n",
+		dnatRules("fib daddr type local"))
+	fmt.Fprintf(&b, "\tchain output {\n\t\ttype nat hook output priority -100; policy accept;\n%s\t}\n",
+		dnatRules("ip daddr != 127.0.0.0/8 fib daddr type local"))
+	if subnet := guestSubnet(guest); subnet != "" {
+		fmt.Fprintf(&b, "\tchain postrouting {\n\t\ttype nat hook postrouting priority srcnat; policy accept;\n"+
+			"\t\tip saddr %s ip daddr %s ct status dnat masquerade\n\t}\n", subnet, guest.IP)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// Apply installs ports for vmID toward guest, replacing whatever the VM had; no ports removes the table.
+func Apply(ctx context.Context, vmID string, guest *types.Network, ports []types.PortMapping) error {
+	if len(ports) == 0 {
+		return Remove(ctx, vmID)
+	}
+	if err := runNft(ctx, Ruleset(vmID, guest, ports)); err != nil {
+		return fmt.Errorf("publish ports for %s: %w", vmID, err)
+	}
+	return nil
+}
+
+// Remove drops vmID's table. Without an nft binary nothing can have been installed, so that is not an error.
+func Remove(ctx context.Context, vmID string) error {
+	if _, err := exec.LookPath("nft"); err != nil {
+		return nil
+	}
+	if err := runNft(ctx, Ruleset(vmID, nil, nil)); err != nil {
+		return fmt.Errorf("unpublish ports for %s: %w", vmID, err)
+	}
+	return nil
+}
+
+func runNft(ctx context.Context, script string) error {
+	cmd := exec.CommandContext(ctx, "nft", "-f", "-")
+	cmd.Stdin = strings.NewReader(script)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("nft: %w: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// parseSpec splits off the protocol and returns the colon-separated address/port fields.
+func parseSpec(spec string) (types.PortMapping, []string, error) {
+	m := types.PortMapping{Protocol: types.ProtocolTCP}
+	ports, proto, hasProto := strings.Cut(spec, "/")
+	if hasProto {
+		if proto != types.ProtocolTCP && proto != types.ProtocolUDP {
+			return m, nil, fmt.Errorf("--publish %q: protocol must be tcp or udp", spec)
+		}
+		m.Protocol = proto
+	}
+	// An IPv6 host address would otherwise be split on its colons into a confusing field-count error.
+	if strings.HasPrefix(ports, "[") || strings.Count(ports, ":") > 2 {
+		return m, nil, fmt.Errorf("--publish %q: IPv6 host addresses are not supported, ports are published over IPv4 only", spec)
+	}
+	return m, strings.Split(ports, ":"), nil
+}
+
+func parseHostIP(spec, s string) (string, error) {
+	ip := net.ParseIP(s)
+	if ip == nil || ip.To4() == nil {
+		return "", fmt.Errorf("--publish %q: host address must be IPv4", spec)
+	}
+	return ip.String(), nil
+}
+
+func guestSubnet(n *types.Network) string {
+	if n.Prefix <= 0 || n.Prefix > 32 {
+		return ""
+	}
+	_, subnet, err := net.ParseCIDR(n.IP + "/" + strconv.Itoa(n.Prefix))
+	if err != nil {
+		return ""
+	}
+	return subnet.String()
+}
+
+func parsePort(s string) (int, error) {
+	p, err := strconv.Atoi(s)
+	if err != nil || p < 1 || p > 65535 {
+		return 0, fmt.Errorf("invalid port %q (want 1-65535)", s)
+	}
+	return p, nil
+}
@@ -0,0 +1,130 @@
+package publish
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cocoonstack/cocoon/types"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    types.PortMapping
+		wantErr string
+	}{
+		{spec: "8080:80", want: types.PortMapping{HostPort: 8080, GuestPort: 80, Protocol: "tcp"}},
+		{spec: "5353:53/udp", want: types.PortMapping{HostPort: 5353, GuestPort: 53, Protocol: "udp"}},
+		{spec: "192.168.1.10:2222:22/tcp", want: types.PortMapping{HostIP: "192.168.1.10", HostPort: 2222, GuestPort: 22, Protocol: "tcp"}},
+
+		{spec: "80", wantErr: "want [HOST_IP:]HOST_PORT:GUEST_PORT"},
+		{spec: "8080:80/sctp", wantErr: "tcp or udp"},
+		{spec: "0:80", wantErr: "host port"},
+		{spec: "8080:65536", wantErr: "guest port"},
+		{spec: "::1:8080:80", wantErr: "IPv6"},
+		{spec: "[fd00::1]:8080:80", wantErr: "IPv6"},
+		{spec: "127.0.0.1:5353:53/udp", want: types.PortMapping{HostIP: "127.0.0.1", HostPort: 5353, GuestPort: 53, Protocol: "udp"}},
+		{spec: "host:8080:80", wantErr: "IPv4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := Parse(tt.spec)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Parse(%q) error = %v, want containing %q", tt.spec, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.spec, err)
+			}
+			if got != tt.want {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.spec, got, tt.want)
+			}
+			if back, _ := Parse(got.String()); back != got {
+				t.Errorf("Parse(String()) = %+v, want round trip of %+v", back, got)
+			}
+		})
+	}
+}
+
+func TestParseHost(t *testing.T) {
+	got, err := ParseHost("10.0.0.1:53/udp")
+	if want := (types.PortMapping{HostIP: "10.0.0.1", HostPort: 53, Protocol: "udp"}); err != nil || got != want {
+		t.Errorf("ParseHost = %+v, %v; want %+v", got, err, want)
+	}
+	if _, err = ParseHost("8080:80"); err == nil {
+		t.Error("ParseHost must reject a guest port (the first field is not an address)")
+	}
+}
+
+func TestCheckDNAT(t *testing.T) {
+	ok := []types.PortMapping{{HostPort: 8080, GuestPort: 80, Protocol: "tcp"}, {HostIP: "192.168.1.10", HostPort: 2222, GuestPort: 22, Protocol: "tcp"}}
+	if err := CheckDNAT(ok); err != nil {
+		t.Errorf("CheckDNAT(%v): %v", ok, err)
+	}
+	lo := append(ok, types.PortMapping{HostIP: "127.0.0.1", HostPort: 5353, GuestPort: 53, Protocol: "udp"})
+	if err := CheckDNAT(lo); err == nil || !strings.Contains(err.Error(), "port-forward") {
+		t.Errorf("CheckDNAT(loopback) = %v, want a port-forward hint", err)
+	}
+}
+
+func TestGuestNetwork(t *testing.T) {
+	v4 := &types.Network{IP: "10.22.0.5", Prefix: 24}
+	v6 := &types.Network{Addresses: []types.Address{{IP: "fd00::5", Prefix: 64}}}
+	vm := &types.VM{}
+	vm.NetworkConfigs = []*types.NetworkConfig{{Network: v6}, {Network: v4}}
+	if got, err := GuestNetwork(vm); err != nil || got != v4 {
+		t.Errorf("GuestNetwork(v6, v4) = %+v, %v; want the IPv4 NIC", got, err)
+	}
+	vm.NetworkConfigs = []*types.NetworkConfig{{Network: v6}}
+	if _, err := GuestNetwork(vm); !errors.Is(err, ErrNoGuestIP) || !strings.Contains(err.Error(), "IPv6-only") {
+		t.Errorf("GuestNetwork(v6 only) error = %v, want ErrNoGuestIP naming IPv6-only", err)
+	}
+	vm.NetworkConfigs = nil
+	if _, err := GuestNetwork(vm); !errors.Is(err, ErrNoGuestIP) {
+		t.Errorf("GuestNetwork(no NICs) error = %v, want ErrNoGuestIP", err)
+	}
+}
+
+func TestRuleset(t *testing.T) {
+	guest := &types.Network{IP: "10.88.0.5", Prefix: 16, Gateway: "10.88.0.1"}
+	ports := []types.PortMapping{
+		{HostPort: 8080, GuestPort: 80, Protocol: "tcp"},
+		{HostIP: "192.168.1.10", HostPort: 5353, GuestPort: 53, Protocol: "udp"},
+	}
+	want := `table ip cocoon_pub_VM1
+delete table ip cocoon_pub_VM1
+table ip cocoon_pub_VM1 {
+	chain prerouting {
+		type nat hook prerouting priority dstnat; policy accept;
+		fib daddr type local tcp dport 8080 dnat to 10.88.0.5:80
+		ip daddr 192.168.1.10 udp dport 5353 dnat to 10.88.0.5:53
+	}
+	chain output {
+		type nat hook output priority -100; policy accept;
+		ip daddr != 127.0.0.0/8 fib daddr type local tcp dport 8080 dnat to 10.88.0.5:80
+		ip daddr 192.168.1.10 udp dport 5353 dnat to 10.88.0.5:53
+	}
+	chain postrouting {
+		type nat hook postrouting priority srcnat; policy accept;
+		ip saddr 10.88.0.0/16 ip daddr 10.88.0.5 ct status dnat masquerade
+	}
+}
+`
+	if got := Ruleset("VM1", guest, ports); got != want {
+		t.Errorf("Ruleset mismatch\ngot:\n%s\nwant:\n%s", got, want)
+	}
+	if got := Ruleset("VM1", nil, nil); got != "table ip cocoon_pub_VM1\ndelete table ip cocoon_pub_VM1\n" {
+		t.Errorf("empty Ruleset must only drop the table, got:\n%s", got)
+	}
+}
+
+func TestParseTables(t *testing.T) {
+	out := "table ip nat\ntable ip cocoon_pub_ABC\ntable ip cocoon_pub_\ntable ip6 cocoon_pub_DEF\ntable ip cocoon_pub_XYZ\n"
+	if got, want := parseTables(out), []string{"ABC", "XYZ"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("parseTables = %v, want %v", got, want)
+	}
+}
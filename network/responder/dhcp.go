@@ -0,0 +1,220 @@
+// Package responder holds the wire formats of the per-bridge DHCP/DNS responder: DHCPv4 replies for the static
+// leases cocoon allocates on a managed bridge, and DNS answers for VM names. Sockets and name lookup live with the
+// callers (network/bridge, network/discovery); beyond packets, this package only has the DNS serve loop they share.
+package responder
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// DHCP message types (option 53).
+const (
+	DHCPDiscover byte = 1
+	DHCPOffer    byte = 2
+	DHCPRequest  byte = 3
+	DHCPDecline  byte = 4
+	DHCPAck      byte = 5
+	DHCPNak      byte = 6
+	DHCPRelease  byte = 7
+	DHCPInform   byte = 8
+)
+
+const (
+	bootRequest byte = 1
+	bootReply   byte = 2
+
+	// fixedLen is the BOOTP header up to and including the magic cookie.
+	fixedLen    = 240
+	magicCookie = 0x63825363
+	flagBcast   = 0x8000
+
+	optPad         byte = 0
+	optSubnetMask  byte = 1
+	optRouter      byte = 3
+	optDNS         byte = 6
+	optHostname    byte = 12
+	optDomainName  byte = 15
+	optBroadcast   byte = 28
+	optRequestedIP byte = 50
+	optLeaseTime   byte = 51
+	optMsgType     byte = 53
+	optServerID    byte = 54
+	optRenewal     byte = 58
+	optRebinding   byte = 59
+	optEnd         byte = 255
+)
+
+// Message is the part of a client's DHCPv4 request the responder acts on.
+type Message struct {
+	XID         uint32
+	Flags       uint16
+	CIAddr      net.IP
+	GIAddr      net.IP
+	CHAddr      net.HardwareAddr
+	Type        byte
+	RequestedIP net.IP // option 50
+	ServerID    net.IP // option 54
+}
+
+// Lease is the configuration handed to one client.
+type Lease struct {
+	IP       net.IP
+	Mask     net.IPMask
+	Router   net.IP
+	DNS      []net.IP
+	Domain   string
+	Hostname string
+	Duration time.Duration
+}
+
+// ParseDHCP decodes a BOOTREQUEST; malformed or non-Ethernet packets are rejected.
+func ParseDHCP(b []byte) (*Message, error) {
+	if len(b) < fixedLen {
+		return nil, fmt.Errorf("dhcp: short packet (%d bytes)", len(b))
+	}
+	if b[0] != bootRequest || b[1] != 1 || b[2] != 6 { //nolint:mnd // htype ethernet, hlen 6
+		return nil, errors.New("dhcp: not an ethernet BOOTREQUEST")
+	}
+	if binary.BigEndian.Uint32(b[236:240]) != magicCookie {
+		return nil, errors.New("dhcp: missing magic cookie")
+	}
+	m := &Message{
+		XID:    binary.BigEndian.Uint32(b[4:8]),
+		Flags:  binary.BigEndian.Uint16(b[10:12]),
+		CIAddr: net.IP(append([]byte(nil), b[12:16]...)),
+		GIAddr: net.IP(append([]byte(nil), b[24:28]...)),
+		CHAddr: net.HardwareAddr(append([]byte(nil), b[28:34]...)),
+	}
+	for opts := b[fixedLen:]; len(opts) > 0; {
+		code := opts[0]
+		if code == optEnd {
+			break
+		}
+		if code == optPad {
+			opts = opts[1:]
+			continue
+		}
+		if len(opts) < 2 || len(opts) < 2+int(opts[1]) {
+			return nil, fmt.Errorf("dhcp: option %d overruns packet", code)
+		}
+		val := opts[2 : 2+opts[1]]
+		switch {
+		case code == optMsgType && len(val) == 1:
+			m.Type = val[0]
+		case code == optRequestedIP && len(val) == net.IPv4len:
+			m.RequestedIP = net.IP(append([]byte(nil), val...))
+		case code == optServerID && len(val) == net.IPv4len:
+			m.ServerID = net.IP(append([]byte(nil), val...))
+		}
+		opts = opts[2+len(val):]
+	}
+	if m.Type == 0 {
+		return nil, errors.New("dhcp: no message type")
+	}
+	return m, nil
+}
+
+// Respond answers req from server with lease, the client's reservation (nil when the MAC has none). It returns the
+// reply type (0 = stay silent): an offer for a discover, and for a request an ACK when the client asks for its
+// reserved address or a NAK when it asks for another. Requests addressed to another server are ignored.
+func Respond(req *Message, server net.IP, lease *Lease) byte {
+	if lease == nil {
+		return 0
+	}
+	switch req.Type {
+	case DHCPDiscover:
+		return DHCPOffer
+	case DHCPRequest:
+		if req.ServerID != nil && !req.ServerID.Equal(server) {
+			return 0
+		}
+		want := req.RequestedIP
+		if want == nil && !req.CIAddr.IsUnspecified() {
+			want = req.CIAddr
+		}
+		if want != nil && !want.Equal(lease.IP) {
+			return DHCPNak
+		}
+		return DHCPAck
+	}
+	return 0
+}
+
+// BuildReply encodes a reply of type typ to req; lease may be nil for a NAK.
+func BuildReply(req *Message, typ byte, server net.IP, lease *Lease) []byte {
+	b := make([]byte, fixedLen)
+	b[0] = bootReply
+	b[1], b[2] = 1, 6 //nolint:mnd // htype ethernet, hlen 6
+	binary.BigEndian.PutUint32(b[4:8], req.XID)
+	binary.BigEndian.PutUint16(b[10:12], req.Flags)
+	copy(b[24:28], req.GIAddr.To4())
+	copy(b[28:34], req.CHAddr)
+	binary.BigEndian.PutUint32(b[236:240], magicCookie)
+
+	b = appendOpt(b, optMsgType, typ)
+	b = appendOpt(b, optServerID, server.To4()...)
+	if typ != DHCPNak && lease != nil {
+		copy(b[12:16], req.CIAddr.To4())
+		copy(b[16:20], lease.IP.To4())
+		secs := uint32(lease.Duration / time.Second)
+		b = appendOpt(b, optLeaseTime, binary.BigEndian.AppendUint32(nil, secs)...)
+		b = appendOpt(b, optRenewal, binary.BigEndian.AppendUint32(nil, secs/2)...)     //nolint:mnd // T1 = 50%
+		b = appendOpt(b, optRebinding, binary.BigEndian.AppendUint32(nil, secs/8*7)...) //nolint:mnd // T2 = 87.5%
+		b = appendOpt(b, optSubnetMask, lease.Mask...)
+		if bcast := broadcast(lease.IP, lease.Mask); bcast != nil {
+			b = appendOpt(b, optBroadcast, bcast...)
+		}
+		if lease.Router != nil {
+			b = appendOpt(b, optRouter, lease.Router.To4()...)
+		}
+		var dns []byte
+		for _, ip := range lease.DNS {
+			dns = append(dns, ip.To4()...)
+		}
+		if len(dns) > 0 {
+			b = appendOpt(b, optDNS, dns...)
+		}
+		if lease.Domain != "" {
+			b = appendOpt(b, optDomainName, []byte(lease.Domain)...)
+		}
+		if lease.Hostname != "" {
+			b = appendOpt(b, optHostname, []byte(lease.Hostname)...)
+		}
+	}
+	b = append(b, optEnd)
+	for len(b) < 300 { //nolint:mnd // BOOTP minimum length some clients enforce
+		b = append(b, optPad)
+	}
+	return b
+}
+
+// Broadcast reports whether the reply must be broadcast: the client has no address to receive unicast on yet,
+// asked for broadcast, or is being refused. Broadcasting instead of unicasting to an unconfigured client's MAC spares
+// a raw socket; every client accepts it.
+func Broadcast(req *Message, typ byte) bool {
+	return typ == DHCPNak || req.Flags&flagBcast != 0 || req.CIAddr.IsUnspecified()
+}
+
+func appendOpt(b []byte, code byte, val ...byte) []byte {
+	for len(val) > 255 { //nolint:mnd
+		b = append(append(b, code, 255), val[:255]...)
+		val = val[255:]
+	}
+	return append(append(b, code, byte(len(val))), val...)
+}
+
+func broadcast(ip net.IP, mask net.IPMask) net.IP {
+	v4 := ip.To4()
+	if v4 == nil || len(mask) != net.IPv4len {
+		return nil
+	}
+	out := make(net.IP, net.IPv4len)
+	for i := range out {
+		out[i] = v4[i] | ^mask[i]
+	}
+	return out
+}
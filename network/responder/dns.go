@@ -0,0 +1,84 @@
+package responder
+
+import (
+	"net"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Domain is the zone VM names are served under; bare single-label names resolve too.
+const Domain = "cocoon.internal"
+
+const answerTTL = 30 // seconds; short so a re-created VM's new address shows up quickly
+
+// Resolver maps a VM name to its IPv4 address, nil when no VM has that name.
+type Resolver func(name string) net.IP
+
+// Answer builds the reply to a DNS query for names resolve knows. It returns forward=true when the query is for a
+// name outside cocoon's zone, which the caller relays upstream untouched. Malformed queries get no reply.
+func Answer(query []byte, resolve Resolver) (reply []byte, forward bool) {
+	var p dnsmessage.Parser
+	hdr, err := p.Start(query)
+	if err != nil || hdr.Response {
+		return nil, false
+	}
+	q, err := p.Question()
+	if err != nil {
+		return nil, false
+	}
+	name, inZone := vmName(q.Name.String())
+	if name == "" || q.Class != dnsmessage.ClassINET {
+		return nil, true
+	}
+	ip := resolve(name).To4()
+	if ip == nil && !inZone {
+		// An unknown bare name may still be a single-label host upstream knows.
+		return nil, true
+	}
+
+	rcode := dnsmessage.RCodeSuccess
+	if ip == nil {
+		rcode = dnsmessage.RCodeNameError
+	}
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{
+		ID:                 hdr.ID,
+		Response:           true,
+		Authoritative:      true,
+		RecursionDesired:   hdr.RecursionDesired,
+		RecursionAvailable: true,
+		RCode:              rcode,
+	})
+	b.EnableCompression()
+	if err = b.StartQuestions(); err != nil {
+		return nil, false
+	}
+	if err = b.Question(q); err != nil {
+		return nil, false
+	}
+	if ip != nil && (q.Type == dnsmessage.TypeA || q.Type == dnsmessage.TypeALL) {
+		if err = b.StartAnswers(); err != nil {
+			return nil, false
+		}
+		rh := dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: answerTTL}
+		if err = b.AResource(rh, dnsmessage.AResource{A: [4]byte(ip)}); err != nil {
+			return nil, false
+		}
+	}
+	reply, err = b.Finish()
+	if err != nil {
+		return nil, false
+	}
+	return reply, false
+}
+
+// vmName extracts the VM name from a query name: "web." yields "web", and "web.cocoon.internal." yields "web" with
+// inZone set, which makes an unknown name authoritative NXDOMAIN. Other names yield "".
+func vmName(fqdn string) (name string, inZone bool) {
+	name = strings.ToLower(strings.TrimSuffix(fqdn, "."))
+	name, inZone = strings.CutSuffix(name, "."+Domain)
+	if name == "" || strings.Contains(name, ".") {
+		return "", false
+	}
+	return name, inZone
+}
@@ -0,0 +1,189 @@
+package responder
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+var (
+	server = net.IPv4(192, 168, 100, 1).To4()
+	mac    = net.HardwareAddr{0x52, 0x54, 0x00, 0x12, 0x34, 0x56}
+	lease  = &Lease{
+		IP:       net.IPv4(192, 168, 100, 7).To4(),
+		Mask:     net.CIDRMask(24, 32),
+		Router:   server,
+		DNS:      []net.IP{server},
+		Domain:   Domain,
+		Hostname: "web",
+		Duration: time.Hour,
+	}
+)
+
+// request builds a client BOOTREQUEST with options opts (code, value pairs).
+func request(ciaddr net.IP, opts ...[]byte) []byte {
+	b := make([]byte, fixedLen)
+	b[0], b[1], b[2] = bootRequest, 1, 6
+	binary.BigEndian.PutUint32(b[4:8], 0xdeadbeef)
+	copy(b[12:16], ciaddr.To4())
+	copy(b[28:34], mac)
+	binary.BigEndian.PutUint32(b[236:240], magicCookie)
+	for _, o := range opts {
+		b = append(b, o[0], byte(len(o)-1))
+		b = append(b, o[1:]...)
+	}
+	return append(b, optEnd)
+}
+
+func opt(code byte, val ...byte) []byte { return append([]byte{code}, val...) }
+
+func TestParseDHCP(t *testing.T) {
+	m, err := ParseDHCP(request(net.IPv4zero, opt(optMsgType, DHCPRequest), []byte{optPad}, opt(optRequestedIP, 192, 168, 100, 7), opt(optServerID, server...)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Type != DHCPRequest || m.XID != 0xdeadbeef || m.CHAddr.String() != mac.String() ||
+		!m.RequestedIP.Equal(lease.IP) || !m.ServerID.Equal(server) {
+		t.Errorf("parsed %+v", m)
+	}
+
+	for name, pkt := range map[string][]byte{
+		"short":       make([]byte, 100),
+		"no type":     request(net.IPv4zero),
+		"overrun":     append(request(net.IPv4zero)[:fixedLen], optMsgType, 5, 1),
+		"reply":       func() []byte { b := request(net.IPv4zero, opt(optMsgType, DHCPDiscover)); b[0] = bootReply; return b }(),
+		"no cookie":   func() []byte { b := request(net.IPv4zero, opt(optMsgType, DHCPDiscover)); b[236] = 0; return b }(),
+		"infiniband":  func() []byte { b := request(net.IPv4zero, opt(optMsgType, DHCPDiscover)); b[1] = 32; return b }(),
+		"long hwaddr": func() []byte { b := request(net.IPv4zero, opt(optMsgType, DHCPDiscover)); b[2] = 20; return b }(),
+	} {
+		if _, err := ParseDHCP(pkt); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestRespond(t *testing.T) {
+	other := net.IPv4(192, 168, 100, 99).To4()
+	tests := []struct {
+		name  string
+		req   []byte
+		lease *Lease
+		want  byte
+	}{
+		{name: "discover", req: request(net.IPv4zero, opt(optMsgType, DHCPDiscover)), lease: lease, want: DHCPOffer},
+		{name: "unknown mac", req: request(net.IPv4zero, opt(optMsgType, DHCPDiscover))},
+		{name: "select", req: request(net.IPv4zero, opt(optMsgType, DHCPRequest), opt(optRequestedIP, lease.IP...), opt(optServerID, server...)), lease: lease, want: DHCPAck},
+		{name: "select other server", req: request(net.IPv4zero, opt(optMsgType, DHCPRequest), opt(optRequestedIP, lease.IP...), opt(optServerID, other...)), lease: lease},
+		{name: "init-reboot wrong address", req: request(net.IPv4zero, opt(optMsgType, DHCPRequest), opt(optRequestedIP, other...)), lease: lease, want: DHCPNak},
+		{name: "renew", req: request(lease.IP, opt(optMsgType, DHCPRequest)), lease: lease, want: DHCPAck},
+		{name: "renew stale address", req: request(other, opt(optMsgType, DHCPRequest)), lease: lease, want: DHCPNak},
+		{name: "release", req: request(lease.IP, opt(optMsgType, DHCPRelease)), lease: lease},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := ParseDHCP(tt.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := Respond(m, server, tt.lease); got != tt.want {
+				t.Errorf("Respond = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildReply(t *testing.T) {
+	req, _ := ParseDHCP(request(net.IPv4zero, opt(optMsgType, DHCPDiscover)))
+	b := BuildReply(req, DHCPOffer, server, lease)
+	if b[0] != bootReply || binary.BigEndian.Uint32(b[4:8]) != 0xdeadbeef || !net.IP(b[16:20]).Equal(lease.IP) ||
+		net.HardwareAddr(b[28:34]).String() != mac.String() {
+		t.Fatalf("bad header % x", b[:34])
+	}
+	opts := map[byte][]byte{}
+	for o := b[fixedLen:]; len(o) > 0 && o[0] != optEnd; o = o[2+o[1]:] {
+		opts[o[0]] = o[2 : 2+o[1]]
+	}
+	for code, want := range map[byte]string{
+		optMsgType:    string([]byte{DHCPOffer}),
+		optServerID:   string(server),
+		optSubnetMask: string(net.CIDRMask(24, 32)),
+		optRouter:     string(server),
+		optDNS:        string(server),
+		optBroadcast:  string(net.IPv4(192, 168, 100, 255).To4()),
+		optLeaseTime:  string(binary.BigEndian.AppendUint32(nil, 3600)),
+		optDomainName: Domain,
+		optHostname:   "web",
+	} {
+		if string(opts[code]) != want {
+			t.Errorf("option %d = % x, want % x", code, opts[code], want)
+		}
+	}
+	if !Broadcast(req, DHCPOffer) {
+		t.Error("offer to an unconfigured client should be broadcast")
+	}
+
+	nak := BuildReply(req, DHCPNak, server, nil)
+	if !net.IP(nak[16:20]).Equal(net.IPv4zero) || nak[fixedLen+2] != DHCPNak {
+		t.Errorf("bad NAK % x", nak[:fixedLen+3])
+	}
+}
+
+func TestAnswer(t *testing.T) {
+	resolve := func(name string) net.IP {
+		if name == "web" {
+			return lease.IP
+		}
+		return nil
+	}
+	tests := []struct {
+		name        string
+		qname       string
+		qtype       dnsmessage.Type
+		wantForward bool
+		wantRCode   dnsmessage.RCode
+		wantA       net.IP
+	}{
+		{name: "bare name", qname: "web.", qtype: dnsmessage.TypeA, wantA: lease.IP},
+		{name: "in zone, any case", qname: "WEB.cocoon.internal.", qtype: dnsmessage.TypeA, wantA: lease.IP},
+		{name: "aaaa is empty", qname: "web.cocoon.internal.", qtype: dnsmessage.TypeAAAA},
+		{name: "unknown in zone", qname: "db.cocoon.internal.", qtype: dnsmessage.TypeA, wantRCode: dnsmessage.RCodeNameError},
+		{name: "unknown bare name", qname: "db.", qtype: dnsmessage.TypeA, wantForward: true},
+		{name: "outside zone", qname: "example.com.", qtype: dnsmessage.TypeA, wantForward: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: 42, RecursionDesired: true})
+			_ = b.StartQuestions()
+			_ = b.Question(dnsmessage.Question{Name: dnsmessage.MustNewName(tt.qname), Type: tt.qtype, Class: dnsmessage.ClassINET})
+			query, _ := b.Finish()
+
+			reply, forward := Answer(query, resolve)
+			if forward != tt.wantForward {
+				t.Fatalf("forward = %v, want %v", forward, tt.wantForward)
+			}
+			if forward {
+				return
+			}
+			var msg dnsmessage.Message
+			if err := msg.Unpack(reply); err != nil {
+				t.Fatal(err)
+			}
+			if msg.ID != 42 || !msg.Response || !msg.Authoritative || msg.RCode != tt.wantRCode {
+				t.Errorf("header %+v", msg.Header)
+			}
+			switch {
+			case tt.wantA == nil && len(msg.Answers) != 0:
+				t.Errorf("unexpected answers %v", msg.Answers)
+			case tt.wantA != nil && (len(msg.Answers) != 1 || !net.IP(msg.Answers[0].Body.(*dnsmessage.AResource).A[:]).Equal(tt.wantA)):
+				t.Errorf("answers %v, want A %s", msg.Answers, tt.wantA)
+			}
+		})
+	}
+
+	if _, forward := Answer([]byte{1, 2, 3}, resolve); forward {
+		t.Error("malformed query forwarded")
+	}
+}
@@ -0,0 +1,74 @@
+package responder
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/projecteru2/core/log"
+)
+
+const (
+	upstreamTimeout = 2 * time.Second
+	packetBufSize   = 1500
+	// maxForwards caps upstream relays in flight; queries beyond it are dropped, as an overloaded resolver would.
+	maxForwards = 64
+)
+
+// Filter reports whether a query from client may be answered.
+type Filter func(client net.Addr) bool
+
+// ServeDNS answers queries on conn for the names resolve knows and relays the rest to upstreams, until conn fails
+// or ctx ends. Queries that allow rejects are dropped unanswered; a nil allow answers every client.
+func ServeDNS(ctx context.Context, conn net.PacketConn, resolve Resolver, upstreams []string, allow Filter) {
+	logger := log.WithFunc("responder.ServeDNS")
+	forwards := make(chan struct{}, maxForwards)
+	for {
+		buf := make([]byte, packetBufSize)
+		n, client, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Warnf(ctx, "read: %v", err)
+			}
+			return
+		}
+		if allow != nil && !allow(client) {
+			continue
+		}
+		reply, forward := Answer(buf[:n], resolve)
+		switch {
+		case forward:
+			select {
+			case forwards <- struct{}{}:
+				go func() {
+					defer func() { <-forwards }()
+					forwardDNS(conn, client, buf[:n], upstreams)
+				}()
+			default:
+			}
+		case reply != nil:
+			_, _ = conn.WriteTo(reply, client)
+		}
+	}
+}
+
+// forwardDNS relays query to the first upstream that answers and passes the answer back unchanged.
+func forwardDNS(conn net.PacketConn, client net.Addr, query []byte, upstreams []string) {
+	buf := make([]byte, 65535) //nolint:mnd
+	for _, up := range upstreams {
+		c, err := net.DialTimeout("udp", net.JoinHostPort(up, "53"), upstreamTimeout)
+		if err != nil {
+			continue
+		}
+		_ = c.SetDeadline(time.Now().Add(upstreamTimeout))
+		n := 0
+		if _, err = c.Write(query); err == nil {
+			n, err = c.Read(buf)
+		}
+		_ = c.Close()
+		if err == nil {
+			_, _ = conn.WriteTo(buf[:n], client)
+			return
+		}
+	}
+}
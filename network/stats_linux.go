@@ -0,0 +1,54 @@
+//go:build linux
+
+package network
+
+import (
+	"fmt"
+
+	cns "github.com/containernetworking/plugins/pkg/ns"
+	"github.com/vishvananda/netlink"
+
+	"github.com/cocoonstack/cocoon/types"
+)
+
+// NICStats reads nc's counters from its host link, inside nc's netns when it has one. A TAP receives what the guest
+// sends, so its counters are swapped; a macvtap already counts from the guest's side.
+func NICStats(nc *types.NetworkConfig) (types.NICStats, error) {
+	var ls *netlink.LinkStatistics
+	read := func() error {
+		link, err := netlink.LinkByName(nc.TAP)
+		if err != nil {
+			return fmt.Errorf("link %s: %w", nc.TAP, err)
+		}
+		if ls = link.Attrs().Statistics; ls == nil {
+			return fmt.Errorf("link %s: no statistics", nc.TAP)
+		}
+		return nil
+	}
+	var err error
+	if nc.NetnsPath == "" {
+		err = read()
+	} else {
+		err = cns.WithNetNSPath(nc.NetnsPath, func(_ cns.NetNS) error { return read() })
+	}
+	if err != nil {
+		return types.NICStats{}, err
+	}
+
+	s := types.NICStats{
+		MAC:       nc.MAC,
+		Device:    nc.TAP,
+		RxBytes:   ls.TxBytes,
+		RxPackets: ls.TxPackets,
+		RxDropped: ls.TxDropped,
+		TxBytes:   ls.RxBytes,
+		TxPackets: ls.RxPackets,
+		TxDropped: ls.RxDropped,
+	}
+	if nc.Backend == types.BackendMacvtap {
+		s.RxBytes, s.TxBytes = s.TxBytes, s.RxBytes
+		s.RxPackets, s.TxPackets = s.TxPackets, s.RxPackets
+		s.RxDropped, s.TxDropped = s.TxDropped, s.RxDropped
+	}
+	return s, nil
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package network
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/cocoonstack/cocoon/types"
+)
+
+// NICStats: host link counters are read over netlink, Linux only.
+func NICStats(nc *types.NetworkConfig) (types.NICStats, error) {
+	return types.NICStats{}, fmt.Errorf("link %s: requires Linux (running on %s)", nc.TAP, runtime.GOOS)
+}
@@ -1,6 +1,10 @@
 package network
 
-import "cmp"
+import (
+	"cmp"
+	"crypto/rand"
+	"net"
+)
 
 const (
 	vmIDPrefixLen = 8
@@ -31,3 +35,11 @@ func VMIDPrefix(vmID string) string {
 	}
 	return vmID
 }
+
+// GenerateMAC returns a random locally administered unicast MAC address.
+func GenerateMAC() string {
+	buf := make([]byte, 6) //nolint:mnd
+	_, _ = rand.Read(buf)
+	buf[0] = (buf[0] | 0x02) & 0xfe
+	return net.HardwareAddr(buf).String()
+}
@@ -0,0 +1,187 @@
+// Package vhostuser is the userspace-switch network provider: each NIC is a port on a local OVS-DPDK (or other
+// vhost-user) switch, reached by Cloud Hypervisor over a vhost-user socket. Cocoon does not talk to the switch
+// itself; the executable in vhost_user_hook creates and removes the ports:
+//
+//	HOOK add VM_ID NIC MAC QUEUES SOCKET
+//	    Create the NIC's port. Print nothing when the switch connects to SOCKET, which CH creates (e.g. an OVS
+//	    dpdkvhostuserclient port); otherwise print the path of the socket the switch listens on, the same on
+//	    every call for that NIC.
+//	HOOK del VM_ID [NIC]
+//	    Remove the NIC's port, or every port of the VM; succeed when there is none.
+//	HOOK check VM_ID NIC
+//	    Exit 0 when the NIC's port exists.
+package vhostuser
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/projecteru2/core/log"
+
+	"github.com/cocoonstack/cocoon/config"
+	"github.com/cocoonstack/cocoon/gc"
+	"github.com/cocoonstack/cocoon/network"
+	"github.com/cocoonstack/cocoon/types"
+	"github.com/cocoonstack/cocoon/utils"
+)
+
+const typ = types.BackendVhostUser
+
+var _ network.Network = (*VhostUser)(nil)
+
+// VhostUser delegates port management to the hook; the sockets CH serves live in RunDir/vhost-user.
+type VhostUser struct {
+	conf *config.Config
+}
+
+// New checks that the hook is configured and executable.
+func New(conf *config.Config) (*VhostUser, error) {
+	if conf == nil {
+		return nil, fmt.Errorf("config is nil")
+	}
+	if conf.VhostUserHook == "" {
+		return nil, fmt.Errorf("vhost_user_hook is not configured")
+	}
+	if _, err := exec.LookPath(conf.VhostUserHook); err != nil {
+		return nil, fmt.Errorf("vhost-user hook %q: %w", conf.VhostUserHook, err)
+	}
+	if err := utils.EnsureDirs(filepath.Join(conf.RunDir, typ)); err != nil {
+		return nil, err
+	}
+	return &VhostUser{conf: conf}, nil
+}
+
+func (v *VhostUser) Type() string { return typ }
+
+// Verify asks the hook whether the VM's first port exists.
+func (v *VhostUser) Verify(ctx context.Context, vmID string) error {
+	_, err := v.hook(ctx, "check", vmID, "0")
+	return err
+}
+
+// Prepare is a no-op (vhost-user has no netns).
+func (v *VhostUser) Prepare(_ context.Context, _ string, _ *types.VMConfig) (string, error) {
+	return "", nil
+}
+
+// Add has the hook create a port per spec; on recovery it re-creates a port the switch lost, with the same MAC.
+func (v *VhostUser) Add(ctx context.Context, vmID string, vmCfg *types.VMConfig, specs ...network.AddSpec) (configs []*types.NetworkConfig, retErr error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	logger := log.WithFunc("vhostuser.Add")
+
+	added := make([]int, 0, len(specs))
+	defer func() {
+		if retErr != nil {
+			_ = v.Remove(context.WithoutCancel(ctx), vmID, added...)
+		}
+	}()
+	configs = make([]*types.NetworkConfig, 0, len(specs))
+	for _, spec := range specs {
+		mac := network.GenerateMAC()
+		switch {
+		case spec.Request != nil && (spec.Request.IP != "" || spec.Request.Network != "" || spec.Request.Bridge != ""):
+			return nil, fmt.Errorf("nic %d: vhost-user NICs take only mac=: the switch owns the address", spec.Index)
+		case spec.Existing != nil:
+			mac = spec.Existing.MAC
+		case spec.Request != nil && spec.Request.MAC != "":
+			mac = spec.Request.MAC
+		}
+		queues := network.NetNumQueues(vmCfg.CPU)
+		sock := v.socket(vmID, spec.Index)
+		_ = os.Remove(sock)
+		out, err := v.hook(ctx, "add", vmID, strconv.Itoa(spec.Index), mac, strconv.Itoa(queues), sock)
+		if err != nil {
+			return nil, fmt.Errorf("nic %d: %w", spec.Index, err)
+		}
+		added = append(added, spec.Index)
+
+		nc := &types.NetworkConfig{
+			MAC:         mac,
+			NumQueues:   queues,
+			QueueSize:   network.ResolveQueueSize(vmCfg.QueueSize),
+			Backend:     typ,
+			VhostSocket: sock,
+			VhostMode:   types.VhostServer,
+		}
+		if out != "" {
+			nc.VhostSocket, nc.VhostMode = out, ""
+		}
+		configs = append(configs, nc)
+		logger.Debugf(ctx, "NIC %d: vhost-user socket=%s mode=%s mac=%s", spec.Index, nc.VhostSocket, nc.VhostMode, mac)
+	}
+	return configs, nil
+}
+
+func (v *VhostUser) Remove(ctx context.Context, vmID string, indices ...int) error {
+	for _, i := range indices {
+		if _, err := v.hook(ctx, "del", vmID, strconv.Itoa(i)); err != nil {
+			return fmt.Errorf("nic %d: %w", i, err)
+		}
+		_ = os.Remove(v.socket(vmID, i))
+	}
+	return nil
+}
+
+func (v *VhostUser) Delete(ctx context.Context, vmIDs []string) ([]string, error) {
+	return Cleanup(ctx, v.conf, vmIDs), nil
+}
+
+// Inspect: the switch holds the records.
+func (v *VhostUser) Inspect(_ context.Context, _ string) (*types.Network, error) {
+	return nil, nil
+}
+
+// List: the switch holds the records.
+func (v *VhostUser) List(_ context.Context) ([]*types.Network, error) {
+	return nil, nil
+}
+
+// RegisterGC is a no-op: the hook cannot enumerate its ports, so rm removes them.
+func (v *VhostUser) RegisterGC(_ *gc.Orchestrator) {}
+
+// Cleanup has the hook remove every port of vmIDs and drops their sockets; it returns the VMs it cleaned.
+func Cleanup(ctx context.Context, conf *config.Config, vmIDs []string) []string {
+	if conf.VhostUserHook == "" {
+		return nil
+	}
+	v := &VhostUser{conf: conf}
+	cleaned := make([]string, 0, len(vmIDs))
+	for _, vmID := range vmIDs {
+		if _, err := v.hook(ctx, "del", vmID); err != nil {
+			log.WithFunc("vhostuser.Cleanup").Warnf(ctx, "remove ports of %s: %v", vmID, err)
+			continue
+		}
+		socks, _ := filepath.Glob(filepath.Join(conf.RunDir, typ, vmID+"-*.sock"))
+		for _, s := range socks {
+			_ = os.Remove(s)
+		}
+		cleaned = append(cleaned, vmID)
+	}
+	return cleaned
+}
+
+// hook runs the vhost-user hook and returns its trimmed stdout.
+func (v *VhostUser) hook(ctx context.Context, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, v.conf.VhostUserHook, args...) //nolint:gosec
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("vhost-user hook %s: %w: %s", args[0], err, msg)
+		}
+		return "", fmt.Errorf("vhost-user hook %s: %w", args[0], err)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+func (v *VhostUser) socket(vmID string, nic int) string {
+	return filepath.Join(v.conf.RunDir, typ, fmt.Sprintf("%s-%d.sock", vmID, nic))
+}
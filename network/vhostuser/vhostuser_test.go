@@ -0,0 +1,111 @@
+package vhostuser
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cocoonstack/cocoon/config"
+	"github.com/cocoonstack/cocoon/network"
+	"github.com/cocoonstack/cocoon/types"
+)
+
+// stubHook stands in for a switch: it logs each call, reports ports of VM "known" as present, and prints
+// $STUB_LISTEN from add when the switch should own the socket.
+const stubHook = `#!/bin/sh
+echo "$@" >> "$(dirname "$0")/calls"
+case "$1" in
+add) [ "$3" = 9 ] && { echo "no such port" >&2; exit 1; }; echo "$STUB_LISTEN" ;;
+check) [ "$2" = known ] ;;
+esac
+`
+
+func newStub(t *testing.T) (*VhostUser, func() []string) {
+	t.Helper()
+	dir := t.TempDir()
+	hook := filepath.Join(dir, "hook")
+	if err := os.WriteFile(hook, []byte(stubHook), 0o755); err != nil { //nolint:gosec
+		t.Fatal(err)
+	}
+	conf := &config.Config{RunDir: filepath.Join(dir, "run"), VhostUserHook: hook}
+	v, err := New(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := func() []string {
+		raw, _ := os.ReadFile(filepath.Join(dir, "calls"))
+		return strings.Split(strings.TrimSpace(string(raw)), "\n")
+	}
+	return v, calls
+}
+
+func TestAdd(t *testing.T) {
+	v, calls := newStub(t)
+	cfg := &types.VMConfig{Config: types.Config{CPU: 2}}
+	configs, err := v.Add(t.Context(), "vm1", cfg,
+		network.AddSpec{Index: 0, Existing: &types.NetworkConfig{MAC: "52:54:00:00:00:01"}},
+		network.AddSpec{Index: 1, Request: &types.NICSpec{MAC: "52:54:00:00:00:02"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, nc := range configs {
+		if nc.Backend != typ || nc.VhostMode != types.VhostServer || nc.VhostSocket != v.socket("vm1", i) || nc.NumQueues != 4 {
+			t.Errorf("nic %d: %+v", i, nc)
+		}
+	}
+	want := []string{
+		"add vm1 0 52:54:00:00:00:01 4 " + v.socket("vm1", 0),
+		"add vm1 1 52:54:00:00:00:02 4 " + v.socket("vm1", 1),
+	}
+	if got := calls(); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("hook calls %q, want %q", got, want)
+	}
+
+	t.Setenv("STUB_LISTEN", "/var/run/openvswitch/vhu0")
+	configs, err = v.Add(t.Context(), "vm1", cfg, network.AddSpec{Index: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nc := configs[0]; nc.VhostSocket != "/var/run/openvswitch/vhu0" || nc.VhostMode != "" {
+		t.Errorf("switch-owned socket: %+v", nc)
+	}
+}
+
+func TestAddRollback(t *testing.T) {
+	v, calls := newStub(t)
+	_, err := v.Add(t.Context(), "vm1", &types.VMConfig{Config: types.Config{CPU: 1}},
+		network.AddSpec{Index: 0},
+		network.AddSpec{Index: 9},
+	)
+	if err == nil || !strings.Contains(err.Error(), "no such port") {
+		t.Fatalf("want the hook's stderr in the error, got %v", err)
+	}
+	if got := calls(); len(got) != 3 || got[2] != "del vm1 0" {
+		t.Errorf("hook calls %q, want the added port removed", got)
+	}
+
+	if _, err = v.Add(t.Context(), "vm1", &types.VMConfig{}, network.AddSpec{Request: &types.NICSpec{IP: "10.0.0.2"}}); err == nil {
+		t.Error("expected ip= to be refused")
+	}
+}
+
+func TestVerifyAndCleanup(t *testing.T) {
+	v, calls := newStub(t)
+	if err := v.Verify(t.Context(), "known"); err != nil {
+		t.Errorf("Verify(known): %v", err)
+	}
+	if err := v.Verify(t.Context(), "gone"); err == nil {
+		t.Error("Verify(gone): expected error")
+	}
+	if got := Cleanup(t.Context(), v.conf, []string{"a", "b"}); strings.Join(got, ",") != "a,b" {
+		t.Errorf("Cleanup = %v", got)
+	}
+	if got := calls(); strings.Join(got[2:], "|") != "del a|del b" {
+		t.Errorf("hook calls %q", got)
+	}
+	if got := Cleanup(t.Context(), &config.Config{}, []string{"a"}); got != nil {
+		t.Errorf("Cleanup without a hook = %v", got)
+	}
+}
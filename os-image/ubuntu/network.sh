@@ -17,15 +17,39 @@ case "$1" in prereqs) prereqs; exit 0 ;; esac
 # $rootmnt is set by initramfs — points to the mounted root filesystem.
 [ -z "$rootmnt" ] && exit 0
 
-# Set hostname from cocoon.hostname= kernel parameter.
+_dns_servers=""
+_dns6=""
+_addrs=""
+_gws6=""
+_has_static=false
+
+# Set hostname from cocoon.hostname= kernel parameter; collect the IPv6 / extra
+# address parameters that ip= cannot carry (cocoon.addr=ethN,CIDR,
+# cocoon.gw6=ethN,GW, cocoon.dns6=A[,B]).
 for _arg in $(cat /proc/cmdline); do
     case "$_arg" in
         cocoon.hostname=*) echo "${_arg#cocoon.hostname=}" > "${rootmnt}/etc/hostname" ;;
+        cocoon.addr=*) _addrs="${_addrs} ${_arg#cocoon.addr=}" ;;
+        cocoon.gw6=*) _gws6="${_gws6} ${_arg#cocoon.gw6=}" ;;
+        cocoon.dns6=*) _dns6=$(echo "${_arg#cocoon.dns6=}" | tr ',' ' ') ;;
     esac
 done
 
-_dns_servers=""
-_has_static=false
+_written=""
+
+# network_file DEVICE points $_f at the MAC-matched .network file for DEVICE.
+# A file not yet written this boot (an IPv6-only NIC has no ip=) is started
+# fresh so reboots of the persistent rootfs don't stack duplicate lines.
+network_file() {
+    [ -e "/sys/class/net/$1/address" ] || return 1
+    _mac=$(cat "/sys/class/net/$1/address")
+    _f="${rootmnt}/etc/systemd/network/10-$(echo "$_mac" | tr -d ':').network"
+    case " $_written " in *" $_f "*) return 0 ;; esac
+    mkdir -p "${rootmnt}/etc/systemd/network"
+    printf "[Match]\nMACAddress=%s\n\n[Network]\n" "$_mac" > "$_f"
+    for _ns in $_dns6; do printf "DNS=%s\n" "$_ns" >> "$_f"; done
+    _written="${_written} ${_f}"
+}
 
 for conf_file in /run/net-*.conf; do
     [ -f "$conf_file" ] || continue
@@ -69,11 +93,13 @@ EOF
         [ -n "$IPV4GATEWAY" ] && [ "$IPV4GATEWAY" != "0.0.0.0" ] && printf "Gateway=%s\n" "$IPV4GATEWAY"
         [ -n "$IPV4DNS0" ] && [ "$IPV4DNS0" != "0.0.0.0" ] && printf "DNS=%s\n" "$IPV4DNS0"
         [ -n "$IPV4DNS1" ] && [ "$IPV4DNS1" != "0.0.0.0" ] && printf "DNS=%s\n" "$IPV4DNS1"
+        for _ns in $_dns6; do printf "DNS=%s\n" "$_ns"; done
         # Fallback DNS if none provided.
-        if [ -z "$IPV4DNS0" ] || [ "$IPV4DNS0" = "0.0.0.0" ]; then
+        if { [ -z "$IPV4DNS0" ] || [ "$IPV4DNS0" = "0.0.0.0" ]; } && [ -z "$_dns6" ]; then
             printf "DNS=8.8.8.8\nDNS=8.8.4.4\n"
         fi
     } > "${rootmnt}/etc/systemd/network/10-${mac_sanitized}.network"
+    _written="${_written} ${rootmnt}/etc/systemd/network/10-${mac_sanitized}.network"
 
     # Collect DNS servers for resolv.conf.
     [ -n "$IPV4DNS0" ] && [ "$IPV4DNS0" != "0.0.0.0" ] && _dns_servers="${_dns_servers} ${IPV4DNS0}"
@@ -81,6 +107,19 @@ EOF
 
 done
 
+# Append IPv6 and secondary addresses, then IPv6 default gateways; both are
+# "ethN,VALUE" and net.ifnames=0 keeps the ethN names stable in initramfs.
+for _entry in $_addrs; do
+    network_file "${_entry%%,*}" || continue
+    _has_static=true
+    printf "Address=%s\n" "${_entry#*,}" >> "$_f"
+done
+for _entry in $_gws6; do
+    network_file "${_entry%%,*}" || continue
+    printf "Gateway=%s\n" "${_entry#*,}" >> "$_f"
+done
+[ -n "$_dns6" ] && _dns_servers="${_dns_servers} ${_dns6}"
+
 # Fallback: no kernel ip= configured — write DHCP config per NIC matched by MAC.
 # This covers macvlan / external DHCP scenarios where CNI does not assign IPs.
 if [ "$_has_static" = false ]; then
@@ -96,7 +135,7 @@ if [ "$_has_static" = false ]; then
         case "$mac" in ""|00:00:00:00:00:00) continue ;; esac
         mac_sanitized=$(echo "$mac" | tr -d ':')
         {
-            printf "[Match]\nMACAddress=%s\n\n[Network]\nDHCP=ipv4\n\n[DHCPv4]\nClientIdentifier=mac\n" "$mac"
+            printf "[Match]\nMACAddress=%s\n\n[Network]\nDHCP=yes\n\n[DHCPv4]\nClientIdentifier=mac\n\n[DHCPv6]\nDUIDType=link-layer\n" "$mac"
         } > "${rootmnt}/etc/systemd/network/10-${mac_sanitized}.network"
     done
 fi
@@ -0,0 +1,22 @@
+package snapshot
+
+// Phase represents a stage in the snapshot export lifecycle.
+type Phase int
+
+const (
+	PhaseExport Phase = iota // Export started; file count and logical size known.
+	PhaseFile                // A data file has been written into the archive.
+	PhaseWrite               // Periodic archive output update.
+	PhaseDone                // Archive fully written.
+)
+
+// Event describes a single snapshot export progress update.
+type Event struct {
+	Phase      Phase
+	File       string // Data file name (file phase only).
+	Index      int    // File index (0-based); -1 for non-file phases.
+	Total      int    // Total number of data files.
+	BytesTotal int64  // Logical size of all data files (holes included).
+	BytesDone  int64  // Logical bytes of data files written so far.
+	BytesOut   int64  // Archive bytes emitted so far, after compression/encryption.
+}
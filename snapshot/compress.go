@@ -0,0 +1,167 @@
+package snapshot
+
+import (
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/cocoonstack/cocoon/utils"
+)
+
+// Compression algorithms accepted by ParseCompression.
+const (
+	CompressNone = "none"
+	CompressGzip = "gzip"
+	CompressZstd = "zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// Compression selects the export stream codec; the zero value means uncompressed. Level 0 picks the codec default.
+type Compression struct {
+	Algo  string
+	Level int
+}
+
+// ParseCompression parses "none", "gzip[:1-9]" or "zstd[:1-22]".
+func ParseCompression(spec string) (Compression, error) {
+	algo, levelStr, hasLevel := strings.Cut(strings.ToLower(strings.TrimSpace(spec)), ":")
+	c := Compression{Algo: algo}
+	switch algo {
+	case "", CompressNone:
+		if hasLevel {
+			return Compression{}, fmt.Errorf("compression %q takes no level", spec)
+		}
+		return Compression{}, nil
+	case CompressGzip, CompressZstd:
+	default:
+		return Compression{}, fmt.Errorf("unknown compression %q (want none, gzip[:level] or zstd[:level])", spec)
+	}
+	if !hasLevel {
+		return c, nil
+	}
+	level, err := strconv.Atoi(levelStr)
+	if err != nil {
+		return Compression{}, fmt.Errorf("compression level %q: %w", levelStr, err)
+	}
+	maxLevel := gzip.BestCompression
+	if algo == CompressZstd {
+		maxLevel = 22
+	}
+	if level < 1 || level > maxLevel {
+		return Compression{}, fmt.Errorf("%s level %d out of range 1..%d", algo, level, maxLevel)
+	}
+	c.Level = level
+	return c, nil
+}
+
+// Enabled reports whether c compresses at all.
+func (c Compression) Enabled() bool {
+	return c.Algo != "" && c.Algo != CompressNone
+}
+
+// Ext is the file suffix appended after ".tar" for this codec.
+func (c Compression) Ext() string {
+	switch c.Algo {
+	case CompressGzip:
+		return ".gz"
+	case CompressZstd:
+		return ".zst"
+	}
+	return ""
+}
+
+// Wrap returns a compressing writer over w; concurrency caps zstd encoder goroutines (gzip is single-threaded). Close flushes but leaves w open.
+func (c Compression) Wrap(w io.Writer, concurrency int) (io.WriteCloser, error) {
+	switch c.Algo {
+	case CompressGzip:
+		gw, err := gzip.NewWriterLevel(w, cmp.Or(c.Level, gzip.BestSpeed))
+		if err != nil {
+			return nil, fmt.Errorf("create gzip writer: %w", err)
+		}
+		return gw, nil
+	case CompressZstd:
+		opts := []zstd.EOption{zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(cmp.Or(c.Level, 3)))}
+		if concurrency > 0 {
+			opts = append(opts, zstd.WithEncoderConcurrency(concurrency))
+		}
+		zw, err := zstd.NewWriter(w, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("create zstd writer: %w", err)
+		}
+		return zw, nil
+	}
+	return nopWriteCloser{w}, nil
+}
+
+// DecompressReader is the codec reader returned by Decompress.
+type DecompressReader struct {
+	io.Reader
+	// Codec is CompressGzip, CompressZstd, or empty for plaintext input.
+	Codec   string
+	release func()
+}
+
+// Decompress sniffs gzip/zstd magic and unwraps r; plaintext passes through. concurrency caps zstd decoder goroutines.
+func Decompress(r io.Reader, concurrency int) (*DecompressReader, error) {
+	head, full, err := utils.PeekReader(r, len(zstdMagic))
+	if err != nil {
+		return nil, fmt.Errorf("peek archive header: %w", err)
+	}
+	if len(head) < len(gzipMagic) {
+		return nil, errors.New("peek archive header: stream shorter than gzip magic (2 bytes)")
+	}
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		gr, gzErr := gzip.NewReader(full)
+		if gzErr != nil {
+			return nil, fmt.Errorf("decompress gzip: %w", gzErr)
+		}
+		return &DecompressReader{Reader: gr, Codec: CompressGzip, release: func() { _ = gr.Close() }}, nil
+	case bytes.HasPrefix(head, zstdMagic):
+		var opts []zstd.DOption
+		if concurrency > 0 {
+			opts = append(opts, zstd.WithDecoderConcurrency(concurrency))
+		}
+		zr, zErr := zstd.NewReader(full, opts...)
+		if zErr != nil {
+			return nil, fmt.Errorf("decompress zstd: %w", zErr)
+		}
+		return &DecompressReader{Reader: zr, Codec: CompressZstd, release: zr.Close}, nil
+	}
+	return &DecompressReader{Reader: full}, nil
+}
+
+// Verify drains the codec to EOF so its trailing checksum (gzip CRC32, zstd frame hash) is checked even though tar stops at its end marker.
+func (d *DecompressReader) Verify() error {
+	if d.Codec == "" {
+		return nil
+	}
+	if _, err := io.Copy(io.Discard, d.Reader); err != nil {
+		return fmt.Errorf("decompress integrity check: %w", err)
+	}
+	return nil
+}
+
+// Close releases codec resources (zstd decoder goroutines) without reading further; safe to call more than once.
+func (d *DecompressReader) Close() error {
+	if d.release != nil {
+		d.release()
+		d.release = nil
+	}
+	return nil
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
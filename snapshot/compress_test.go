@@ -0,0 +1,76 @@
+package snapshot
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestParseCompression(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    Compression
+		wantErr bool
+	}{
+		{spec: "", want: Compression{}},
+		{spec: "none", want: Compression{}},
+		{spec: "gzip", want: Compression{Algo: CompressGzip}},
+		{spec: "gzip:9", want: Compression{Algo: CompressGzip, Level: 9}},
+		{spec: "ZSTD:19", want: Compression{Algo: CompressZstd, Level: 19}},
+		{spec: "zstd", want: Compression{Algo: CompressZstd}},
+		{spec: "gzip:10", wantErr: true},
+		{spec: "zstd:0", wantErr: true},
+		{spec: "zstd:fast", wantErr: true},
+		{spec: "none:1", wantErr: true},
+		{spec: "lz4", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseCompression(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseCompression(%q) err = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseCompression(%q) = %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestCompressionRoundtrip(t *testing.T) {
+	payload := bytes.Repeat([]byte("cocoon snapshot "), 64<<10)
+	for _, c := range []Compression{{}, {Algo: CompressGzip}, {Algo: CompressZstd, Level: 1}} {
+		var buf bytes.Buffer
+		w, err := c.Wrap(&buf, 4)
+		if err != nil {
+			t.Fatalf("%s: Wrap: %v", c.Algo, err)
+		}
+		if _, err = w.Write(payload); err != nil {
+			t.Fatal(err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if c.Enabled() && buf.Len() >= len(payload) {
+			t.Errorf("%s: output %d bytes not smaller than input %d", c.Algo, buf.Len(), len(payload))
+		}
+
+		dr, err := Decompress(&buf, 2)
+		if err != nil {
+			t.Fatalf("%s: Decompress: %v", c.Algo, err)
+		}
+		if dr.Codec != c.Algo {
+			t.Errorf("codec: got %q, want %q", dr.Codec, c.Algo)
+		}
+		got, err := io.ReadAll(dr)
+		if err != nil {
+			t.Fatalf("%s: read: %v", c.Algo, err)
+		}
+		if err = dr.Verify(); err != nil {
+			t.Errorf("%s: Verify: %v", c.Algo, err)
+		}
+		dr.Close() //nolint:errcheck,gosec
+		if !bytes.Equal(got, payload) {
+			t.Errorf("%s: payload mismatch (%d bytes)", c.Algo, len(got))
+		}
+	}
+}
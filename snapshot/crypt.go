@@ -0,0 +1,275 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+
+	"github.com/cocoonstack/cocoon/types"
+	"github.com/cocoonstack/cocoon/utils"
+)
+
+const (
+	// EncryptionSchemeAge marks data encrypted to age X25519 recipients.
+	EncryptionSchemeAge = "age-x25519"
+	// EncryptedFileSuffix is appended to each data file name in an encrypted --to-dir export.
+	EncryptedFileSuffix = ".age"
+
+	ageMagic = "age-encryption.org/v1\n"
+)
+
+// ErrEncrypted is returned when encrypted data is read without a decryption key.
+var ErrEncrypted = errors.New("snapshot data is encrypted")
+
+// Encrypter wraps export streams for a fixed set of age X25519 recipients.
+type Encrypter struct {
+	recipients []age.Recipient
+	info       types.SnapshotEncryption
+}
+
+// NewEncrypter parses spec as an age1... recipient, or a file of recipients or identities (public keys derived).
+func NewEncrypter(spec string) (*Encrypter, error) {
+	var recipients []*age.X25519Recipient
+	if strings.HasPrefix(spec, "age1") {
+		r, err := age.ParseX25519Recipient(spec)
+		if err != nil {
+			return nil, fmt.Errorf("parse recipient: %w", err)
+		}
+		recipients = append(recipients, r)
+	} else {
+		var err error
+		if recipients, err = readRecipientFile(spec); err != nil {
+			return nil, err
+		}
+	}
+	e := &Encrypter{info: types.SnapshotEncryption{Scheme: EncryptionSchemeAge}}
+	for _, r := range recipients {
+		e.recipients = append(e.recipients, r)
+		e.info.Fingerprints = append(e.info.Fingerprints, Fingerprint(r))
+	}
+	return e, nil
+}
+
+// Info returns the envelope record for this encrypter; callers own the copy.
+func (e *Encrypter) Info() *types.SnapshotEncryption {
+	info := e.info
+	info.Fingerprints = append([]string(nil), e.info.Fingerprints...)
+	return &info
+}
+
+// Wrap returns a writer that encrypts into w; Close flushes the final chunk and must be called before w is closed.
+func (e *Encrypter) Wrap(w io.Writer) (io.WriteCloser, error) {
+	aw, err := age.Encrypt(w, e.recipients...)
+	if err != nil {
+		return nil, fmt.Errorf("age encrypt: %w", err)
+	}
+	return aw, nil
+}
+
+// Fingerprint is the ssh-keygen style SHA256 of the recipient's age1... string.
+func Fingerprint(r *age.X25519Recipient) string {
+	sum := sha256.Sum256([]byte(r.String()))
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// ReadIdentityFile loads age identities (AGE-SECRET-KEY-1... lines) for --decrypt-key.
+func ReadIdentityFile(path string) ([]age.Identity, error) {
+	data, err := os.ReadFile(path) //nolint:gosec
+	if err != nil {
+		return nil, fmt.Errorf("read key file: %w", err)
+	}
+	ids, err := age.ParseIdentities(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("parse key file %s: %w", path, err)
+	}
+	return ids, nil
+}
+
+// MaybeDecrypt sniffs the age header; encrypted input is unwrapped with ids, plaintext passes through untouched.
+func MaybeDecrypt(r io.Reader, ids []age.Identity) (io.Reader, bool, error) {
+	head, full, err := utils.PeekReader(r, len(ageMagic))
+	if err != nil {
+		return nil, false, fmt.Errorf("peek archive header: %w", err)
+	}
+	if string(head) != ageMagic {
+		return full, false, nil
+	}
+	if len(ids) == 0 {
+		return nil, true, fmt.Errorf("%w: pass --decrypt-key", ErrEncrypted)
+	}
+	dr, err := age.Decrypt(full, ids...)
+	if err != nil {
+		return nil, true, fmt.Errorf("age decrypt: %w", err)
+	}
+	return dr, true, nil
+}
+
+// EncryptFileTo writes src as a single-entry sparse-aware tar, encrypted, to dst; holes stay holes after decryption.
+func EncryptFileTo(dst, src string, enc *Encrypter) (err error) {
+	f, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o600) //nolint:gosec
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+	aw, err := enc.Wrap(f)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(aw)
+	if err = utils.TarFile(tw, src, filepath.Base(src)); err != nil {
+		return err
+	}
+	if err = tw.Close(); err != nil {
+		return err
+	}
+	if err = aw.Close(); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// DecryptDirStream turns an encrypted --to-dir export into the flat (sparse) tar stream hypervisor Clone/Restore consume.
+// With verify, each file's plaintext size and sha256 are checked against the manifest as it streams and a mismatch
+// fails the stream: age authenticates every file alone, so only the manifest ties them to this export.
+func DecryptDirStream(ctx context.Context, dir string, envelope types.SnapshotExport, ids []age.Identity, verify bool) io.ReadCloser {
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		var streamErr error
+		defer func() {
+			if streamErr != nil {
+				pw.CloseWithError(streamErr) //nolint:errcheck,gosec
+			} else {
+				pw.Close() //nolint:errcheck,gosec
+			}
+			done <- streamErr
+		}()
+		if verify {
+			if streamErr = VerifyEncryptedDirLayout(dir, envelope.Files); streamErr != nil {
+				return
+			}
+		}
+		tw := tar.NewWriter(pw)
+		for _, want := range envelope.Files {
+			got, copyErr := copyEncryptedEntry(ctx, tw, dir, want.Name, ids)
+			if copyErr != nil {
+				streamErr = copyErr
+				return
+			}
+			if p := manifestProblem(want, got, true); verify && p != "" {
+				streamErr = mismatchError([]string{p})
+				return
+			}
+		}
+		streamErr = tw.Close()
+	}()
+	return utils.NewPipeStreamReader(pr, done, nil)
+}
+
+// VerifyEncryptedDirLayout checks that dir holds exactly one <name>.age per manifest entry and no other data files.
+// The content is checked where it is decrypted (DecryptDirStream, VerifyDir).
+func VerifyEncryptedDirLayout(dir string, files []types.SnapshotFile) error {
+	if len(files) == 0 {
+		return ErrNoManifest
+	}
+	problems, err := unlistedFiles(dir, files, EncryptedFileSuffix)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if _, statErr := os.Stat(filepath.Join(dir, f.Name+EncryptedFileSuffix)); errors.Is(statErr, os.ErrNotExist) {
+			problems = append(problems, fmt.Sprintf("%s: missing", f.Name))
+		}
+	}
+	return mismatchError(problems)
+}
+
+// copyEncryptedEntry re-emits name's decrypted entry into tw and returns the digest of its logical content.
+func copyEncryptedEntry(ctx context.Context, tw *tar.Writer, dir, name string, ids []age.Identity) (types.SnapshotFile, error) {
+	var got types.SnapshotFile
+	err := openEncryptedEntry(dir, name, ids, func(hdr *tar.Header, r io.Reader) error {
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("write header %s: %w", name, err)
+		}
+		// The tee sees the packed (hole-free) bytes; the hash sees the logical content.
+		tee := io.TeeReader(r, tw)
+		lr, _, err := utils.TarEntryReader(hdr, tee)
+		if err != nil {
+			return err
+		}
+		if got, err = hashReader(ctx, name, lr); err != nil {
+			return err
+		}
+		if _, err = io.Copy(io.Discard, tee); err != nil {
+			return fmt.Errorf("copy %s: %w", name, err)
+		}
+		return nil
+	})
+	return got, err
+}
+
+// openEncryptedEntry decrypts <dir>/<name>.age and hands its single tar entry to fn.
+func openEncryptedEntry(dir, name string, ids []age.Identity, fn func(*tar.Header, io.Reader) error) error {
+	f, err := os.Open(filepath.Join(dir, name+EncryptedFileSuffix)) //nolint:gosec
+	if err != nil {
+		return err
+	}
+	defer f.Close() //nolint:errcheck
+	dr, err := age.Decrypt(f, ids...)
+	if err != nil {
+		return fmt.Errorf("age decrypt %s: %w", name, err)
+	}
+	tr := tar.NewReader(dr)
+	hdr, err := tr.Next()
+	if err != nil {
+		return fmt.Errorf("read %s: %w", name, err)
+	}
+	if hdr.Name != name {
+		return fmt.Errorf("%s%s holds entry %q", name, EncryptedFileSuffix, hdr.Name)
+	}
+	return fn(hdr, tr)
+}
+
+func readRecipientFile(path string) ([]*age.X25519Recipient, error) {
+	data, err := os.ReadFile(path) //nolint:gosec
+	if err != nil {
+		return nil, fmt.Errorf("read recipient file: %w", err)
+	}
+	var out []*age.X25519Recipient
+	if parsed, parseErr := age.ParseRecipients(bytes.NewReader(data)); parseErr == nil {
+		for _, r := range parsed {
+			x, ok := r.(*age.X25519Recipient)
+			if !ok {
+				return nil, fmt.Errorf("recipient file %s: only X25519 recipients are supported", path)
+			}
+			out = append(out, x)
+		}
+		return out, nil
+	}
+	ids, err := age.ParseIdentities(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("recipient file %s: neither age recipients nor identities: %w", path, err)
+	}
+	for _, id := range ids {
+		x, ok := id.(*age.X25519Identity)
+		if !ok {
+			return nil, fmt.Errorf("key file %s: only X25519 identities are supported", path)
+		}
+		out = append(out, x.Recipient())
+	}
+	return out, nil
+}
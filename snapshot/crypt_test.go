@@ -0,0 +1,238 @@
+package snapshot
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+
+	"github.com/cocoonstack/cocoon/types"
+	"github.com/cocoonstack/cocoon/utils"
+)
+
+func newTestIdentity(t *testing.T) (*age.X25519Identity, string) {
+	t.Helper()
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "key.txt")
+	if err = os.WriteFile(keyFile, []byte(id.String()+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return id, keyFile
+}
+
+func TestNewEncrypter_RecipientAndIdentityFileAgree(t *testing.T) {
+	id, keyFile := newTestIdentity(t)
+
+	fromString, err := NewEncrypter(id.Recipient().String())
+	if err != nil {
+		t.Fatalf("recipient string: %v", err)
+	}
+	fromFile, err := NewEncrypter(keyFile)
+	if err != nil {
+		t.Fatalf("identity file: %v", err)
+	}
+	a, b := fromString.Info(), fromFile.Info()
+	if a.Scheme != EncryptionSchemeAge || len(a.Fingerprints) != 1 || a.Fingerprints[0] != b.Fingerprints[0] {
+		t.Errorf("fingerprints differ: %+v vs %+v", a, b)
+	}
+	if !strings.HasPrefix(a.Fingerprints[0], "SHA256:") {
+		t.Errorf("fingerprint format: %s", a.Fingerprints[0])
+	}
+}
+
+func TestMaybeDecrypt(t *testing.T) {
+	id, keyFile := newTestIdentity(t)
+	enc, err := NewEncrypter(id.Recipient().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	w, err := enc.Wrap(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write([]byte("secret tar")); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	ciphertext := buf.Bytes()
+
+	if _, _, err = MaybeDecrypt(bytes.NewReader(ciphertext), nil); !errors.Is(err, ErrEncrypted) {
+		t.Fatalf("no key: got %v, want ErrEncrypted", err)
+	}
+	ids, err := ReadIdentityFile(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, encrypted, err := MaybeDecrypt(bytes.NewReader(ciphertext), ids)
+	if err != nil || !encrypted {
+		t.Fatalf("decrypt: encrypted=%v err=%v", encrypted, err)
+	}
+	if got, _ := io.ReadAll(r); string(got) != "secret tar" {
+		t.Errorf("got %q", got)
+	}
+
+	r, encrypted, err = MaybeDecrypt(strings.NewReader("plain"), ids)
+	if err != nil || encrypted {
+		t.Fatalf("plaintext: encrypted=%v err=%v", encrypted, err)
+	}
+	if got, _ := io.ReadAll(r); string(got) != "plain" {
+		t.Errorf("plaintext passthrough: got %q", got)
+	}
+}
+
+func TestEncryptedDir_VerifyAndStream(t *testing.T) {
+	id, _ := newTestIdentity(t)
+	enc, err := NewEncrypter(id.Recipient().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := t.TempDir()
+	sparse := filepath.Join(src, "memory-range-0")
+	f, err := os.Create(sparse) //nolint:gosec
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = f.Truncate(1 << 20); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.WriteAt([]byte("tail"), 1<<19); err != nil {
+		t.Fatal(err)
+	}
+	f.Close() //nolint:errcheck,gosec
+	if err = os.WriteFile(filepath.Join(src, "config.json"), []byte(`{"cpu":1}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	files, err := BuildManifest(t.Context(), src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := t.TempDir()
+	for _, file := range files {
+		if err = EncryptFileTo(filepath.Join(dst, file.Name+EncryptedFileSuffix), filepath.Join(src, file.Name), enc); err != nil {
+			t.Fatalf("EncryptFileTo %s: %v", file.Name, err)
+		}
+	}
+	envelope := types.SnapshotExport{Config: types.SnapshotConfig{Name: "enc"}, Files: files, Encryption: enc.Info()}
+	if err = WriteSnapshotEnvelope(dst, envelope); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = VerifyDir(t.Context(), dst, 0); !errors.Is(err, ErrEncrypted) {
+		t.Fatalf("no key: got %v, want ErrEncrypted", err)
+	}
+	if _, err = VerifyDir(t.Context(), dst, 2, id); err != nil {
+		t.Fatalf("VerifyDir: %v", err)
+	}
+
+	stream := DecryptDirStream(t.Context(), dst, envelope, []age.Identity{id}, true)
+	out := t.TempDir()
+	if err = utils.ExtractTar(out, stream); err != nil {
+		t.Fatalf("ExtractTar: %v", err)
+	}
+	if err = stream.Close(); err != nil {
+		t.Fatalf("stream close: %v", err)
+	}
+	if err = VerifyManifest(t.Context(), out, files, 0); err != nil {
+		t.Fatalf("decrypted data: %v", err)
+	}
+}
+
+func TestEncryptedDirManifest(t *testing.T) {
+	id, _ := newTestIdentity(t)
+	enc, err := NewEncrypter(id.Recipient().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := t.TempDir()
+	for name, data := range map[string]string{"a.raw": "aaa", "b.raw": "bbb"} {
+		if err = os.WriteFile(filepath.Join(src, name), []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, err := BuildManifest(t.Context(), src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// encryptDir writes an encrypted export of src, then lets tamper change it.
+	encryptDir := func(tamper func(dst string)) (string, types.SnapshotExport) {
+		dst := t.TempDir()
+		for _, file := range files {
+			if err := EncryptFileTo(filepath.Join(dst, file.Name+EncryptedFileSuffix), filepath.Join(src, file.Name), enc); err != nil {
+				t.Fatal(err)
+			}
+		}
+		envelope := types.SnapshotExport{Files: files, Encryption: enc.Info()}
+		if err := WriteSnapshotEnvelope(dst, envelope); err != nil {
+			t.Fatal(err)
+		}
+		tamper(dst)
+		return dst, envelope
+	}
+	stream := func(dst string, envelope types.SnapshotExport) error {
+		rc := DecryptDirStream(t.Context(), dst, envelope, []age.Identity{id}, true)
+		_, copyErr := io.Copy(io.Discard, rc)
+		return errors.Join(copyErr, rc.Close())
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(dst string)
+		want   string
+	}{
+		{"intact", func(string) {}, ""},
+		{"extra file", func(dst string) {
+			if err := EncryptFileTo(filepath.Join(dst, "c.raw"+EncryptedFileSuffix), filepath.Join(src, "a.raw"), enc); err != nil {
+				t.Fatal(err)
+			}
+		}, "c.raw.age: not in manifest"},
+		{"missing file", func(dst string) {
+			if err := os.Remove(filepath.Join(dst, "b.raw"+EncryptedFileSuffix)); err != nil {
+				t.Fatal(err)
+			}
+		}, "b.raw: missing"},
+		{"replaced file", func(dst string) {
+			other := filepath.Join(t.TempDir(), "b.raw")
+			if err := os.WriteFile(other, []byte("evil"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			target := filepath.Join(dst, "b.raw"+EncryptedFileSuffix)
+			if err := os.Remove(target); err != nil {
+				t.Fatal(err)
+			}
+			if err := EncryptFileTo(target, other, enc); err != nil {
+				t.Fatal(err)
+			}
+		}, "b.raw: size 4, want 3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst, envelope := encryptDir(tt.tamper)
+			_, verifyErr := VerifyDir(t.Context(), dst, 0, id)
+			streamErr := stream(dst, envelope)
+			for what, err := range map[string]error{"VerifyDir": verifyErr, "DecryptDirStream": streamErr} {
+				if tt.want == "" {
+					if err != nil {
+						t.Errorf("%s: %v", what, err)
+					}
+					continue
+				}
+				if !errors.Is(err, ErrManifestMismatch) || !strings.Contains(err.Error(), tt.want) {
+					t.Errorf("%s: got %v, want mismatch %q", what, err, tt.want)
+				}
+			}
+		})
+	}
+}
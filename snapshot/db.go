@@ -13,10 +13,11 @@ var ErrNotFound = errors.New("snapshot not found")
 // SnapshotRecord is the persisted record for a single snapshot.
 type SnapshotRecord struct {
 	types.Snapshot
-	DataDir        string    `json:"data_dir,omitempty"`
-	SizeBytes      int64     `json:"size_bytes,omitempty"`
-	Pending        bool      `json:"pending,omitempty"` // true while Create is in progress
-	LastAccessedAt time.Time `json:"last_accessed_at,omitzero"`
+	DataDir        string               `json:"data_dir,omitempty"`
+	SizeBytes      int64                `json:"size_bytes,omitempty"`
+	Files          []types.SnapshotFile `json:"files,omitempty"`   // integrity manifest; empty on records predating it
+	Pending        bool                 `json:"pending,omitempty"` // true while Create is in progress
+	LastAccessedAt time.Time            `json:"last_accessed_at,omitzero"`
 }
 
 // SnapshotIndex is the top-level DB structure for the snapshot module.
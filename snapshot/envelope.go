@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"path/filepath"
 
@@ -13,7 +14,10 @@ import (
 
 const (
 	SnapshotJSONName = "snapshot.json"
-	EnvelopeVersion  = 1
+	// EnvelopeVersion is what export writes; v2 adds the per-file manifest.
+	EnvelopeVersion = 2
+	// minEnvelopeVersion is the oldest envelope still accepted on read (v1: config only).
+	minEnvelopeVersion = 1
 )
 
 // ErrEnvelopeMissing wraps the not-found case so callers can render a dir-specific error instead of a raw open failure.
@@ -21,23 +25,53 @@ var ErrEnvelopeMissing = errors.New("snapshot envelope missing")
 
 // ReadSnapshotEnvelope reads <dir>/snapshot.json into a SnapshotConfig.
 func ReadSnapshotEnvelope(dir string) (types.SnapshotConfig, error) {
+	envelope, err := ReadEnvelope(dir)
+	if err != nil {
+		return types.SnapshotConfig{}, err
+	}
+	return envelope.Config, nil
+}
+
+// ReadEnvelope reads <dir>/snapshot.json including the manifest; v1 envelopes come back with nil Files.
+func ReadEnvelope(dir string) (types.SnapshotExport, error) {
 	path := filepath.Join(dir, SnapshotJSONName)
 	envelope := types.SnapshotExport{}
 	if err := utils.ReadJSONFile(path, &envelope); err != nil {
 		if errors.Is(err, fs.ErrNotExist) {
-			return types.SnapshotConfig{}, fmt.Errorf("%s missing in %s: %w", SnapshotJSONName, dir, ErrEnvelopeMissing)
+			return types.SnapshotExport{}, fmt.Errorf("%s missing in %s: %w", SnapshotJSONName, dir, ErrEnvelopeMissing)
 		}
-		return types.SnapshotConfig{}, err
+		return types.SnapshotExport{}, err
 	}
-	if envelope.Version != EnvelopeVersion {
-		return types.SnapshotConfig{}, fmt.Errorf("unsupported snapshot envelope version %d (want %d)", envelope.Version, EnvelopeVersion)
+	if err := checkEnvelopeVersion(envelope); err != nil {
+		return types.SnapshotExport{}, err
 	}
-	return envelope.Config, nil
+	return envelope, nil
+}
+
+// DecodeEnvelope parses a snapshot.json read from an archive stream (e.g. the first tar entry of an export).
+func DecodeEnvelope(r io.Reader) (types.SnapshotExport, error) {
+	envelope := types.SnapshotExport{}
+	if err := json.NewDecoder(r).Decode(&envelope); err != nil {
+		return types.SnapshotExport{}, fmt.Errorf("decode %s: %w", SnapshotJSONName, err)
+	}
+	if err := checkEnvelopeVersion(envelope); err != nil {
+		return types.SnapshotExport{}, err
+	}
+	return envelope, nil
+}
+
+func checkEnvelopeVersion(envelope types.SnapshotExport) error {
+	if envelope.Version < minEnvelopeVersion || envelope.Version > EnvelopeVersion {
+		return fmt.Errorf("unsupported snapshot envelope version %d (want %d..%d)",
+			envelope.Version, minEnvelopeVersion, EnvelopeVersion)
+	}
+	return nil
 }
 
-// MarshalEnvelope returns the indented snapshot.json bytes for cfg.
-func MarshalEnvelope(cfg types.SnapshotConfig) ([]byte, error) {
-	data, err := json.MarshalIndent(types.SnapshotExport{Version: EnvelopeVersion, Config: cfg}, "", "  ")
+// MarshalEnvelope returns the indented snapshot.json bytes for envelope, stamped with the current EnvelopeVersion.
+func MarshalEnvelope(envelope types.SnapshotExport) ([]byte, error) {
+	envelope.Version = EnvelopeVersion
+	data, err := json.MarshalIndent(envelope, "", "  ")
 	if err != nil {
 		return nil, fmt.Errorf("marshal snapshot envelope: %w", err)
 	}
@@ -45,8 +79,8 @@ func MarshalEnvelope(cfg types.SnapshotConfig) ([]byte, error) {
 }
 
 // WriteSnapshotEnvelope writes <dir>/snapshot.json atomically so a concurrent reader can't see a partial write.
-func WriteSnapshotEnvelope(dir string, cfg types.SnapshotConfig) error {
-	data, err := MarshalEnvelope(cfg)
+func WriteSnapshotEnvelope(dir string, envelope types.SnapshotExport) error {
+	data, err := MarshalEnvelope(envelope)
 	if err != nil {
 		return err
 	}
@@ -17,7 +17,7 @@ func TestReadSnapshotEnvelope_RoundTrip(t *testing.T) {
 		Hypervisor: "cloud-hypervisor",
 		NICs:       1,
 	}
-	if err := WriteSnapshotEnvelope(dir, cfg); err != nil {
+	if err := WriteSnapshotEnvelope(dir, types.SnapshotExport{Config: cfg}); err != nil {
 		t.Fatalf("write: %v", err)
 	}
 	got, err := ReadSnapshotEnvelope(dir)
@@ -0,0 +1,141 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"time"
+
+	"github.com/cocoonstack/cocoon/progress"
+	snapshotProgress "github.com/cocoonstack/cocoon/progress/snapshot"
+	"github.com/cocoonstack/cocoon/types"
+	"github.com/cocoonstack/cocoon/utils"
+)
+
+// exportProgressInterval is how many archive bytes pass between PhaseWrite events.
+const exportProgressInterval = 64 << 20
+
+// StreamExport runs tar -> compressor -> age into a pipe; compression runs before encryption since ciphertext doesn't compress.
+// writeData appends the data entries after snapshot.json and calls fileDone per finished file so progress tracks the manifest's logical sizes.
+func StreamExport(ctx context.Context, envelope types.SnapshotExport, opts ExportOptions, writeData func(tw *tar.Writer, fileDone func(name string)) error) (io.ReadCloser, error) {
+	if opts.Encrypter != nil {
+		envelope.Encryption = opts.Encrypter.Info()
+	}
+	jsonData, err := MarshalEnvelope(envelope)
+	if err != nil {
+		return nil, err
+	}
+	tracker := opts.Tracker
+	if tracker == nil {
+		tracker = progress.Nop
+	}
+	sizes := make(map[string]int64, len(envelope.Files))
+	for _, file := range envelope.Files {
+		sizes[file.Name] = file.Size
+	}
+
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		var streamErr error
+		defer func() {
+			if streamErr != nil {
+				pw.CloseWithError(streamErr) //nolint:errcheck,gosec
+			} else {
+				pw.Close() //nolint:errcheck,gosec
+			}
+			done <- streamErr
+		}()
+
+		prog := &exportProgress{w: pw, tracker: tracker, files: len(envelope.Files)}
+		for _, size := range sizes {
+			prog.total += size
+		}
+		var w io.Writer = prog
+		var aw io.WriteCloser
+		if opts.Encrypter != nil {
+			if aw, streamErr = opts.Encrypter.Wrap(w); streamErr != nil {
+				return
+			}
+			w = aw
+		}
+		cw, cwErr := opts.Compression.Wrap(w, opts.Concurrency)
+		if cwErr != nil {
+			streamErr = cwErr
+			return
+		}
+		tw := tar.NewWriter(cw)
+		prog.emit(snapshotProgress.PhaseExport, "", -1)
+
+		streamErr = tw.WriteHeader(&tar.Header{
+			Name:    SnapshotJSONName,
+			Size:    int64(len(jsonData)),
+			Mode:    0o644,
+			ModTime: time.Now(),
+		})
+		if streamErr != nil {
+			return
+		}
+		if _, streamErr = tw.Write(jsonData); streamErr != nil {
+			return
+		}
+
+		index := 0
+		if streamErr = writeData(tw, func(name string) {
+			prog.done += sizes[name]
+			prog.emit(snapshotProgress.PhaseFile, name, index)
+			index++
+		}); streamErr != nil {
+			return
+		}
+
+		if streamErr = tw.Close(); streamErr != nil {
+			return
+		}
+		if streamErr = cw.Close(); streamErr != nil {
+			return
+		}
+		if aw != nil {
+			if streamErr = aw.Close(); streamErr != nil {
+				return
+			}
+		}
+		prog.emit(snapshotProgress.PhaseDone, "", -1)
+	}()
+
+	return utils.NewPipeStreamReader(pr, done, nil), nil
+}
+
+// exportProgress tracks logical and archive byte counts; only the pipe goroutine touches it, so plain fields suffice.
+type exportProgress struct {
+	w          io.Writer
+	tracker    progress.Tracker
+	files      int
+	total      int64
+	done       int64
+	out        int64
+	lastReport int64
+}
+
+// Write counts archive bytes and emits a PhaseWrite event every exportProgressInterval.
+func (p *exportProgress) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.out += int64(n)
+	if p.out-p.lastReport >= exportProgressInterval {
+		p.lastReport = p.out
+		p.emit(snapshotProgress.PhaseWrite, "", -1)
+	}
+	return n, err
+}
+
+func (p *exportProgress) emit(phase snapshotProgress.Phase, file string, index int) {
+	p.tracker.OnEvent(snapshotProgress.Event{
+		Phase:      phase,
+		File:       file,
+		Index:      index,
+		Total:      p.files,
+		BytesTotal: p.total,
+		BytesDone:  p.done,
+		BytesOut:   p.out,
+	})
+}
@@ -0,0 +1,246 @@
+package snapshot
+
+import (
+	"cmp"
+	"errors"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/cocoonstack/cocoon/types"
+	"github.com/cocoonstack/cocoon/utils"
+)
+
+const (
+	LineageSnapshot = "snapshot"
+	LineageVM       = "vm"
+)
+
+// LineageNode is one snapshot or VM in the snapshot→VM→snapshot graph.
+// A snapshot's children are the VMs cloned from it; a VM's children are the snapshots saved from it.
+type LineageNode struct {
+	Kind      string    `json:"kind"`
+	ID        string    `json:"id"`
+	Name      string    `json:"name,omitempty"`
+	State     string    `json:"state,omitempty"` // VMs only
+	CreatedAt time.Time `json:"created_at"`
+	// MissingParent is the source snapshot ID of a VM whose snapshot has since been deleted.
+	MissingParent string `json:"missing_parent,omitempty"`
+	// Target marks the node a Tree call was asked about.
+	Target bool `json:"target,omitempty"`
+	// Cycle marks a node already rendered higher up the same branch; its children are omitted.
+	Cycle    bool           `json:"cycle,omitempty"`
+	Children []*LineageNode `json:"children,omitempty"`
+}
+
+// Lineage indexes snapshots and VMs by their parent/child edges: VM.SnapshotIDs (VM→snapshot) and VM.SourceSnapshotID (snapshot→VM).
+type Lineage struct {
+	snapshots   map[string]*types.Snapshot
+	snapNames   map[string]string
+	vms         map[string]*types.VM
+	vmNames     map[string]string
+	snapParent  map[string]string   // snapshot → VM it was saved from
+	vmParent    map[string]string   // VM → snapshot it was cloned from
+	children    map[string][]string // node → child IDs, sorted by creation time
+	missingSrcs map[string]string   // VM → deleted source snapshot ID
+}
+
+// NewLineage builds the graph; edges pointing at deleted snapshots or VMs are dropped.
+func NewLineage(snapshots []*types.Snapshot, vms []*types.VM) *Lineage {
+	l := &Lineage{
+		snapshots:   make(map[string]*types.Snapshot, len(snapshots)),
+		snapNames:   make(map[string]string),
+		vms:         make(map[string]*types.VM, len(vms)),
+		vmNames:     make(map[string]string),
+		snapParent:  make(map[string]string),
+		vmParent:    make(map[string]string),
+		children:    make(map[string][]string),
+		missingSrcs: make(map[string]string),
+	}
+	for _, s := range snapshots {
+		l.snapshots[s.ID] = s
+		if s.Name != "" {
+			l.snapNames[s.Name] = s.ID
+		}
+	}
+	for _, vm := range vms {
+		l.vms[vm.ID] = vm
+		l.vmNames[vm.Config.Name] = vm.ID
+	}
+	// Iterate VMs in a stable order so a snapshot claimed by two records always lands under the same parent.
+	for _, vmID := range slices.Sorted(maps.Keys(l.vms)) {
+		vm := l.vms[vmID]
+		for _, snapID := range slices.Sorted(maps.Keys(vm.SnapshotIDs)) {
+			if _, ok := l.snapshots[snapID]; !ok {
+				continue
+			}
+			if _, claimed := l.snapParent[snapID]; claimed {
+				continue
+			}
+			l.snapParent[snapID] = vmID
+			l.children[vmID] = append(l.children[vmID], snapID)
+		}
+		switch src := vm.SourceSnapshotID; {
+		case src == "":
+		case l.snapshots[src] != nil:
+			l.vmParent[vmID] = src
+			l.children[src] = append(l.children[src], vmID)
+		default:
+			l.missingSrcs[vmID] = src
+		}
+	}
+	for _, kids := range l.children {
+		l.sortByCreated(kids)
+	}
+	return l
+}
+
+// Forest returns every lineage root: snapshots with no live source VM, and VMs with snapshots or a deleted source.
+// Image-created VMs without snapshots are left out; nodes reachable only through a cycle become extra roots.
+func (l *Lineage) Forest() []*LineageNode {
+	var roots []string
+	for id := range l.snapshots {
+		if _, ok := l.snapParent[id]; !ok {
+			roots = append(roots, id)
+		}
+	}
+	for id := range l.vms {
+		if _, ok := l.vmParent[id]; ok {
+			continue
+		}
+		if len(l.children[id]) > 0 || l.missingSrcs[id] != "" {
+			roots = append(roots, id)
+		}
+	}
+	l.sortByCreated(roots)
+
+	seen := make(map[string]struct{})
+	var forest []*LineageNode
+	for _, id := range roots {
+		forest = append(forest, l.subtree(id, seen))
+	}
+	var leftover []string
+	for id := range l.children {
+		if _, ok := seen[id]; !ok {
+			leftover = append(leftover, id)
+		}
+	}
+	l.sortByCreated(leftover)
+	for _, id := range leftover {
+		if _, ok := seen[id]; !ok {
+			forest = append(forest, l.subtree(id, seen))
+		}
+	}
+	return forest
+}
+
+// Tree resolves ref (snapshot first, then VM; ID, name, or ID prefix) and returns its ancestry from the lineage
+// root down to it, followed by its full subtree. Off-path siblings of the ancestors are omitted.
+func (l *Lineage) Tree(ref string) (*LineageNode, error) {
+	id, err := utils.ResolveRef(l.snapshots, l.snapNames, ref, ErrNotFound)
+	if errors.Is(err, ErrNotFound) {
+		id, err = utils.ResolveRef(l.vms, l.vmNames, ref, ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	path := []string{id}
+	onPath := map[string]struct{}{id: {}}
+	for cur := id; ; {
+		parent, ok := l.parent(cur)
+		if !ok {
+			break
+		}
+		if _, loop := onPath[parent]; loop {
+			break
+		}
+		path = append(path, parent)
+		onPath[parent] = struct{}{}
+		cur = parent
+	}
+
+	// Ancestors count as seen so a cycle stops at the path instead of repeating it.
+	seen := make(map[string]struct{}, len(path))
+	for _, ancestor := range path[1:] {
+		seen[ancestor] = struct{}{}
+	}
+	target := l.subtree(id, seen)
+	target.Target = true
+	node := target
+	for _, ancestor := range path[1:] {
+		up := l.node(ancestor)
+		up.Children = []*LineageNode{node}
+		node = up
+	}
+	return node, nil
+}
+
+// LiveDescendants returns every VM still on record that descends from snapID, at any depth.
+func (l *Lineage) LiveDescendants(snapID string) []*types.VM {
+	var (
+		result []*types.VM
+		walk   func(n *LineageNode)
+	)
+	walk = func(n *LineageNode) {
+		for _, c := range n.Children {
+			if c.Kind == LineageVM && !c.Cycle {
+				result = append(result, l.vms[c.ID])
+			}
+			walk(c)
+		}
+	}
+	if _, ok := l.snapshots[snapID]; ok {
+		walk(l.subtree(snapID, make(map[string]struct{})))
+	}
+	return result
+}
+
+// subtree renders id and everything below it; seen carries across calls so each node is expanded once.
+func (l *Lineage) subtree(id string, seen map[string]struct{}) *LineageNode {
+	n := l.node(id)
+	if _, ok := seen[id]; ok {
+		n.Cycle = true
+		return n
+	}
+	seen[id] = struct{}{}
+	for _, child := range l.children[id] {
+		n.Children = append(n.Children, l.subtree(child, seen))
+	}
+	return n
+}
+
+func (l *Lineage) node(id string) *LineageNode {
+	if s, ok := l.snapshots[id]; ok {
+		return &LineageNode{Kind: LineageSnapshot, ID: id, Name: s.Name, CreatedAt: s.CreatedAt}
+	}
+	vm := l.vms[id]
+	return &LineageNode{
+		Kind: LineageVM, ID: id, Name: vm.Config.Name, State: string(vm.State),
+		CreatedAt: vm.CreatedAt, MissingParent: l.missingSrcs[id],
+	}
+}
+
+func (l *Lineage) parent(id string) (string, bool) {
+	if p, ok := l.snapParent[id]; ok {
+		return p, true
+	}
+	p, ok := l.vmParent[id]
+	return p, ok
+}
+
+func (l *Lineage) createdAt(id string) time.Time {
+	if s, ok := l.snapshots[id]; ok {
+		return s.CreatedAt
+	}
+	return l.vms[id].CreatedAt
+}
+
+func (l *Lineage) sortByCreated(ids []string) {
+	slices.SortFunc(ids, func(a, b string) int {
+		if c := l.createdAt(a).Compare(l.createdAt(b)); c != 0 {
+			return c
+		}
+		return cmp.Compare(a, b)
+	})
+}
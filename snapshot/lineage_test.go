@@ -0,0 +1,140 @@
+package snapshot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cocoonstack/cocoon/types"
+)
+
+var lineageEpoch = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func testSnap(id, name string, minute int) *types.Snapshot {
+	return &types.Snapshot{
+		SnapshotConfig: types.SnapshotConfig{ID: id, Name: name},
+		CreatedAt:      lineageEpoch.Add(time.Duration(minute) * time.Minute),
+	}
+}
+
+func testVM(id, name string, minute int, source string, snaps ...string) *types.VM {
+	vm := &types.VM{
+		ID: id, State: types.VMStateRunning, Config: types.VMConfig{Name: name},
+		SourceSnapshotID: source, CreatedAt: lineageEpoch.Add(time.Duration(minute) * time.Minute),
+	}
+	if len(snaps) > 0 {
+		vm.SnapshotIDs = make(map[string]struct{})
+		for _, s := range snaps {
+			vm.SnapshotIDs[s] = struct{}{}
+		}
+	}
+	return vm
+}
+
+// flatten renders a tree as "kind:id" in depth-first order, with "*" on the target and "!" on cycle stubs.
+func flatten(n *LineageNode) []string {
+	label := n.Kind + ":" + n.ID
+	if n.Target {
+		label += "*"
+	}
+	if n.Cycle {
+		label += "!"
+	}
+	out := []string{label}
+	for _, c := range n.Children {
+		out = append(out, flatten(c)...)
+	}
+	return out
+}
+
+func assertFlat(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+// goldenLineage: base-vm → golden → {web-1 → web-1-snap → web-1b, web-2}; plus an imported snapshot and a plain VM.
+func goldenLineage() *Lineage {
+	return NewLineage(
+		[]*types.Snapshot{
+			testSnap("s-golden", "golden", 1),
+			testSnap("s-web1", "web-1-snap", 5),
+			testSnap("s-import", "imported", 2),
+		},
+		[]*types.VM{
+			testVM("v-base", "base-vm", 0, "", "s-golden", "s-deleted"),
+			testVM("v-web1", "web-1", 3, "s-golden", "s-web1"),
+			testVM("v-web2", "web-2", 4, "s-golden"),
+			testVM("v-web1b", "web-1b", 6, "s-web1"),
+			testVM("v-plain", "plain", 7, ""),
+		},
+	)
+}
+
+func TestLineage_Forest(t *testing.T) {
+	forest := goldenLineage().Forest()
+	if len(forest) != 2 {
+		t.Fatalf("got %d roots, want 2 (base-vm, imported)", len(forest))
+	}
+	assertFlat(t, flatten(forest[0]),
+		"vm:v-base", "snapshot:s-golden", "vm:v-web1", "snapshot:s-web1", "vm:v-web1b", "vm:v-web2")
+	assertFlat(t, flatten(forest[1]), "snapshot:s-import")
+}
+
+func TestLineage_TreeShowsAncestryAndSubtree(t *testing.T) {
+	l := goldenLineage()
+	tree, err := l.Tree("web-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// web-2 is a sibling off the path, so it is left out.
+	assertFlat(t, flatten(tree),
+		"vm:v-base", "snapshot:s-golden", "vm:v-web1*", "snapshot:s-web1", "vm:v-web1b")
+
+	if _, err = l.Tree("nope"); err == nil {
+		t.Error("Tree on an unknown ref should fail")
+	}
+}
+
+func TestLineage_LiveDescendants(t *testing.T) {
+	l := goldenLineage()
+	var names []string
+	for _, vm := range l.LiveDescendants("s-golden") {
+		names = append(names, vm.Config.Name)
+	}
+	assertFlat(t, names, "web-1", "web-1b", "web-2")
+	if got := l.LiveDescendants("s-import"); len(got) != 0 {
+		t.Errorf("imported snapshot has descendants: %v", got)
+	}
+}
+
+func TestLineage_MissingSourceAndCycle(t *testing.T) {
+	l := NewLineage(
+		[]*types.Snapshot{testSnap("s-a", "a", 1), testSnap("s-b", "b", 2)},
+		[]*types.VM{
+			// vm-a cloned from s-b, vm-b force-restored from s-a: a pure cycle with no natural root.
+			testVM("v-a", "vm-a", 0, "s-b", "s-a"),
+			testVM("v-b", "vm-b", 0, "s-a", "s-b"),
+			testVM("v-orphan", "orphan", 3, "s-gone"),
+		},
+	)
+	forest := l.Forest()
+	if len(forest) != 2 {
+		t.Fatalf("got %d roots, want 2", len(forest))
+	}
+	if forest[0].ID != "v-orphan" || forest[0].MissingParent != "s-gone" {
+		t.Errorf("orphan root: %+v", forest[0])
+	}
+	assertFlat(t, flatten(forest[1]), "vm:v-a", "snapshot:s-a", "vm:v-b", "snapshot:s-b", "vm:v-a!")
+
+	tree, err := l.Tree("s-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertFlat(t, flatten(tree), "vm:v-b", "snapshot:s-b", "vm:v-a", "snapshot:s-a*", "vm:v-b!")
+}
@@ -2,31 +2,44 @@ package localfile
 
 import (
 	"archive/tar"
-	"compress/gzip"
+	"cmp"
 	"context"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
-	"time"
 
 	"github.com/cocoonstack/cocoon/snapshot"
+	"github.com/cocoonstack/cocoon/types"
 	"github.com/cocoonstack/cocoon/utils"
 )
 
 // Export streams the snapshot as a raw tar (first entry: snapshot.json envelope; rest: data files).
 func (lf *LocalFile) Export(ctx context.Context, ref string) (io.ReadCloser, error) {
-	return lf.export(ctx, ref, false)
+	return lf.ExportStream(ctx, ref, snapshot.ExportOptions{})
 }
 
 // ExportCompressed streams the snapshot as a gzip-compressed tar archive.
 func (lf *LocalFile) ExportCompressed(ctx context.Context, ref string) (io.ReadCloser, error) {
-	return lf.export(ctx, ref, true)
+	return lf.ExportStream(ctx, ref, snapshot.ExportOptions{Compression: snapshot.Compression{Algo: snapshot.CompressGzip}})
 }
 
-// ExportToDir reflinks snapshot data into dir + writes snapshot.json last so its presence is the all-data-ready marker for --from-dir.
+// ExportToDir reflinks snapshot data into dir + writes snapshot.json (with manifest) last so its presence is the all-data-ready marker for --from-dir.
 func (lf *LocalFile) ExportToDir(ctx context.Context, ref, dir string) error {
-	dataDir, cfg, err := lf.DataDir(ctx, ref)
+	return lf.exportToDir(ctx, ref, dir, nil, func(dst, src string) error {
+		return utils.ReflinkCopy(dst, src)
+	})
+}
+
+// ExportToDirEncrypted writes each data file as <name>.age (an encrypted single-entry sparse tar) next to a plaintext snapshot.json.
+func (lf *LocalFile) ExportToDirEncrypted(ctx context.Context, ref, dir string, enc *snapshot.Encrypter) error {
+	return lf.exportToDir(ctx, ref, dir, enc.Info(), func(dst, src string) error {
+		return snapshot.EncryptFileTo(dst+snapshot.EncryptedFileSuffix, src, enc)
+	})
+}
+
+func (lf *LocalFile) exportToDir(ctx context.Context, ref, dir string, encryption *types.SnapshotEncryption, copyFile func(dst, src string) error) error {
+	dataDir, cfg, files, err := lf.exportSource(ctx, ref)
 	if err != nil {
 		return err
 	}
@@ -51,79 +64,48 @@ func (lf *LocalFile) ExportToDir(ctx context.Context, ref, dir string) error {
 			continue
 		}
 		name := entry.Name()
-		src := filepath.Join(dataDir, name)
-		dst := filepath.Join(dir, name)
-		if err = utils.ReflinkCopy(dst, src); err != nil {
+		if err = copyFile(filepath.Join(dir, name), filepath.Join(dataDir, name)); err != nil {
 			return fmt.Errorf("copy %s: %w", name, err)
 		}
 	}
-	if err = snapshot.WriteSnapshotEnvelope(dir, cfg); err != nil {
+	if err = snapshot.WriteSnapshotEnvelope(dir, types.SnapshotExport{Config: cfg, Files: files, Encryption: encryption}); err != nil {
 		return fmt.Errorf("write envelope: %w", err)
 	}
 	return nil
 }
 
-func (lf *LocalFile) export(ctx context.Context, ref string, compress bool) (io.ReadCloser, error) {
-	dataDir, cfg, err := lf.DataDir(ctx, ref)
+// ExportStream streams the snapshot through the shared export pipeline; data files are written in manifest order.
+func (lf *LocalFile) ExportStream(ctx context.Context, ref string, opts snapshot.ExportOptions) (io.ReadCloser, error) {
+	dataDir, cfg, files, err := lf.exportSource(ctx, ref)
 	if err != nil {
 		return nil, err
 	}
-
-	jsonData, err := snapshot.MarshalEnvelope(cfg)
-	if err != nil {
-		return nil, err
-	}
-
-	pr, pw := io.Pipe()
-	done := make(chan error, 1)
-	go func() {
-		var streamErr error
-		defer func() {
-			if streamErr != nil {
-				pw.CloseWithError(streamErr) //nolint:errcheck,gosec
-			} else {
-				pw.Close() //nolint:errcheck,gosec
+	opts.Concurrency = cmp.Or(opts.Concurrency, lf.conf.EffectivePoolSize())
+	return snapshot.StreamExport(ctx, types.SnapshotExport{Config: cfg, Files: files}, opts, func(tw *tar.Writer, fileDone func(string)) error {
+		for _, file := range files {
+			if err := ctx.Err(); err != nil {
+				return err
 			}
-			done <- streamErr
-		}()
-
-		var w io.Writer = pw
-		var gw *gzip.Writer
-		if compress {
-			var gzErr error
-			gw, gzErr = gzip.NewWriterLevel(pw, gzip.BestSpeed)
-			if gzErr != nil {
-				streamErr = fmt.Errorf("create gzip writer: %w", gzErr)
-				return
+			if err := utils.TarFile(tw, filepath.Join(dataDir, file.Name), file.Name); err != nil {
+				return err
 			}
-			w = gw
-		}
-		tw := tar.NewWriter(w)
-
-		streamErr = tw.WriteHeader(&tar.Header{
-			Name:    snapshot.SnapshotJSONName,
-			Size:    int64(len(jsonData)),
-			Mode:    0o644,
-			ModTime: time.Now(),
-		})
-		if streamErr != nil {
-			return
-		}
-		if _, streamErr = tw.Write(jsonData); streamErr != nil {
-			return
-		}
-
-		if streamErr = utils.TarDir(tw, dataDir); streamErr != nil {
-			return
+			fileDone(file.Name)
 		}
+		return nil
+	})
+}
 
-		if streamErr = tw.Close(); streamErr != nil {
-			return
-		}
-		if gw != nil {
-			streamErr = gw.Close()
+// exportSource resolves ref for export; records predating manifests are hashed on the fly so every export carries a v2 envelope.
+func (lf *LocalFile) exportSource(ctx context.Context, ref string) (string, types.SnapshotConfig, []types.SnapshotFile, error) {
+	rec, err := lf.lookupRecord(ctx, ref, true)
+	if err != nil {
+		return "", types.SnapshotConfig{}, nil, err
+	}
+	files := rec.Files
+	if len(files) == 0 {
+		if files, err = snapshot.BuildManifest(ctx, rec.DataDir, lf.conf.EffectivePoolSize()); err != nil {
+			return "", types.SnapshotConfig{}, nil, fmt.Errorf("build manifest: %w", err)
 		}
-	}()
-
-	return utils.NewPipeStreamReader(pr, done, nil), nil
+	}
+	return rec.DataDir, snapshotRecordToConfig(rec), files, nil
 }
@@ -139,7 +139,7 @@ func gcModule(conf *Config, store storage.Store[snapshot.SnapshotIndex], locker
 				removed = append(removed, id)
 				// Skip orphan dirs and stale-pending — they never opened a snap.storage interval.
 				if m, ok := snap.records[id]; ok {
-					emitSnapStop(ctx, recorder, id, m.hypervisor)
+					snapshot.EmitSnapStop(ctx, recorder, id, m.hypervisor)
 				}
 			}
 			if err := cleanResolvedRecords(store, removed); err != nil {
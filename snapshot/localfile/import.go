@@ -2,7 +2,6 @@ package localfile
 
 import (
 	"cmp"
-	"compress/gzip"
 	"context"
 	"errors"
 	"fmt"
@@ -16,12 +15,14 @@ import (
 	"github.com/cocoonstack/cocoon/utils"
 )
 
-// Import reads a snapshot tar (gzip auto-detected), stores it, returns the new ID. Non-empty name/description override the envelope.
+// Import reads a snapshot tar (gzip/zstd auto-detected), verifies it against the envelope manifest (v2), stores it, returns the new ID.
+// Non-empty name/description override the envelope. v1 archives carry no manifest, so one is computed from the extracted data.
 func (lf *LocalFile) Import(ctx context.Context, r io.Reader, name, description string) (_ string, err error) {
-	tarReader, gzCloser, err := unwrapGzip(r)
+	tarReader, err := snapshot.Decompress(r, lf.conf.EffectivePoolSize())
 	if err != nil {
 		return "", err
 	}
+	defer tarReader.Close() //nolint:errcheck
 
 	id := utils.GenerateID()
 	dataDir := lf.conf.SnapshotDataDir(id)
@@ -38,17 +39,23 @@ func (lf *LocalFile) Import(ctx context.Context, r io.Reader, name, description
 	if err = utils.ExtractTar(dataDir, tarReader); err != nil {
 		return "", fmt.Errorf("extract archive: %w", err)
 	}
-	// Verify gzip checksum (CRC32 + size) when the input was gzip-wrapped.
-	if gzCloser != nil {
-		if err = gzCloser.Close(); err != nil {
-			return "", fmt.Errorf("gzip integrity check: %w", err)
-		}
+	if err = tarReader.Verify(); err != nil {
+		return "", err
 	}
 
-	cfg, err := readAndRemoveSnapshotJSON(dataDir)
+	envelope, err := readAndRemoveSnapshotJSON(dataDir)
 	if err != nil {
 		return "", err
 	}
+	cfg := envelope.Config
+	files := envelope.Files
+	if len(files) > 0 {
+		if err = snapshot.VerifyManifest(ctx, dataDir, files, lf.conf.EffectivePoolSize()); err != nil {
+			return "", fmt.Errorf("verify archive: %w", err)
+		}
+	} else if files, err = snapshot.BuildManifest(ctx, dataDir, lf.conf.EffectivePoolSize()); err != nil {
+		return "", fmt.Errorf("build manifest: %w", err)
+	}
 
 	cfg.ID = id
 	cfg.Name = cmp.Or(name, cfg.Name)
@@ -67,47 +74,28 @@ func (lf *LocalFile) Import(ctx context.Context, r io.Reader, name, description
 		Snapshot:       types.Snapshot{SnapshotConfig: cfg, CreatedAt: now},
 		DataDir:        dataDir,
 		SizeBytes:      size,
+		Files:          files,
 		LastAccessedAt: now,
 	}); err != nil {
 		return "", err
 	}
 
-	emitSnapStart(ctx, lf.metering, id, cfg.Hypervisor, size, now)
+	snapshot.EmitSnapStart(ctx, lf.metering, id, cfg.Hypervisor, size, now)
 	return id, nil
 }
 
-// unwrapGzip peeks at the first 2 bytes to detect gzip magic (0x1f 0x8b).
-// Returns the underlying tar reader and an optional gzip closer.
-func unwrapGzip(r io.Reader) (io.Reader, io.Closer, error) {
-	head, full, err := utils.PeekReader(r, 2)
-	if err != nil {
-		return nil, nil, fmt.Errorf("peek archive header: %w", err)
-	}
-	if len(head) < 2 {
-		return nil, nil, errors.New("peek archive header: stream shorter than gzip magic (2 bytes)")
-	}
-	if head[0] == 0x1f && head[1] == 0x8b {
-		gr, gzErr := gzip.NewReader(full)
-		if gzErr != nil {
-			return nil, nil, fmt.Errorf("decompress: %w", gzErr)
-		}
-		return gr, gr, nil
-	}
-	return full, nil, nil
-}
-
 // readAndRemoveSnapshotJSON reads the envelope and deletes it; the registered snapshot dir keeps only runtime sidecars (cocoon.json), not import metadata.
-func readAndRemoveSnapshotJSON(dataDir string) (types.SnapshotConfig, error) {
-	cfg, err := snapshot.ReadSnapshotEnvelope(dataDir)
+func readAndRemoveSnapshotJSON(dataDir string) (types.SnapshotExport, error) {
+	envelope, err := snapshot.ReadEnvelope(dataDir)
 	if err != nil {
 		if errors.Is(err, snapshot.ErrEnvelopeMissing) {
-			return types.SnapshotConfig{}, fmt.Errorf("invalid snapshot archive: %s not found", snapshot.SnapshotJSONName)
+			return types.SnapshotExport{}, fmt.Errorf("invalid snapshot archive: %s not found", snapshot.SnapshotJSONName)
 		}
-		return types.SnapshotConfig{}, err
+		return types.SnapshotExport{}, err
 	}
 	path := filepath.Join(dataDir, snapshot.SnapshotJSONName)
 	if err := os.Remove(path); err != nil {
-		return types.SnapshotConfig{}, fmt.Errorf("remove %s from data dir: %w", snapshot.SnapshotJSONName, err)
+		return types.SnapshotExport{}, fmt.Errorf("remove %s from data dir: %w", snapshot.SnapshotJSONName, err)
 	}
-	return cfg, nil
+	return envelope, nil
 }
@@ -29,7 +29,10 @@ var (
 	_ snapshot.Snapshot           = (*LocalFile)(nil)
 	_ snapshot.Direct             = (*LocalFile)(nil)
 	_ snapshot.CompressedExporter = (*LocalFile)(nil)
+	_ snapshot.StreamExporter     = (*LocalFile)(nil)
 	_ snapshot.DirectoryExporter  = (*LocalFile)(nil)
+	_ snapshot.EncryptedExporter  = (*LocalFile)(nil)
+	_ snapshot.Verifier           = (*LocalFile)(nil)
 )
 
 // Option configures a LocalFile constructed via New.
@@ -80,7 +83,7 @@ func (lf *LocalFile) DataDir(ctx context.Context, ref string) (string, types.Sna
 	return rec.DataDir, snapshotRecordToConfig(rec), nil
 }
 
-// Create stores a snapshot via placeholder→extract→finalize; a mid-flight crash leaves a pending record for GC.
+// Create stores a snapshot via placeholder→extract→hash→finalize; a mid-flight crash leaves a pending record for GC.
 func (lf *LocalFile) Create(ctx context.Context, cfg *types.SnapshotConfig, stream io.Reader) (_ string, err error) {
 	id := cfg.ID
 	if id == "" {
@@ -111,7 +114,9 @@ func (lf *LocalFile) Create(ctx context.Context, cfg *types.SnapshotConfig, stre
 	if err = os.MkdirAll(dataDir, 0o750); err != nil {
 		return "", fmt.Errorf("create data dir: %w", err)
 	}
-	if err = utils.ExtractTar(dataDir, stream); err != nil {
+	// Hashing during extraction records the manifest without a second pass over the data.
+	files, err := snapshot.ExtractManifest(dataDir, stream)
+	if err != nil {
 		return "", fmt.Errorf("extract snapshot data: %w", err)
 	}
 
@@ -127,13 +132,14 @@ func (lf *LocalFile) Create(ctx context.Context, cfg *types.SnapshotConfig, stre
 		}
 		rec.Pending = false
 		rec.SizeBytes = size
+		rec.Files = files
 		rec.LastAccessedAt = finalizedAt
 		return nil
 	}); err != nil {
 		return "", fmt.Errorf("finalize snapshot: %w", err)
 	}
 
-	emitSnapStart(ctx, lf.metering, id, cfg.Hypervisor, size, finalizedAt)
+	snapshot.EmitSnapStart(ctx, lf.metering, id, cfg.Hypervisor, size, finalizedAt)
 	return id, nil
 }
 
@@ -190,6 +196,18 @@ func (lf *LocalFile) Restore(ctx context.Context, ref string) (types.SnapshotCon
 	return snapshotRecordToConfig(rec), utils.TarDirStream(rec.DataDir, nil), nil
 }
 
+// Verify re-hashes the snapshot's data files against the manifest recorded at Create/Import time.
+func (lf *LocalFile) Verify(ctx context.Context, ref string) error {
+	rec, err := lf.lookupRecord(ctx, ref, false)
+	if err != nil {
+		return err
+	}
+	if len(rec.Files) == 0 {
+		return fmt.Errorf("snapshot %s: %w (created before manifests; re-export and re-import to add one)", rec.ID, snapshot.ErrNoManifest)
+	}
+	return snapshot.VerifyManifest(ctx, rec.DataDir, rec.Files, lf.conf.EffectivePoolSize())
+}
+
 func (lf *LocalFile) RegisterGC(orch *gc.Orchestrator) {
 	gc.Register(orch, gcModule(lf.conf, lf.store, lf.locker, lf.gcPolicy, lf.metering))
 }
@@ -219,7 +237,7 @@ func (lf *LocalFile) deleteOne(ctx context.Context, id string) error {
 		return fmt.Errorf("delete DB record %s: %w", id, err)
 	}
 	if deletedRecord {
-		emitSnapStop(ctx, lf.metering, id, hypType)
+		snapshot.EmitSnapStop(ctx, lf.metering, id, hypType)
 	}
 	return nil
 }
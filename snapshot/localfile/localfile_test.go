@@ -11,10 +11,15 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 
+	"filippo.io/age"
+
 	"github.com/cocoonstack/cocoon/config"
 	"github.com/cocoonstack/cocoon/metering"
+	"github.com/cocoonstack/cocoon/progress"
+	snapshotProgress "github.com/cocoonstack/cocoon/progress/snapshot"
 	"github.com/cocoonstack/cocoon/snapshot"
 	"github.com/cocoonstack/cocoon/types"
 	"github.com/cocoonstack/cocoon/utils"
@@ -180,11 +185,11 @@ func TestImportEmitsSnapStorageStart(t *testing.T) {
 	lf := newTestLFWithRecorder(t, rec)
 	ctx := t.Context()
 
-	envelope, err := snapshot.MarshalEnvelope(types.SnapshotConfig{
+	envelope, err := snapshot.MarshalEnvelope(types.SnapshotExport{Config: types.SnapshotConfig{
 		ID:         "src-snap",
 		Name:       "src-name",
 		Hypervisor: "cloud-hypervisor",
-	})
+	}})
 	if err != nil {
 		t.Fatalf("MarshalEnvelope: %v", err)
 	}
@@ -1168,6 +1173,98 @@ func TestExportCompressed_ImportRoundtrip(t *testing.T) {
 	}
 }
 
+func TestExportStream_ZstdImportRoundtrip(t *testing.T) {
+	lf := newTestLF(t)
+	ctx := t.Context()
+
+	origFiles := map[string][]byte{
+		"cow.raw":    bytes.Repeat([]byte("zstd roundtrip "), 4096),
+		"state.json": []byte(`{"cpu":4}`),
+	}
+	makeExportableSnapshot(t, lf, "zst-src", origFiles)
+
+	var (
+		mu     sync.Mutex
+		events []snapshotProgress.Event
+	)
+	stream, err := lf.ExportStream(ctx, "zst-src", snapshot.ExportOptions{
+		Compression: snapshot.Compression{Algo: snapshot.CompressZstd, Level: 1},
+		Concurrency: 2,
+		Tracker: progress.NewTracker(func(e snapshotProgress.Event) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, e)
+		}),
+	})
+	if err != nil {
+		t.Fatalf("ExportStream: %v", err)
+	}
+	archive, err := io.ReadAll(stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = stream.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(archive, []byte{0x28, 0xb5, 0x2f, 0xfd}) {
+		t.Fatalf("archive is not zstd: % x", archive[:4])
+	}
+
+	importedID, err := lf.Import(ctx, bytes.NewReader(archive), "zst-imported", "")
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	dataDir := lf.conf.SnapshotDataDir(importedID)
+	for name, want := range origFiles {
+		got, readErr := os.ReadFile(filepath.Join(dataDir, name))
+		if readErr != nil || !bytes.Equal(got, want) {
+			t.Errorf("file %s: got %d bytes, err %v", name, len(got), readErr)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) < 2 || events[0].Phase != snapshotProgress.PhaseExport {
+		t.Fatalf("events: %+v", events)
+	}
+	last := events[len(events)-1]
+	if last.Phase != snapshotProgress.PhaseDone || last.BytesDone != last.BytesTotal || last.BytesOut != int64(len(archive)) {
+		t.Errorf("done event: %+v (archive %d bytes)", last, len(archive))
+	}
+	files := 0
+	for _, e := range events {
+		if e.Phase == snapshotProgress.PhaseFile {
+			files++
+		}
+	}
+	if files != len(origFiles) {
+		t.Errorf("file events: got %d, want %d", files, len(origFiles))
+	}
+}
+
+func TestImport_RejectsTruncatedZstd(t *testing.T) {
+	lf := newTestLF(t)
+	ctx := t.Context()
+	makeExportableSnapshot(t, lf, "zst-trunc", map[string][]byte{"cow.raw": []byte("data")})
+
+	stream, err := lf.ExportStream(ctx, "zst-trunc", snapshot.ExportOptions{Compression: snapshot.Compression{Algo: snapshot.CompressZstd}})
+	if err != nil {
+		t.Fatalf("ExportStream: %v", err)
+	}
+	archive, err := io.ReadAll(stream)
+	stream.Close() //nolint:errcheck,gosec
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = lf.Import(ctx, bytes.NewReader(archive[:len(archive)-4]), "zst-bad", ""); err == nil {
+		t.Fatal("expected truncated zstd archive to be rejected")
+	}
+	snaps, _ := lf.List(ctx)
+	if len(snaps) != 1 {
+		t.Errorf("failed import left %d snapshots, want 1", len(snaps))
+	}
+}
+
 func TestExport_ImportRoundtrip(t *testing.T) {
 	lf := newTestLF(t)
 	ctx := t.Context()
@@ -1303,3 +1400,153 @@ func TestExportToDir_RejectNonEmpty(t *testing.T) {
 		t.Fatal("want non-empty rejection")
 	}
 }
+
+func TestImport_RejectsManifestMismatch(t *testing.T) {
+	lf := newTestLF(t)
+	ctx := t.Context()
+
+	envelope, err := snapshot.MarshalEnvelope(types.SnapshotExport{
+		Config: types.SnapshotConfig{Name: "tampered"},
+		Files:  []types.SnapshotFile{{Name: "cow.raw", Size: 9, SHA256: strings.Repeat("0", 64)}},
+	})
+	if err != nil {
+		t.Fatalf("MarshalEnvelope: %v", err)
+	}
+	stream := makeTar(t, map[string][]byte{
+		snapshot.SnapshotJSONName: envelope,
+		"cow.raw":                 []byte("disk-data"),
+	})
+
+	_, err = lf.Import(ctx, stream, "", "")
+	if !errors.Is(err, snapshot.ErrManifestMismatch) {
+		t.Fatalf("got %v, want wrap of ErrManifestMismatch", err)
+	}
+	if _, inspectErr := lf.Inspect(ctx, "tampered"); !errors.Is(inspectErr, snapshot.ErrNotFound) {
+		t.Errorf("failed import left a record: %v", inspectErr)
+	}
+}
+
+func TestExportToDir_WritesManifest(t *testing.T) {
+	lf := newTestLF(t)
+	ctx := t.Context()
+	makeExportableSnapshot(t, lf, "tdr-manifest", map[string][]byte{
+		"cow.raw":    []byte("disk data"),
+		"state.json": []byte(`{"cpu":4}`),
+	})
+
+	dst := filepath.Join(t.TempDir(), "exported")
+	if err := lf.ExportToDir(ctx, "tdr-manifest", dst); err != nil {
+		t.Fatalf("ExportToDir: %v", err)
+	}
+	envelope, err := snapshot.ReadEnvelope(dst)
+	if err != nil {
+		t.Fatalf("ReadEnvelope: %v", err)
+	}
+	if envelope.Version != snapshot.EnvelopeVersion || len(envelope.Files) != 2 {
+		t.Fatalf("envelope: version %d, %d files", envelope.Version, len(envelope.Files))
+	}
+	if _, err = snapshot.VerifyDir(ctx, dst, 2); err != nil {
+		t.Fatalf("VerifyDir: %v", err)
+	}
+
+	if err = os.WriteFile(filepath.Join(dst, "cow.raw"), []byte("disk dat4"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = snapshot.VerifyDir(ctx, dst, 2); !errors.Is(err, snapshot.ErrManifestMismatch) {
+		t.Fatalf("got %v, want wrap of ErrManifestMismatch", err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	lf := newTestLF(t)
+	ctx := t.Context()
+	id := makeExportableSnapshot(t, lf, "verify-me", map[string][]byte{"cow.raw": []byte("disk data")})
+
+	if err := lf.Verify(ctx, "verify-me"); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if err := os.Remove(filepath.Join(lf.conf.SnapshotDataDir(id), "cow.raw")); err != nil {
+		t.Fatal(err)
+	}
+	if err := lf.Verify(ctx, "verify-me"); !errors.Is(err, snapshot.ErrManifestMismatch) {
+		t.Fatalf("got %v, want wrap of ErrManifestMismatch", err)
+	}
+}
+
+func TestExportEncrypted_ImportRoundtrip(t *testing.T) {
+	lf := newTestLF(t)
+	ctx := t.Context()
+	origFiles := map[string][]byte{"cow.raw": []byte("secret disk")}
+	makeExportableSnapshot(t, lf, "enc-src", origFiles)
+
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := snapshot.NewEncrypter(id.Recipient().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, err := lf.ExportStream(ctx, "enc-src", snapshot.ExportOptions{
+		Compression: snapshot.Compression{Algo: snapshot.CompressGzip},
+		Encrypter:   enc,
+	})
+	if err != nil {
+		t.Fatalf("ExportStream: %v", err)
+	}
+	archive, err := io.ReadAll(stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = stream.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(archive, []byte("secret disk")) {
+		t.Fatal("plaintext leaked into encrypted archive")
+	}
+
+	r, encrypted, err := snapshot.MaybeDecrypt(bytes.NewReader(archive), []age.Identity{id})
+	if err != nil || !encrypted {
+		t.Fatalf("MaybeDecrypt: encrypted=%v err=%v", encrypted, err)
+	}
+	importedID, err := lf.Import(ctx, r, "enc-dst", "")
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(lf.conf.SnapshotDataDir(importedID), "cow.raw"))
+	if err != nil || !bytes.Equal(got, origFiles["cow.raw"]) {
+		t.Errorf("cow.raw: got %q, err %v", got, err)
+	}
+}
+
+func TestExportToDirEncrypted(t *testing.T) {
+	lf := newTestLF(t)
+	ctx := t.Context()
+	makeExportableSnapshot(t, lf, "enc-dir", map[string][]byte{"cow.raw": []byte("secret disk")})
+
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := snapshot.NewEncrypter(id.Recipient().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(t.TempDir(), "exported")
+	if err = lf.ExportToDirEncrypted(ctx, "enc-dir", dst, enc); err != nil {
+		t.Fatalf("ExportToDirEncrypted: %v", err)
+	}
+	if _, statErr := os.Stat(filepath.Join(dst, "cow.raw")); !errors.Is(statErr, fs.ErrNotExist) {
+		t.Errorf("plaintext cow.raw present: %v", statErr)
+	}
+	envelope, err := snapshot.ReadEnvelope(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if envelope.Encryption == nil || envelope.Encryption.Fingerprints[0] != snapshot.Fingerprint(id.Recipient()) {
+		t.Fatalf("encryption record: %+v", envelope.Encryption)
+	}
+	if _, err = snapshot.VerifyDir(ctx, dst, 0, id); err != nil {
+		t.Fatalf("VerifyDir: %v", err)
+	}
+}
@@ -0,0 +1,291 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"filippo.io/age"
+
+	"github.com/cocoonstack/cocoon/types"
+	"github.com/cocoonstack/cocoon/utils"
+)
+
+var (
+	// ErrNoManifest is returned when verification is requested but the envelope/record predates manifests (v1).
+	ErrNoManifest = errors.New("snapshot has no integrity manifest")
+	// ErrManifestMismatch wraps every size/digest/missing-file failure so callers can tell corruption from I/O errors.
+	ErrManifestMismatch = errors.New("snapshot integrity mismatch")
+)
+
+// BuildManifest hashes every regular data file in dir (snapshot.json excluded), sorted by name. concurrency caps parallel hashers (0 = unlimited).
+func BuildManifest(ctx context.Context, dir string, concurrency int) ([]types.SnapshotFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read dir %s: %w", dir, err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || entry.Name() == SnapshotJSONName {
+			continue
+		}
+		names = append(names, entry.Name())
+	}
+	slices.Sort(names)
+	return utils.Map(ctx, names, func(ctx context.Context, _ int, name string) (types.SnapshotFile, error) {
+		return hashFile(ctx, filepath.Join(dir, name))
+	}, concurrency)
+}
+
+// ExtractManifest extracts the flat tar r into dir and returns the manifest BuildManifest would, hashed on the way in
+// instead of by re-reading dir.
+func ExtractManifest(dir string, r io.Reader) ([]types.SnapshotFile, error) {
+	hashes := map[string]*countingHash{}
+	if err := utils.ExtractTarTee(dir, r, func(name string) io.Writer {
+		h := &countingHash{Hash: sha256.New()}
+		hashes[name] = h
+		return h
+	}); err != nil {
+		return nil, err
+	}
+	files := make([]types.SnapshotFile, 0, len(hashes))
+	for name, h := range hashes {
+		if name == SnapshotJSONName {
+			continue
+		}
+		files = append(files, types.SnapshotFile{Name: name, Size: h.n, SHA256: hex.EncodeToString(h.Sum(nil))})
+	}
+	slices.SortFunc(files, func(a, b types.SnapshotFile) int { return strings.Compare(a.Name, b.Name) })
+	return files, nil
+}
+
+// VerifyManifest re-hashes the files listed in files under dir and rejects data files the manifest does not list;
+// all mismatches are joined so one run reports every bad file.
+func VerifyManifest(ctx context.Context, dir string, files []types.SnapshotFile, concurrency int) error {
+	if len(files) == 0 {
+		return ErrNoManifest
+	}
+	unlisted, err := unlistedFiles(dir, files, "")
+	if err != nil {
+		return err
+	}
+	return verifyFiles(ctx, files, concurrency, unlisted, func(ctx context.Context, name string) (types.SnapshotFile, error) {
+		return hashFile(ctx, filepath.Join(dir, name))
+	})
+}
+
+// VerifyDir checks an envelope-bearing dir against its own manifest and returns the envelope config.
+// Encrypted dirs need ids; a v1 envelope yields ErrNoManifest alongside the config so callers may choose to proceed.
+func VerifyDir(ctx context.Context, dir string, concurrency int, ids ...age.Identity) (types.SnapshotConfig, error) {
+	envelope, err := ReadEnvelope(dir)
+	if err != nil {
+		return types.SnapshotConfig{}, err
+	}
+	if len(envelope.Files) == 0 {
+		return envelope.Config, ErrNoManifest
+	}
+	if envelope.Encryption == nil {
+		return envelope.Config, VerifyManifest(ctx, dir, envelope.Files, concurrency)
+	}
+	if len(ids) == 0 {
+		return envelope.Config, fmt.Errorf("%w: pass --decrypt-key", ErrEncrypted)
+	}
+	unlisted, err := unlistedFiles(dir, envelope.Files, EncryptedFileSuffix)
+	if err != nil {
+		return envelope.Config, err
+	}
+	return envelope.Config, verifyFiles(ctx, envelope.Files, concurrency, unlisted, func(ctx context.Context, name string) (types.SnapshotFile, error) {
+		var got types.SnapshotFile
+		err := openEncryptedEntry(dir, name, ids, func(hdr *tar.Header, r io.Reader) error {
+			lr, _, lrErr := utils.TarEntryReader(hdr, r)
+			if lrErr != nil {
+				return lrErr
+			}
+			var hashErr error
+			got, hashErr = hashReader(ctx, name, lr)
+			return hashErr
+		})
+		return got, err
+	})
+}
+
+// CopyTar re-emits the flat (sparse) tar entries of tr into tw unchanged while hashing their logical content.
+// tw may be nil to only hash; snapshot.json and non-regular entries are skipped; fileDone (optional) runs per copied file.
+func CopyTar(ctx context.Context, tw *tar.Writer, tr *tar.Reader, fileDone func(types.SnapshotFile)) ([]types.SnapshotFile, error) {
+	var files []types.SnapshotFile
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("tar next: %w", err)
+		}
+		name := filepath.Base(hdr.Name)
+		if hdr.Typeflag != tar.TypeReg || name == SnapshotJSONName || name == "." || name == ".." {
+			continue
+		}
+		var r io.Reader = tr
+		if tw != nil {
+			hdr.Name = name
+			if err = tw.WriteHeader(hdr); err != nil {
+				return nil, fmt.Errorf("write header %s: %w", name, err)
+			}
+			r = io.TeeReader(tr, tw)
+		}
+		// The tee sees the packed (hole-free) bytes; the hash sees the logical content.
+		lr, _, err := utils.TarEntryReader(hdr, r)
+		if err != nil {
+			return nil, err
+		}
+		file, err := hashReader(ctx, name, lr)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+		if fileDone != nil {
+			fileDone(file)
+		}
+	}
+	slices.SortFunc(files, func(a, b types.SnapshotFile) int { return strings.Compare(a.Name, b.Name) })
+	return files, nil
+}
+
+// CompareManifest checks got (e.g. from CopyTar) against want; like VerifyManifest, every problem is reported at once.
+func CompareManifest(want, got []types.SnapshotFile) error {
+	if len(want) == 0 {
+		return ErrNoManifest
+	}
+	byName := make(map[string]types.SnapshotFile, len(got))
+	for _, file := range got {
+		byName[file.Name] = file
+	}
+	var problems []string
+	for _, w := range want {
+		g, ok := byName[w.Name]
+		if p := manifestProblem(w, g, ok); p != "" {
+			problems = append(problems, p)
+		}
+	}
+	return mismatchError(problems)
+}
+
+// verifyFiles hashes every listed file; problems already found by the caller are reported along with the mismatches.
+func verifyFiles(ctx context.Context, files []types.SnapshotFile, concurrency int, problems []string, hash func(context.Context, string) (types.SnapshotFile, error)) error {
+	if len(files) == 0 {
+		return ErrNoManifest
+	}
+	found, err := utils.Map(ctx, files, func(ctx context.Context, _ int, want types.SnapshotFile) (string, error) {
+		if want.Name != filepath.Base(want.Name) || want.Name == "." || want.Name == ".." {
+			return fmt.Sprintf("%s: invalid file name in manifest", want.Name), nil
+		}
+		got, hashErr := hash(ctx, want.Name)
+		switch {
+		case errors.Is(hashErr, os.ErrNotExist):
+			return manifestProblem(want, got, false), nil
+		case hashErr != nil:
+			return "", hashErr
+		}
+		return manifestProblem(want, got, true), nil
+	}, concurrency)
+	if err != nil {
+		return err
+	}
+	return mismatchError(append(problems, slices.DeleteFunc(found, func(s string) bool { return s == "" })...))
+}
+
+// unlistedFiles reports the entries of dir, other than the envelope, that files does not list: an export dir is
+// self-contained, so anything extra is leftovers or tampering. suffix is what each data file carries on disk (".age"
+// in an encrypted dir).
+func unlistedFiles(dir string, files []types.SnapshotFile, suffix string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read dir %s: %w", dir, err)
+	}
+	listed := make(map[string]bool, len(files))
+	for _, f := range files {
+		listed[f.Name+suffix] = true
+	}
+	var problems []string
+	for _, entry := range entries {
+		if name := entry.Name(); name != SnapshotJSONName && !listed[name] {
+			problems = append(problems, fmt.Sprintf("%s: not in manifest", name))
+		}
+	}
+	return problems, nil
+}
+
+func manifestProblem(want, got types.SnapshotFile, found bool) string {
+	switch {
+	case !found:
+		return fmt.Sprintf("%s: missing", want.Name)
+	case got.Size != want.Size:
+		return fmt.Sprintf("%s: size %d, want %d", want.Name, got.Size, want.Size)
+	case got.SHA256 != want.SHA256:
+		return fmt.Sprintf("%s: sha256 %s, want %s", want.Name, got.SHA256, want.SHA256)
+	}
+	return ""
+}
+
+func mismatchError(problems []string) error {
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrManifestMismatch, strings.Join(problems, "; "))
+}
+
+// hashFile digests the logical content of path; ctx is checked between reads so a canceled verify stops promptly.
+func hashFile(ctx context.Context, path string) (types.SnapshotFile, error) {
+	f, err := os.Open(path) //nolint:gosec
+	if err != nil {
+		return types.SnapshotFile{}, err
+	}
+	defer f.Close() //nolint:errcheck
+	return hashReader(ctx, filepath.Base(path), f)
+}
+
+func hashReader(ctx context.Context, name string, r io.Reader) (types.SnapshotFile, error) {
+	h := sha256.New()
+	n, err := io.Copy(h, &ctxReader{ctx: ctx, r: r})
+	if err != nil {
+		return types.SnapshotFile{}, fmt.Errorf("hash %s: %w", name, err)
+	}
+	return types.SnapshotFile{
+		Name:   name,
+		Size:   n,
+		SHA256: hex.EncodeToString(h.Sum(nil)),
+	}, nil
+}
+
+// countingHash is a hash that also counts the bytes written to it.
+type countingHash struct {
+	hash.Hash
+	n int64
+}
+
+func (c *countingHash) Write(p []byte) (int, error) {
+	n, err := c.Hash.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
@@ -0,0 +1,158 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/cocoonstack/cocoon/types"
+	"github.com/cocoonstack/cocoon/utils"
+)
+
+func TestBuildManifest_SkipsEnvelopeAndSorts(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{"b.raw": "bbb", "a.json": "{}", SnapshotJSONName: "{}"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, err := BuildManifest(t.Context(), dir, 0)
+	if err != nil {
+		t.Fatalf("BuildManifest: %v", err)
+	}
+	if len(files) != 2 || files[0].Name != "a.json" || files[1].Name != "b.raw" {
+		t.Fatalf("got %+v", files)
+	}
+	// sha256("bbb")
+	if files[1].Size != 3 || files[1].SHA256 != "3e744b9dc39389baf0c5a0660589b8402f3dbb49b89b3e75f2c9355852a3c677" {
+		t.Errorf("b.raw: %+v", files[1])
+	}
+}
+
+func TestBuildManifest_SparseHashesLogicalContent(t *testing.T) {
+	dir := t.TempDir()
+	sparse := filepath.Join(dir, "sparse.raw")
+	f, err := os.Create(sparse) //nolint:gosec
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = f.Truncate(1 << 20); err != nil {
+		t.Fatal(err)
+	}
+	f.Close() //nolint:errcheck,gosec
+	if err = os.WriteFile(filepath.Join(dir, "dense.raw"), make([]byte, 1<<20), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	files, err := BuildManifest(t.Context(), dir, 2)
+	if err != nil {
+		t.Fatalf("BuildManifest: %v", err)
+	}
+	if files[0].SHA256 != files[1].SHA256 || files[0].Size != files[1].Size {
+		t.Errorf("sparse and dense zero files differ: %+v", files)
+	}
+}
+
+func TestExtractManifest_MatchesBuildManifest(t *testing.T) {
+	src := t.TempDir()
+	for name, data := range map[string]string{"b.raw": "bbb", "a.json": "{}", SnapshotJSONName: "{}"} {
+		if err := os.WriteFile(filepath.Join(src, name), []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f, err := os.Create(filepath.Join(src, "mem.raw")) //nolint:gosec
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.WriteAt([]byte("data"), 512<<10); err != nil {
+		t.Fatal(err)
+	}
+	if err = f.Truncate(1 << 20); err != nil {
+		t.Fatal(err)
+	}
+	f.Close() //nolint:errcheck,gosec
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err = utils.TarDir(tw, src); err != nil {
+		t.Fatal(err)
+	}
+	if err = tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	dst := t.TempDir()
+	got, err := ExtractManifest(dst, &buf)
+	if err != nil {
+		t.Fatalf("ExtractManifest: %v", err)
+	}
+	want, err := BuildManifest(t.Context(), src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+	if err = VerifyManifest(t.Context(), dst, got, 0); err != nil {
+		t.Errorf("extracted data does not verify: %v", err)
+	}
+}
+
+func TestVerifyManifest_ReportsAllProblems(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "ok.raw"), []byte("ok"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	files, err := BuildManifest(t.Context(), dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files = append(files, types.SnapshotFile{Name: "gone.raw", Size: 1, SHA256: "00"})
+	err = VerifyManifest(t.Context(), dir, files, 0)
+	if !errors.Is(err, ErrManifestMismatch) {
+		t.Fatalf("got %v, want wrap of ErrManifestMismatch", err)
+	}
+}
+
+func TestVerifyManifest_RejectsUnlistedFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "ok.raw"), []byte("ok"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	files, err := BuildManifest(t.Context(), dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(dir, "extra.raw"), []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	err = VerifyManifest(t.Context(), dir, files, 0)
+	if !errors.Is(err, ErrManifestMismatch) || !strings.Contains(err.Error(), "extra.raw: not in manifest") {
+		t.Fatalf("got %v, want unlisted extra.raw reported", err)
+	}
+}
+
+func TestVerifyManifest_RejectsPathEscape(t *testing.T) {
+	err := VerifyManifest(t.Context(), t.TempDir(), []types.SnapshotFile{{Name: "../etc/passwd"}}, 0)
+	if !errors.Is(err, ErrManifestMismatch) {
+		t.Fatalf("got %v, want wrap of ErrManifestMismatch", err)
+	}
+}
+
+func TestVerifyDir_V1HasNoManifest(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, SnapshotJSONName),
+		[]byte(`{"version": 1, "config": {"name": "legacy"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := VerifyDir(t.Context(), dir, 0)
+	if !errors.Is(err, ErrNoManifest) {
+		t.Fatalf("got %v, want ErrNoManifest", err)
+	}
+	if cfg.Name != "legacy" {
+		t.Errorf("config not returned alongside ErrNoManifest: %+v", cfg)
+	}
+}
@@ -1,4 +1,4 @@
-package localfile
+package snapshot
 
 import (
 	"context"
@@ -7,14 +7,16 @@ import (
 	"github.com/cocoonstack/cocoon/metering"
 )
 
-func emitSnapStart(ctx context.Context, rec metering.Recorder, snapID, hypType string, size int64, at time.Time) {
+// EmitSnapStart opens a snap.storage metering interval for a stored snapshot.
+func EmitSnapStart(ctx context.Context, rec metering.Recorder, snapID, hypType string, size int64, at time.Time) {
 	rec.Emit(ctx, metering.Entry{
 		Kind: metering.KindSnapStorageStart, SnapshotID: snapID, Hypervisor: hypType,
 		Shape: metering.Shape{StorageBytes: size}, EmittedAt: at,
 	})
 }
 
-func emitSnapStop(ctx context.Context, rec metering.Recorder, snapID, hypType string) {
+// EmitSnapStop closes the snapshot's snap.storage interval on removal.
+func EmitSnapStop(ctx context.Context, rec metering.Recorder, snapID, hypType string) {
 	rec.Emit(ctx, metering.Entry{
 		Kind: metering.KindSnapStorageStop, SnapshotID: snapID,
 		Reason: metering.ReasonSnapRemove, Hypervisor: hypType, EmittedAt: time.Now(),
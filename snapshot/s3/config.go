@@ -0,0 +1,46 @@
+package s3
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/cocoonstack/cocoon/config"
+	"github.com/cocoonstack/cocoon/utils"
+)
+
+const dataSuffix = ".tar"
+
+// Config holds s3 snapshot backend configuration, embedding the global config.
+type Config struct {
+	*config.Config
+}
+
+func NewConfig(conf *config.Config) *Config {
+	return &Config{Config: conf}
+}
+
+func (c *Config) EnsureDirs() error {
+	return utils.EnsureDirs(c.CacheDir())
+}
+
+// CacheDir holds extracted snapshots served through snapshot.Direct; it is disposable, the bucket is the source of truth.
+func (c *Config) CacheDir() string { return filepath.Join(c.dir(), "cache") }
+
+func (c *Config) SnapshotCacheDir(id string) string { return filepath.Join(c.CacheDir(), id) }
+
+// IndexLock serializes this host's index writers; cross-host writers are ordered by conditional PUTs.
+func (c *Config) IndexLock() string { return filepath.Join(c.dir(), "index.lock") }
+
+func (c *Config) IndexKey() string { return c.key("index.json") }
+
+// DataKey is the object holding the snapshot's data files as one flat sparse tar.
+func (c *Config) DataKey(id string) string { return c.key("data", id+dataSuffix) }
+
+func (c *Config) DataPrefix() string { return c.key("data") + "/" }
+
+func (c *Config) dir() string { return filepath.Join(c.RootDir, "snapshot", "s3") }
+
+func (c *Config) key(elem ...string) string {
+	return path.Join(append([]string{strings.Trim(c.S3.Prefix, "/")}, elem...)...)
+}
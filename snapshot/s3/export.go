@@ -0,0 +1,153 @@
+package s3
+
+import (
+	"archive/tar"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cocoonstack/cocoon/snapshot"
+	"github.com/cocoonstack/cocoon/types"
+	"github.com/cocoonstack/cocoon/utils"
+)
+
+// Export streams the snapshot as a raw tar (first entry: snapshot.json envelope; rest: data files).
+func (s *S3) Export(ctx context.Context, ref string) (io.ReadCloser, error) {
+	return s.ExportStream(ctx, ref, snapshot.ExportOptions{})
+}
+
+// ExportCompressed streams the snapshot as a gzip-compressed tar archive.
+func (s *S3) ExportCompressed(ctx context.Context, ref string) (io.ReadCloser, error) {
+	return s.ExportStream(ctx, ref, snapshot.ExportOptions{Compression: snapshot.Compression{Algo: snapshot.CompressGzip}})
+}
+
+// ExportStream copies the stored object's entries into the shared export pipeline, re-checking them against the manifest as they pass.
+func (s *S3) ExportStream(ctx context.Context, ref string, opts snapshot.ExportOptions) (io.ReadCloser, error) {
+	rec, err := s.lookupRecord(ctx, ref, true)
+	if err != nil {
+		return nil, err
+	}
+	opts.Concurrency = cmp.Or(opts.Concurrency, s.conf.EffectivePoolSize())
+	envelope := types.SnapshotExport{Config: snapshotRecordToConfig(rec), Files: rec.Files}
+	return snapshot.StreamExport(ctx, envelope, opts, func(tw *tar.Writer, fileDone func(string)) error {
+		rc, _, getErr := s.objects.get(ctx, s.conf.DataKey(rec.ID))
+		if getErr != nil {
+			return fmt.Errorf("open snapshot data %s: %w", rec.ID, getErr)
+		}
+		defer rc.Close() //nolint:errcheck
+		got, copyErr := snapshot.CopyTar(ctx, tw, tar.NewReader(rc), func(f types.SnapshotFile) { fileDone(f.Name) })
+		if copyErr != nil {
+			return copyErr
+		}
+		return snapshot.CompareManifest(rec.Files, got)
+	})
+}
+
+// ExportToDir downloads the object into dir and writes snapshot.json (with manifest) last so its presence marks all data ready.
+func (s *S3) ExportToDir(ctx context.Context, ref, dir string) error {
+	rec, err := s.lookupRecord(ctx, ref, true)
+	if err != nil {
+		return err
+	}
+	if err = utils.EnsureDirs(dir); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", dir, err)
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("target dir %s is not empty", dir)
+	}
+	rc, _, err := s.objects.get(ctx, s.conf.DataKey(rec.ID))
+	if err != nil {
+		return fmt.Errorf("open snapshot data %s: %w", rec.ID, err)
+	}
+	err = utils.ExtractTar(dir, rc)
+	rc.Close() //nolint:errcheck,gosec
+	if err != nil {
+		return fmt.Errorf("download snapshot data %s: %w", rec.ID, err)
+	}
+	if err = snapshot.VerifyManifest(ctx, dir, rec.Files, s.conf.EffectivePoolSize()); err != nil {
+		return fmt.Errorf("verify downloaded snapshot %s: %w", rec.ID, err)
+	}
+	if err = snapshot.WriteSnapshotEnvelope(dir, types.SnapshotExport{Config: snapshotRecordToConfig(rec), Files: rec.Files}); err != nil {
+		return fmt.Errorf("write envelope: %w", err)
+	}
+	return nil
+}
+
+// Import streams an export archive (gzip/zstd auto-detected) straight into the bucket, verifying the envelope manifest (v2) on the way.
+// snapshot.json must be the first entry, which is how every export writes it; non-empty name/description override the envelope.
+func (s *S3) Import(ctx context.Context, r io.Reader, name, description string) (_ string, err error) {
+	dr, err := snapshot.Decompress(r, s.conf.EffectivePoolSize())
+	if err != nil {
+		return "", err
+	}
+	defer dr.Close() //nolint:errcheck
+
+	tr := tar.NewReader(dr)
+	hdr, err := tr.Next()
+	if err != nil {
+		return "", fmt.Errorf("read archive: %w", err)
+	}
+	if filepath.Base(hdr.Name) != snapshot.SnapshotJSONName {
+		return "", fmt.Errorf("invalid snapshot archive: first entry is %q, want %s", hdr.Name, snapshot.SnapshotJSONName)
+	}
+	envelope, err := snapshot.DecodeEnvelope(tr)
+	if err != nil {
+		return "", err
+	}
+
+	id := utils.GenerateID()
+	cfg := envelope.Config
+	cfg.ID = id
+	cfg.Name = cmp.Or(name, cfg.Name)
+	cfg.Description = cmp.Or(description, cfg.Description)
+	if err = cfg.Validate(); err != nil {
+		return "", err
+	}
+	if err = s.insertRecord(ctx, id, cfg.Name, &snapshot.SnapshotRecord{
+		Snapshot: types.Snapshot{SnapshotConfig: cfg, CreatedAt: time.Now()},
+		Pending:  true,
+	}); err != nil {
+		return "", err
+	}
+	defer func() {
+		if err != nil {
+			s.rollbackCreate(ctx, id, cfg.Name)
+		}
+	}()
+
+	files, size, err := s.upload(ctx, id, func(tw *tar.Writer) ([]types.SnapshotFile, error) {
+		got, copyErr := snapshot.CopyTar(ctx, tw, tr, nil)
+		if copyErr != nil {
+			return nil, fmt.Errorf("read archive: %w", copyErr)
+		}
+		if verifyErr := dr.Verify(); verifyErr != nil {
+			return nil, verifyErr
+		}
+		// v1 archives carry no manifest; the hashes just computed become it.
+		if len(envelope.Files) > 0 {
+			if cmpErr := snapshot.CompareManifest(envelope.Files, got); cmpErr != nil {
+				return nil, fmt.Errorf("verify archive: %w", cmpErr)
+			}
+		}
+		return got, nil
+	})
+	if err != nil {
+		if errors.Is(err, snapshot.ErrManifestMismatch) {
+			return "", err
+		}
+		return "", fmt.Errorf("import snapshot data: %w", err)
+	}
+	if err = s.finalize(ctx, id, size, files); err != nil {
+		return "", err
+	}
+	return id, nil
+}
@@ -0,0 +1,153 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/projecteru2/core/log"
+
+	"github.com/cocoonstack/cocoon/gc"
+	"github.com/cocoonstack/cocoon/snapshot"
+	"github.com/cocoonstack/cocoon/utils"
+)
+
+const (
+	// pendingGCGrace lets a slow upload finish before GC reclaims a pending record and its object.
+	pendingGCGrace = 24 * time.Hour
+	// tmpCacheInfix marks cache dirs still being downloaded by DataDir.
+	tmpCacheInfix = ".tmp-"
+)
+
+type snapshotGCSnapshot struct {
+	blobIDs      map[string]struct{}
+	snapshotIDs  map[string]struct{}
+	objectIDs    []string
+	cacheDirs    []string
+	stalePending []string
+}
+
+func (s snapshotGCSnapshot) UsedBlobIDs() map[string]struct{} { return s.blobIDs }
+
+// gcModule reclaims objects and cache dirs without an index record plus pending records past the grace period.
+// The module lock is host-local; cross-host safety comes from Create inserting its pending record before the upload starts.
+func gcModule(conf *Config, objects objectStore, store *indexStore) gc.Module[snapshotGCSnapshot] {
+	return gc.Module[snapshotGCSnapshot]{
+		Name:   "snapshot",
+		Locker: store.locker,
+		ReadDB: func(ctx context.Context) (snapshotGCSnapshot, error) {
+			snap := snapshotGCSnapshot{
+				blobIDs:     make(map[string]struct{}),
+				snapshotIDs: make(map[string]struct{}),
+			}
+			idx, _, err := store.load(ctx)
+			if err != nil {
+				return snap, err
+			}
+			cutoff := time.Now().Add(-pendingGCGrace)
+			for id, rec := range idx.Snapshots {
+				if rec == nil {
+					continue
+				}
+				snap.snapshotIDs[id] = struct{}{}
+				maps.Copy(snap.blobIDs, rec.ImageBlobIDs)
+				if rec.Pending && rec.CreatedAt.Before(cutoff) {
+					snap.stalePending = append(snap.stalePending, id)
+				}
+			}
+			keys, err := objects.list(ctx, conf.DataPrefix())
+			if err != nil {
+				return snap, err
+			}
+			for _, key := range keys {
+				if id, ok := strings.CutSuffix(strings.TrimPrefix(key, conf.DataPrefix()), dataSuffix); ok {
+					snap.objectIDs = append(snap.objectIDs, id)
+				}
+			}
+			if snap.cacheDirs, err = utils.ScanSubdirs(conf.CacheDir()); err != nil {
+				return snap, err
+			}
+			// In-flight downloads belong to a live DataDir; only crash leftovers past the grace period are fair game.
+			snap.cacheDirs = slices.DeleteFunc(snap.cacheDirs, func(name string) bool {
+				if !strings.Contains(name, tmpCacheInfix) {
+					return false
+				}
+				fi, statErr := os.Stat(filepath.Join(conf.CacheDir(), name))
+				return statErr != nil || fi.ModTime().After(cutoff)
+			})
+			return snap, nil
+		},
+		Resolve: func(_ context.Context, snap snapshotGCSnapshot, _ map[string]any) []string {
+			candidates := slices.Concat(
+				utils.FilterUnreferenced(snap.objectIDs, snap.snapshotIDs),
+				utils.FilterUnreferenced(snap.cacheDirs, snap.snapshotIDs),
+				snap.stalePending,
+			)
+			slices.Sort(candidates)
+			return slices.Compact(candidates)
+		},
+		Collect: func(ctx context.Context, ids []string, snap snapshotGCSnapshot) error {
+			logger := log.WithFunc("gc.snapshot.s3")
+			var (
+				errs    []error
+				removed = make([]string, 0, len(ids))
+			)
+			for _, id := range ids {
+				if err := ctx.Err(); err != nil {
+					errs = append(errs, err)
+					break
+				}
+				if !strings.Contains(id, tmpCacheInfix) {
+					if err := objects.remove(ctx, conf.DataKey(id)); err != nil {
+						errs = append(errs, fmt.Errorf("remove snapshot data %s: %w", id, err))
+						continue
+					}
+				}
+				if err := os.RemoveAll(conf.SnapshotCacheDir(id)); err != nil {
+					errs = append(errs, fmt.Errorf("remove cache dir %s: %w", id, err))
+					continue
+				}
+				logger.Infof(ctx, "collected snapshot %s", id)
+				// Orphans and stale-pending never opened a snap.storage interval, so nothing is emitted.
+				removed = append(removed, id)
+			}
+			if err := cleanStalePending(ctx, store, removed, snap.stalePending); err != nil {
+				errs = append(errs, fmt.Errorf("clean index records: %w", err))
+			}
+			return errors.Join(errs...)
+		},
+	}
+}
+
+// cleanStalePending drops pending records GC just reclaimed; ready records are never touched here.
+func cleanStalePending(ctx context.Context, store *indexStore, removed, stalePending []string) error {
+	var drop []string
+	for _, id := range removed {
+		if slices.Contains(stalePending, id) {
+			drop = append(drop, id)
+		}
+	}
+	if len(drop) == 0 {
+		return nil
+	}
+	cutoff := time.Now().Add(-pendingGCGrace)
+	return store.update(ctx, func(idx *snapshot.SnapshotIndex) error {
+		for _, id := range drop {
+			rec := idx.Snapshots[id]
+			if rec == nil || !rec.Pending || !rec.CreatedAt.Before(cutoff) {
+				continue
+			}
+			if rec.Name != "" && idx.Names[rec.Name] == id {
+				delete(idx.Names, rec.Name)
+			}
+			delete(idx.Snapshots, id)
+		}
+		return nil
+	})
+}
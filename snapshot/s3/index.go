@@ -0,0 +1,85 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/projecteru2/core/log"
+
+	"github.com/cocoonstack/cocoon/lock"
+	"github.com/cocoonstack/cocoon/snapshot"
+)
+
+// indexCASAttempts bounds read-modify-write retries when another host wins the conditional PUT.
+const indexCASAttempts = 8
+
+// indexStore keeps the SnapshotIndex as one JSON object; updates are conditional PUTs on the ETag read, retried on conflict.
+type indexStore struct {
+	objects objectStore
+	key     string
+	locker  lock.Locker
+}
+
+// With runs fn on a fresh copy of the index; nothing is persisted.
+func (s *indexStore) With(ctx context.Context, fn func(*snapshot.SnapshotIndex) error) error {
+	idx, _, err := s.load(ctx)
+	if err != nil {
+		return err
+	}
+	return fn(idx)
+}
+
+// Update re-runs fn on the latest index until the conditional PUT lands; fn must tolerate being called more than once.
+func (s *indexStore) Update(ctx context.Context, fn func(*snapshot.SnapshotIndex) error) error {
+	if err := s.locker.Lock(ctx); err != nil {
+		return err
+	}
+	defer s.locker.Unlock(ctx) //nolint:errcheck
+	return s.update(ctx, fn)
+}
+
+// update is Update without the host-local lock, for callers already holding it (GC).
+func (s *indexStore) update(ctx context.Context, fn func(*snapshot.SnapshotIndex) error) error {
+	logger := log.WithFunc("s3.index.update")
+	for attempt := range indexCASAttempts {
+		idx, etag, err := s.load(ctx)
+		if err != nil {
+			return err
+		}
+		if err = fn(idx); err != nil {
+			return err
+		}
+		data, err := json.Marshal(idx)
+		if err != nil {
+			return fmt.Errorf("marshal index: %w", err)
+		}
+		_, err = s.objects.put(ctx, s.key, bytes.NewReader(data), int64(len(data)), putCond{ifMatch: etag, ifNoneMatch: etag == ""})
+		if !errors.Is(err, errPrecondition) {
+			return err
+		}
+		logger.Debugf(ctx, "index %s changed concurrently, retrying (attempt %d)", s.key, attempt+1)
+	}
+	return fmt.Errorf("update index %s: %w after %d attempts", s.key, errPrecondition, indexCASAttempts)
+}
+
+// load returns the index and its ETag; a missing object is an empty index with an empty ETag.
+func (s *indexStore) load(ctx context.Context) (*snapshot.SnapshotIndex, string, error) {
+	idx := &snapshot.SnapshotIndex{}
+	rc, info, err := s.objects.get(ctx, s.key)
+	if errors.Is(err, errNoObject) {
+		idx.Init()
+		return idx, "", nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("read index %s: %w", s.key, err)
+	}
+	defer rc.Close() //nolint:errcheck
+	if err = json.NewDecoder(rc).Decode(idx); err != nil {
+		return nil, "", fmt.Errorf("decode index %s: %w", s.key, err)
+	}
+	idx.Init()
+	return idx, info.etag, nil
+}
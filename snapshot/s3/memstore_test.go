@@ -0,0 +1,98 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5" //nolint:gosec // ETag stand-in, as S3 does for single-part objects
+	"encoding/hex"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// memStore is an in-memory S3 stand-in with S3's conditional-PUT semantics.
+type memStore struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	puts    map[string]int
+}
+
+func newMemStore() *memStore {
+	return &memStore{objects: make(map[string][]byte), puts: make(map[string]int)}
+}
+
+func memETag(data []byte) string {
+	sum := md5.Sum(data) //nolint:gosec
+	return hex.EncodeToString(sum[:])
+}
+
+func (m *memStore) put(ctx context.Context, key string, r io.Reader, _ int64, cond putCond) (objectInfo, error) {
+	// Read outside the lock like a real upload; the condition is evaluated at commit time.
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return objectInfo{}, err
+	}
+	if err = ctx.Err(); err != nil {
+		return objectInfo{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cur, exists := m.objects[key]
+	switch {
+	case cond.ifNoneMatch && exists:
+		return objectInfo{}, fmt.Errorf("%w: %s exists", errPrecondition, key)
+	case cond.ifMatch != "" && (!exists || memETag(cur) != cond.ifMatch):
+		return objectInfo{}, fmt.Errorf("%w: %s etag moved", errPrecondition, key)
+	}
+	m.objects[key] = data
+	m.puts[key]++
+	return objectInfo{etag: memETag(data), size: int64(len(data))}, nil
+}
+
+func (m *memStore) get(_ context.Context, key string) (io.ReadCloser, objectInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.objects[key]
+	if !ok {
+		return nil, objectInfo{}, fmt.Errorf("%w: %s", errNoObject, key)
+	}
+	return io.NopCloser(bytes.NewReader(data)), objectInfo{etag: memETag(data), size: int64(len(data))}, nil
+}
+
+func (m *memStore) remove(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects, key)
+	return nil
+}
+
+func (m *memStore) list(_ context.Context, prefix string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var keys []string
+	for key := range m.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys, nil
+}
+
+func (m *memStore) has(key string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.objects[key]
+	return ok
+}
+
+// corrupt flips one byte near the end of key's payload.
+func (m *memStore) corrupt(key string, offsetFromEnd int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data := slices.Clone(m.objects[key])
+	data[len(data)-offsetFromEnd] ^= 0xff
+	m.objects[key] = data
+}
@@ -0,0 +1,158 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+
+	"github.com/cocoonstack/cocoon/config"
+)
+
+const (
+	defaultPartSizeMB = 64
+
+	// maxStreamThreads caps parallel parts for unknown-size uploads, each of which buffers a whole part in memory.
+	maxStreamThreads = 4
+)
+
+var (
+	errNoObject     = errors.New("object not found")
+	errPrecondition = errors.New("object changed concurrently")
+)
+
+// putCond guards a PUT for optimistic locking: ifMatch requires the current ETag, ifNoneMatch requires absence.
+type putCond struct {
+	ifMatch     string
+	ifNoneMatch bool
+}
+
+type objectInfo struct {
+	etag string
+	size int64
+}
+
+// objectStore is the slice of the S3 API the backend needs; tests substitute an in-memory stand-in.
+type objectStore interface {
+	// put uploads r; size -1 streams it as a multipart upload of unknown length.
+	put(ctx context.Context, key string, r io.Reader, size int64, cond putCond) (objectInfo, error)
+	// get returns errNoObject for a missing key.
+	get(ctx context.Context, key string) (io.ReadCloser, objectInfo, error)
+	// remove treats a missing key as success.
+	remove(ctx context.Context, key string) error
+	// list returns every key under prefix.
+	list(ctx context.Context, prefix string) ([]string, error)
+}
+
+type minioStore struct {
+	client   *minio.Client
+	bucket   string
+	partSize uint64
+	threads  uint
+}
+
+func newMinioStore(conf *config.S3Config, threads int) (*minioStore, error) {
+	creds := credentials.NewStaticV4(conf.AccessKeyID, conf.SecretAccessKey, "")
+	if conf.AccessKeyID == "" {
+		creds = credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.EnvMinio{},
+			&credentials.FileAWSCredentials{},
+			&credentials.IAM{},
+		})
+	}
+	client, err := minio.New(conf.Endpoint, &minio.Options{
+		Creds:  creds,
+		Secure: !conf.Insecure,
+		Region: conf.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("s3 client for %s: %w", conf.Endpoint, err)
+	}
+	partSizeMB := conf.PartSizeMB
+	if partSizeMB == 0 {
+		partSizeMB = defaultPartSizeMB
+	}
+	return &minioStore{
+		client:   client,
+		bucket:   conf.Bucket,
+		partSize: uint64(partSizeMB) << 20, //nolint:gosec // validated >= 0
+		threads:  uint(max(threads, 1)),    //nolint:gosec
+	}, nil
+}
+
+func (m *minioStore) put(ctx context.Context, key string, r io.Reader, size int64, cond putCond) (objectInfo, error) {
+	threads := m.threads
+	if size < 0 {
+		threads = min(threads, maxStreamThreads)
+	}
+	opts := minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+		PartSize:    m.partSize,
+		NumThreads:  threads,
+		// Buffer NumThreads parts and upload them in parallel; the tar stream itself is not seekable.
+		ConcurrentStreamParts: size < 0,
+	}
+	switch {
+	case cond.ifMatch != "":
+		opts.SetMatchETag(cond.ifMatch)
+	case cond.ifNoneMatch:
+		opts.SetMatchETagExcept("*")
+	}
+	info, err := m.client.PutObject(ctx, m.bucket, key, r, size, opts)
+	if err != nil {
+		return objectInfo{}, mapError(err)
+	}
+	return objectInfo{etag: info.ETag, size: info.Size}, nil
+}
+
+func (m *minioStore) get(ctx context.Context, key string) (io.ReadCloser, objectInfo, error) {
+	obj, err := m.client.GetObject(ctx, m.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, objectInfo{}, mapError(err)
+	}
+	// GetObject is lazy; Stat issues the request so a missing key surfaces here rather than on first Read.
+	info, err := obj.Stat()
+	if err != nil {
+		obj.Close() //nolint:errcheck,gosec
+		return nil, objectInfo{}, mapError(err)
+	}
+	return obj, objectInfo{etag: info.ETag, size: info.Size}, nil
+}
+
+func (m *minioStore) remove(ctx context.Context, key string) error {
+	if err := m.client.RemoveObject(ctx, m.bucket, key, minio.RemoveObjectOptions{}); err != nil {
+		if err = mapError(err); !errors.Is(err, errNoObject) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *minioStore) list(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	for obj := range m.client.ListObjects(ctx, m.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return nil, fmt.Errorf("list %s: %w", prefix, obj.Err)
+		}
+		keys = append(keys, obj.Key)
+	}
+	return keys, nil
+}
+
+// mapError folds S3 status codes the backend branches on into sentinel errors.
+func mapError(err error) error {
+	resp := minio.ToErrorResponse(err)
+	switch {
+	case resp.Code == minio.NoSuchKey || resp.StatusCode == http.StatusNotFound && !strings.Contains(resp.Code, "Bucket"):
+		return fmt.Errorf("%w: %w", errNoObject, err)
+	case resp.Code == minio.PreconditionFailed || resp.StatusCode == http.StatusPreconditionFailed:
+		return fmt.Errorf("%w: %w", errPrecondition, err)
+	}
+	return err
+}
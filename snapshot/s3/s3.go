@@ -0,0 +1,380 @@
+// Package s3 stores snapshots in an S3-compatible bucket so they outlive the host that took them.
+package s3
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"time"
+
+	"github.com/projecteru2/core/log"
+
+	"github.com/cocoonstack/cocoon/config"
+	"github.com/cocoonstack/cocoon/gc"
+	"github.com/cocoonstack/cocoon/lock/flock"
+	"github.com/cocoonstack/cocoon/metering"
+	"github.com/cocoonstack/cocoon/snapshot"
+	"github.com/cocoonstack/cocoon/types"
+	"github.com/cocoonstack/cocoon/utils"
+)
+
+const typ = "s3"
+
+// compile-time interface checks.
+var (
+	_ snapshot.Snapshot           = (*S3)(nil)
+	_ snapshot.Direct             = (*S3)(nil)
+	_ snapshot.CompressedExporter = (*S3)(nil)
+	_ snapshot.StreamExporter     = (*S3)(nil)
+	_ snapshot.DirectoryExporter  = (*S3)(nil)
+	_ snapshot.Verifier           = (*S3)(nil)
+)
+
+// S3 keeps the snapshot index and one sparse tar object per snapshot in a bucket; Direct callers get a local extracted cache.
+type S3 struct {
+	conf     *Config
+	objects  objectStore
+	store    *indexStore
+	metering metering.Recorder
+}
+
+// New builds an S3 snapshot backend from conf.S3; rec may be nil and falls back to NopRecorder.
+func New(conf *config.Config, rec metering.Recorder) (*S3, error) {
+	if conf == nil || conf.S3 == nil {
+		return nil, fmt.Errorf("s3 config is nil")
+	}
+	objects, err := newMinioStore(conf.S3, conf.EffectivePoolSize())
+	if err != nil {
+		return nil, err
+	}
+	return newWithStore(conf, rec, objects)
+}
+
+func newWithStore(conf *config.Config, rec metering.Recorder, objects objectStore) (*S3, error) {
+	cfg := NewConfig(conf)
+	if err := cfg.EnsureDirs(); err != nil {
+		return nil, fmt.Errorf("ensure dirs: %w", err)
+	}
+	if rec == nil {
+		rec = metering.NopRecorder{}
+	}
+	return &S3{
+		conf:     cfg,
+		objects:  objects,
+		store:    &indexStore{objects: objects, key: cfg.IndexKey(), locker: flock.New(cfg.IndexLock())},
+		metering: rec,
+	}, nil
+}
+
+func (s *S3) Type() string { return typ }
+
+// Create uploads the stream via placeholder→multipart upload→finalize, hashing entries on the way; a mid-flight crash leaves a pending record for GC.
+func (s *S3) Create(ctx context.Context, cfg *types.SnapshotConfig, stream io.Reader) (_ string, err error) {
+	id := cfg.ID
+	if id == "" {
+		return "", fmt.Errorf("snapshot ID is required (must be set by caller)")
+	}
+	if err = cfg.Validate(); err != nil {
+		return "", err
+	}
+	if err = s.insertRecord(ctx, id, cfg.Name, &snapshot.SnapshotRecord{
+		Snapshot: types.Snapshot{SnapshotConfig: *cfg, CreatedAt: time.Now()},
+		Pending:  true,
+	}); err != nil {
+		return "", err
+	}
+	defer func() {
+		if err != nil {
+			s.rollbackCreate(ctx, id, cfg.Name)
+		}
+	}()
+
+	files, size, err := s.upload(ctx, id, func(tw *tar.Writer) ([]types.SnapshotFile, error) {
+		return snapshot.CopyTar(ctx, tw, tar.NewReader(stream), nil)
+	})
+	if err != nil {
+		return "", fmt.Errorf("upload snapshot data: %w", err)
+	}
+	if err = s.finalize(ctx, id, size, files); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// List returns all snapshots (excluding pending ones).
+func (s *S3) List(ctx context.Context) ([]*types.Snapshot, error) {
+	var result []*types.Snapshot
+	return result, s.store.With(ctx, func(idx *snapshot.SnapshotIndex) error {
+		for _, rec := range idx.Snapshots {
+			if rec == nil || rec.Pending {
+				continue
+			}
+			snap := rec.Snapshot // value copy
+			result = append(result, &snap)
+		}
+		return nil
+	})
+}
+
+func (s *S3) Inspect(ctx context.Context, ref string) (*types.Snapshot, error) {
+	rec, err := s.lookupRecord(ctx, ref, false)
+	if err != nil {
+		return nil, err
+	}
+	snap := rec.Snapshot
+	return &snap, nil
+}
+
+// Delete removes each ref (object + cache → index); a failed index write leaves a dataless record that a repeat rm clears.
+func (s *S3) Delete(ctx context.Context, refs []string) ([]string, error) {
+	var ids []string
+	if err := s.store.With(ctx, func(idx *snapshot.SnapshotIndex) error {
+		var resolveErr error
+		ids, resolveErr = idx.ResolveMany(refs)
+		return resolveErr
+	}); err != nil {
+		return nil, err
+	}
+
+	var deleted []string
+	for _, id := range ids {
+		if err := s.deleteOne(ctx, id); err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, id)
+	}
+	return deleted, nil
+}
+
+// Restore streams the data object back; it is already the flat sparse tar hypervisors consume.
+func (s *S3) Restore(ctx context.Context, ref string) (types.SnapshotConfig, io.ReadCloser, error) {
+	rec, err := s.lookupRecord(ctx, ref, true)
+	if err != nil {
+		return types.SnapshotConfig{}, nil, err
+	}
+	rc, _, err := s.objects.get(ctx, s.conf.DataKey(rec.ID))
+	if err != nil {
+		return types.SnapshotConfig{}, nil, fmt.Errorf("open snapshot data %s: %w", rec.ID, err)
+	}
+	return snapshotRecordToConfig(rec), rc, nil
+}
+
+// DataDir serves snapshot.Direct from a local cache, downloading and verifying the object on first use.
+// The cache dir appears via rename, so its presence means fully extracted.
+func (s *S3) DataDir(ctx context.Context, ref string) (string, types.SnapshotConfig, error) {
+	rec, err := s.lookupRecord(ctx, ref, true)
+	if err != nil {
+		return "", types.SnapshotConfig{}, err
+	}
+	cfg := snapshotRecordToConfig(rec)
+	dir := s.conf.SnapshotCacheDir(rec.ID)
+	if _, statErr := os.Stat(dir); statErr == nil {
+		return dir, cfg, nil
+	}
+
+	tmp, err := os.MkdirTemp(s.conf.CacheDir(), rec.ID+tmpCacheInfix)
+	if err != nil {
+		return "", types.SnapshotConfig{}, fmt.Errorf("create cache dir: %w", err)
+	}
+	defer os.RemoveAll(tmp) //nolint:errcheck
+
+	rc, _, err := s.objects.get(ctx, s.conf.DataKey(rec.ID))
+	if err != nil {
+		return "", types.SnapshotConfig{}, fmt.Errorf("open snapshot data %s: %w", rec.ID, err)
+	}
+	err = utils.ExtractTar(tmp, rc)
+	rc.Close() //nolint:errcheck,gosec
+	if err != nil {
+		return "", types.SnapshotConfig{}, fmt.Errorf("download snapshot data %s: %w", rec.ID, err)
+	}
+	if err = snapshot.VerifyManifest(ctx, tmp, rec.Files, s.conf.EffectivePoolSize()); err != nil {
+		return "", types.SnapshotConfig{}, fmt.Errorf("verify downloaded snapshot %s: %w", rec.ID, err)
+	}
+	if err = os.Rename(tmp, dir); err != nil {
+		// A concurrent DataDir won the rename; its copy is equally complete.
+		if _, statErr := os.Stat(dir); statErr != nil {
+			return "", types.SnapshotConfig{}, fmt.Errorf("publish cache dir: %w", err)
+		}
+	}
+	return dir, cfg, nil
+}
+
+// Verify streams the stored object and re-hashes it against the manifest recorded at Create/Import time.
+func (s *S3) Verify(ctx context.Context, ref string) error {
+	rec, err := s.lookupRecord(ctx, ref, false)
+	if err != nil {
+		return err
+	}
+	rc, _, err := s.objects.get(ctx, s.conf.DataKey(rec.ID))
+	if err != nil {
+		return fmt.Errorf("open snapshot data %s: %w", rec.ID, err)
+	}
+	defer rc.Close() //nolint:errcheck
+	got, err := snapshot.CopyTar(ctx, nil, tar.NewReader(rc), nil)
+	if err != nil {
+		return err
+	}
+	return snapshot.CompareManifest(rec.Files, got)
+}
+
+func (s *S3) RegisterGC(orch *gc.Orchestrator) {
+	gc.Register(orch, gcModule(s.conf, s.objects, s.store))
+}
+
+// upload streams the tar produced by write into the snapshot's data object (multipart, unknown length) and returns write's manifest and the stored size.
+// A write error aborts the upload through the pipe, so no partial object is committed.
+func (s *S3) upload(ctx context.Context, id string, write func(*tar.Writer) ([]types.SnapshotFile, error)) ([]types.SnapshotFile, int64, error) {
+	type result struct {
+		info objectInfo
+		err  error
+	}
+	pr, pw := io.Pipe()
+	uploaded := make(chan result, 1)
+	go func() {
+		info, err := s.objects.put(ctx, s.conf.DataKey(id), pr, -1, putCond{})
+		if err != nil {
+			// Unblock the writer side; it reports this error instead of hanging on a full pipe.
+			pr.CloseWithError(err) //nolint:errcheck,gosec
+		}
+		uploaded <- result{info: info, err: err}
+	}()
+
+	tw := tar.NewWriter(pw)
+	files, err := write(tw)
+	if err == nil {
+		err = tw.Close()
+	}
+	pw.CloseWithError(err) //nolint:errcheck,gosec
+	res := <-uploaded
+	if err != nil {
+		return nil, 0, err
+	}
+	if res.err != nil {
+		return nil, 0, res.err
+	}
+	return files, res.info.size, nil
+}
+
+// finalize flips a pending record to ready with its manifest and opens the metering interval.
+func (s *S3) finalize(ctx context.Context, id string, size int64, files []types.SnapshotFile) error {
+	var hypType string
+	finalizedAt := time.Now()
+	if err := s.store.Update(ctx, func(idx *snapshot.SnapshotIndex) error {
+		rec := idx.Snapshots[id]
+		if rec == nil {
+			return fmt.Errorf("snapshot %q disappeared from index", id)
+		}
+		rec.Pending = false
+		rec.SizeBytes = size
+		rec.Files = files
+		rec.LastAccessedAt = finalizedAt
+		hypType = rec.Hypervisor
+		return nil
+	}); err != nil {
+		return fmt.Errorf("finalize snapshot: %w", err)
+	}
+	snapshot.EmitSnapStart(ctx, s.metering, id, hypType, size, finalizedAt)
+	return nil
+}
+
+// deleteOne is idempotent under concurrent rm; the rival's emit is skipped so the ledger keeps exactly one stop per snapshot.
+func (s *S3) deleteOne(ctx context.Context, id string) error {
+	if err := s.objects.remove(ctx, s.conf.DataKey(id)); err != nil {
+		return fmt.Errorf("remove snapshot data %s: %w", id, err)
+	}
+	if err := os.RemoveAll(s.conf.SnapshotCacheDir(id)); err != nil {
+		return fmt.Errorf("remove cache dir %s: %w", id, err)
+	}
+	var (
+		hypType       string
+		deletedRecord bool
+	)
+	if err := s.store.Update(ctx, func(idx *snapshot.SnapshotIndex) error {
+		rec := idx.Snapshots[id]
+		deletedRecord = rec != nil
+		if rec == nil {
+			return nil
+		}
+		hypType = rec.Hypervisor
+		if rec.Name != "" {
+			delete(idx.Names, rec.Name)
+		}
+		delete(idx.Snapshots, id)
+		return nil
+	}); err != nil {
+		return fmt.Errorf("delete index record %s: %w", id, err)
+	}
+	if deletedRecord {
+		snapshot.EmitSnapStop(ctx, s.metering, id, hypType)
+	}
+	return nil
+}
+
+// insertRecord adds rec under id with name-collision check; Create and Import both start from a pending record.
+func (s *S3) insertRecord(ctx context.Context, id, name string, rec *snapshot.SnapshotRecord) error {
+	return s.store.Update(ctx, func(idx *snapshot.SnapshotIndex) error {
+		if name != "" {
+			if existingID, ok := idx.Names[name]; ok {
+				return fmt.Errorf("snapshot name %q already in use by %s", name, existingID)
+			}
+		}
+		idx.Snapshots[id] = rec
+		if name != "" {
+			idx.Names[name] = id
+		}
+		return nil
+	})
+}
+
+// rollbackCreate removes a placeholder record and whatever part of its object made it to the bucket.
+func (s *S3) rollbackCreate(ctx context.Context, id, name string) {
+	logger := log.WithFunc("s3.rollbackCreate")
+	// The caller's ctx may be the reason we're rolling back; cleanup still needs to reach the bucket.
+	ctx = context.WithoutCancel(ctx)
+	if err := s.objects.remove(ctx, s.conf.DataKey(id)); err != nil {
+		logger.Warnf(ctx, "remove data for snapshot %s: %v", id, err)
+	}
+	if err := s.store.Update(ctx, func(idx *snapshot.SnapshotIndex) error {
+		delete(idx.Snapshots, id)
+		if name != "" && idx.Names[name] == id {
+			delete(idx.Names, name)
+		}
+		return nil
+	}); err != nil {
+		logger.Warnf(ctx, "rollback snapshot %s (name=%s): %v", id, name, err)
+	}
+}
+
+// lookupRecord resolves ref to a non-pending record; touch=true also bumps LastAccessedAt (one conditional PUT).
+func (s *S3) lookupRecord(ctx context.Context, ref string, touch bool) (snapshot.SnapshotRecord, error) {
+	var rec snapshot.SnapshotRecord
+	apply := func(idx *snapshot.SnapshotIndex) error {
+		id, err := idx.Resolve(ref)
+		if err != nil {
+			return err
+		}
+		r := idx.Snapshots[id]
+		if r == nil || r.Pending {
+			return snapshot.ErrNotFound
+		}
+		if touch {
+			r.LastAccessedAt = time.Now()
+		}
+		rec = *r
+		return nil
+	}
+	if touch {
+		return rec, s.store.Update(ctx, apply)
+	}
+	return rec, s.store.With(ctx, apply)
+}
+
+// snapshotRecordToConfig builds a detached SnapshotConfig from a record, deep-copying ImageBlobIDs.
+func snapshotRecordToConfig(rec snapshot.SnapshotRecord) types.SnapshotConfig {
+	cfg := rec.SnapshotConfig
+	cfg.ImageBlobIDs = maps.Clone(rec.ImageBlobIDs)
+	return cfg
+}
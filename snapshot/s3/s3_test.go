@@ -0,0 +1,353 @@
+package s3
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cocoonstack/cocoon/config"
+	"github.com/cocoonstack/cocoon/metering"
+	"github.com/cocoonstack/cocoon/snapshot"
+	"github.com/cocoonstack/cocoon/types"
+	"github.com/cocoonstack/cocoon/utils"
+)
+
+// newTestS3 creates a backend with its own root dir ("host") over the shared bucket stand-in.
+func newTestS3(t *testing.T, objects *memStore) *S3 {
+	t.Helper()
+	conf := &config.Config{RootDir: t.TempDir(), S3: &config.S3Config{Endpoint: "stand-in", Bucket: "snaps", Prefix: "cluster-a/"}}
+	s, err := newWithStore(conf, metering.NopRecorder{}, objects)
+	if err != nil {
+		t.Fatalf("newWithStore: %v", err)
+	}
+	return s
+}
+
+// makeSparseTar builds a hypervisor-style stream: one plain entry and one COCOON.sparse entry (4 KiB data at 1 MiB in an 8 MiB file).
+func makeSparseTar(t *testing.T) (*bytes.Buffer, map[string][]byte) {
+	t.Helper()
+	state := []byte(`{"cpu":2}`)
+	chunk := bytes.Repeat([]byte{0xab}, 4096)
+	const realSize, offset = 8 << 20, 1 << 20
+	memory := make([]byte, realSize)
+	copy(memory[offset:], chunk)
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{Name: "state.json", Size: int64(len(state)), Mode: 0o644, Typeflag: tar.TypeReg}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write(state); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.WriteHeader(&tar.Header{
+		Name: "memory-range-0", Size: int64(len(chunk)), Mode: 0o600, Typeflag: tar.TypeReg,
+		PAXRecords: map[string]string{
+			"COCOON.sparse.map":  fmt.Sprintf(`[{"o":%d,"l":%d}]`, offset, len(chunk)),
+			"COCOON.sparse.size": strconv.Itoa(realSize),
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write(chunk); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf, map[string][]byte{"state.json": state, "memory-range-0": memory}
+}
+
+func createTestSnapshot(t *testing.T, s *S3, name string) (string, map[string][]byte) {
+	t.Helper()
+	stream, files := makeSparseTar(t)
+	id, err := s.Create(t.Context(), &types.SnapshotConfig{
+		ID:           utils.GenerateID(),
+		Name:         name,
+		ImageBlobIDs: map[string]struct{}{"blob1": {}},
+		Config:       types.Config{Image: "ubuntu:24.04", CPU: 2, Memory: 1 << 30, Storage: 10 << 30},
+	}, stream)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	return id, files
+}
+
+func assertDirFiles(t *testing.T, dir string, want map[string][]byte) {
+	t.Helper()
+	for name, data := range want {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("%s: got %d bytes, want %d (err %v)", name, len(got), len(data), err)
+		}
+	}
+}
+
+func TestCreateRestore_KeepsSparseEntries(t *testing.T) {
+	objects := newMemStore()
+	s := newTestS3(t, objects)
+	id, want := createTestSnapshot(t, s, "sparse")
+
+	snap, err := s.Inspect(t.Context(), "sparse")
+	if err != nil {
+		t.Fatalf("Inspect: %v", err)
+	}
+	if snap.ID != id || snap.Image != "ubuntu:24.04" {
+		t.Errorf("Inspect: %+v", snap)
+	}
+
+	cfg, rc, err := s.Restore(t.Context(), id)
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	defer rc.Close() //nolint:errcheck
+	if cfg.Name != "sparse" {
+		t.Errorf("Restore cfg name: %q", cfg.Name)
+	}
+	raw, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(raw) >= 1<<20 {
+		t.Errorf("stored stream is %d bytes; holes were materialized", len(raw))
+	}
+	tr := tar.NewReader(bytes.NewReader(raw))
+	sparseSeen := false
+	for {
+		hdr, nextErr := tr.Next()
+		if errors.Is(nextErr, io.EOF) {
+			break
+		}
+		if nextErr != nil {
+			t.Fatal(nextErr)
+		}
+		if hdr.Name == "memory-range-0" {
+			sparseSeen = hdr.PAXRecords["COCOON.sparse.size"] == strconv.Itoa(8<<20)
+		}
+	}
+	if !sparseSeen {
+		t.Error("sparse PAX records lost on the way through the bucket")
+	}
+
+	out := t.TempDir()
+	if err = utils.ExtractTar(out, bytes.NewReader(raw)); err != nil {
+		t.Fatal(err)
+	}
+	assertDirFiles(t, out, want)
+}
+
+func TestSnapshotSurvivesHostLoss(t *testing.T) {
+	objects := newMemStore()
+	hostA := newTestS3(t, objects)
+	id, want := createTestSnapshot(t, hostA, "golden")
+
+	// A brand-new host with an empty root dir sees the same snapshot through the bucket.
+	hostB := newTestS3(t, objects)
+	snaps, err := hostB.List(t.Context())
+	if err != nil || len(snaps) != 1 || snaps[0].ID != id {
+		t.Fatalf("List on new host: %v, %v", snaps, err)
+	}
+	dir, cfg, err := hostB.DataDir(t.Context(), "golden")
+	if err != nil {
+		t.Fatalf("DataDir: %v", err)
+	}
+	if dir != hostB.conf.SnapshotCacheDir(id) || cfg.ID != id {
+		t.Errorf("DataDir = %s, %s", dir, cfg.ID)
+	}
+	assertDirFiles(t, dir, want)
+	if err = hostB.Verify(t.Context(), id); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+}
+
+func TestExportImport_AcrossBuckets(t *testing.T) {
+	src := newTestS3(t, newMemStore())
+	_, want := createTestSnapshot(t, src, "src")
+
+	stream, err := src.ExportStream(t.Context(), "src", snapshot.ExportOptions{Compression: snapshot.Compression{Algo: snapshot.CompressZstd}})
+	if err != nil {
+		t.Fatalf("ExportStream: %v", err)
+	}
+	archive, err := io.ReadAll(stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = stream.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dstObjects := newMemStore()
+	dst := newTestS3(t, dstObjects)
+	id, err := dst.Import(t.Context(), bytes.NewReader(archive), "dst", "")
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if err = dst.Verify(t.Context(), id); err != nil {
+		t.Errorf("Verify imported: %v", err)
+	}
+	dir := filepath.Join(t.TempDir(), "exported")
+	if err = dst.ExportToDir(t.Context(), id, dir); err != nil {
+		t.Fatalf("ExportToDir: %v", err)
+	}
+	assertDirFiles(t, dir, want)
+	if _, err = snapshot.VerifyDir(t.Context(), dir, 0); err != nil {
+		t.Errorf("VerifyDir: %v", err)
+	}
+}
+
+func TestImport_RejectsManifestMismatch(t *testing.T) {
+	src := newTestS3(t, newMemStore())
+	createTestSnapshot(t, src, "src")
+	stream, err := src.Export(t.Context(), "src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive, err := io.ReadAll(stream)
+	stream.Close() //nolint:errcheck,gosec
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Flip a byte inside the last data entry's payload (the tar trailer is 1 KiB of zeros plus padding).
+	archive[bytes.LastIndex(archive, bytes.Repeat([]byte{0xab}, 16))] ^= 0xff
+
+	dstObjects := newMemStore()
+	dst := newTestS3(t, dstObjects)
+	if _, err = dst.Import(t.Context(), bytes.NewReader(archive), "bad", ""); !errors.Is(err, snapshot.ErrManifestMismatch) {
+		t.Fatalf("Import: got %v, want ErrManifestMismatch", err)
+	}
+	snaps, _ := dst.List(t.Context())
+	keys, _ := dstObjects.list(t.Context(), dst.conf.DataPrefix())
+	if len(snaps) != 0 || len(keys) != 0 {
+		t.Errorf("failed import left %d records, %d objects", len(snaps), len(keys))
+	}
+}
+
+func TestVerify_DetectsCorruptObject(t *testing.T) {
+	objects := newMemStore()
+	s := newTestS3(t, objects)
+	id, _ := createTestSnapshot(t, s, "c")
+	rc, _, err := objects.get(t.Context(), s.conf.DataKey(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := io.ReadAll(rc)
+	objects.corrupt(s.conf.DataKey(id), len(raw)-bytes.LastIndex(raw, []byte{0xab}))
+	if err = s.Verify(t.Context(), id); !errors.Is(err, snapshot.ErrManifestMismatch) {
+		t.Errorf("Verify: got %v, want ErrManifestMismatch", err)
+	}
+}
+
+func TestDelete_RemovesObjectAndCache(t *testing.T) {
+	objects := newMemStore()
+	s := newTestS3(t, objects)
+	id, _ := createTestSnapshot(t, s, "gone")
+	if _, _, err := s.DataDir(t.Context(), id); err != nil {
+		t.Fatal(err)
+	}
+	deleted, err := s.Delete(t.Context(), []string{"gone"})
+	if err != nil || len(deleted) != 1 {
+		t.Fatalf("Delete: %v, %v", deleted, err)
+	}
+	if objects.has(s.conf.DataKey(id)) {
+		t.Error("data object still present")
+	}
+	if _, statErr := os.Stat(s.conf.SnapshotCacheDir(id)); !errors.Is(statErr, os.ErrNotExist) {
+		t.Errorf("cache dir still present: %v", statErr)
+	}
+	if _, err = s.Inspect(t.Context(), id); !errors.Is(err, snapshot.ErrNotFound) {
+		t.Errorf("Inspect after delete: %v", err)
+	}
+}
+
+func TestIndex_ConcurrentHostsDoNotLoseUpdates(t *testing.T) {
+	objects := newMemStore()
+	hosts := []*S3{newTestS3(t, objects), newTestS3(t, objects)}
+	const perHost = 5
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(hosts)*perHost)
+	for h, s := range hosts {
+		wg.Go(func() {
+			for i := range perHost {
+				stream, _ := makeSparseTar(t)
+				_, err := s.Create(t.Context(), &types.SnapshotConfig{
+					ID:     utils.GenerateID(),
+					Name:   fmt.Sprintf("h%d-%d", h, i),
+					Config: types.Config{Image: "ubuntu:24.04", CPU: 1, Memory: 1 << 30, Storage: 1 << 30},
+				}, stream)
+				errs <- err
+			}
+		})
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Create: %v", err)
+		}
+	}
+	snaps, err := hosts[0].List(t.Context())
+	if err != nil || len(snaps) != len(hosts)*perHost {
+		t.Errorf("List: %d snapshots (err %v), want %d", len(snaps), err, len(hosts)*perHost)
+	}
+}
+
+func TestGC_CollectsOrphansAndStalePending(t *testing.T) {
+	objects := newMemStore()
+	s := newTestS3(t, objects)
+	ctx := t.Context()
+	keep, _ := createTestSnapshot(t, s, "keep")
+
+	orphan := utils.GenerateID()
+	if _, err := objects.put(ctx, s.conf.DataKey(orphan), bytes.NewReader([]byte("x")), 1, putCond{}); err != nil {
+		t.Fatal(err)
+	}
+	stale := utils.GenerateID()
+	if err := s.insertRecord(ctx, stale, "stale", &snapshot.SnapshotRecord{
+		Snapshot: types.Snapshot{SnapshotConfig: types.SnapshotConfig{ID: stale, Name: "stale"}, CreatedAt: time.Now().Add(-2 * pendingGCGrace)},
+		Pending:  true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(s.conf.SnapshotCacheDir("deadbeef"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+
+	mod := gcModule(s.conf, objects, s.store)
+	snap, err := mod.ReadDB(ctx)
+	if err != nil {
+		t.Fatalf("ReadDB: %v", err)
+	}
+	if _, ok := snap.UsedBlobIDs()["blob1"]; !ok {
+		t.Error("image blob referenced by a bucket snapshot is not protected")
+	}
+	ids := mod.Resolve(ctx, snap, nil)
+	if err = mod.Collect(ctx, ids, snap); err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+
+	if objects.has(s.conf.DataKey(orphan)) {
+		t.Error("orphan object survived GC")
+	}
+	if !objects.has(s.conf.DataKey(keep)) {
+		t.Error("live snapshot object collected")
+	}
+	if _, statErr := os.Stat(s.conf.SnapshotCacheDir("deadbeef")); !errors.Is(statErr, os.ErrNotExist) {
+		t.Error("orphan cache dir survived GC")
+	}
+	idx, _, _ := s.store.load(ctx)
+	if _, ok := idx.Snapshots[stale]; ok {
+		t.Error("stale pending record survived GC")
+	}
+	if _, ok := idx.Names["stale"]; ok {
+		t.Error("stale pending name survived GC")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"io"
 
 	"github.com/cocoonstack/cocoon/gc"
+	"github.com/cocoonstack/cocoon/progress"
 	"github.com/cocoonstack/cocoon/types"
 )
 
@@ -23,6 +24,33 @@ type DirectoryExporter interface {
 	ExportToDir(ctx context.Context, ref, dir string) error
 }
 
+// ExportOptions tunes a streamed export; the zero value yields the same raw tar as Export.
+type ExportOptions struct {
+	Compression Compression
+	// Encrypter age-encrypts the (compressed) stream when non-nil; its fingerprints are recorded in the envelope.
+	Encrypter *Encrypter
+	// Concurrency caps compressor goroutines (0 = backend default).
+	Concurrency int
+	// Tracker receives progress/snapshot events; nil means progress.Nop.
+	Tracker progress.Tracker
+}
+
+// StreamExporter is an optional interface for backends that can compress (gzip/zstd), encrypt, and report progress while exporting.
+type StreamExporter interface {
+	ExportStream(ctx context.Context, ref string, opts ExportOptions) (io.ReadCloser, error)
+}
+
+// EncryptedExporter is an optional interface for backends that can age-encrypt each data file in dir mode.
+// snapshot.json stays plaintext (with recipient fingerprints) so --from-dir can read it.
+type EncryptedExporter interface {
+	ExportToDirEncrypted(ctx context.Context, ref, dir string, enc *Encrypter) error
+}
+
+// Verifier is an optional interface for backends that record an integrity manifest and can re-check stored data against it.
+type Verifier interface {
+	Verify(ctx context.Context, ref string) error
+}
+
 // Snapshot manages snapshot lifecycle and storage.
 type Snapshot interface {
 	Type() string
@@ -41,7 +69,7 @@ type Snapshot interface {
 	// Export streams the snapshot as a raw tar archive.
 	// The archive includes a snapshot.json metadata entry followed by data files.
 	Export(ctx context.Context, ref string) (io.ReadCloser, error)
-	// Import reads a snapshot tar (gzip auto-detected); non-empty name/description override the envelope.
+	// Import reads a snapshot tar (gzip/zstd auto-detected); non-empty name/description override the envelope.
 	Import(ctx context.Context, r io.Reader, name, description string) (string, error)
 
 	RegisterGC(*gc.Orchestrator)
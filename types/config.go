@@ -1,11 +1,31 @@
 package types
 
+import "time"
+
 // Image backend type names (Config.ImageType / Images.Type()).
 const (
 	ImageTypeOCI      = "oci"
 	ImageTypeCloudImg = "cloudimg"
 )
 
+// Guest clock-sync modes (Config.ClockSync).
+const (
+	ClockSyncAgent = "agent" // cocoon-agent sets the guest clock to the host's wall time
+	ClockSyncPTP   = "ptp"   // cocoon-agent steps the guest clock from the KVM PTP clock (/dev/ptp*, needs linuxptp's phc_ctl)
+	ClockSyncOff   = "off"
+)
+
+// Health check defaults and states (VM.Health.Status).
+const (
+	DefaultHealthInterval = 30 * time.Second
+	DefaultHealthRetries  = 3
+
+	HealthStarting  = "starting" // no check has completed since the VM last started
+	HealthHealthy   = "healthy"
+	HealthUnhealthy = "unhealthy"
+	HealthStale     = "stale" // the last check is older than two intervals: no supervisor is running checks
+)
+
 // Config holds resource params shared by VMConfig and SnapshotConfig (value-copy friendly).
 type Config struct {
 	CPU           int    `json:"cpu,omitempty"`
@@ -21,4 +41,31 @@ type Config struct {
 	Windows       bool   `json:"windows,omitempty"`      // Windows guest: UEFI boot, kvm_hyperv=on, no cidata
 	// SharedMemory toggles CH memory shared=on (vhost-user-fs prerequisite); fixed at create, persists through clone/restore.
 	SharedMemory bool `json:"shared_memory,omitempty"`
+	// ClockSync picks how the guest wall clock is stepped after clone/restore: ClockSyncAgent (default), ClockSyncPTP, or ClockSyncOff.
+	ClockSync string `json:"clock_sync,omitempty"`
+	// HealthCmd is a guest shell command run through cocoon-agent; exit 0 counts as healthy. Empty disables checks.
+	HealthCmd      string        `json:"health_cmd,omitempty"`
+	HealthInterval time.Duration `json:"health_interval,omitempty"` // between checks; 0 = DefaultHealthInterval
+	HealthRetries  int           `json:"health_retries,omitempty"`  // consecutive failures before unhealthy; 0 = DefaultHealthRetries
+	// SSHKeys are authorized_keys lines installed by cloud-init (cloudimg) or cocoon-agent (OCI, clones). Public, so
+	// persisted: snapshots and clones inherit them.
+	SSHKeys []string `json:"ssh_keys,omitempty"`
+	// Firewall filters the VM's NIC traffic; nil allows everything. Snapshots keep it, clones take it only on request.
+	Firewall *Firewall `json:"firewall,omitempty"`
+}
+
+// EffectiveHealthInterval returns HealthInterval with the default applied.
+func (c Config) EffectiveHealthInterval() time.Duration {
+	if c.HealthInterval > 0 {
+		return c.HealthInterval
+	}
+	return DefaultHealthInterval
+}
+
+// EffectiveHealthRetries returns HealthRetries with the default applied.
+func (c Config) EffectiveHealthRetries() int {
+	if c.HealthRetries > 0 {
+		return c.HealthRetries
+	}
+	return DefaultHealthRetries
 }
@@ -0,0 +1,143 @@
+package types
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Firewall actions, directions and the extra rule protocol (tcp/udp are shared with PortMapping).
+const (
+	FirewallAllow = "allow"
+	FirewallDeny  = "deny"
+
+	DirectionIngress = "ingress" // toward the guest
+	DirectionEgress  = "egress"  // from the guest
+
+	ProtocolICMP = "icmp" // ICMP for IPv4 peers, ICMPv6 for IPv6 peers
+)
+
+// Firewall is a VM's stateless packet filter, enforced by TC filters on the host side of every NIC.
+type Firewall struct {
+	// Ingress and Egress are the policies for traffic no rule matches: allow (default) or deny.
+	Ingress string `json:"ingress,omitempty"`
+	Egress  string `json:"egress,omitempty"`
+	// Rules are evaluated in order per direction; the first match wins.
+	Rules []FirewallRule `json:"rules,omitempty"`
+}
+
+// FirewallRule matches one direction of traffic; an empty Protocol, Ports or CIDR matches anything.
+type FirewallRule struct {
+	Action    string `json:"action"`
+	Direction string `json:"direction"`
+	Protocol  string `json:"protocol,omitempty"`
+	// Ports is the destination port list, "22,443,8000-8100": the guest's for ingress, the peer's for egress (tcp/udp only).
+	Ports string `json:"ports,omitempty"`
+	// CIDR is the peer: source for ingress, destination for egress. A bare address means a single host.
+	CIDR string `json:"cidr,omitempty"`
+}
+
+// PortRange is an inclusive port range; From == To for a single port.
+type PortRange struct {
+	From, To uint16
+}
+
+// Empty reports whether the firewall filters nothing and can be dropped.
+func (f *Firewall) Empty() bool {
+	return f == nil || (len(f.Rules) == 0 && f.Ingress != FirewallDeny && f.Egress != FirewallDeny)
+}
+
+// Validate checks policies and every rule.
+func (f *Firewall) Validate() error {
+	if f == nil {
+		return nil
+	}
+	for _, p := range []string{f.Ingress, f.Egress} {
+		if p != "" && p != FirewallAllow && p != FirewallDeny {
+			return fmt.Errorf("firewall: policy must be %s or %s, got %q", FirewallAllow, FirewallDeny, p)
+		}
+	}
+	for i, r := range f.Rules {
+		if err := r.Validate(); err != nil {
+			return fmt.Errorf("firewall rule %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// Validate checks the rule's fields and their combination.
+func (r FirewallRule) Validate() error {
+	if r.Action != FirewallAllow && r.Action != FirewallDeny {
+		return fmt.Errorf("action must be %s or %s, got %q", FirewallAllow, FirewallDeny, r.Action)
+	}
+	if r.Direction != DirectionIngress && r.Direction != DirectionEgress {
+		return fmt.Errorf("direction must be %s or %s, got %q", DirectionIngress, DirectionEgress, r.Direction)
+	}
+	switch r.Protocol {
+	case "", ProtocolICMP:
+		if r.Ports != "" {
+			return fmt.Errorf("ports need protocol %s or %s", ProtocolTCP, ProtocolUDP)
+		}
+	case ProtocolTCP, ProtocolUDP:
+	default:
+		return fmt.Errorf("protocol must be %s, %s or %s, got %q", ProtocolTCP, ProtocolUDP, ProtocolICMP, r.Protocol)
+	}
+	if _, err := r.PortRanges(); err != nil {
+		return err
+	}
+	_, err := r.Peer()
+	return err
+}
+
+// PortRanges parses Ports; nil means any port.
+func (r FirewallRule) PortRanges() ([]PortRange, error) {
+	if r.Ports == "" {
+		return nil, nil
+	}
+	var out []PortRange
+	for item := range strings.SplitSeq(r.Ports, ",") {
+		lo, hi, isRange := strings.Cut(strings.TrimSpace(item), "-")
+		from, err := parseRulePort(lo)
+		if err != nil {
+			return nil, err
+		}
+		to := from
+		if isRange {
+			if to, err = parseRulePort(hi); err != nil {
+				return nil, err
+			}
+			if to < from {
+				return nil, fmt.Errorf("port range %q is reversed", item)
+			}
+		}
+		out = append(out, PortRange{From: from, To: to})
+	}
+	return out, nil
+}
+
+// Peer parses CIDR; nil means any address of either family.
+func (r FirewallRule) Peer() (*net.IPNet, error) {
+	if r.CIDR == "" {
+		return nil, nil
+	}
+	if _, n, err := net.ParseCIDR(r.CIDR); err == nil {
+		return n, nil
+	}
+	ip := net.ParseIP(r.CIDR)
+	if ip == nil {
+		return nil, fmt.Errorf("cidr %q is not an address or CIDR", r.CIDR)
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return &net.IPNet{IP: v4, Mask: net.CIDRMask(32, 32)}, nil //nolint:mnd
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil //nolint:mnd
+}
+
+func parseRulePort(s string) (uint16, error) {
+	p, err := strconv.ParseUint(s, 10, 16)
+	if err != nil || p == 0 {
+		return 0, fmt.Errorf("invalid port %q (want 1-65535)", s)
+	}
+	return uint16(p), nil
+}
@@ -1,9 +1,29 @@
 package types
 
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
 // Network backend identifiers stored in NetworkConfig.Backend.
 const (
-	BackendCNI    = "cni"
-	BackendBridge = "bridge"
+	BackendCNI       = "cni"
+	BackendBridge    = "bridge"
+	BackendPasst     = "passt"
+	BackendMacvtap   = "macvtap"
+	BackendVhostUser = "vhost-user"
+)
+
+// VhostServer is NetworkConfig.VhostMode when CH creates VhostSocket and the backend connects to it.
+const VhostServer = "server"
+
+// Macvtap modes accepted by --macvtap.
+const (
+	MacvtapBridge   = "bridge"
+	MacvtapPassthru = "passthru"
 )
 
 // NetworkConfig describes a single NIC attached to a VM.
@@ -13,13 +33,22 @@ type NetworkConfig struct {
 	NumQueues int    `json:"num_queues"` // Virtio queue count (= CPU * 2 for multi-queue).
 	QueueSize int    `json:"queue_size"`
 
-	// Backend is the provider type ("cni" or "bridge"); empty means "cni" for
+	// Backend is the provider type ("cni", "bridge", "passt", "macvtap" or "vhost-user"); empty means "cni" for
 	// backward compat with pre-bridge VM records.
 	Backend string `json:"backend,omitempty"`
 
-	// BridgeDev is the Linux bridge device name; set only when Backend=="bridge".
+	// BridgeDev is the Linux bridge the NIC joins: its TAP's master for Backend=="bridge", or the bridge a CNI
+	// NIC reaches at layer 2 (--nic bridge= on a CNI VM).
 	BridgeDev string `json:"bridge_dev,omitempty"`
 
+	// CNINetwork is the conflist the NIC was added with; empty means the VM's Config.Network (pre per-NIC records).
+	CNINetwork string `json:"cni_network,omitempty"`
+
+	// VhostSocket is the vhost-user socket CH uses instead of opening TAP (passt and vhost-user NICs).
+	VhostSocket string `json:"vhost_socket,omitempty"`
+	// VhostMode is VhostServer when CH listens on VhostSocket; empty means CH connects to it.
+	VhostMode string `json:"vhost_mode,omitempty"`
+
 	// NetnsPath is the netns where the TAP lives; empty for backends without netns (e.g. macOS vmnet).
 	NetnsPath string `json:"netns_path,omitempty"`
 
@@ -27,9 +56,149 @@ type NetworkConfig struct {
 	Network *Network `json:"network,omitempty"`
 }
 
+// NICSpec is one --nic request for a fresh NIC; an empty field falls back to IPAM, the veth's MAC, or the VM's
+// --network/--bridge.
+type NICSpec struct {
+	IP      string `json:"ip,omitempty"`      // primary address to pin via the CNI "IP" arg
+	MAC     string `json:"mac,omitempty"`     // guest MAC, normalized to lower case
+	Network string `json:"network,omitempty"` // CNI conflist name
+	Bridge  string `json:"bridge,omitempty"`  // Linux bridge to join at layer 2 instead of a conflist
+}
+
+// Validate checks the address and MAC syntax and the attachment; a MAC must be unicast so the guest can own it.
+func (s NICSpec) Validate() error {
+	if s.Network != "" && s.Bridge != "" {
+		return fmt.Errorf("network=%s and bridge=%s are mutually exclusive", s.Network, s.Bridge)
+	}
+	if s.IP != "" && s.Bridge != "" {
+		return fmt.Errorf("ip= needs a CNI network: bridge=%s NICs take DHCP leases", s.Bridge)
+	}
+	if s.IP != "" && net.ParseIP(s.IP) == nil {
+		return fmt.Errorf("ip %q is not an IP address", s.IP)
+	}
+	if s.MAC != "" {
+		hw, err := net.ParseMAC(s.MAC)
+		if err != nil || len(hw) != 6 { //nolint:mnd
+			return fmt.Errorf("mac %q is not an Ethernet address", s.MAC)
+		}
+		if hw[0]&1 != 0 {
+			return fmt.Errorf("mac %s is multicast", s.MAC)
+		}
+	}
+	return nil
+}
+
+// ParseBridgeIPAM parses a --bridge-ipam subnet, masked: IPv4 with room for a gateway and at least one guest.
+func ParseBridgeIPAM(cidr string) (netip.Prefix, error) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return prefix, fmt.Errorf("--bridge-ipam %q: %w", cidr, err)
+	}
+	if !prefix.Addr().Is4() || prefix.Bits() > 30 { //nolint:mnd // network, gateway, guest, broadcast
+		return prefix, fmt.Errorf("--bridge-ipam %q: need an IPv4 subnet of /30 or larger", cidr)
+	}
+	return prefix.Masked(), nil
+}
+
+// ParseMacvtap parses a --macvtap spec, PARENT[,mode=bridge|passthru]; mode defaults to bridge.
+func ParseMacvtap(spec string) (parent, mode string, err error) {
+	parent, rest, _ := strings.Cut(spec, ",")
+	if parent == "" {
+		return "", "", fmt.Errorf("--macvtap %q: parent interface is required", spec)
+	}
+	mode = MacvtapBridge
+	if rest != "" {
+		key, val, _ := strings.Cut(rest, "=")
+		if key != "mode" || (val != MacvtapBridge && val != MacvtapPassthru) {
+			return "", "", fmt.Errorf("--macvtap %q: want PARENT[,mode=bridge|passthru]", spec)
+		}
+		mode = val
+	}
+	return parent, mode, nil
+}
+
 // Network is the guest-visible IP config for a NIC; all fields omitempty so DHCP NICs serialize empty.
+// IP/Gateway/Prefix hold the primary IPv4 (kept flat for pre-dual-stack records); IPv6 and secondary IPv4
+// addresses live in Addresses. An IPv6-only NIC has an empty IP and a non-empty Addresses.
 type Network struct {
-	IP      string `json:"ip,omitempty"`      // dotted decimal, e.g. "10.0.0.2"
-	Gateway string `json:"gateway,omitempty"` // dotted decimal, e.g. "10.0.0.1"
-	Prefix  int    `json:"prefix,omitempty"`  // CIDR prefix length, e.g. 24
+	IP        string    `json:"ip,omitempty"`        // dotted decimal, e.g. "10.0.0.2"
+	Gateway   string    `json:"gateway,omitempty"`   // dotted decimal, e.g. "10.0.0.1"
+	Prefix    int       `json:"prefix,omitempty"`    // CIDR prefix length, e.g. 24
+	Addresses []Address `json:"addresses,omitempty"` // beyond the primary IPv4
+}
+
+// Address is one additional guest address on a NIC.
+type Address struct {
+	IP      string `json:"ip"`                // e.g. "fd00::2" or "10.0.1.2"
+	Prefix  int    `json:"prefix"`            // CIDR prefix length, e.g. 64
+	Gateway string `json:"gateway,omitempty"` // same family as IP
+}
+
+// CIDR renders the address as "IP/PREFIX".
+func (a Address) CIDR() string {
+	return a.IP + "/" + strconv.Itoa(a.Prefix)
+}
+
+// IsIPv6 reports whether the address is IPv6.
+func (a Address) IsIPv6() bool {
+	return strings.Contains(a.IP, ":")
+}
+
+// Static reports whether the NIC has any assigned address; a nil or empty Network means DHCP.
+func (n *Network) Static() bool {
+	return n != nil && (n.IP != "" || len(n.Addresses) > 0)
+}
+
+// All returns every address, primary IPv4 first.
+func (n *Network) All() []Address {
+	if n == nil {
+		return nil
+	}
+	all := make([]Address, 0, 1+len(n.Addresses))
+	if n.IP != "" {
+		all = append(all, Address{IP: n.IP, Prefix: n.Prefix, Gateway: n.Gateway})
+	}
+	return append(all, n.Addresses...)
+}
+
+// Gateway6 returns the first IPv6 gateway, the default route for that family; Gateway plays that role for IPv4.
+func (n *Network) Gateway6() string {
+	if n == nil {
+		return ""
+	}
+	for _, a := range n.Addresses {
+		if a.IsIPv6() && a.Gateway != "" {
+			return a.Gateway
+		}
+	}
+	return ""
+}
+
+// Port-publish protocols (PortMapping.Protocol).
+const (
+	ProtocolTCP = "tcp"
+	ProtocolUDP = "udp"
+)
+
+// PortMapping publishes a guest port on the host (--publish, `vm port add`) via nftables DNAT.
+type PortMapping struct {
+	HostIP    string `json:"host_ip,omitempty"` // empty = every local host address
+	HostPort  int    `json:"host_port"`
+	GuestPort int    `json:"guest_port"`
+	Protocol  string `json:"protocol"` // ProtocolTCP or ProtocolUDP
+}
+
+// String renders the mapping in --publish syntax.
+func (p PortMapping) String() string {
+	s := fmt.Sprintf("%d:%d/%s", p.HostPort, p.GuestPort, p.Protocol)
+	if p.HostIP != "" {
+		s = p.HostIP + ":" + s
+	}
+	return s
+}
+
+// Conflicts reports whether p and o claim the same host socket; an empty HostIP overlaps every address.
+func (p PortMapping) Conflicts(o PortMapping) bool {
+	return p.Protocol == o.Protocol && p.HostPort == o.HostPort &&
+		(p.HostIP == "" || o.HostIP == "" || p.HostIP == o.HostIP)
 }
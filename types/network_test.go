@@ -0,0 +1,62 @@
+package types
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNetworkAddresses(t *testing.T) {
+	var dhcp *Network
+	if dhcp.Static() || dhcp.All() != nil || dhcp.Gateway6() != "" {
+		t.Error("nil Network must read as DHCP")
+	}
+	if (&Network{}).Static() {
+		t.Error("empty Network must read as DHCP")
+	}
+
+	n := &Network{
+		IP: "10.0.0.2", Prefix: 24, Gateway: "10.0.0.1",
+		Addresses: []Address{
+			{IP: "10.0.1.2", Prefix: 24, Gateway: "10.0.1.1"},
+			{IP: "fd00::2", Prefix: 64, Gateway: "fd00::1"},
+		},
+	}
+	var cidrs []string
+	for _, a := range n.All() {
+		cidrs = append(cidrs, a.CIDR())
+	}
+	if want := []string{"10.0.0.2/24", "10.0.1.2/24", "fd00::2/64"}; !reflect.DeepEqual(cidrs, want) {
+		t.Errorf("All = %v, want %v", cidrs, want)
+	}
+	if got := n.Gateway6(); got != "fd00::1" {
+		t.Errorf("Gateway6 = %q, want fd00::1", got)
+	}
+
+	v6only := &Network{Addresses: []Address{{IP: "fd00::3", Prefix: 64}}}
+	if !v6only.Static() || len(v6only.All()) != 1 {
+		t.Errorf("IPv6-only NIC must be static with one address: %+v", v6only)
+	}
+}
+
+func TestParseMacvtap(t *testing.T) {
+	tests := []struct {
+		spec       string
+		wantParent string
+		wantMode   string
+		wantErr    bool
+	}{
+		{spec: "eth1", wantParent: "eth1", wantMode: MacvtapBridge},
+		{spec: "eth1,mode=bridge", wantParent: "eth1", wantMode: MacvtapBridge},
+		{spec: "bond0.100,mode=passthru", wantParent: "bond0.100", wantMode: MacvtapPassthru},
+		{spec: "", wantErr: true},
+		{spec: ",mode=bridge", wantErr: true},
+		{spec: "eth1,mode=vepa", wantErr: true},
+		{spec: "eth1,bridge", wantErr: true},
+	}
+	for _, tt := range tests {
+		parent, mode, err := ParseMacvtap(tt.spec)
+		if (err != nil) != tt.wantErr || parent != tt.wantParent || mode != tt.wantMode {
+			t.Errorf("ParseMacvtap(%q) = %q, %q, %v", tt.spec, parent, mode, err)
+		}
+	}
+}
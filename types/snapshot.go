@@ -16,6 +16,9 @@ type SnapshotConfig struct {
 	ImageBlobIDs map[string]struct{} `json:"image_blob_ids,omitempty"` // blob hex set for GC pinning
 	Hypervisor   string              `json:"hypervisor,omitempty"`     // originating backend ("cloud-hypervisor" or "firecracker")
 	NICs         int                 `json:"nics,omitempty"`
+	// NICAttachments are the source NICs' non-default networks/bridges (VM.NICAttachments); clones inherit them
+	// unless they retarget the network.
+	NICAttachments []NICSpec `json:"nic_attachments,omitempty"`
 }
 
 // Validate checks SnapshotConfig caller-controlled fields. Empty Name is allowed (name is optional).
@@ -32,8 +35,23 @@ type Snapshot struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// SnapshotFile is one data-file entry of a snapshot integrity manifest.
+type SnapshotFile struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`   // logical size; holes count as zeros
+	SHA256 string `json:"sha256"` // hex digest of the logical content
+}
+
+// SnapshotEncryption records how exported data was encrypted; only recipient fingerprints, never key material.
+type SnapshotEncryption struct {
+	Scheme       string   `json:"scheme"`                 // "age-x25519"
+	Fingerprints []string `json:"recipient_fingerprints"` // SHA256 of each recipient's public key string
+}
+
 // SnapshotExport is the envelope written as snapshot.json inside an export archive.
 type SnapshotExport struct {
-	Config  SnapshotConfig `json:"config"`
-	Version int            `json:"version"`
+	Config     SnapshotConfig      `json:"config"`
+	Files      []SnapshotFile      `json:"files,omitempty"`      // v2+: per-file integrity manifest
+	Encryption *SnapshotEncryption `json:"encryption,omitempty"` // set when data was exported with --encrypt-to
+	Version    int                 `json:"version"`
 }
@@ -0,0 +1,47 @@
+package types
+
+import "time"
+
+// VMStats is one sample of a running VM's counters; every counter is cumulative since its VMM process started.
+type VMStats struct {
+	ID    string      `json:"id"`
+	Name  string      `json:"name"`
+	At    time.Time   `json:"at"`
+	CPU   CPUStats    `json:"cpu"`
+	NICs  []NICStats  `json:"nics"`
+	Disks []DiskStats `json:"disks"`
+}
+
+// CPUStats is CPU time the VMM process spent on the host.
+type CPUStats struct {
+	// VCPUSeconds is the time of the vCPU threads, i.e. guest execution.
+	VCPUSeconds float64 `json:"vcpu_seconds"`
+	// HostSeconds is the whole VMM process: vCPUs plus device emulation and I/O threads.
+	HostSeconds float64 `json:"host_seconds"`
+}
+
+// NICStats counts one NIC from the guest's side: Rx is traffic delivered to the guest, Tx what it sent.
+type NICStats struct {
+	Index int    `json:"index"`
+	MAC   string `json:"mac"`
+	// Device is the host link the counters come from; empty when the hypervisor counts (vhost-user NICs).
+	Device string `json:"device,omitempty"`
+
+	RxBytes   uint64 `json:"rx_bytes"`
+	RxPackets uint64 `json:"rx_packets"`
+	RxDropped uint64 `json:"rx_dropped"`
+	TxBytes   uint64 `json:"tx_bytes"`
+	TxPackets uint64 `json:"tx_packets"`
+	TxDropped uint64 `json:"tx_dropped"`
+}
+
+// DiskStats counts one disk's guest I/O as seen by the VMM.
+type DiskStats struct {
+	Name string `json:"name"` // serial, or the file name for disks without one
+	Path string `json:"path"`
+
+	ReadBytes  uint64 `json:"read_bytes"`
+	WriteBytes uint64 `json:"write_bytes"`
+	ReadOps    uint64 `json:"read_ops"`
+	WriteOps   uint64 `json:"write_ops"`
+}
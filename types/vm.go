@@ -3,6 +3,7 @@ package types
 import (
 	"fmt"
 	"regexp"
+	"strings"
 	"time"
 )
 
@@ -29,10 +30,18 @@ type VMConfig struct {
 	Config
 	Name string `json:"name"`
 
-	OnDemand  bool           `json:"-"` // use UFFD on-demand memory restore (CH only); transient, not persisted
-	User      string         `json:"-"`
-	Password  string         `json:"-"`
-	DataDisks []DataDiskSpec `json:"-"` // populated from --data-disk; consumed by Create
+	OnDemand   bool           `json:"-"` // use UFFD on-demand memory restore (CH only); transient, not persisted
+	User       string         `json:"-"`
+	Password   string         `json:"-"`
+	UserData   []byte         `json:"-"` // --user-data, merged into the cidata user-data (cloudimg only)
+	VendorData []byte         `json:"-"` // --vendor-data, written as cidata vendor-data (cloudimg only)
+	DataDisks  []DataDiskSpec `json:"-"` // populated from --data-disk; consumed by Create
+	NICs       []NICSpec      `json:"-"` // populated from --nic, one per leading NIC; consumed by network Add
+	BridgeIPAM string         `json:"-"` // --bridge-ipam subnet; the lease store, not the VM, remembers it
+
+	// Ports are the --publish host port mappings. Kept outside Config so snapshots and clones don't inherit them:
+	// two VMs cannot own the same host port.
+	Ports []PortMapping `json:"ports,omitempty"`
 }
 
 // NetSetup is the VM's host networking state: backend, netns, bridge, and attached NICs.
@@ -41,6 +50,7 @@ type NetSetup struct {
 	NetBackend     string           `json:"net_backend,omitempty"`
 	NetnsPath      string           `json:"netns_path,omitempty"`
 	NetBridgeDev   string           `json:"net_bridge_dev,omitempty"`
+	NetMacvtap     string           `json:"net_macvtap,omitempty"` // --macvtap spec, PARENT[,mode=M]
 	NetworkConfigs []*NetworkConfig `json:"network_configs,omitempty"`
 }
 
@@ -69,6 +79,15 @@ type VM struct {
 	// Populated at runtime by toVM() from VMRecord.SnapshotIDs.
 	SnapshotIDs map[string]struct{} `json:"snapshot_ids,omitempty"`
 
+	// SourceSnapshotID is the snapshot this VM was cloned from (or force-restored from a foreign one); empty for image-created VMs.
+	SourceSnapshotID string `json:"source_snapshot_id,omitempty"`
+
+	// LastClockSync is the outcome of the most recent post-clone/restore guest clock step.
+	LastClockSync *ClockSyncResult `json:"last_clock_sync,omitempty"`
+
+	// Health is the latest --health-cmd result; nil until a supervisor or `vm wait --for healthy` has run a check.
+	Health *HealthStatus `json:"health,omitempty"`
+
 	// Timestamps.
 	CreatedAt time.Time  `json:"created_at"`
 	UpdatedAt time.Time  `json:"updated_at"`
@@ -105,9 +124,102 @@ func (cfg *VMConfig) Validate() error {
 	if cfg.Password != "" && shellUnsafe.MatchString(cfg.Password) {
 		return fmt.Errorf("--password contains unsafe shell or YAML characters")
 	}
+	for _, k := range cfg.SSHKeys {
+		if k == "" || strings.ContainsAny(k, "\r\n\x00") {
+			return fmt.Errorf("--ssh-key: invalid authorized_keys line %q", k)
+		}
+	}
+	for i, p := range cfg.Ports {
+		for _, q := range cfg.Ports[:i] {
+			if p.Conflicts(q) {
+				return fmt.Errorf("--publish %s conflicts with %s", p, q)
+			}
+		}
+	}
+	if err := cfg.validateNICs(); err != nil {
+		return err
+	}
+	if cfg.BridgeIPAM != "" {
+		if _, err := ParseBridgeIPAM(cfg.BridgeIPAM); err != nil {
+			return err
+		}
+	}
+	if err := cfg.Firewall.Validate(); err != nil {
+		return err
+	}
+	if cfg.HealthInterval < 0 {
+		return fmt.Errorf("--health-interval must be non-negative, got %s", cfg.HealthInterval)
+	}
+	if cfg.HealthRetries < 0 {
+		return fmt.Errorf("--health-retries must be non-negative, got %d", cfg.HealthRetries)
+	}
+	return ValidateClockSync(cfg.ClockSync)
+}
+
+// validateNICs checks each --nic and that no two pin the same IP or MAC.
+func (cfg *VMConfig) validateNICs() error {
+	for i, n := range cfg.NICs {
+		if err := n.Validate(); err != nil {
+			return fmt.Errorf("--nic %d: %w", i+1, err)
+		}
+		for j, o := range cfg.NICs[:i] {
+			switch {
+			case n.IP != "" && n.IP == o.IP:
+				return fmt.Errorf("--nic %d and %d both request ip %s", j+1, i+1, n.IP)
+			case n.MAC != "" && n.MAC == o.MAC:
+				return fmt.Errorf("--nic %d and %d both request mac %s", j+1, i+1, n.MAC)
+			}
+		}
+	}
 	return nil
 }
 
+// ValidateClockSync checks a --clock-sync mode; empty means the default (agent).
+func ValidateClockSync(mode string) error {
+	switch mode {
+	case "", ClockSyncAgent, ClockSyncPTP, ClockSyncOff:
+		return nil
+	}
+	return fmt.Errorf("--clock-sync must be %s, %s or %s, got %q", ClockSyncAgent, ClockSyncPTP, ClockSyncOff, mode)
+}
+
+// ClockSyncResult records one guest clock step.
+type ClockSyncResult struct {
+	Method string    `json:"method"`
+	At     time.Time `json:"at"`
+	// OffsetSeconds is how far the guest clock moved (positive = forward); zero when Error is set.
+	OffsetSeconds float64 `json:"offset_seconds"`
+	Error         string  `json:"error,omitempty"`
+}
+
+// HealthStatus is the persisted outcome of a VM's health checks.
+type HealthStatus struct {
+	Status        string    `json:"status"` // HealthStarting, HealthHealthy, or HealthUnhealthy
+	FailingStreak int       `json:"failing_streak"`
+	CheckedAt     time.Time `json:"checked_at,omitzero"`
+	Output        string    `json:"output,omitempty"` // tail of the last failed check's output
+}
+
+// HealthState is what inspect/status show: "" without a health command or when not running, HealthStarting until
+// the first check since the last start, HealthStale once no check has landed for two intervals, else the recorded status.
+func (v *VM) HealthState() string {
+	return v.healthStateAt(time.Now())
+}
+
+func (v *VM) healthStateAt(now time.Time) string {
+	if v.Config.HealthCmd == "" || v.State != VMStateRunning {
+		return ""
+	}
+	if v.Health == nil || (v.StartedAt != nil && v.Health.CheckedAt.Before(*v.StartedAt)) {
+		return HealthStarting
+	}
+	// A check may itself run for up to one interval, so only a second missed interval means nobody is checking.
+	if now.Sub(v.Health.CheckedAt) > 2*v.Config.EffectiveHealthInterval() {
+		return HealthStale
+	}
+	return v.Health.Status
+}
+
 // ResolvedNetnsPath returns NetnsPath, with NIC[0] fallback.
 func (v *VM) ResolvedNetnsPath() string {
 	if v == nil {
@@ -139,6 +251,32 @@ func (v *VM) ResolvedNetBackend() string {
 	return ""
 }
 
+// NICAttachments returns, per NIC, the network or bridge it joins where that differs from the VM's default, so
+// snapshots can hand a multi-fabric layout to clones; nil when every NIC uses the default.
+func (v *VM) NICAttachments() []NICSpec {
+	out := make([]NICSpec, len(v.NetworkConfigs))
+	for i, nc := range v.NetworkConfigs {
+		switch {
+		case nc == nil:
+		case nc.Backend == BackendBridge:
+			if nc.BridgeDev != v.ResolvedNetBridgeDev() {
+				out[i].Bridge = nc.BridgeDev
+			}
+		case nc.BridgeDev != "":
+			out[i].Bridge = nc.BridgeDev
+		case nc.CNINetwork != v.Config.Network:
+			out[i].Network = nc.CNINetwork
+		}
+	}
+	for len(out) > 0 && out[len(out)-1] == (NICSpec{}) {
+		out = out[:len(out)-1]
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
 // ResolvedNetBridgeDev returns NetBridgeDev, with NIC[0] fallback.
 func (v *VM) ResolvedNetBridgeDev() string {
 	if v == nil {
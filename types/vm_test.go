@@ -1,8 +1,10 @@
 package types
 
 import (
+	"slices"
 	"strings"
 	"testing"
+	"time"
 )
 
 func validConfig() VMConfig {
@@ -176,6 +178,125 @@ func TestValidate(t *testing.T) {
 			name:   "empty password is allowed",
 			modify: func(c *VMConfig) { c.Password = "" },
 		},
+		{
+			name:    "ssh key with newline",
+			modify:  func(c *VMConfig) { c.SSHKeys = []string{"ssh-ed25519 AAAA\nruncmd: [reboot]"} },
+			wantErr: "--ssh-key",
+		},
+		{
+			name:    "negative health interval",
+			modify:  func(c *VMConfig) { c.HealthInterval = -time.Second },
+			wantErr: "--health-interval",
+		},
+		{
+			name:    "negative health retries",
+			modify:  func(c *VMConfig) { c.HealthRetries = -1 },
+			wantErr: "--health-retries",
+		},
+		{
+			name: "published ports on distinct sockets",
+			modify: func(c *VMConfig) {
+				c.Ports = []PortMapping{
+					{HostPort: 8080, GuestPort: 80, Protocol: ProtocolTCP},
+					{HostPort: 8080, GuestPort: 80, Protocol: ProtocolUDP},
+					{HostIP: "10.0.0.1", HostPort: 2222, GuestPort: 22, Protocol: ProtocolTCP},
+					{HostIP: "10.0.0.2", HostPort: 2222, GuestPort: 22, Protocol: ProtocolTCP},
+				}
+			},
+		},
+		{
+			name: "published port on wildcard and specific address",
+			modify: func(c *VMConfig) {
+				c.Ports = []PortMapping{
+					{HostPort: 8080, GuestPort: 80, Protocol: ProtocolTCP},
+					{HostIP: "10.0.0.1", HostPort: 8080, GuestPort: 81, Protocol: ProtocolTCP},
+				}
+			},
+			wantErr: "--publish 10.0.0.1:8080:81/tcp conflicts with 8080:80/tcp",
+		},
+		{
+			name: "firewall with port ranges and a bare host",
+			modify: func(c *VMConfig) {
+				c.Firewall = &Firewall{Ingress: FirewallDeny, Rules: []FirewallRule{
+					{Action: FirewallAllow, Direction: DirectionIngress, Protocol: ProtocolTCP, Ports: "22, 8000-8100", CIDR: "10.0.0.7"},
+					{Action: FirewallDeny, Direction: DirectionEgress, CIDR: "fd00::/8"},
+				}}
+			},
+		},
+		{
+			name: "firewall ports without tcp/udp",
+			modify: func(c *VMConfig) {
+				c.Firewall = &Firewall{Rules: []FirewallRule{{Action: FirewallAllow, Direction: DirectionIngress, Protocol: ProtocolICMP, Ports: "8"}}}
+			},
+			wantErr: "firewall rule 1: ports need protocol",
+		},
+		{
+			name: "firewall reversed port range",
+			modify: func(c *VMConfig) {
+				c.Firewall = &Firewall{Rules: []FirewallRule{{Action: FirewallAllow, Direction: DirectionIngress, Protocol: ProtocolTCP, Ports: "90-80"}}}
+			},
+			wantErr: "reversed",
+		},
+		{
+			name: "nics with pinned addresses",
+			modify: func(c *VMConfig) {
+				c.NICs = []NICSpec{{IP: "10.22.0.50", MAC: "52:54:00:00:00:01"}, {}, {IP: "10.22.0.51"}}
+			},
+		},
+		{
+			name: "nics pin the same ip",
+			modify: func(c *VMConfig) {
+				c.NICs = []NICSpec{{IP: "10.22.0.50"}, {IP: "10.22.0.50"}}
+			},
+			wantErr: "--nic 1 and 2 both request ip 10.22.0.50",
+		},
+		{
+			name: "nics pin the same mac",
+			modify: func(c *VMConfig) {
+				c.NICs = []NICSpec{{MAC: "52:54:00:00:00:01"}, {}, {MAC: "52:54:00:00:00:01"}}
+			},
+			wantErr: "--nic 1 and 3 both request mac",
+		},
+		{
+			name: "nics on separate fabrics",
+			modify: func(c *VMConfig) {
+				c.Network = "mgmt"
+				c.NICs = []NICSpec{{}, {Network: "storage"}, {Bridge: "br-data", MAC: "52:54:00:00:00:02"}}
+			},
+		},
+		{
+			name: "nic with network and bridge",
+			modify: func(c *VMConfig) {
+				c.NICs = []NICSpec{{Network: "storage", Bridge: "br-data"}}
+			},
+			wantErr: "--nic 1: network=storage and bridge=br-data are mutually exclusive",
+		},
+		{
+			name: "bridge nic with pinned ip",
+			modify: func(c *VMConfig) {
+				c.NICs = []NICSpec{{}, {Bridge: "br-data", IP: "192.168.1.5"}}
+			},
+			wantErr: "--nic 2: ip= needs a CNI network",
+		},
+		{
+			name:   "bridge ipam",
+			modify: func(c *VMConfig) { c.BridgeIPAM = "192.168.100.0/24" },
+		},
+		{
+			name:    "bridge ipam too small",
+			modify:  func(c *VMConfig) { c.BridgeIPAM = "192.168.100.0/31" },
+			wantErr: "need an IPv4 subnet of /30 or larger",
+		},
+		{
+			name:    "bridge ipam ipv6",
+			modify:  func(c *VMConfig) { c.BridgeIPAM = "fd00::/64" },
+			wantErr: "need an IPv4 subnet",
+		},
+		{
+			name:    "firewall unknown policy",
+			modify:  func(c *VMConfig) { c.Firewall = &Firewall{Egress: "drop"} },
+			wantErr: "policy must be allow or deny",
+		},
 	}
 
 	for _, tt := range tests {
@@ -200,6 +321,36 @@ func TestValidate(t *testing.T) {
 	}
 }
 
+func TestVMHealthState(t *testing.T) {
+	started := time.Now()
+	before, after := started.Add(-time.Minute), started.Add(time.Second)
+	tests := []struct {
+		name string
+		vm   VM
+		now  time.Time
+		want string
+	}{
+		{name: "no health cmd", vm: VM{State: VMStateRunning, Health: &HealthStatus{Status: HealthHealthy, CheckedAt: after}}},
+		{name: "stopped", vm: VM{Config: VMConfig{Config: Config{HealthCmd: "true"}}, State: VMStateStopped}},
+		{name: "never checked", vm: VM{Config: VMConfig{Config: Config{HealthCmd: "true"}}, State: VMStateRunning, StartedAt: &started}, want: HealthStarting},
+		{name: "checked before restart", vm: VM{Config: VMConfig{Config: Config{HealthCmd: "true"}}, State: VMStateRunning, StartedAt: &started,
+			Health: &HealthStatus{Status: HealthUnhealthy, CheckedAt: before}}, want: HealthStarting},
+		{name: "checked since start", vm: VM{Config: VMConfig{Config: Config{HealthCmd: "true"}}, State: VMStateRunning, StartedAt: &started,
+			Health: &HealthStatus{Status: HealthUnhealthy, CheckedAt: after}}, want: HealthUnhealthy},
+		{name: "no check for two intervals", vm: VM{Config: VMConfig{Config: Config{HealthCmd: "true", HealthInterval: 10 * time.Second}}, State: VMStateRunning,
+			StartedAt: &started, Health: &HealthStatus{Status: HealthHealthy, CheckedAt: after}}, now: after.Add(21 * time.Second), want: HealthStale},
+	}
+	for _, tt := range tests {
+		now := tt.now
+		if now.IsZero() {
+			now = after
+		}
+		if got := tt.vm.healthStateAt(now); got != tt.want {
+			t.Errorf("%s: HealthState() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
 func TestVMResolvedNetFields(t *testing.T) {
 	tests := []struct {
 		name             string
@@ -255,6 +406,53 @@ func TestVMResolvedNetFields(t *testing.T) {
 	}
 }
 
+func TestVMNICAttachments(t *testing.T) {
+	cniVM := func(ncs ...*NetworkConfig) VM {
+		return VM{Config: VMConfig{Config: Config{Network: "default"}}, NetSetup: NetSetup{NetBackend: BackendCNI, NetworkConfigs: ncs}}
+	}
+	tests := []struct {
+		name string
+		vm   VM
+		want []NICSpec
+	}{
+		{name: "no NICs", vm: cniVM()},
+		{
+			name: "all on the VM network",
+			vm:   cniVM(&NetworkConfig{CNINetwork: "default"}, &NetworkConfig{CNINetwork: "default"}),
+		},
+		{
+			name: "pre-per-NIC records",
+			vm:   cniVM(&NetworkConfig{}),
+			want: nil,
+		},
+		{
+			name: "mixed CNI fabrics keep leading defaults, trim trailing ones",
+			vm: cniVM(
+				&NetworkConfig{CNINetwork: "default"},
+				&NetworkConfig{CNINetwork: "storage"},
+				&NetworkConfig{CNINetwork: "cocoon-bridge-br-data", BridgeDev: "br-data"},
+				&NetworkConfig{CNINetwork: "default"},
+			),
+			want: []NICSpec{{}, {Network: "storage"}, {Bridge: "br-data"}},
+		},
+		{
+			name: "host bridge VM lists only non-default bridges",
+			vm: VM{NetSetup: NetSetup{NetBackend: BackendBridge, NetBridgeDev: "br0", NetworkConfigs: []*NetworkConfig{
+				{Backend: BackendBridge, BridgeDev: "br0"},
+				{Backend: BackendBridge, BridgeDev: "br1"},
+			}}},
+			want: []NICSpec{{}, {Bridge: "br1"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.vm.NICAttachments(); !slices.Equal(got, tt.want) {
+				t.Errorf("NICAttachments = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestVMResolvedNetNilReceiver(t *testing.T) {
 	var v *VM
 	if got := v.ResolvedNetnsPath(); got != "" {
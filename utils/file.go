@@ -37,6 +37,13 @@ func FileHead(f *os.File, n int) ([]byte, error) {
 	return buf[:m], nil
 }
 
+// CloseFiles closes every file, ignoring errors.
+func CloseFiles(files []*os.File) {
+	for _, f := range files {
+		_ = f.Close()
+	}
+}
+
 // ValidFile returns true if path is a regular file with size > 0.
 func ValidFile(path string) bool {
 	info, err := os.Stat(path)
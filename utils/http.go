@@ -8,8 +8,11 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"os"
 	"slices"
 	"time"
+
+	"golang.org/x/sys/unix"
 )
 
 const (
@@ -44,6 +47,44 @@ func NewSocketHTTPClientWithTimeout(socketPath string, timeout time.Duration) *h
 	}
 }
 
+// NewSocketHTTPClientWithFiles passes files over the Unix socket (SCM_RIGHTS) with each request, for endpoints
+// that take descriptors, e.g. CH's vm.add-net with macvtap queues. Every request dials its own connection.
+func NewSocketHTTPClientWithFiles(socketPath string, files []*os.File) *http.Client {
+	return &http.Client{
+		Timeout: HTTPTimeout,
+		Transport: &http.Transport{
+			DisableKeepAlives: true,
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				conn, err := d.DialContext(ctx, "unix", socketPath)
+				if err != nil {
+					return nil, err
+				}
+				fds := make([]int, len(files))
+				for i, f := range files {
+					fds[i] = int(f.Fd())
+				}
+				return &rightsConn{UnixConn: conn.(*net.UnixConn), oob: unix.UnixRights(fds...)}, nil
+			},
+		},
+	}
+}
+
+// rightsConn attaches oob to its first write, so the descriptors arrive with the request's first byte.
+type rightsConn struct {
+	*net.UnixConn
+	oob []byte
+}
+
+func (c *rightsConn) Write(b []byte) (int, error) {
+	if c.oob == nil {
+		return c.UnixConn.Write(b)
+	}
+	n, _, err := c.UnixConn.WriteMsgUnix(b, c.oob, nil)
+	c.oob = nil
+	return n, err
+}
+
 // DoAPI sends a request, validates status, returns body (nil for 204). url must be fully-formed.
 func DoAPI(ctx context.Context, hc *http.Client, method, url string, body []byte, expectedStatus int) ([]byte, error) {
 	var reqBody io.Reader
@@ -13,6 +13,8 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"golang.org/x/sys/unix"
 )
 
 func TestAPIError_Error(t *testing.T) {
@@ -60,6 +62,51 @@ func TestNewSocketHTTPClient_DialsSocket(t *testing.T) {
 	}
 }
 
+func TestNewSocketHTTPClientWithFiles_PassesFDs(t *testing.T) {
+	sockPath := filepath.Join("/tmp", fmt.Sprintf("cocoon-test-fds-%d.sock", os.Getpid()))
+	t.Cleanup(func() { os.Remove(sockPath) })
+
+	ln, err := net.ListenUnix("unix", &net.UnixAddr{Name: sockPath, Net: "unix"})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	received := make(chan int, 1)
+	go func() {
+		conn, err := ln.AcceptUnix()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buf, oob := make([]byte, 4096), make([]byte, unix.CmsgSpace(8))
+		_, oobn, _, _, _ := conn.ReadMsgUnix(buf, oob)
+		var fds []int
+		if msgs, err := unix.ParseSocketControlMessage(oob[:oobn]); err == nil && len(msgs) == 1 {
+			fds, _ = unix.ParseUnixRights(&msgs[0])
+		}
+		for _, fd := range fds {
+			_ = unix.Close(fd)
+		}
+		received <- len(fds)
+		_, _ = conn.Write([]byte("HTTP/1.1 204 No Content\r\n\r\n"))
+	}()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	hc := NewSocketHTTPClientWithFiles(sockPath, []*os.File{r, w})
+	if _, err := DoAPI(t.Context(), hc, http.MethodPut, "http://localhost/api/v1/vm.add-net", []byte(`{}`), http.StatusNoContent); err != nil {
+		t.Fatalf("PUT: %v", err)
+	}
+	if n := <-received; n != 2 {
+		t.Errorf("received %d descriptors, want 2", n)
+	}
+}
+
 func TestNewSocketHTTPClient_BadSocket(t *testing.T) {
 	hc := NewSocketHTTPClient("/nonexistent/socket.sock")
 	_, err := hc.Get("http://localhost/ping")
@@ -53,8 +53,47 @@ func TarDir(tw *tar.Writer, dir string) error {
 	return nil
 }
 
+// TarFile writes one file into tw under nameInTar, sparse-aware like TarDir.
+func TarFile(tw *tar.Writer, path, nameInTar string) error {
+	return tarFileMaybeSparse(tw, path, nameInTar)
+}
+
+// TarEntryReader returns the logical content of the current tar entry (holes of COCOON.sparse entries re-expanded as zeros) and its logical size.
+func TarEntryReader(hdr *tar.Header, r io.Reader) (io.Reader, int64, error) {
+	mapJSON, ok := hdr.PAXRecords[paxSparseMap]
+	if !ok {
+		return io.LimitReader(r, hdr.Size), hdr.Size, nil
+	}
+	realSize, err := strconv.ParseInt(hdr.PAXRecords[paxSparseSize], 10, 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("parse sparse size for %s: %w", hdr.Name, err)
+	}
+	var segments []sparseSegment
+	if err := json.Unmarshal([]byte(mapJSON), &segments); err != nil {
+		return nil, 0, fmt.Errorf("decode sparse map for %s: %w", hdr.Name, err)
+	}
+	var (
+		readers []io.Reader
+		pos     int64
+	)
+	for _, seg := range segments {
+		if seg.Offset < pos || seg.Length < 0 || seg.Offset+seg.Length > realSize {
+			return nil, 0, fmt.Errorf("sparse map for %s: segment %d+%d out of order or bounds", hdr.Name, seg.Offset, seg.Length)
+		}
+		readers = append(readers, io.LimitReader(zeroReader{}, seg.Offset-pos), io.LimitReader(r, seg.Length))
+		pos = seg.Offset + seg.Length
+	}
+	readers = append(readers, io.LimitReader(zeroReader{}, realSize-pos))
+	return io.MultiReader(readers...), realSize, nil
+}
+
 // ExtractTar extracts flat tar entries into dir.
 func ExtractTar(dir string, r io.Reader) error {
+	return ExtractTarTee(dir, r, nil)
+}
+
+// ExtractTarTee is ExtractTar that also copies each file's logical content (sparse holes as zeros) to tee(name).
+func ExtractTarTee(dir string, r io.Reader, tee func(name string) io.Writer) error {
 	tr := tar.NewReader(r)
 	for {
 		hdr, err := tr.Next()
@@ -76,6 +115,16 @@ func ExtractTar(dir string, r io.Reader) error {
 
 		outPath := filepath.Join(dir, name)
 
+		if tee != nil {
+			content, _, err := TarEntryReader(hdr, tr)
+			if err != nil {
+				return err
+			}
+			if err := extractFile(outPath, io.TeeReader(content, tee(name)), hdr.FileInfo().Mode()); err != nil {
+				return fmt.Errorf("extract %s: %w", name, err)
+			}
+			continue
+		}
 		if mapJSON, ok := hdr.PAXRecords[paxSparseMap]; ok {
 			realSize, parseErr := strconv.ParseInt(hdr.PAXRecords[paxSparseSize], 10, 64)
 			if parseErr != nil {
@@ -146,6 +195,14 @@ func extractFile(path string, r io.Reader, perm os.FileMode) error {
 	}
 	defer f.Close() //nolint:errcheck
 
+	if err := writeSparse(f, r); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// writeSparse copies r into f from its current offset, seeking over all-zero blocks.
+func writeSparse(f *os.File, r io.Reader) error {
 	bp := sparseBlockPool.Get().(*[]byte)
 	buf := *bp
 	defer sparseBlockPool.Put(bp)
@@ -172,12 +229,9 @@ func extractFile(path string, r io.Reader, perm os.FileMode) error {
 
 	// Seeked holes at EOF do not extend file size, so fix it with Truncate.
 	if endsWithHole {
-		if err := f.Truncate(total); err != nil {
-			return err
-		}
+		return f.Truncate(total)
 	}
-
-	return f.Sync()
+	return nil
 }
 
 // writeBlockSparse seeks over all-zero chunks instead of writing them.
@@ -190,6 +244,14 @@ func writeBlockSparse(f *os.File, chunk []byte) (hole bool, err error) {
 	return false, err
 }
 
+// zeroReader yields an endless stream of zero bytes.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
 // isAllZero reports whether every byte in b is zero.
 func isAllZero(b []byte) bool {
 	for len(b) >= 8 {
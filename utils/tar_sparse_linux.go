@@ -91,3 +91,21 @@ func rewindAndTarFull(tw *tar.Writer, f *os.File, fi os.FileInfo, path, nameInTa
 	}
 	return tarFileFrom(tw, f, fi, nameInTar)
 }
+
+// fileHasHoles reports whether f has at least one hole; false when SEEK_HOLE/SEEK_DATA is unsupported.
+// f is rewound to the start afterwards.
+func fileHasHoles(f *os.File, size int64) bool {
+	if size == 0 {
+		return false
+	}
+	defer f.Seek(0, io.SeekStart) //nolint:errcheck
+	segments, err := scanDataSegments(int(f.Fd()), size)
+	if err != nil {
+		return false
+	}
+	var dataSize int64
+	for _, seg := range segments {
+		dataSize += seg.Length
+	}
+	return dataSize < size
+}
@@ -23,3 +23,6 @@ func tarFileMaybeSparse(tw *tar.Writer, path, nameInTar string) error {
 
 	return tarFileFrom(tw, f, fi, nameInTar)
 }
+
+// fileHasHoles is always false on non-Linux (no SEEK_HOLE/SEEK_DATA).
+func fileHasHoles(*os.File, int64) bool { return false }
@@ -896,3 +896,51 @@ func concat(slices ...[]byte) []byte {
 	}
 	return out
 }
+
+func TestTarEntryReader_ExpandsSparseHoles(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{
+		Name: "sparse.raw", Size: 4, Mode: 0o644, Typeflag: tar.TypeReg,
+		PAXRecords: map[string]string{
+			paxSparseMap:  `[{"o":2,"l":2},{"o":6,"l":2}]`,
+			paxSparseSize: "10",
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte("abcd")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tr := tar.NewReader(&buf)
+	hdr, err := tr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, size, err := TarEntryReader(hdr, tr)
+	if err != nil {
+		t.Fatalf("TarEntryReader: %v", err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte("\x00\x00ab\x00\x00cd\x00\x00")
+	if size != 10 || !bytes.Equal(got, want) {
+		t.Errorf("got %q (size %d), want %q", got, size, want)
+	}
+}
+
+func TestTarEntryReader_RejectsOverlappingSegments(t *testing.T) {
+	hdr := &tar.Header{Name: "bad", PAXRecords: map[string]string{
+		paxSparseMap:  `[{"o":4,"l":4},{"o":2,"l":2}]`,
+		paxSparseSize: "10",
+	}}
+	if _, _, err := TarEntryReader(hdr, strings.NewReader("abcdef")); err == nil {
+		t.Fatal("want out-of-order error")
+	}
+}
@@ -0,0 +1,184 @@
+package utils
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// TarTree writes root (a file, directory, or symlink) and everything below it into tw under nameInTar, keeping
+// modes, mtimes, and symlinks. Unlike TarDir it emits plain tar readable by any tar(1): holes are written out as
+// zeros, and the tar names of files that had holes are returned so the receiver can punch them again.
+func TarTree(tw *tar.Writer, root, nameInTar string) ([]string, error) {
+	var sparse []string
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		name := path.Join(nameInTar, filepath.ToSlash(rel))
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case fi.Mode().IsRegular():
+			holey, tarErr := tarTreeFile(tw, p, name)
+			if holey {
+				sparse = append(sparse, name)
+			}
+			return tarErr
+		case fi.IsDir(), fi.Mode()&fs.ModeSymlink != 0:
+			link := ""
+			if fi.Mode()&fs.ModeSymlink != 0 {
+				if link, err = os.Readlink(p); err != nil {
+					return err
+				}
+			}
+			hdr, hdrErr := tar.FileInfoHeader(fi, link)
+			if hdrErr != nil {
+				return fmt.Errorf("tar header for %s: %w", p, hdrErr)
+			}
+			hdr.Name = name
+			if fi.IsDir() {
+				hdr.Name += "/"
+			}
+			if err := tw.WriteHeader(hdr); err != nil {
+				return fmt.Errorf("write header %s: %w", name, err)
+			}
+		}
+		// Devices, sockets, and FIFOs are skipped.
+		return nil
+	})
+	return sparse, err
+}
+
+func tarTreeFile(tw *tar.Writer, p, name string) (bool, error) {
+	f, err := os.Open(p) //nolint:gosec
+	if err != nil {
+		return false, fmt.Errorf("open %s: %w", p, err)
+	}
+	defer f.Close() //nolint:errcheck
+	fi, err := f.Stat()
+	if err != nil {
+		return false, fmt.Errorf("stat %s: %w", p, err)
+	}
+	return fileHasHoles(f, fi.Size()), tarFileFrom(tw, f, fi, name)
+}
+
+// ExtractTree extracts a tar stream of files, directories, symlinks, and hard links into dir (which must exist),
+// keeping permission bits (never setuid, setgid, or sticky) and mtimes. All-zero blocks become holes. Entries may not escape dir, including through symlinks.
+// A non-empty topName replaces the first path component of every entry, so "src/a" lands as "topName/a".
+func ExtractTree(dir string, r io.Reader, topName string) error {
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return err
+	}
+	defer root.Close() //nolint:errcheck
+
+	type dirMeta struct {
+		name  string
+		mode  fs.FileMode
+		mtime time.Time
+	}
+	var dirs []dirMeta
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("tar next: %w", err)
+		}
+		name, err := treeEntryName(hdr.Name, topName)
+		if err != nil {
+			return err
+		}
+		// Permission bits only: the tar may come from a guest, which must not plant setuid/setgid files on the host.
+		mode := hdr.FileInfo().Mode().Perm()
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := root.MkdirAll(name, 0o750); err != nil {
+				return fmt.Errorf("mkdir %s: %w", name, err)
+			}
+			// Modes and mtimes are applied last so read-only dirs can still be filled.
+			dirs = append(dirs, dirMeta{name, mode, hdr.ModTime})
+		case tar.TypeReg:
+			if err := extractTreeFile(root, name, tr, mode, hdr.ModTime); err != nil {
+				return fmt.Errorf("extract %s: %w", name, err)
+			}
+		case tar.TypeSymlink:
+			_ = root.Remove(name)
+			if err := root.Symlink(hdr.Linkname, name); err != nil {
+				return fmt.Errorf("symlink %s: %w", name, err)
+			}
+		case tar.TypeLink:
+			target, err := treeEntryName(hdr.Linkname, topName)
+			if err != nil {
+				return err
+			}
+			_ = root.Remove(name)
+			if err := root.Link(target, name); err != nil {
+				return fmt.Errorf("link %s: %w", name, err)
+			}
+		}
+	}
+	// Deepest first, so setting a parent's mtime is not undone by a child's.
+	slices.SortFunc(dirs, func(a, b dirMeta) int { return strings.Count(b.name, "/") - strings.Count(a.name, "/") })
+	for _, d := range dirs {
+		if err := root.Chmod(d.name, d.mode); err != nil {
+			return fmt.Errorf("chmod %s: %w", d.name, err)
+		}
+		if err := root.Chtimes(d.name, d.mtime, d.mtime); err != nil {
+			return fmt.Errorf("chtimes %s: %w", d.name, err)
+		}
+	}
+	return nil
+}
+
+// treeEntryName cleans a tar entry name into a dir-relative path and applies the topName rename.
+func treeEntryName(name, topName string) (string, error) {
+	clean := path.Clean(strings.TrimLeft(filepath.ToSlash(name), "/"))
+	if clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("tar entry %q escapes destination", name)
+	}
+	if topName != "" && clean != "." {
+		if _, rest, ok := strings.Cut(clean, "/"); ok {
+			return path.Join(topName, rest), nil
+		}
+		return topName, nil
+	}
+	return clean, nil
+}
+
+func extractTreeFile(root *os.Root, name string, r io.Reader, mode fs.FileMode, mtime time.Time) error {
+	_ = root.Remove(name) // Replace rather than write through an existing symlink or hard link.
+	f, err := root.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if err := writeSparse(f, r); err != nil {
+		f.Close() //nolint:errcheck,gosec
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	// OpenFile's perm is masked by umask and ignores setuid/setgid.
+	if err := root.Chmod(name, mode); err != nil {
+		return err
+	}
+	return root.Chtimes(name, mtime, mtime)
+}
@@ -0,0 +1,192 @@
+package utils
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func buildTreeFixture(t *testing.T) string {
+	t.Helper()
+	src := filepath.Join(t.TempDir(), "src")
+	for _, d := range []string{"src/sub", "src/ro"} {
+		if err := os.MkdirAll(filepath.Join(filepath.Dir(src), d), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(src, "run.sh"), []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "sub", "data"), []byte("payload"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "ro", "f"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(src, "ro"), 0o555); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chmod(filepath.Join(src, "ro"), 0o755) })
+	if err := os.Symlink("sub/data", filepath.Join(src, "link")); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(src, "sub", "data"), mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	return src
+}
+
+func tarTreeBytes(t *testing.T, src, name string) ([]byte, []string) {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	sparse, err := TarTree(tw, src, name)
+	if err != nil {
+		t.Fatalf("TarTree: %v", err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes(), sparse
+}
+
+func TestTarTree_ExtractTreeRoundTrip(t *testing.T) {
+	src := buildTreeFixture(t)
+	data, _ := tarTreeBytes(t, src, "src")
+
+	dst := t.TempDir()
+	t.Cleanup(func() { _ = os.Chmod(filepath.Join(dst, "copy", "ro"), 0o755) })
+	if err := ExtractTree(dst, bytes.NewReader(data), "copy"); err != nil {
+		t.Fatalf("ExtractTree: %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(dst, "copy", "sub", "data"))
+	if err != nil || string(got) != "payload" {
+		t.Fatalf("sub/data = %q, %v", got, err)
+	}
+	for rel, want := range map[string]os.FileMode{"run.sh": 0o755, "sub/data": 0o600, "ro": 0o555 | os.ModeDir} {
+		fi, err := os.Lstat(filepath.Join(dst, "copy", rel))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode() != want {
+			t.Errorf("%s mode = %v, want %v", rel, fi.Mode(), want)
+		}
+	}
+	if fi, _ := os.Stat(filepath.Join(dst, "copy", "sub", "data")); !fi.ModTime().Equal(time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("mtime = %v", fi.ModTime())
+	}
+	if link, err := os.Readlink(filepath.Join(dst, "copy", "link")); err != nil || link != "sub/data" {
+		t.Errorf("link = %q, %v", link, err)
+	}
+}
+
+func TestTarTree_SingleFile(t *testing.T) {
+	src := buildTreeFixture(t)
+	data, _ := tarTreeBytes(t, filepath.Join(src, "run.sh"), "run.sh")
+
+	dst := t.TempDir()
+	if err := ExtractTree(dst, bytes.NewReader(data), "renamed.sh"); err != nil {
+		t.Fatalf("ExtractTree: %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(dst, "renamed.sh")); err != nil || !strings.HasPrefix(string(got), "#!") {
+		t.Fatalf("renamed.sh = %q, %v", got, err)
+	}
+}
+
+func TestTarTree_ReportsSparseFiles(t *testing.T) {
+	src := t.TempDir()
+	f, err := os.Create(filepath.Join(src, "disk.img"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.WriteAt([]byte("tail"), 8<<20); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+	if fi, _ := os.Stat(filepath.Join(src, "disk.img")); !hasHolesOnDisk(t, filepath.Join(src, "disk.img"), fi.Size()) {
+		t.Skip("filesystem does not report holes")
+	}
+
+	data, sparse := tarTreeBytes(t, src, "d")
+	if len(sparse) != 1 || sparse[0] != "d/disk.img" {
+		t.Fatalf("sparse = %v, want [d/disk.img]", sparse)
+	}
+	dst := t.TempDir()
+	if err := ExtractTree(dst, bytes.NewReader(data), ""); err != nil {
+		t.Fatalf("ExtractTree: %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(dst, "d", "disk.img"))
+	if err != nil || len(got) != 8<<20+4 || string(got[8<<20:]) != "tail" {
+		t.Fatalf("disk.img len %d, %v", len(got), err)
+	}
+}
+
+func hasHolesOnDisk(t *testing.T, p string, size int64) bool {
+	t.Helper()
+	f, err := os.Open(p) //nolint:gosec
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close() //nolint:errcheck
+	return fileHasHoles(f, size)
+}
+
+func TestExtractTree_RejectsEscapes(t *testing.T) {
+	for _, hdr := range []*tar.Header{
+		{Name: "../evil", Typeflag: tar.TypeReg, Mode: 0o644},
+		{Name: "a/../../evil", Typeflag: tar.TypeReg, Mode: 0o644},
+	} {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		_ = tw.Close()
+		if err := ExtractTree(t.TempDir(), &buf, ""); err == nil {
+			t.Errorf("%s: expected escape error", hdr.Name)
+		}
+	}
+
+	// A symlink pointing outside must not be followed by a later entry.
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	outside := t.TempDir()
+	_ = tw.WriteHeader(&tar.Header{Name: "out", Typeflag: tar.TypeSymlink, Linkname: outside})
+	_ = tw.WriteHeader(&tar.Header{Name: "out/pwned", Typeflag: tar.TypeReg, Mode: 0o644, Size: 1})
+	_, _ = tw.Write([]byte("x"))
+	_ = tw.Close()
+	if err := ExtractTree(t.TempDir(), &buf, ""); err == nil {
+		t.Error("write through an escaping symlink should fail")
+	}
+	if _, err := os.Stat(filepath.Join(outside, "pwned")); err == nil {
+		t.Error("file written outside the destination")
+	}
+}
+
+func TestExtractTree_DropsSetuid(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	_ = tw.WriteHeader(&tar.Header{Name: "d", Typeflag: tar.TypeDir, Mode: 0o1777})
+	_ = tw.WriteHeader(&tar.Header{Name: "d/su", Typeflag: tar.TypeReg, Mode: 0o4755, Size: 1})
+	_, _ = tw.Write([]byte("x"))
+	_ = tw.Close()
+
+	dst := t.TempDir()
+	if err := ExtractTree(dst, &buf, ""); err != nil {
+		t.Fatalf("ExtractTree: %v", err)
+	}
+	for rel, want := range map[string]os.FileMode{"d/su": 0o755, "d": 0o777 | os.ModeDir} {
+		fi, err := os.Lstat(filepath.Join(dst, rel))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode() != want {
+			t.Errorf("%s mode = %v, want %v", rel, fi.Mode(), want)
+		}
+	}
+}